@@ -0,0 +1,191 @@
+// mg-analyze runs offline checks on a must-gather bundle.
+//
+//	mg-analyze list
+//	mg-analyze <check> [--output text|json] <bundle dir>
+//
+// Each check reads the collected objects and files, and prints a report as text tables, or as JSON.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/analysis/addresses"
+	"github.com/kubevirt/must-gather/pkg/analysis/apiservices"
+	"github.com/kubevirt/must-gather/pkg/analysis/cdi"
+	"github.com/kubevirt/must-gather/pkg/analysis/cpu"
+	"github.com/kubevirt/must-gather/pkg/analysis/crds"
+	"github.com/kubevirt/must-gather/pkg/analysis/deprecations"
+	"github.com/kubevirt/must-gather/pkg/analysis/domain"
+	"github.com/kubevirt/must-gather/pkg/analysis/hostdevices"
+	"github.com/kubevirt/must-gather/pkg/analysis/kernel"
+	"github.com/kubevirt/must-gather/pkg/analysis/logs"
+	"github.com/kubevirt/must-gather/pkg/analysis/migration"
+	"github.com/kubevirt/must-gather/pkg/analysis/nmstate"
+	"github.com/kubevirt/must-gather/pkg/analysis/selinux"
+	"github.com/kubevirt/must-gather/pkg/analysis/storage"
+	"github.com/kubevirt/must-gather/pkg/analysis/upgrade"
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+const usage = `Usage:
+  mg-analyze list
+  mg-analyze <check> [--output text|json] <bundle dir>
+
+Checks:
+`
+
+var analyzers = []analysis.Analyzer{
+	{
+		Name:        "migration",
+		Description: "VMIs that can't be live migrated, and nodes that can't be drained cleanly",
+		Run:         func(b *layout.Bundle) (analysis.Report, error) { return migration.Analyze(b) },
+	},
+	{
+		Name:        "upgrade",
+		Description: "VMIs on outdated virt-launcher images, what the update does with them, and pending install plans",
+		Run:         func(b *layout.Bundle) (analysis.Report, error) { return upgrade.Analyze(b) },
+	},
+	{
+		Name:        "storage",
+		Description: "the DataVolume, PVC, PV, StorageClass and attachments of each VM volume, and their issues",
+		Run:         func(b *layout.Bundle) (analysis.Report, error) { return storage.Analyze(b) },
+	},
+	{
+		Name:        "cdi",
+		Description: "the progress, errors and likely cause of each DataVolume import, upload or clone, and the DataImportCrons",
+		Run:         func(b *layout.Bundle) (analysis.Report, error) { return cdi.Analyze(b) },
+	},
+	{
+		Name:        "crds",
+		Description: "custom resources that don't match the schema of their CRD, and CRDs with unserved stored versions",
+		Run:         func(b *layout.Bundle) (analysis.Report, error) { return crds.Analyze(b) },
+	},
+	{
+		Name:        "deprecations",
+		Description: "VMs and KubeVirt and HyperConverged CRs that use deprecated fields or feature gates",
+		Run:         func(b *layout.Bundle) (analysis.Report, error) { return deprecations.Analyze(b) },
+	},
+	{
+		Name:        "domain",
+		Description: "differences between the libvirt domain of each running VM and the spec and status of its VMI",
+		Run:         func(b *layout.Bundle) (analysis.Report, error) { return domain.Analyze(b) },
+	},
+	{
+		Name:        "cpu",
+		Description: "which VMs can run on which nodes by CPU model and features, and nodes whose host model differs from the majority",
+		Run:         func(b *layout.Bundle) (analysis.Report, error) { return cpu.Analyze(b) },
+	},
+	{
+		Name:        "addresses",
+		Description: "duplicate MAC addresses, MAC addresses outside the kubemacpool range, and duplicate guest IP addresses",
+		Run:         func(b *layout.Bundle) (analysis.Report, error) { return addresses.Analyze(b) },
+	},
+	{
+		Name:        "nmstate",
+		Description: "desired vs actual node interfaces, failed enactments, and bridge attachments missing their bridge or VLAN",
+		Run:         func(b *layout.Bundle) (analysis.Report, error) { return nmstate.Analyze(b) },
+	},
+	{
+		Name:        "hostdevices",
+		Description: "IOMMU, vfio-pci and SR-IOV readiness of the nodes, and VMs requesting host devices or SR-IOV networks no node has",
+		Run:         func(b *layout.Bundle) (analysis.Report, error) { return hostdevices.Analyze(b) },
+	},
+	{
+		Name:        "kernel",
+		Description: "KVM, IOMMU, vfio-pci, hugepage, OOM kill and lockup messages of the dmesg of each node, mapped to VMs",
+		Run:         func(b *layout.Bundle) (analysis.Report, error) { return kernel.Analyze(b) },
+	},
+	{
+		Name:        "selinux",
+		Description: "SELinux AVC denials of the audit.log of each node, grouped by context and permission, mapped to pods and VMs",
+		Run:         func(b *layout.Bundle) (analysis.Report, error) { return selinux.Analyze(b) },
+	},
+	{
+		Name:        "logs",
+		Description: "known errors of the KubeVirt, CDI and QEMU logs, from a catalogue of signatures, mapped to VMs",
+		Run:         func(b *layout.Bundle) (analysis.Report, error) { return logs.Analyze(b) },
+	},
+	{
+		Name:        "apiservices",
+		Description: "the availability, discovery time and endpoints of the KubeVirt and CDI aggregated APIs",
+		Run:         func(b *layout.Bundle) (analysis.Report, error) { return apiservices.Analyze(b) },
+	},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "list":
+		printChecks()
+		return
+	case "-h", "--help", "help":
+		printUsage()
+		return
+	}
+
+	for _, a := range analyzers {
+		if a.Name == os.Args[1] {
+			if err := run(a, os.Args[2:]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Printf("unknown check %q\n", os.Args[1])
+	printUsage()
+	os.Exit(2)
+}
+
+func run(a analysis.Analyzer, args []string) error {
+	flags := flag.NewFlagSet(a.Name, flag.ExitOnError)
+	output := flags.String("output", string(analysis.Text), "the output format: text or json")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	format := analysis.Format(*output)
+	if format != analysis.Text && format != analysis.JSON {
+		return fmt.Errorf("unknown output format %q; use text or json", *output)
+	}
+
+	b, err := layout.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	report, err := a.Run(b)
+	// the warnings go to stderr, so the JSON output stays valid
+	for _, w := range b.Warnings() {
+		_, _ = fmt.Fprintf(os.Stderr, "[WARN] %s\n", w)
+	}
+	if err != nil {
+		return fmt.Errorf("the %s check failed; %w", a.Name, err)
+	}
+
+	return analysis.Write(os.Stdout, report, format)
+}
+
+func printUsage() {
+	fmt.Print(usage)
+	printChecks()
+}
+
+func printChecks() {
+	t := analysis.NewTable(os.Stdout)
+	for _, a := range analyzers {
+		_, _ = fmt.Fprintf(t, "  %s\t%s\n", a.Name, a.Description)
+	}
+	_ = t.Flush()
+}
@@ -0,0 +1,76 @@
+// mg-apiaudit filters a kube-apiserver audit log, read from the standard input, down to the requests about KubeVirt
+// and CDI resources.
+//
+//	mg-apiaudit [--since <duration>] [--since-time <RFC 3339 time>] <output dir>
+//
+// The requests are appended to one file per namespace in the output directory, one JSON line per request, so the
+// audit logs of all the control plane nodes can be piped in turn into the same directory. --since and --since-time
+// default to $MUST_GATHER_SINCE and $MUST_GATHER_SINCE_TIME, the window of oc adm must-gather; --since-time wins over
+// --since, the same way MUST_GATHER_SINCE_TIME wins over MUST_GATHER_SINCE.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kubevirt/must-gather/pkg/apiaudit"
+)
+
+const usage = `Usage:
+  mg-apiaudit [--since <duration>] [--since-time <RFC 3339 time>] <output dir> < audit.log
+`
+
+func main() {
+	flags := flag.NewFlagSet("mg-apiaudit", flag.ExitOnError)
+	flags.Usage = func() { fmt.Print(usage) }
+	sinceDuration := flags.String("since", os.Getenv("MUST_GATHER_SINCE"), "keep the requests received in this last duration, e.g. 2h")
+	sinceTime := flags.String("since-time", os.Getenv("MUST_GATHER_SINCE_TIME"), "keep the requests received since this time")
+	_ = flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 1 {
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+
+	var since time.Time
+	if *sinceDuration != "" {
+		d, err := time.ParseDuration(*sinceDuration)
+		if err != nil {
+			fmt.Printf("can't parse --since; %v\n", err)
+			os.Exit(2)
+		}
+		since = time.Now().Add(-d)
+	}
+	if *sinceTime != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, *sinceTime); err != nil {
+			fmt.Printf("can't parse --since-time; %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	if err := run(flags.Arg(0), since); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(dir string, since time.Time) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("can't create %s; %w", dir, err)
+	}
+
+	stats, err := apiaudit.Filter(os.Stdin, dir, since)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d of %d audit events kept", stats.Kept, stats.Events)
+	if stats.Invalid > 0 {
+		fmt.Printf(", %d lines that are not audit events", stats.Invalid)
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,75 @@
+// mg-apiservices checks the aggregated APIs of KubeVirt and CDI, with oc.
+//
+//	mg-apiservices [--samples <n>] [--interval <duration>] [--timeout <duration>] [--slow <duration>] <output file>
+//
+// The APIServices of the kubevirt.io groups are sampled a few times. Each sample has the Available condition of each
+// APIService, and the time a discovery request to its group-version took. The Service and the ready endpoints of each
+// APIService, each sample, and the problems found, such as an unavailable or slow API, are written to the output file
+// as JSON. The problems are also printed. When the collection fails partway, e.g. for a sample, the samples taken
+// before are written, with the error.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kubevirt/must-gather/pkg/apiservices"
+	"github.com/kubevirt/must-gather/pkg/oc"
+)
+
+const usage = `Usage:
+  mg-apiservices [--samples <n>] [--interval <duration>] [--timeout <duration>] [--slow <duration>] <output file>
+`
+
+func main() {
+	opts := apiservices.DefaultOptions
+	flags := flag.NewFlagSet("mg-apiservices", flag.ExitOnError)
+	flags.Usage = func() { fmt.Print(usage) }
+	flags.IntVar(&opts.Samples, "samples", opts.Samples, "how many times the APIServices are sampled")
+	flags.DurationVar(&opts.Interval, "interval", opts.Interval, "the time between two samples")
+	flags.DurationVar(&opts.Timeout, "timeout", opts.Timeout, "the time a discovery request is given")
+	flags.DurationVar(&opts.Slow, "slow", opts.Slow, "the discovery time above which an API is reported as slow")
+	_ = flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 1 {
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+
+	if err := run(context.Background(), oc.Run, flags.Arg(0), opts); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, runner oc.Runner, output string, opts apiservices.Options) error {
+	report, collectErr := apiservices.Collect(ctx, runner, opts)
+	if collectErr != nil {
+		fmt.Printf("[WARN] the APIServices were not all sampled; %v\n", collectErr)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(output, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("can't write %s; %w", output, err)
+	}
+
+	failing := 0
+	for _, svc := range report.APIServices {
+		if len(svc.Problems) == 0 {
+			continue
+		}
+		failing++
+		fmt.Printf("[WARN] %s: %s\n", svc.Name, strings.Join(svc.Problems, "; "))
+	}
+	fmt.Printf("%d APIServices, %d with a problem\n", len(report.APIServices), failing)
+
+	// the exit status tells the manifest the collection failed
+	return collectErr
+}
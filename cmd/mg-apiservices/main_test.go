@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kubevirt/must-gather/pkg/apiservices"
+)
+
+const apiServicesJSON = `{"kind":"List","apiVersion":"v1","items":[{"apiVersion":"apiregistration.k8s.io/v1","kind":"APIService",
+"metadata":{"name":"v1.kubevirt.io"},"spec":{"group":"kubevirt.io","version":"v1"},
+"status":{"conditions":[{"type":"Available","status":"True","reason":"Local"}]}}]}`
+
+func TestRunPartial(t *testing.T) {
+	samples := 0
+	runner := func(_ context.Context, args ...string) ([]byte, error) {
+		if args[0] == "get" && args[1] == "apiservices" {
+			samples++
+			if samples > 1 {
+				return nil, errors.New("Unable to connect to the server")
+			}
+			return []byte(apiServicesJSON), nil
+		}
+		return []byte(`{"kind":"APIResourceList","resources":[]}`), nil
+	}
+
+	output := filepath.Join(t.TempDir(), apiservices.FileName)
+	err := run(context.Background(), runner, output, apiservices.Options{Samples: 3, Interval: time.Millisecond})
+	if err == nil {
+		t.Error("expected the error of the second sample")
+	}
+
+	report, err := apiservices.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Error == "" || len(report.APIServices) != 1 || len(report.APIServices[0].Samples) != 1 {
+		t.Errorf("expected the first sample, with the error, but got %+v", report)
+	}
+}
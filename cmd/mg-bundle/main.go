@@ -0,0 +1,270 @@
+// mg-bundle signs, encrypts, verifies and decrypts must-gather bundles.
+//
+//	mg-bundle keygen --type signing|encryption --out <prefix>
+//	mg-bundle seal [--signing-key <key>] [--recipient <key>]... [<bundle dir>]
+//	mg-bundle verify --key <public key> <bundle dir>
+//	mg-bundle decrypt --identity <private key> [--key <public key>] --output <dir> <encrypted file | bundle dir>
+//
+// seal runs at the end of the gathering, and defaults to $SIGNING_KEY, $ENCRYPTION_RECIPIENTS (comma separated) and
+// $BASE_COLLECTION_PATH. The signing key is a file name only, so it never appears on a command line; the public keys
+// are given as file names, PEM text, or base64 encoded PEM text. verify and decrypt run on the support side.
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kubevirt/must-gather/pkg/bundle"
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/manifest"
+)
+
+const usage = `Usage:
+  mg-bundle keygen --type signing|encryption --out <prefix>
+  mg-bundle seal [--signing-key <key>] [--recipient <key>]... [<bundle dir>]
+  mg-bundle verify --key <public key> <bundle dir>
+  mg-bundle decrypt --identity <private key> [--key <public key>] --output <dir> <encrypted file | bundle dir>
+`
+
+type keyList []string
+
+func (l *keyList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *keyList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "keygen":
+		err = keygen(os.Args[2:])
+	case "seal":
+		err = seal(os.Args[2:])
+	case "verify":
+		var ok bool
+		ok, err = verify(os.Args[2:])
+		if err == nil && !ok {
+			os.Exit(1)
+		}
+	case "decrypt":
+		var ok bool
+		ok, err = decrypt(os.Args[2:])
+		if err == nil && !ok {
+			os.Exit(1)
+		}
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Printf("unknown command %q\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func keygen(args []string) error {
+	flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	keyType := flags.String("type", "", "the key type: signing or encryption")
+	out := flags.String("out", "", "the output file prefix; writes <prefix>.key and <prefix>.pub")
+	_ = flags.Parse(args)
+
+	if *out == "" {
+		return fmt.Errorf("--out is required")
+	}
+
+	var (
+		priv, pub []byte
+		err       error
+	)
+	switch *keyType {
+	case "signing":
+		priv, pub, err = bundle.GenerateSigningKey()
+	case "encryption":
+		priv, pub, err = bundle.GenerateEncryptionKey()
+	default:
+		return fmt.Errorf("unknown key type %q; use signing or encryption", *keyType)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(*out+".key", priv, 0600); err != nil {
+		return err
+	}
+	if err = os.WriteFile(*out+".pub", pub, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote %s.key and %s.pub\n", *out, *out)
+	return nil
+}
+
+func seal(args []string) error {
+	flags := flag.NewFlagSet("seal", flag.ExitOnError)
+	signingKey := flags.String("signing-key", os.Getenv("SIGNING_KEY"), "the file of the ed25519 private key to sign the manifest with")
+	var recipients keyList
+	flags.Var(&recipients, "recipient", "an X25519 public key to encrypt the bundle for; may be repeated")
+	_ = flags.Parse(args)
+
+	if len(recipients) == 0 {
+		for _, value := range strings.Split(os.Getenv("ENCRYPTION_RECIPIENTS"), ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				recipients = append(recipients, value)
+			}
+		}
+	}
+
+	root := os.Getenv("BASE_COLLECTION_PATH")
+	if flags.NArg() > 0 {
+		root = flags.Arg(0)
+	}
+	if root == "" {
+		return fmt.Errorf("the bundle directory is not set")
+	}
+
+	var opts bundle.SealOptions
+	if *signingKey != "" {
+		data, err := os.ReadFile(*signingKey)
+		if err != nil {
+			return fmt.Errorf("can't read the signing key; %w", err)
+		}
+		if opts.SigningKey, err = bundle.ParseSigningKey(data); err != nil {
+			return err
+		}
+	}
+
+	for _, value := range recipients {
+		data, err := bundle.ReadKey(value)
+		if err != nil {
+			return fmt.Errorf("can't read a recipient key; %w", err)
+		}
+		recipient, err := bundle.ParseRecipient(data)
+		if err != nil {
+			return err
+		}
+		opts.Recipients = append(opts.Recipients, recipient)
+	}
+
+	if opts.SigningKey == nil && len(opts.Recipients) == 0 {
+		fmt.Println("no signing key and no recipients; the bundle is left as is")
+		return nil
+	}
+
+	if err := bundle.Seal(root, opts); err != nil {
+		return err
+	}
+
+	if opts.SigningKey != nil {
+		fmt.Printf("signed the manifest with key %s\n", bundle.Fingerprint(opts.SigningKey.Public().(ed25519.PublicKey)))
+	}
+	for _, recipient := range opts.Recipients {
+		fmt.Printf("encrypted the bundle for key %s\n", bundle.Fingerprint(recipient.Bytes()))
+	}
+
+	return nil
+}
+
+func verify(args []string) (bool, error) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	key := flags.String("key", "", "the ed25519 public key the manifest was signed with")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return false, fmt.Errorf("expected one bundle directory\n%s", usage)
+	}
+
+	b, err := layout.Open(flags.Arg(0))
+	if err != nil {
+		return false, err
+	}
+
+	return verifyBundle(b.Root(), *key)
+}
+
+func decrypt(args []string) (bool, error) {
+	flags := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	identityKey := flags.String("identity", "", "the X25519 private key of the recipient")
+	key := flags.String("key", "", "if set, the ed25519 public key to verify the decrypted bundle with")
+	output := flags.String("output", "", "the directory to extract the bundle to")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return false, fmt.Errorf("expected one encrypted file or bundle directory\n%s", usage)
+	}
+	if *identityKey == "" || *output == "" {
+		return false, fmt.Errorf("--identity and --output are required")
+	}
+
+	data, err := bundle.ReadKey(*identityKey)
+	if err != nil {
+		return false, fmt.Errorf("can't read the identity; %w", err)
+	}
+	identity, err := bundle.ParseIdentity(data)
+	if err != nil {
+		return false, err
+	}
+
+	if err = bundle.DecryptBundle(flags.Arg(0), *output, identity); err != nil {
+		return false, err
+	}
+	fmt.Printf("decrypted the bundle to %s\n", *output)
+
+	if *key == "" {
+		return true, nil
+	}
+
+	return verifyBundle(*output, *key)
+}
+
+func verifyBundle(root, keyValue string) (bool, error) {
+	if keyValue == "" {
+		return false, fmt.Errorf("--key is required")
+	}
+
+	data, err := bundle.ReadKey(keyValue)
+	if err != nil {
+		return false, fmt.Errorf("can't read the verification key; %w", err)
+	}
+	key, err := bundle.ParseVerificationKey(data)
+	if err != nil {
+		return false, err
+	}
+
+	problems, err := bundle.VerifyBundle(root, key)
+	if err != nil {
+		return false, err
+	}
+
+	return reportProblems(problems), nil
+}
+
+func reportProblems(problems []manifest.Problem) bool {
+	ok := true
+	for _, problem := range problems {
+		fmt.Println(problem)
+		if problem.IsIntegrityProblem() {
+			ok = false
+		}
+	}
+
+	if ok {
+		fmt.Println("the manifest signature is valid, and the bundle matches its manifest")
+	}
+
+	return ok
+}
@@ -0,0 +1,166 @@
+// mg-manifest maintains the manifest.json of a must-gather bundle.
+//
+//	mg-manifest add --collector <name> [--command <cmd>] [--exit-status <n>] [--duration <d>] [--missing] <file>...
+//	mg-manifest finalize [<bundle dir>]
+//	mg-manifest verify <bundle dir>
+//
+// add and finalize are used while gathering, and default to $BASE_COLLECTION_PATH; add --missing records a failed
+// collection that left no file. verify is used on the received bundle.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/manifest"
+)
+
+const usage = `Usage:
+  mg-manifest add --collector <name> [--command <cmd>] [--exit-status <n>] [--duration <d>] [--error <msg>] [--missing] <file>...
+  mg-manifest finalize [<bundle dir>]
+  mg-manifest verify <bundle dir>
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "add":
+		err = add(os.Args[2:])
+	case "finalize":
+		err = finalize(os.Args[2:])
+	case "verify":
+		var ok bool
+		ok, err = verify(os.Args[2:])
+		if err == nil && !ok {
+			os.Exit(1)
+		}
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Printf("unknown command %q\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func add(args []string) error {
+	flags := flag.NewFlagSet("add", flag.ExitOnError)
+	root := flags.String("root", os.Getenv("BASE_COLLECTION_PATH"), "the bundle directory")
+	collector := flags.String("collector", "", "the collector that wrote the files")
+	command := flags.String("command", "", "the command that produced the content")
+	exitStatus := flags.Int("exit-status", -1, "the exit status of the command")
+	duration := flags.Duration("duration", 0, "how long it took to produce the files")
+	errMsg := flags.String("error", "", "an error message")
+	missing := flags.Bool("missing", false, "the command failed before writing the files; they are recorded as not written")
+	_ = flags.Parse(args)
+
+	if *root == "" {
+		return fmt.Errorf("the bundle directory is not set; use --root or BASE_COLLECTION_PATH")
+	}
+
+	entry := manifest.Entry{
+		Collector:  *collector,
+		Command:    *command,
+		Error:      *errMsg,
+		DurationMS: duration.Milliseconds(),
+		NotWritten: *missing,
+	}
+	if *exitStatus >= 0 {
+		entry.ExitStatus = exitStatus
+	}
+
+	for _, file := range flags.Args() {
+		rel, err := relativePath(*root, file)
+		if err != nil {
+			return err
+		}
+
+		entry.Path = rel
+		if err = manifest.Record(*root, entry); err != nil {
+			return fmt.Errorf("can't record %s; %w", file, err)
+		}
+	}
+
+	return nil
+}
+
+func finalize(args []string) error {
+	root := os.Getenv("BASE_COLLECTION_PATH")
+	if len(args) > 0 {
+		root = args[0]
+	}
+	if root == "" {
+		return fmt.Errorf("the bundle directory is not set")
+	}
+
+	m, err := manifest.Finalize(root)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: %d files\n", filepath.Join(root, manifest.FileName), len(m.Entries))
+	return nil
+}
+
+func verify(args []string) (bool, error) {
+	if len(args) != 1 {
+		return false, fmt.Errorf("expected one bundle directory\n%s", usage)
+	}
+
+	bundle, err := layout.Open(args[0])
+	if err != nil {
+		return false, err
+	}
+
+	problems, err := manifest.VerifyDir(bundle.Root())
+	if err != nil {
+		return false, err
+	}
+
+	ok := true
+	for _, problem := range problems {
+		fmt.Println(problem)
+		if problem.IsIntegrityProblem() {
+			ok = false
+		}
+	}
+
+	if ok {
+		fmt.Println("the bundle matches its manifest")
+	}
+
+	return ok, nil
+}
+
+// relativePath returns the path of file relative to the bundle root. file may be absolute, or relative to the
+// current directory.
+func relativePath(root, file string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(absRoot, absFile)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not in the bundle directory %s", file, root)
+	}
+
+	return rel, nil
+}
@@ -0,0 +1,80 @@
+// mg-nodedata writes the JSON form of the command outputs gather_nodes stores in nodes/<node>/.
+//
+//	mg-nodedata [<bundle dir>]
+//
+// Each ip a, bridge, bridge -j vlan show, nft list ruleset, lspci -vv, ls -al /dev/vfio, /proc/cmdline and sriov VF
+// count output gets a <file>.json next to it, e.g. nodes/node01/ip.txt.json, recorded in the manifest. The bundle
+// directory defaults to $BASE_COLLECTION_PATH.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/manifest"
+	"github.com/kubevirt/must-gather/pkg/nodedata"
+)
+
+const usage = `Usage:
+  mg-nodedata [<bundle dir>]
+`
+
+const collector = "mg-nodedata"
+
+func main() {
+	root := os.Getenv("BASE_COLLECTION_PATH")
+	switch len(os.Args) {
+	case 1:
+	case 2:
+		if os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+			fmt.Print(usage)
+			return
+		}
+		root = os.Args[1]
+	default:
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+	if root == "" {
+		fmt.Printf("the bundle directory is not set\n%s", usage)
+		os.Exit(2)
+	}
+
+	if err := run(root); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(root string) error {
+	b, err := layout.Open(root)
+	if err != nil {
+		return err
+	}
+
+	conversions, err := nodedata.ConvertBundle(b)
+
+	var entries []manifest.Entry
+	failed := 0
+	for _, c := range conversions {
+		if c.Err != nil {
+			// an output that can't be parsed is kept as is; it doesn't fail the gathering
+			fmt.Printf("[WARN] %v\n", c.Err)
+			failed++
+			continue
+		}
+		entries = append(entries, manifest.Entry{
+			Path: b.Rel(c.Path), Collector: collector, Command: "parse " + b.Rel(b.NodeFilePath(c.Node, c.File)),
+		})
+	}
+	if rerr := manifest.RecordAll(b.Root(), entries); rerr != nil {
+		return rerr
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d node files converted to JSON, %d can't be parsed\n", len(entries), failed)
+	return nil
+}
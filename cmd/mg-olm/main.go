@@ -0,0 +1,100 @@
+// mg-olm collects the OLM objects of the HyperConverged installation namespace, with oc.
+//
+//	mg-olm [--namespace <ns>] [<bundle dir>]
+//
+// The Subscriptions, InstallPlans, ClusterServiceVersions and OperatorGroups of the namespace, the CatalogSources of
+// its subscriptions and the PackageManifests of their packages are written one object per file, as
+// namespaces/<ns>/<group>/<resource>/<name>.yaml. Their summary, with the problems found, is written to
+// olm/summary.json, and the problems are printed. The namespace defaults to $INSTALLATION_NAMESPACE, and the bundle
+// directory to $BASE_COLLECTION_PATH. The files are recorded in the manifest.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/manifest"
+	"github.com/kubevirt/must-gather/pkg/oc"
+	"github.com/kubevirt/must-gather/pkg/olm"
+)
+
+const usage = `Usage:
+  mg-olm [--namespace <ns>] [<bundle dir>]
+`
+
+const collector = "mg-olm"
+
+func main() {
+	flags := flag.NewFlagSet("mg-olm", flag.ExitOnError)
+	flags.Usage = func() { fmt.Print(usage) }
+	namespace := flags.String("namespace", os.Getenv("INSTALLATION_NAMESPACE"), "the HyperConverged installation namespace")
+	_ = flags.Parse(os.Args[1:])
+
+	root := os.Getenv("BASE_COLLECTION_PATH")
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		root = flags.Arg(0)
+	default:
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+	if root == "" || *namespace == "" {
+		fmt.Printf("the bundle directory or the namespace is not set\n%s", usage)
+		os.Exit(2)
+	}
+
+	if err := run(root, *namespace); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(root, namespace string) error {
+	objs, err := olm.Fetch(context.Background(), oc.Run, namespace)
+	if err != nil {
+		return err
+	}
+
+	paths, err := olm.WriteObjects(root, objs)
+	if err != nil {
+		return err
+	}
+
+	summary := olm.Summarize(objs, namespace, time.Now().UTC())
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	summaryPath := filepath.Join(root, layout.OLMDir, olm.SummaryFile)
+	if err = os.MkdirAll(filepath.Dir(summaryPath), 0755); err != nil {
+		return err
+	}
+	if err = os.WriteFile(summaryPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("can't write %s; %w", summaryPath, err)
+	}
+
+	var entries []manifest.Entry
+	for _, path := range append(paths, summaryPath) {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, manifest.Entry{Path: rel, Collector: collector, Command: "oc get <OLM objects> -n " + namespace + " -o json"})
+	}
+	if err = manifest.RecordAll(root, entries); err != nil {
+		return err
+	}
+
+	for _, p := range summary.Problems {
+		fmt.Printf("[WARN] %s\n", p)
+	}
+	fmt.Printf("%d OLM objects of %s, %d problems\n", len(paths), namespace, len(summary.Problems))
+	return nil
+}
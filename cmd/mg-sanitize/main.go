@@ -0,0 +1,97 @@
+// mg-sanitize anonymizes a must-gather bundle in place.
+//
+//	mg-sanitize [--mapping <file>] [--key <key>] [--keep-namespace <ns>]... <bundle dir>
+//
+// Namespaces, node and host names, VM names, IP addresses and MAC addresses are replaced with consistent tokens. The
+// key and the reverse mapping are written to the mapping file, which defaults to <bundle dir>.mapping.json, next to
+// the bundle, and must not be sent with it. Reusing the mapping file, or the key, keeps the tokens consistent across
+// bundles.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kubevirt/must-gather/pkg/bundle"
+	"github.com/kubevirt/must-gather/pkg/sanitize"
+)
+
+const usage = `Usage:
+  mg-sanitize [--mapping <file>] [--key <key>] [--keep-namespace <ns>]... <bundle dir>
+`
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func main() {
+	flags := flag.NewFlagSet("mg-sanitize", flag.ExitOnError)
+	flags.Usage = func() { fmt.Print(usage); flags.PrintDefaults() }
+	mappingFile := flags.String("mapping", "", "the private mapping file; defaults to <bundle dir>.mapping.json")
+	key := flags.String("key", os.Getenv("MG_SANITIZE_KEY"), "the secret the tokens are derived from; defaults to the key of the mapping file, or to a random key")
+	var keep stringList
+	flags.Var(&keep, "keep-namespace", "a namespace to keep as is; may be repeated")
+	_ = flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flags.Arg(0), *mappingFile, *key, keep); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, mappingFile, key string, keep []string) error {
+	root, err := filepath.Abs(filepath.Clean(dir))
+	if err != nil {
+		return err
+	}
+
+	if _, err = os.Stat(filepath.Join(root, bundle.EncryptedFileName)); err == nil {
+		return fmt.Errorf("%s is encrypted; decrypt it first", dir)
+	}
+
+	if mappingFile == "" {
+		mappingFile = root + ".mapping.json"
+	}
+	mappingFile, err = filepath.Abs(mappingFile)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(root, mappingFile); err == nil && filepath.IsLocal(rel) {
+		return fmt.Errorf("the mapping file %s must not be in the bundle directory", mappingFile)
+	}
+
+	mapper, err := sanitize.LoadMapper(mappingFile, []byte(key))
+	if err != nil {
+		return err
+	}
+
+	stats, err := sanitize.Sanitize(root, mapper, sanitize.Options{KeepNamespaces: keep})
+	// save the mapping even if sanitizing failed half way, so the replaced values can still be looked up
+	if saveErr := mapper.Save(mappingFile); saveErr != nil {
+		return fmt.Errorf("can't save the mapping file; %w", saveErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d text files, %d modified, %d renamed, %d binary files skipped\n",
+		stats.Files, stats.Modified, stats.Renamed, stats.Skipped)
+	fmt.Printf("the reverse mapping is in %s; keep it private\n", mappingFile)
+
+	return nil
+}
@@ -0,0 +1,264 @@
+// mg-upload sends a must-gather bundle to an S3-compatible object store, or to an HTTP endpoint.
+//
+//	mg-upload [options] <bundle dir | file> s3://<bucket>/<key>
+//	mg-upload [options] <bundle dir | file> https://<host>/<path>
+//
+// A bundle directory is sent as a tar.gz archive, written next to it, or as its encrypted archive if it was sealed for
+// recipients. S3 credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN. An
+// interrupted S3 upload resumes when the same command is run again.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kubevirt/must-gather/pkg/bundle"
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/manifest"
+	"github.com/kubevirt/must-gather/pkg/upload"
+)
+
+const usage = `Usage:
+  mg-upload [options] <bundle dir | file> s3://<bucket>/<key>
+  mg-upload [options] <bundle dir | file> https://<host>/<path>
+
+Options:
+`
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+type options struct {
+	endpoint    string
+	region      string
+	partSizeMB  int64
+	concurrency int
+	proxy       string
+	caFile      string
+	form        string
+	headers     stringList
+	timeout     time.Duration
+}
+
+func main() {
+	var opts options
+	flags := flag.NewFlagSet("mg-upload", flag.ExitOnError)
+	flags.Usage = func() { fmt.Print(usage); flags.PrintDefaults() }
+	flags.StringVar(&opts.endpoint, "endpoint", os.Getenv("AWS_ENDPOINT_URL"), "the S3 endpoint URL; defaults to AWS S3 in the region")
+	flags.StringVar(&opts.region, "region", os.Getenv("AWS_REGION"), "the S3 region")
+	flags.Int64Var(&opts.partSizeMB, "part-size", upload.DefaultPartSize/(1024*1024), "the size of the parts of S3 multipart uploads, in MiB")
+	flags.IntVar(&opts.concurrency, "concurrency", upload.DefaultConcurrency, "the number of parts sent in parallel")
+	flags.StringVar(&opts.proxy, "proxy", "", "the proxy URL; defaults to HTTPS_PROXY, HTTP_PROXY and NO_PROXY")
+	flags.StringVar(&opts.caFile, "ca-file", "", "a PEM file with additional CA certificates to trust")
+	flags.StringVar(&opts.form, "form", "", "for HTTP endpoints, POST the file in this multipart/form-data field instead of a PUT")
+	flags.Var(&opts.headers, "header", "for HTTP endpoints, a 'Name: value' header to add, e.g. for authentication; may be repeated")
+	flags.DurationVar(&opts.timeout, "timeout", 0, "the timeout of each request; no timeout by default")
+	_ = flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, flags.Arg(0), flags.Arg(1), opts); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, source, targetURL string, opts options) error {
+	client, err := upload.NewClient(upload.ClientOptions{Proxy: opts.proxy, CAFile: opts.caFile, Timeout: opts.timeout})
+	if err != nil {
+		return err
+	}
+
+	target, err := newTarget(targetURL, client, opts)
+	if err != nil {
+		return err
+	}
+
+	file, err := fileToUpload(source)
+	if err != nil {
+		return err
+	}
+
+	// an S3 key that ends with a slash is a folder, for the file name
+	if s3, ok := target.(*upload.S3); ok && (s3.Key == "" || strings.HasSuffix(s3.Key, "/")) {
+		s3.Key += filepath.Base(file)
+	}
+
+	start := time.Now()
+	if err = target.Upload(ctx, file); err != nil {
+		return fmt.Errorf("can't upload %s; %w", file, err)
+	}
+
+	fmt.Printf("uploaded %s to %s in %s\n", file, targetURL, time.Since(start).Round(time.Second))
+	return nil
+}
+
+// fileToUpload returns the file to send for source: the file itself, the encrypted archive of a sealed bundle, or a
+// tar.gz archive of a bundle directory
+func fileToUpload(source string) (string, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return source, nil
+	}
+
+	// source may be the directory created by oc adm must-gather, around the bundle
+	root := source
+	if b, err := layout.Open(source); err == nil {
+		root = b.Root()
+	}
+
+	encrypted := filepath.Join(root, bundle.EncryptedFileName)
+	if _, err = os.Stat(encrypted); err == nil {
+		return encrypted, nil
+	}
+
+	archive := filepath.Clean(source) + ".tar.gz"
+	if archiveInfo, err := os.Stat(archive); err == nil {
+		// keep the archive of a previous run, so an interrupted upload can resume, unless the bundle changed since,
+		// e.g. when it was sanitized; the manifest is rewritten whenever the bundle is
+		if isNewerThanManifest(archiveInfo, root) {
+			fmt.Printf("using the existing archive %s\n", archive)
+			return archive, nil
+		}
+		fmt.Printf("the existing archive %s is older than the manifest of the bundle\n", archive)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	fmt.Printf("archiving %s to %s\n", source, archive)
+	if err = writeArchive(source, archive); err != nil {
+		return "", err
+	}
+
+	return archive, nil
+}
+
+// isNewerThanManifest reports whether the archive was written after the manifest of the bundle in root. It is false
+// for a bundle without a manifest, whose changes can't be told.
+func isNewerThanManifest(archive fs.FileInfo, root string) bool {
+	info, err := os.Stat(filepath.Join(root, manifest.FileName))
+	return err == nil && archive.ModTime().After(info.ModTime())
+}
+
+func writeArchive(dir, archive string) error {
+	partial := archive + ".partial"
+	f, err := os.OpenFile(partial, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err = bundle.WriteArchive(f, dir, nil); err != nil {
+		_ = f.Close()
+		_ = os.Remove(partial)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		_ = os.Remove(partial)
+		return err
+	}
+
+	return os.Rename(partial, archive)
+}
+
+func newTarget(targetURL string, client *http.Client, opts options) (upload.Target, error) {
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %q; %w", targetURL, err)
+	}
+
+	switch u.Scheme {
+	case "s3":
+		return newS3Target(u, client, opts)
+	case "http", "https":
+		headers := http.Header{}
+		for _, header := range opts.headers {
+			name, value, found := strings.Cut(header, ":")
+			if !found {
+				return nil, fmt.Errorf("invalid header %q; expected 'Name: value'", header)
+			}
+			headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+		return &upload.HTTP{URL: targetURL, Form: opts.form, Headers: headers, Client: client}, nil
+	default:
+		return nil, fmt.Errorf("unsupported target %q; use s3://<bucket>/<key> or an http(s) URL", targetURL)
+	}
+}
+
+func newS3Target(u *url.URL, client *http.Client, opts options) (*upload.S3, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("no bucket in %q", u.String())
+	}
+
+	region := opts.region
+	if region == "" {
+		region = upload.DefaultRegion
+	}
+
+	endpoint := opts.endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q; %w", endpoint, err)
+	}
+
+	creds := upload.CredentialsFromEnv()
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+
+	partSize := opts.partSizeMB * 1024 * 1024
+	if partSize < upload.MinPartSize {
+		return nil, fmt.Errorf("the part size must be at least %d MiB", upload.MinPartSize/(1024*1024))
+	}
+
+	s3 := &upload.S3{
+		Endpoint:    endpointURL,
+		Bucket:      u.Host,
+		Key:         strings.TrimPrefix(u.Path, "/"),
+		Region:      region,
+		Credentials: creds,
+		Client:      client,
+		PartSize:    partSize,
+		Concurrency: opts.concurrency,
+	}
+
+	lastReport := time.Now()
+	s3.Progress = func(done, total int64) {
+		if time.Since(lastReport) > 10*time.Second || done == total {
+			fmt.Printf("%d/%d MiB uploaded\n", done/(1024*1024), total/(1024*1024))
+			lastReport = time.Now()
+		}
+	}
+
+	return s3, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kubevirt/must-gather/pkg/manifest"
+)
+
+func TestFileToUploadStaleArchive(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "must-gather.local.1")
+	root := filepath.Join(source, "quay-io-kubevirt-must-gather-sha256-1")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "version"), []byte("kubevirt/must-gather\nv1.6.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manifest.Finalize(root); err != nil {
+		t.Fatal(err)
+	}
+
+	// the archive of an interrupted upload, written after the manifest
+	archive := source + ".tar.gz"
+	if err := os.WriteFile(archive, []byte("previous run"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := os.Chtimes(filepath.Join(root, manifest.FileName), now.Add(-time.Hour), now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := fileToUpload(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(file); file != archive || string(data) != "previous run" {
+		t.Errorf("expected the archive of the previous run to be reused")
+	}
+
+	// the bundle is sanitized, which rewrites the manifest
+	if err = os.Chtimes(filepath.Join(root, manifest.FileName), now.Add(time.Hour), now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if file, err = fileToUpload(source); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(file); file != archive || string(data) == "previous run" {
+		t.Errorf("expected the archive to be written again")
+	}
+}
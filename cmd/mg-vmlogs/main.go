@@ -0,0 +1,76 @@
+// mg-vmlogs writes the lines of the virt-handler and virt-controller logs about each VM into its details directory.
+//
+//	mg-vmlogs [<bundle dir>]
+//
+// The lines about each VM gather_vms_details collected are merged in time order with the logs of its virt-launcher pod
+// and its QEMU log, into namespaces/<ns>/vms/<vm>/component-logs.log, which is recorded in the manifest. The bundle
+// directory defaults to $BASE_COLLECTION_PATH.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/manifest"
+	"github.com/kubevirt/must-gather/pkg/vmlogs"
+)
+
+const usage = `Usage:
+  mg-vmlogs [<bundle dir>]
+`
+
+const collector = "mg-vmlogs"
+
+func main() {
+	root := os.Getenv("BASE_COLLECTION_PATH")
+	switch len(os.Args) {
+	case 1:
+	case 2:
+		if os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+			fmt.Print(usage)
+			return
+		}
+		root = os.Args[1]
+	default:
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+	if root == "" {
+		fmt.Printf("the bundle directory is not set\n%s", usage)
+		os.Exit(2)
+	}
+
+	if err := run(root); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(root string) error {
+	b, err := layout.Open(root)
+	if err != nil {
+		return err
+	}
+
+	results, err := vmlogs.SliceBundle(b)
+
+	var entries []manifest.Entry
+	lines := 0
+	for _, r := range results {
+		if r.Path == "" {
+			continue
+		}
+		lines += r.Lines
+		entries = append(entries, manifest.Entry{Path: b.Rel(r.Path), Collector: collector, Command: "merge the logs of " + r.VM.String()})
+	}
+	if rerr := manifest.RecordAll(b.Root(), entries); rerr != nil {
+		return rerr
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d of %d VMs got a %s, with %d lines\n", len(entries), len(results), vmlogs.FileName, lines)
+	return nil
+}
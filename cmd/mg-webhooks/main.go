@@ -0,0 +1,76 @@
+// mg-webhooks checks the admission webhooks, from the objects read on the standard input.
+//
+//	oc get validatingwebhookconfigurations,mutatingwebhookconfigurations -o yaml | mg-webhooks <output file>
+//
+// The input is YAML or JSON documents, separated by "---": the webhook configurations, with their caBundle, and the
+// Services and EndpointSlices of the namespaces of the webhook services. The certificates of each caBundle, the ready
+// endpoints of the service port each webhook calls, and the problems found, are written to the output file as JSON;
+// the caBundles themselves are not. The problems are also printed.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/webhooks"
+)
+
+const usage = `Usage:
+  mg-webhooks <output file> < objects
+`
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+	if os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+		fmt.Print(usage)
+		return
+	}
+
+	if err := run(os.Args[1]); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(output string) error {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("can't read the objects; %w", err)
+	}
+	objs, err := layout.DecodeObjects(data)
+	if err != nil {
+		return fmt.Errorf("can't decode the objects; %w", err)
+	}
+
+	report := webhooks.Check(objs, time.Now().UTC())
+
+	data, err = json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(output, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("can't write %s; %w", output, err)
+	}
+
+	for _, w := range report.Webhooks {
+		if len(w.Problems) == 0 {
+			continue
+		}
+		level := "WARN"
+		if w.Blocking {
+			level = "BLOCKING"
+		}
+		fmt.Printf("[%s] %s webhook %s of %s: %s\n", level, w.Type, w.Name, w.Configuration, strings.Join(w.Problems, "; "))
+	}
+	problems, blocking := report.Problems()
+	fmt.Printf("%d webhooks, %d with a problem, %d blocking KubeVirt requests\n", len(report.Webhooks), problems, blocking)
+	return nil
+}
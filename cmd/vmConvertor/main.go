@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/exec"
 	"path"
 	"strings"
 	"sync"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -20,6 +22,8 @@ import (
 
 var baseDir string
 
+var vmResource = schema.GroupVersionResource{Group: "kubevirt.io", Version: "v1", Resource: "virtualmachines"}
+
 const numWorkers = 100
 
 func main() {
@@ -31,8 +35,6 @@ func main() {
 		os.Exit(1)
 	}
 
-	vmResource := schema.GroupVersionResource{Group: "kubevirt.io", Version: "v1", Resource: "virtualmachines"}
-
 	list, err := client.Resource(vmResource).List(context.Background(), metav1.ListOptions{})
 	if err != nil {
 		fmt.Println("failed to read the VMs from the cluster", err)
@@ -86,6 +88,7 @@ func getClient() (dynamic.Interface, error) {
 func handleOneVM(vm unstructured.Unstructured, wg *sync.WaitGroup) {
 	defer wg.Done()
 
+	start := time.Now()
 	ns, vmName, vmType := getVmIdentity(vm)
 
 	dir, err := createOutputDir(ns, vmType)
@@ -107,7 +110,8 @@ func handleOneVM(vm unstructured.Unstructured, wg *sync.WaitGroup) {
 	}
 
 	fileName := path.Join(dir, vmName+".yaml")
-	writeYamlVmFile(fileName, vmYaml)
+	err = writeYamlVmFile(fileName, vmYaml)
+	recordVmFile(fileName, start, err)
 }
 
 func createOutputDir(ns string, vmType string) (string, error) {
@@ -119,16 +123,41 @@ func createOutputDir(ns string, vmType string) (string, error) {
 	return dir, nil
 }
 
-func writeYamlVmFile(fileName string, vmYaml []byte) {
+func writeYamlVmFile(fileName string, vmYaml []byte) error {
 	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY, 0664)
 	if err != nil {
 		log.Println("can't create file", fileName, ";", err)
-		return
+		return err
 	}
 
 	defer func() { _ = file.Close() }()
 	if _, err = file.Write(vmYaml); err != nil {
 		log.Println("failed to write", vmYaml, err)
+		return err
+	}
+
+	return nil
+}
+
+// recordVmFile adds the VM file to the bundle manifest with mg-manifest, when it is installed. writeErr is the error
+// returned when writing the file.
+func recordVmFile(fileName string, start time.Time, writeErr error) {
+	if _, err := exec.LookPath("mg-manifest"); err != nil {
+		return
+	}
+
+	args := []string{"add", "--root", baseDir, "--collector", "vmConvertor",
+		"--command", "list " + vmResource.Resource + "." + vmResource.Group + " --all-namespaces",
+		"--duration", time.Since(start).String()}
+	if writeErr != nil {
+		args = append(args, "--error", writeErr.Error())
+	}
+	if _, err := os.Stat(fileName); err != nil {
+		args = append(args, "--missing")
+	}
+
+	if out, err := exec.Command("mg-manifest", append(args, fileName)...).CombinedOutput(); err != nil {
+		log.Println("can't record", fileName, "in the manifest;", err, string(out))
 	}
 }
 
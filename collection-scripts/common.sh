@@ -45,3 +45,51 @@ get_log_collection_args() {
 	export log_collection_args
 	export node_log_collection_args
 }
+
+# record_file records a file in the bundle manifest, with the command that produced it, its exit status and its
+# duration. This is what tells an empty file apart from a failed command. A command that failed before writing the
+# file is recorded too, as not written.
+# usage: record_file <collector> <file> <exit status> <start time, in nanoseconds since the epoch> <command>
+function record_file() {
+	if ! command -v mg-manifest > /dev/null 2>&1; then
+		return 0
+	fi
+
+	local duration_ms
+	local missing=()
+	duration_ms=$(( ($(date +%s%N) - $4) / 1000000 ))
+	if [[ ! -e "$2" ]]; then
+		missing=(--missing)
+	fi
+	mg-manifest add --collector "$1" --exit-status "$3" --duration "${duration_ms}ms" --command "$5" "${missing[@]}" "$2"
+}
+
+# record_output runs a command, appends its standard output to a file, or overwrites the file with --truncate, and
+# records the file in the bundle manifest. It returns the exit status of the command.
+# usage: record_output [--truncate] <collector> <file> <command> [args...]
+function record_output() {
+	local truncate=false
+	if [[ "$1" == "--truncate" ]]; then
+		truncate=true
+		shift
+	fi
+	local collector=$1
+	local file=$2
+	shift 2
+
+	local start
+	local rc
+	start=$(date +%s%N)
+	if [[ "${truncate}" == "true" ]]; then
+		"$@" > "${file}"
+	else
+		"$@" >> "${file}"
+	fi
+	rc=$?
+
+	record_file "${collector}" "${file}" "${rc}" "${start}" "$*"
+	return ${rc}
+}
+
+export -f record_file
+export -f record_output
@@ -0,0 +1,353 @@
+// Package addresses finds MAC and IP address conflicts between VMs: MAC addresses used by more than one VM interface,
+// MAC addresses outside the kubemacpool range, and guest IP addresses used more than once on the same network
+// attachment.
+package addresses
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+// kubemacpool stores the range it generated, when the NetworkAddonsConfig does not set one, in this ConfigMap
+const (
+	rangeConfigMap = "kubemacpool-mac-range-config"
+	rangeStartKey  = "RANGE_START"
+	rangeEndKey    = "RANGE_END"
+)
+
+// networkAddonsCR is the name of the NetworkAddonsConfig singleton
+const networkAddonsCR = "cluster"
+
+// Sources of the addresses.
+const (
+	SourceVM        = "vm"
+	SourceVMI       = "vmi"
+	SourceVMIStatus = "vmi status"
+)
+
+const podNetwork = "pod network"
+
+// Owner is a VM interface that uses an address.
+type Owner struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Interface string `json:"interface"`
+	// Network is the pod network, or the namespace/name of the NetworkAttachmentDefinition.
+	Network string `json:"network,omitempty"`
+	// Sources tell where the address was found: the VM spec, the VMI spec or the VMI status.
+	Sources []string `json:"sources"`
+	Running bool     `json:"running"`
+}
+
+// Conflict is an address used by more than one VM interface.
+type Conflict struct {
+	Address string `json:"address"`
+	// Network is set for IP conflicts.
+	Network string  `json:"network,omitempty"`
+	Owners  []Owner `json:"owners"`
+}
+
+// OutOfRange is a MAC address outside the kubemacpool range.
+type OutOfRange struct {
+	Address string `json:"address"`
+	Owner   Owner  `json:"owner"`
+}
+
+// Range is the MAC address range of kubemacpool.
+type Range struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Source is the object the range was read from.
+	Source string `json:"source"`
+
+	start, end uint64
+}
+
+// Report is the result of the address check.
+type Report struct {
+	// Range is nil when no kubemacpool range was collected.
+	Range         *Range       `json:"range,omitempty"`
+	DuplicateMACs []Conflict   `json:"duplicateMACs"`
+	OutOfRange    []OutOfRange `json:"outOfRange"`
+	DuplicateIPs  []Conflict   `json:"duplicateIPs"`
+}
+
+// usage is the addresses of a VM interface
+type usage struct {
+	owner Owner
+	mac   string
+	ips   []netip.Addr
+}
+
+// Analyze checks the addresses of the collected VMs and VMIs.
+func Analyze(b *layout.Bundle) (*Report, error) {
+	report := &Report{DuplicateMACs: []Conflict{}, OutOfRange: []OutOfRange{}, DuplicateIPs: []Conflict{}}
+
+	var err error
+	if report.Range, err = macRange(b); err != nil {
+		return nil, err
+	}
+
+	usages, err := collectUsages(b)
+	if err != nil {
+		return nil, err
+	}
+
+	byMAC := make(map[string][]Owner)
+	byIP := make(map[string]map[string][]Owner)
+	for _, key := range slices.Sorted(maps.Keys(usages)) {
+		u := usages[key]
+		if u.mac != "" {
+			byMAC[u.mac] = append(byMAC[u.mac], u.owner)
+			if report.Range != nil && !report.Range.contains(u.mac) {
+				report.OutOfRange = append(report.OutOfRange, OutOfRange{Address: u.mac, Owner: u.owner})
+			}
+		}
+		// the pod network is managed by the cluster, and masquerade bindings report the same guest address
+		if u.owner.Network == podNetwork {
+			continue
+		}
+		for _, ip := range u.ips {
+			if byIP[u.owner.Network] == nil {
+				byIP[u.owner.Network] = make(map[string][]Owner)
+			}
+			byIP[u.owner.Network][ip.String()] = append(byIP[u.owner.Network][ip.String()], u.owner)
+		}
+	}
+
+	for _, mac := range slices.Sorted(maps.Keys(byMAC)) {
+		if owners := byMAC[mac]; len(owners) > 1 {
+			report.DuplicateMACs = append(report.DuplicateMACs, Conflict{Address: mac, Owners: owners})
+		}
+	}
+	for _, network := range slices.Sorted(maps.Keys(byIP)) {
+		for _, ip := range slices.Sorted(maps.Keys(byIP[network])) {
+			if owners := byIP[network][ip]; len(owners) > 1 {
+				report.DuplicateIPs = append(report.DuplicateIPs, Conflict{Address: ip, Network: network, Owners: owners})
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// macRange reads the range of the NetworkAddonsConfig, or the range kubemacpool generated
+func macRange(b *layout.Bundle) (*Range, error) {
+	nac, err := b.Object(layout.NetworkAddonsConfigs, "", networkAddonsCR)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		start, _, _ := unstructured.NestedString(nac.Object, "spec", "kubeMacPool", "rangeStart")
+		end, _, _ := unstructured.NestedString(nac.Object, "spec", "kubeMacPool", "rangeEnd")
+		if start != "" && end != "" {
+			return newRange(start, end, "NetworkAddonsConfig "+networkAddonsCR)
+		}
+	}
+
+	configMaps, err := b.Objects(layout.ConfigMaps)
+	if err != nil {
+		return nil, err
+	}
+	for _, cm := range configMaps {
+		if cm.GetName() != rangeConfigMap {
+			continue
+		}
+		start, _, _ := unstructured.NestedString(cm.Object, "data", rangeStartKey)
+		end, _, _ := unstructured.NestedString(cm.Object, "data", rangeEndKey)
+		if start != "" && end != "" {
+			return newRange(start, end, "ConfigMap "+cm.GetNamespace()+"/"+cm.GetName())
+		}
+	}
+
+	return nil, nil
+}
+
+func newRange(start, end, source string) (*Range, error) {
+	r := &Range{Start: strings.ToLower(start), End: strings.ToLower(end), Source: source}
+
+	var err error
+	if r.start, err = macValue(start); err != nil {
+		return nil, fmt.Errorf("can't parse the kubemacpool range of %s; %w", source, err)
+	}
+	if r.end, err = macValue(end); err != nil {
+		return nil, fmt.Errorf("can't parse the kubemacpool range of %s; %w", source, err)
+	}
+	return r, nil
+}
+
+func (r *Range) contains(mac string) bool {
+	value, err := macValue(mac)
+	return err == nil && value >= r.start && value <= r.end
+}
+
+func macValue(mac string) (uint64, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return 0, err
+	}
+	if len(hw) != 6 {
+		return 0, fmt.Errorf("%s is not a 48 bit MAC address", mac)
+	}
+	return binary.BigEndian.Uint64(append([]byte{0, 0}, hw...)), nil
+}
+
+// collectUsages reads the MAC addresses of the interfaces of the VM specs, the VMI specs and the VMI statuses, and the
+// IP addresses of the VMI statuses, by namespace, VM and interface
+func collectUsages(b *layout.Bundle) (map[string]*usage, error) {
+	vms, err := b.VirtualMachines()
+	if err != nil {
+		return nil, err
+	}
+	vmis, err := b.VirtualMachineInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make(map[string]*usage)
+	get := func(obj layout.Object, spec map[string]any, iface string) *usage {
+		key := obj.GetNamespace() + "/" + obj.GetName() + "/" + iface
+		u, found := usages[key]
+		if !found {
+			u = &usage{owner: Owner{Namespace: obj.GetNamespace(), Name: obj.GetName(), Interface: iface}}
+			u.owner.Network = network(obj.GetNamespace(), spec, iface)
+			usages[key] = u
+		}
+		return u
+	}
+	setMAC := func(u *usage, mac, source string) {
+		if mac == "" {
+			return
+		}
+		// a VMI status that differs from the spec is reported by the domain check; the status is what the guest uses
+		if u.mac == "" || source == SourceVMIStatus {
+			u.mac = strings.ToLower(mac)
+		}
+		if !slices.Contains(u.owner.Sources, source) {
+			u.owner.Sources = append(u.owner.Sources, source)
+		}
+	}
+
+	for _, vm := range vms {
+		spec, _, _ := unstructured.NestedMap(vm.Object, "spec", "template", "spec")
+		for _, iface := range analysis.NestedMaps(spec, "domain", "devices", "interfaces") {
+			name, _, _ := unstructured.NestedString(iface, "name")
+			mac, _, _ := unstructured.NestedString(iface, "macAddress")
+			setMAC(get(vm, spec, name), mac, SourceVM)
+		}
+	}
+
+	for _, vmi := range vmis {
+		spec, _, _ := unstructured.NestedMap(vmi.Object, "spec")
+		phase, _, _ := unstructured.NestedString(vmi.Object, "status", "phase")
+		for _, iface := range analysis.NestedMaps(spec, "domain", "devices", "interfaces") {
+			name, _, _ := unstructured.NestedString(iface, "name")
+			mac, _, _ := unstructured.NestedString(iface, "macAddress")
+			u := get(vmi, spec, name)
+			u.owner.Running = phase == "Running"
+			setMAC(u, mac, SourceVMI)
+		}
+		for _, status := range analysis.NestedMaps(vmi.Object, "status", "interfaces") {
+			name, _, _ := unstructured.NestedString(status, "name")
+			if name == "" {
+				// interfaces the guest agent reports, that are not in the spec, e.g. the loopback
+				continue
+			}
+			u := get(vmi, spec, name)
+			u.owner.Running = phase == "Running"
+			mac, _, _ := unstructured.NestedString(status, "mac")
+			setMAC(u, mac, SourceVMIStatus)
+
+			addresses, _, _ := unstructured.NestedStringSlice(status, "ipAddresses")
+			if ip, _, _ := unstructured.NestedString(status, "ipAddress"); ip != "" {
+				addresses = append(addresses, ip)
+			}
+			for _, address := range addresses {
+				ip, err := netip.ParseAddr(strings.Split(address, "/")[0])
+				if err != nil || ip.IsLinkLocalUnicast() || ip.IsLoopback() || slices.Contains(u.ips, ip) {
+					continue
+				}
+				u.ips = append(u.ips, ip)
+			}
+		}
+	}
+
+	return usages, nil
+}
+
+// network returns the network of an interface: the pod network, or the namespace/name of the NetworkAttachmentDefinition
+func network(namespace string, spec map[string]any, iface string) string {
+	for _, n := range analysis.NestedMaps(spec, "networks") {
+		if name, _, _ := unstructured.NestedString(n, "name"); name != iface {
+			continue
+		}
+		if _, pod := n["pod"]; pod {
+			return podNetwork
+		}
+		nad, _, _ := unstructured.NestedString(n, "multus", "networkName")
+		if nad != "" && !strings.Contains(nad, "/") {
+			nad = namespace + "/" + nad
+		}
+		return nad
+	}
+	return ""
+}
+
+// WriteText prints the conflicts as tables.
+func (r *Report) WriteText(w io.Writer) error {
+	t := analysis.NewTable(w)
+
+	if r.Range != nil {
+		_, _ = fmt.Fprintf(t, "kubemacpool range: %s - %s (%s)\n\n", r.Range.Start, r.Range.End, r.Range.Source)
+	} else {
+		_, _ = fmt.Fprint(t, "No kubemacpool range was collected; the MAC addresses are not checked against it.\n\n")
+	}
+
+	if len(r.DuplicateMACs) == 0 && len(r.OutOfRange) == 0 && len(r.DuplicateIPs) == 0 {
+		_, _ = fmt.Fprintln(t, "No address conflict was found.")
+		return t.Flush()
+	}
+
+	if len(r.DuplicateMACs) > 0 {
+		_, _ = fmt.Fprintln(t, "DUPLICATE MAC\tNAMESPACE\tVM\tINTERFACE\tRUNNING\tSOURCES")
+		for _, c := range r.DuplicateMACs {
+			for _, o := range c.Owners {
+				_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%t\t%s\n", c.Address, o.Namespace, o.Name, o.Interface, o.Running, strings.Join(o.Sources, ", "))
+			}
+		}
+		_, _ = fmt.Fprintln(t)
+	}
+
+	if len(r.OutOfRange) > 0 {
+		_, _ = fmt.Fprintln(t, "MAC OUTSIDE THE RANGE\tNAMESPACE\tVM\tINTERFACE\tRUNNING\tSOURCES")
+		for _, o := range r.OutOfRange {
+			_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%t\t%s\n", o.Address, o.Owner.Namespace, o.Owner.Name, o.Owner.Interface,
+				o.Owner.Running, strings.Join(o.Owner.Sources, ", "))
+		}
+		_, _ = fmt.Fprintln(t)
+	}
+
+	if len(r.DuplicateIPs) > 0 {
+		_, _ = fmt.Fprintln(t, "DUPLICATE IP\tNETWORK\tNAMESPACE\tVM\tINTERFACE")
+		for _, c := range r.DuplicateIPs {
+			for _, o := range c.Owners {
+				_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\n", c.Address, c.Network, o.Namespace, o.Name, o.Interface)
+			}
+		}
+	}
+
+	return t.Flush()
+}
@@ -0,0 +1,60 @@
+package addresses
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/analysis/analysistest"
+)
+
+func TestDuplicateMACs(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	if len(report.DuplicateMACs) != 1 {
+		t.Fatalf("expected 1 duplicate MAC, but got %+v", report.DuplicateMACs)
+	}
+	c := report.DuplicateMACs[0]
+	if c.Address != "02:00:00:00:00:01" || len(c.Owners) != 2 || c.Owners[0].Namespace != "ns1" || c.Owners[1].Name != "b" {
+		t.Errorf("unexpected conflict: %+v", c)
+	}
+	if !c.Owners[0].Running || len(c.Owners[0].Sources) != 3 {
+		t.Errorf("expected the VM, the VMI and its status as sources of a running owner, but got %+v", c.Owners[0])
+	}
+}
+
+func TestOutOfRange(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	if report.Range == nil || report.Range.Source != "NetworkAddonsConfig cluster" {
+		t.Fatalf("unexpected range: %+v", report.Range)
+	}
+	if len(report.OutOfRange) != 1 || report.OutOfRange[0].Address != "0a:58:00:00:00:05" || report.OutOfRange[0].Owner.Running {
+		t.Errorf("expected the MAC of the stopped VM c to be out of range, but got %+v", report.OutOfRange)
+	}
+}
+
+func TestDuplicateIPs(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	// 10.0.2.2 of the masquerade interfaces, fe80::1 and the loopback are not conflicts
+	if len(report.DuplicateIPs) != 1 {
+		t.Fatalf("expected 1 duplicate IP, but got %+v", report.DuplicateIPs)
+	}
+	if c := report.DuplicateIPs[0]; c.Address != "192.168.1.10" || c.Network != "ns1/br-net" || len(c.Owners) != 2 {
+		t.Errorf("unexpected conflict: %+v", c)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := analysistest.Analyze(t, "testdata/must-gather", Analyze).WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"kubemacpool range: 02:00:00:00:00:00 - 02:00:00:00:ff:ff", "0a:58:00:00:00:05", "ns1/br-net"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in\n%s", expected, buf.String())
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Package analysis holds what the offline checks of a must-gather bundle share: the report interface, the output
+// formats, and helpers to read common fields of the collected objects. Each check is in a sub package, and is run by
+// the mg-analyze command.
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/manifest"
+)
+
+// Report is the result of a check. It is printed as text, or as JSON with encoding/json.
+type Report interface {
+	WriteText(w io.Writer) error
+}
+
+// Analyzer is a check of a bundle.
+type Analyzer struct {
+	Name        string
+	Description string
+	Run         func(b *layout.Bundle) (Report, error)
+}
+
+// Eviction strategies of KubeVirt.
+const (
+	EvictionNone                  = "None"
+	EvictionLiveMigrate           = "LiveMigrate"
+	EvictionLiveMigrateIfPossible = "LiveMigrateIfPossible"
+	EvictionExternal              = "External"
+)
+
+// Format is an output format of the reports.
+type Format string
+
+const (
+	Text Format = "text"
+	JSON Format = "json"
+)
+
+// Write prints the report in the format.
+func Write(w io.Writer, report Report, format Format) error {
+	switch format {
+	case Text:
+		return report.WriteText(w)
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// NewTable returns a tabwriter for the tables of the text reports; columns are separated with tabs.
+func NewTable(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+}
+
+// LiveMigratableCondition is the condition of the VMIs that tells whether they can be live migrated.
+const LiveMigratableCondition = "LiveMigratable"
+
+// Condition is a status condition of an object.
+type Condition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// GetCondition returns the condition of the given type from status.conditions.
+func GetCondition(obj layout.Object, conditionType string) (Condition, bool) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		fields, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if t, _, _ := unstructured.NestedString(fields, "type"); t == conditionType {
+			cond := Condition{Type: t}
+			cond.Status, _, _ = unstructured.NestedString(fields, "status")
+			cond.Reason, _, _ = unstructured.NestedString(fields, "reason")
+			cond.Message, _, _ = unstructured.NestedString(fields, "message")
+			return cond, true
+		}
+	}
+
+	return Condition{}, false
+}
+
+// IsPodRunning reports whether a pod has not terminated, i.e. its phase is neither Succeeded nor Failed.
+func IsPodRunning(pod layout.Object) bool {
+	phase, _, _ := unstructured.NestedString(pod.Object, "status", "phase")
+	return phase != "Succeeded" && phase != "Failed"
+}
+
+// NestedMaps returns a slice of objects, e.g. spec.volumes, skipping the items that are not objects.
+func NestedMaps(obj map[string]any, fields ...string) []map[string]any {
+	items, _, _ := unstructured.NestedSlice(obj, fields...)
+
+	maps := make([]map[string]any, 0, len(items))
+	for _, item := range items {
+		if m, ok := item.(map[string]any); ok {
+			maps = append(maps, m)
+		}
+	}
+	return maps
+}
+
+// KubeVirtConfig returns spec.configuration of the KubeVirt CR, or nil if it was not collected.
+func KubeVirtConfig(b *layout.Bundle) (map[string]any, error) {
+	kvs, err := b.Objects(layout.KubeVirts)
+	if err != nil || len(kvs) == 0 {
+		return nil, err
+	}
+
+	config, _, _ := unstructured.NestedMap(kvs[0].Object, "spec", "configuration")
+	return config, nil
+}
+
+// HyperConverged returns the HyperConverged CR, and false if it was not collected.
+func HyperConverged(b *layout.Bundle) (layout.Object, bool, error) {
+	hcos, err := b.Objects(layout.HyperConvergeds)
+	if err != nil || len(hcos) == 0 {
+		return layout.Object{}, false, err
+	}
+	return hcos[0], true, nil
+}
+
+// DefaultEvictionStrategy returns the eviction strategy of the VMIs that don't set one: the one of the KubeVirt CR,
+// else the one of the HyperConverged CR, else None.
+func DefaultEvictionStrategy(b *layout.Bundle) (string, error) {
+	config, err := KubeVirtConfig(b)
+	if err != nil {
+		return "", err
+	}
+	if strategy, _, _ := unstructured.NestedString(config, "evictionStrategy"); strategy != "" {
+		return strategy, nil
+	}
+
+	hco, found, err := HyperConverged(b)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		if strategy, _, _ := unstructured.NestedString(hco.Object, "spec", "evictionStrategy"); strategy != "" {
+			return strategy, nil
+		}
+	}
+
+	return EvictionNone, nil
+}
+
+// FeatureGates returns the feature gates enabled in the KubeVirt CR.
+func FeatureGates(b *layout.Bundle) (map[string]bool, error) {
+	config, err := KubeVirtConfig(b)
+	if err != nil {
+		return nil, err
+	}
+
+	gates, _, _ := unstructured.NestedStringSlice(config, "developerConfiguration", "featureGates")
+	enabled := make(map[string]bool, len(gates))
+	for _, gate := range gates {
+		enabled[gate] = true
+	}
+	return enabled, nil
+}
+
+// GatherTime returns the time the bundle was gathered, from its manifest, and false if the bundle has no manifest.
+func GatherTime(b *layout.Bundle) (time.Time, bool) {
+	m, err := manifest.Load(b.Root())
+	if err != nil || m.Created.IsZero() {
+		return time.Time{}, false
+	}
+	return m.Created, true
+}
+
+// NestedTime returns an RFC 3339 time field, such as a creationTimestamp or a lastTransitionTime.
+func NestedTime(obj map[string]any, fields ...string) (time.Time, bool) {
+	value, _, _ := unstructured.NestedString(obj, fields...)
+	t, err := time.Parse(time.RFC3339, value)
+	return t, err == nil
+}
+
+// podUIDPattern finds a pod UID in a cgroup path, e.g. kubepods-burstable-pod<uid>.slice, where the systemd driver
+// replaces the dashes with underscores, or in a kubelet path, e.g. /var/lib/kubelet/pods/<uid>/volumes.
+var podUIDPattern = regexp.MustCompile(`pods?/?([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+
+// PodUID returns the pod UID in a cgroup or kubelet path, or an empty string if there is none.
+func PodUID(path string) string {
+	m := podUIDPattern.FindStringSubmatch(path)
+	if m == nil {
+		return ""
+	}
+	return strings.ReplaceAll(m[1], "_", "-")
+}
+
+// VMIsByPodUID returns the VMIs by the UIDs of their virt-launcher pods, from the collected launcher pods and from
+// status.activePods of the VMIs, which also lists the pods that were not collected.
+func VMIsByPodUID(b *layout.Bundle) (map[string]layout.VMRef, error) {
+	vmis := make(map[string]layout.VMRef)
+
+	launchers, err := b.LauncherPods()
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range launchers {
+		if name := layout.LauncherVMName(pod); name != "" {
+			vmis[string(pod.GetUID())] = layout.VMRef{Namespace: pod.GetNamespace(), Name: name}
+		}
+	}
+
+	objects, err := b.VirtualMachineInstances()
+	if err != nil {
+		return nil, err
+	}
+	for _, vmi := range objects {
+		activePods, _, _ := unstructured.NestedStringMap(vmi.Object, "status", "activePods")
+		for uid := range activePods {
+			vmis[uid] = layout.VMRef{Namespace: vmi.GetNamespace(), Name: vmi.GetName()}
+		}
+	}
+
+	return vmis, nil
+}
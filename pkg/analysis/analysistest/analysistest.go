@@ -0,0 +1,43 @@
+// Package analysistest has the helpers of the analyzer tests, which read the test bundles in their testdata
+// directories.
+package analysistest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+// Open opens the test bundle in dir, and fails the test if it can't be opened.
+func Open(t testing.TB, dir string) *layout.Bundle {
+	t.Helper()
+
+	b, err := layout.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// Copy copies the test bundle in dir into a temporary directory, for the tests that change it, and returns the copy.
+func Copy(t testing.TB, dir string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	if err := os.CopyFS(root, os.DirFS(dir)); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// Analyze runs an analyzer on the test bundle in dir, and fails the test if it returns an error.
+func Analyze[R any](t testing.TB, dir string, analyze func(*layout.Bundle) (R, error)) R {
+	t.Helper()
+
+	report, err := analyze(Open(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
@@ -0,0 +1,202 @@
+// Package apiservices reports the availability of the aggregated APIs of KubeVirt and CDI. A broken
+// subresources.kubevirt.io API makes virtctl console, vnc and the VM actions hang or fail. The samples mg-apiservices
+// took while gathering tell whether an API was unavailable, flapping or slow to answer a discovery request, and whether
+// its Service had ready endpoints; bundles without them are reported from the Available condition of the collected
+// APIServices.
+package apiservices
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/apiservices"
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+// APIService is the availability of an aggregated API.
+type APIService struct {
+	Name string `json:"name"`
+	// Service is the namespace/name of the Service of the API; it is empty for the local APIServices.
+	Service string `json:"service,omitempty"`
+	// Available, Reason, Message and Since are the Available condition of the last sample, or of the collected
+	// APIService.
+	Available string    `json:"available"`
+	Reason    string    `json:"reason,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Since     time.Time `json:"since,omitzero"`
+	// Samples is the number of samples taken while gathering, and Unavailable the number of them where Available was
+	// not True.
+	Samples           int      `json:"samples"`
+	Unavailable       int      `json:"unavailable"`
+	ReadyEndpoints    int      `json:"readyEndpoints"`
+	NotReadyEndpoints int      `json:"notReadyEndpoints"`
+	MaxDiscoveryMS    int64    `json:"maxDiscoveryMs"`
+	Problems          []string `json:"problems"`
+}
+
+// Report is the result of the apiservices check.
+type Report struct {
+	// Sampled tells whether the bundle has the samples of mg-apiservices.
+	Sampled bool  `json:"sampled"`
+	SlowMS  int64 `json:"slowMs,omitempty"`
+	// SamplingError is the error that stopped mg-apiservices; the samples taken before it are reported.
+	SamplingError string       `json:"samplingError,omitempty"`
+	APIServices   []APIService `json:"apiServices"`
+}
+
+// Analyze reads the samples of the APIServices, and the collected APIServices of the kubevirt.io groups.
+func Analyze(b *layout.Bundle) (*Report, error) {
+	report := &Report{APIServices: []APIService{}}
+
+	objects, err := b.Objects(layout.APIServices)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int)
+	for _, obj := range objects {
+		group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+		if group != apiservices.GroupSuffix && !strings.HasSuffix(group, "."+apiservices.GroupSuffix) {
+			continue
+		}
+		index[obj.GetName()] = len(report.APIServices)
+		report.APIServices = append(report.APIServices, fromObject(obj))
+	}
+
+	sampled, err := apiservices.ReadFile(b.Path(layout.APIServicesDir, apiservices.FileName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if sampled != nil {
+		report.Sampled, report.SlowMS, report.SamplingError = true, sampled.SlowMS, sampled.Error
+		for _, svc := range sampled.APIServices {
+			i, found := index[svc.Name]
+			if !found {
+				i = len(report.APIServices)
+				index[svc.Name] = i
+				report.APIServices = append(report.APIServices, APIService{Name: svc.Name})
+			}
+			fromSamples(&report.APIServices[i], svc)
+		}
+	}
+
+	// the APIServices with a problem first
+	slices.SortStableFunc(report.APIServices, func(a, b APIService) int {
+		if (len(a.Problems) == 0) != (len(b.Problems) == 0) {
+			if len(a.Problems) == 0 {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return report, nil
+}
+
+// fromObject reads the Available condition of a collected APIService
+func fromObject(obj layout.Object) APIService {
+	svc := APIService{Name: obj.GetName(), Problems: []string{}}
+	namespace, _, _ := unstructured.NestedString(obj.Object, "spec", "service", "namespace")
+	if name, _, _ := unstructured.NestedString(obj.Object, "spec", "service", "name"); name != "" {
+		svc.Service = namespace + "/" + name
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	i := slices.IndexFunc(conditions, func(c any) bool {
+		fields, _ := c.(map[string]any)
+		t, _, _ := unstructured.NestedString(fields, "type")
+		return t == "Available"
+	})
+	if i < 0 {
+		svc.Problems = append(svc.Problems, "the APIService has no Available condition")
+		return svc
+	}
+	available, _ := conditions[i].(map[string]any)
+	svc.Available, _, _ = unstructured.NestedString(available, "status")
+	svc.Reason, _, _ = unstructured.NestedString(available, "reason")
+	svc.Message, _, _ = unstructured.NestedString(available, "message")
+	transition, _, _ := unstructured.NestedString(available, "lastTransitionTime")
+	svc.Since, _ = time.Parse(time.RFC3339, transition)
+	if svc.Available != "True" {
+		svc.Problems = append(svc.Problems, strings.TrimSpace(fmt.Sprintf("Available is %s: %s %s", svc.Available,
+			svc.Reason, svc.Message)))
+	}
+	return svc
+}
+
+// fromSamples replaces the state of an APIService with the one of its samples
+func fromSamples(svc *APIService, sampled apiservices.APIService) {
+	svc.Service = sampled.Service
+	svc.Samples = len(sampled.Samples)
+	svc.ReadyEndpoints, svc.NotReadyEndpoints = sampled.ReadyEndpoints, sampled.NotReadyEndpoints
+	svc.Problems = slices.Clone(sampled.Problems)
+	if svc.Problems == nil {
+		svc.Problems = []string{}
+	}
+
+	svc.Unavailable, svc.MaxDiscoveryMS = 0, 0
+	for _, s := range sampled.Samples {
+		if s.Available != "True" {
+			svc.Unavailable++
+		}
+		svc.MaxDiscoveryMS = max(svc.MaxDiscoveryMS, s.DiscoveryMS)
+	}
+	if len(sampled.Samples) > 0 {
+		last := sampled.Samples[len(sampled.Samples)-1]
+		svc.Available, svc.Reason, svc.Message, svc.Since = last.Available, last.Reason, last.Message, last.LastTransitionTime
+	}
+}
+
+// WriteText prints the APIServices, and their problems.
+func (r *Report) WriteText(w io.Writer) error {
+	t := analysis.NewTable(w)
+
+	if !r.Sampled {
+		_, _ = fmt.Fprintln(t, "the APIServices were not sampled while gathering; only their Available condition is known")
+		_, _ = fmt.Fprintln(t)
+	}
+	if r.SamplingError != "" {
+		_, _ = fmt.Fprintf(t, "the sampling stopped early: %s\n", r.SamplingError)
+		_, _ = fmt.Fprintln(t)
+	}
+
+	_, _ = fmt.Fprintln(t, "APISERVICE\tSERVICE\tAVAILABLE\tSINCE\tUNAVAILABLE SAMPLES\tENDPOINTS\tMAX DISCOVERY")
+	for _, svc := range r.APIServices {
+		service, since, samples, endpoints, discovery := cmp.Or(svc.Service, "Local"), "-", "-", "-", "-"
+		if !svc.Since.IsZero() {
+			since = svc.Since.Format(time.RFC3339)
+		}
+		if r.Sampled && svc.Samples > 0 {
+			samples = fmt.Sprintf("%d/%d", svc.Unavailable, svc.Samples)
+			discovery = (time.Duration(svc.MaxDiscoveryMS) * time.Millisecond).String()
+			if svc.Service != "" {
+				endpoints = fmt.Sprintf("%d ready, %d not ready", svc.ReadyEndpoints, svc.NotReadyEndpoints)
+			}
+		}
+		_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", svc.Name, service, cmp.Or(svc.Available, "-"), since,
+			samples, endpoints, discovery)
+	}
+
+	problems := false
+	for _, svc := range r.APIServices {
+		for _, p := range svc.Problems {
+			if !problems {
+				_, _ = fmt.Fprintln(t)
+				_, _ = fmt.Fprintln(t, "APISERVICE\tPROBLEM")
+				problems = true
+			}
+			_, _ = fmt.Fprintf(t, "%s\t%s\n", svc.Name, p)
+		}
+	}
+
+	return t.Flush()
+}
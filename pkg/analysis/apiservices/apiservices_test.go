@@ -0,0 +1,54 @@
+package apiservices
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/analysis/analysistest"
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+func TestAnalyze(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	if !report.Sampled || report.SlowMS != 1000 || len(report.APIServices) != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	subresources := report.APIServices[0]
+	if subresources.Name != "v1.subresources.kubevirt.io" || subresources.Available != "False" ||
+		subresources.Samples != 2 || subresources.Unavailable != 1 || subresources.MaxDiscoveryMS != 30004 ||
+		subresources.NotReadyEndpoints != 1 || len(subresources.Problems) != 5 {
+		t.Errorf("unexpected subresources APIService: %+v", subresources)
+	}
+	if upload := report.APIServices[1]; upload.Name != "v1beta1.upload.cdi.kubevirt.io" || len(upload.Problems) != 1 {
+		t.Errorf("unexpected upload APIService: %+v", upload)
+	}
+	if local := report.APIServices[2]; local.Name != "v1.kubevirt.io" || local.Service != "" || len(local.Problems) != 0 {
+		t.Errorf("unexpected local APIService: %+v", local)
+	}
+}
+
+func TestAnalyzeWithoutSamples(t *testing.T) {
+	dir := analysistest.Copy(t, "testdata/must-gather")
+	if err := os.Remove(filepath.Join(dir, layout.APIServicesDir, "health.json")); err != nil {
+		t.Fatal(err)
+	}
+	report := analysistest.Analyze(t, dir, Analyze)
+
+	if report.Sampled || len(report.APIServices) != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	subresources := report.APIServices[0]
+	expected := "Available is False: FailedDiscoveryCheck failing or missing response from https://10.128.0.31:8443/apis/subresources.kubevirt.io/v1: context deadline exceeded"
+	if subresources.Service != "openshift-cnv/virt-api" || subresources.Samples != 0 || len(subresources.Problems) != 1 ||
+		subresources.Problems[0] != expected {
+		t.Errorf("unexpected subresources APIService: %+v", subresources)
+	}
+	for _, svc := range report.APIServices[1:] {
+		if len(svc.Problems) != 0 {
+			t.Errorf("unexpected problems: %+v", svc)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+// Package cdi ties each DataVolume to its importer, upload or clone pods, their logs and the annotations CDI sets on
+// the PVC, to tell how far an import got and why it is slow or stuck. It also checks the DataImportCrons that keep
+// the golden images up to date.
+package cdi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+// Annotations CDI sets on the PVCs of the DataVolumes.
+const (
+	importPodAnnotation      = "cdi.kubevirt.io/storage.import.importPodName"
+	uploadPodAnnotation      = "cdi.kubevirt.io/storage.uploadPodName"
+	podPhaseAnnotation       = "cdi.kubevirt.io/storage.pod.phase"
+	podRestartsAnnotation    = "cdi.kubevirt.io/storage.pod.restarts"
+	runningMessageAnnotation = "cdi.kubevirt.io/storage.condition.running.message"
+	runningReasonAnnotation  = "cdi.kubevirt.io/storage.condition.running.reason"
+)
+
+const (
+	phaseSucceeded = "Succeeded"
+	// maxErrors is the number of distinct error lines kept from the logs of each DataVolume
+	maxErrors = 3
+	// maxErrorLength truncates long error lines
+	maxErrorLength = 300
+)
+
+var (
+	// the importer logs its progress as a bare percentage, e.g. "I1019 10:00:00.000000 1 prometheus.go:78] 45.23"
+	progressRe = regexp.MustCompile(`prometheus\.go:\d+\]\s+([0-9]+(?:\.[0-9]+)?)\s*$`)
+	// klog error lines, e.g. "E1019 10:00:00.000000 1 importer.go:172] ..."
+	klogErrorRe = regexp.MustCompile(`^E\d{4} `)
+	// JSON log lines with an error level
+	jsonErrorRe = regexp.MustCompile(`"level":"error"`)
+)
+
+// DataVolume is the import, upload or clone state of a DataVolume.
+type DataVolume struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Phase     string `json:"phase"`
+	Progress  string `json:"progress,omitempty"`
+	Source    string `json:"source"`
+	// Elapsed is the time from the creation of the DataVolume to its completion, or to the gathering, e.g. "1h2m3s".
+	Elapsed  string   `json:"elapsed,omitempty"`
+	Restarts int64    `json:"restarts"`
+	Pods     []string `json:"pods,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	Hint     string   `json:"hint,omitempty"`
+}
+
+// DataImportCron is the state of a DataImportCron.
+type DataImportCron struct {
+	Namespace         string    `json:"namespace"`
+	Name              string    `json:"name"`
+	Schedule          string    `json:"schedule"`
+	ManagedDataSource string    `json:"managedDataSource"`
+	LastImportedPVC   string    `json:"lastImportedPVC,omitempty"`
+	LastImport        time.Time `json:"lastImport,omitempty"`
+	UpToDate          string    `json:"upToDate"`
+	Reason            string    `json:"reason,omitempty"`
+	Message           string    `json:"message,omitempty"`
+	CurrentImports    []string  `json:"currentImports,omitempty"`
+}
+
+// Report is the result of the CDI check.
+type Report struct {
+	DataVolumes     []DataVolume     `json:"dataVolumes"`
+	DataImportCrons []DataImportCron `json:"dataImportCrons"`
+}
+
+// Analyze checks the DataVolumes and the DataImportCrons of the bundle.
+func Analyze(b *layout.Bundle) (*Report, error) {
+	a, err := newAnalyzer(b)
+	if err != nil {
+		return nil, err
+	}
+
+	dvs, err := b.Objects(layout.DataVolumes)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{DataVolumes: []DataVolume{}, DataImportCrons: []DataImportCron{}}
+	for _, dv := range dvs {
+		report.DataVolumes = append(report.DataVolumes, a.dataVolume(dv))
+	}
+
+	crons, err := b.Objects(layout.DataImportCrons)
+	if err != nil {
+		return nil, err
+	}
+	for _, cron := range crons {
+		report.DataImportCrons = append(report.DataImportCrons, dataImportCron(cron))
+	}
+
+	return report, nil
+}
+
+type analyzer struct {
+	b          *layout.Bundle
+	gatherTime time.Time
+	pvcs       map[string]layout.Object
+	pods       map[string]layout.Object
+}
+
+func newAnalyzer(b *layout.Bundle) (*analyzer, error) {
+	a := &analyzer{b: b, pvcs: make(map[string]layout.Object), pods: make(map[string]layout.Object)}
+	a.gatherTime, _ = analysis.GatherTime(b)
+
+	pvcs, err := b.Objects(layout.PersistentVolumeClaims)
+	if err != nil {
+		return nil, err
+	}
+	for _, pvc := range pvcs {
+		a.pvcs[pvc.Key()] = pvc
+	}
+
+	pods, err := b.Objects(layout.Pods)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		a.pods[pod.Key()] = pod
+	}
+
+	return a, nil
+}
+
+func (a *analyzer) dataVolume(obj layout.Object) DataVolume {
+	dv := DataVolume{Namespace: obj.GetNamespace(), Name: obj.GetName(), Source: sourceType(obj)}
+	dv.Phase, _, _ = unstructured.NestedString(obj.Object, "status", "phase")
+	dv.Progress, _, _ = unstructured.NestedString(obj.Object, "status", "progress")
+	dv.Restarts, _ = layout.NestedInt64(obj.Object, "status", "restartCount")
+	dv.Elapsed = a.elapsed(obj, dv.Phase)
+
+	pvc, hasPVC := a.pvcs[dv.Namespace+"/"+dv.Name]
+	if hasPVC {
+		annotations := pvc.GetAnnotations()
+		if restarts, err := strconv.ParseInt(annotations[podRestartsAnnotation], 10, 64); err == nil && restarts > dv.Restarts {
+			dv.Restarts = restarts
+		}
+		if msg := annotations[runningMessageAnnotation]; msg != "" && dv.Phase != phaseSucceeded {
+			dv.addError(strings.TrimSpace(annotations[runningReasonAnnotation] + ": " + msg))
+		}
+	}
+
+	if cond, found := analysis.GetCondition(obj, "Running"); found && cond.Status != "True" && cond.Message != "" && dv.Phase != phaseSucceeded {
+		dv.addError(cond.Reason + ": " + cond.Message)
+	}
+
+	var podProblem string
+	for _, name := range a.podNames(obj, pvc, hasPVC) {
+		dv.Pods = append(dv.Pods, name)
+
+		if pod, found := a.pods[dv.Namespace+"/"+name]; found {
+			if restarts := podRestarts(pod); restarts > dv.Restarts {
+				dv.Restarts = restarts
+			}
+			if podProblem == "" {
+				podProblem = unschedulable(pod)
+			}
+		}
+
+		progress, errors := a.scanLogs(dv.Namespace, name)
+		if progress != "" && (dv.Progress == "" || dv.Progress == "N/A") {
+			dv.Progress = progress + "%"
+		}
+		for _, e := range errors {
+			dv.addError(e)
+		}
+	}
+
+	dv.Hint = hint(dv, podProblem, pvc, hasPVC)
+	return dv
+}
+
+func (dv *DataVolume) addError(msg string) {
+	if len(msg) > maxErrorLength {
+		msg = msg[:maxErrorLength] + "..."
+	}
+	if !slices.Contains(dv.Errors, msg) {
+		dv.Errors = append(dv.Errors, msg)
+	}
+}
+
+// sourceType returns the kind of source of the DataVolume, e.g. http, registry, pvc or upload
+func sourceType(dv layout.Object) string {
+	if source, found, _ := unstructured.NestedMap(dv.Object, "spec", "source"); found {
+		for kind := range source {
+			return kind
+		}
+	}
+	if kind, _, _ := unstructured.NestedString(dv.Object, "spec", "sourceRef", "kind"); kind != "" {
+		name, _, _ := unstructured.NestedString(dv.Object, "spec", "sourceRef", "name")
+		return kind + "/" + name
+	}
+	return "unknown"
+}
+
+// elapsed returns the time from the creation of the DataVolume to its completion, or to the gathering
+func (a *analyzer) elapsed(dv layout.Object, phase string) string {
+	created := dv.GetCreationTimestamp().Time
+	if created.IsZero() {
+		return "unknown"
+	}
+
+	end := a.gatherTime
+	if phase == phaseSucceeded {
+		for _, cond := range analysis.NestedMaps(dv.Object, "status", "conditions") {
+			if t, _, _ := unstructured.NestedString(cond, "type"); t == "Ready" {
+				end, _ = analysis.NestedTime(cond, "lastTransitionTime")
+			}
+		}
+	}
+	if end.IsZero() {
+		// without a manifest, the last heartbeat of the conditions is the closest to the gathering
+		for _, cond := range analysis.NestedMaps(dv.Object, "status", "conditions") {
+			if heartbeat, ok := analysis.NestedTime(cond, "lastHeartbeatTime"); ok && heartbeat.After(end) {
+				end = heartbeat
+			}
+		}
+	}
+
+	if end.Before(created) {
+		return "unknown"
+	}
+	return end.Sub(created).Round(time.Second).String()
+}
+
+// podNames returns the names of the CDI pods that work for the DataVolume: the ones named in the annotations of its
+// PVC, and the ones named after the PVC or its prime PVC, whether they were collected or not
+func (a *analyzer) podNames(dv layout.Object, pvc layout.Object, hasPVC bool) []string {
+	name := dv.GetName()
+	candidates := []string{"importer-" + name, "cdi-upload-" + name}
+	if hasPVC {
+		annotations := pvc.GetAnnotations()
+		candidates = append(candidates, annotations[importPodAnnotation], annotations[uploadPodAnnotation])
+
+		uid := string(pvc.GetUID())
+		if uid != "" {
+			candidates = append(candidates, "importer-prime-"+uid, "cdi-upload-prime-"+uid, uid+"-source-pod")
+		}
+	}
+
+	var names []string
+	for _, candidate := range candidates {
+		if candidate == "" || slices.Contains(names, candidate) {
+			continue
+		}
+		if _, found := a.pods[dv.GetNamespace()+"/"+candidate]; found {
+			names = append(names, candidate)
+		} else if logs, _ := a.b.PodLogs(dv.GetNamespace(), candidate); len(logs) > 0 {
+			names = append(names, candidate)
+		}
+	}
+
+	return names
+}
+
+func podRestarts(pod layout.Object) int64 {
+	var restarts int64
+	for _, status := range analysis.NestedMaps(pod.Object, "status", "containerStatuses") {
+		if n, _ := layout.NestedInt64(status, "restartCount"); n > restarts {
+			restarts = n
+		}
+	}
+	return restarts
+}
+
+// unschedulable returns the message of the PodScheduled condition of a pending pod
+func unschedulable(pod layout.Object) string {
+	if cond, found := analysis.GetCondition(pod, "PodScheduled"); found && cond.Status == "False" {
+		return cond.Message
+	}
+	return ""
+}
+
+// scanLogs returns the last progress percentage and the last distinct error lines found in the logs of a pod
+func (a *analyzer) scanLogs(namespace, pod string) (string, []string) {
+	logs, err := a.b.PodLogs(namespace, pod)
+	if err != nil {
+		return "", nil
+	}
+
+	var progress string
+	var errors []string
+	for _, log := range logs {
+		f, err := os.Open(log.Path)
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if m := progressRe.FindStringSubmatch(line); m != nil {
+				progress = m[1]
+			} else if klogErrorRe.MatchString(line) || jsonErrorRe.MatchString(line) {
+				errors = append(errors, errorMessage(line))
+			}
+		}
+		_ = f.Close()
+	}
+
+	slices.Reverse(errors)
+	errors = slices.Compact(errors)
+	if len(errors) > maxErrors {
+		errors = errors[:maxErrors]
+	}
+	return progress, errors
+}
+
+// errorMessage strips the klog header of an error line
+func errorMessage(line string) string {
+	if _, msg, found := strings.Cut(line, "] "); found && klogErrorRe.MatchString(line) {
+		return msg
+	}
+	return line
+}
+
+// hints maps error substrings to the likely causes, in order
+var hints = []struct {
+	substrings []string
+	hint       string
+}{
+	{[]string{"x509", "certificate signed by unknown authority"}, "the certificate of the source is not trusted; set certConfigMap"},
+	{[]string{"401", "403", "unauthorized", "forbidden", "authentication required"}, "the source denied access; check secretRef"},
+	{[]string{"404", "not found", "manifest unknown"}, "the source image was not found; check the URL"},
+	{[]string{"toomanyrequests", "rate limit"}, "the registry rate limits the pulls"},
+	{[]string{"no such host", "connection refused", "i/o timeout", "dial tcp", "unable to connect", "context deadline exceeded"},
+		"the pod can't reach the source; check the URL, the proxy and the network policies"},
+	{[]string{"no space left", "too small", "exceeds", "insufficient"}, "the PVC is too small for the image"},
+	{[]string{"qemu-img", "unable to process data", "unknown format", "invalid image"}, "the image can't be converted; check its format"},
+}
+
+// hint guesses the cause of the state of the DataVolume
+func hint(dv DataVolume, podProblem string, pvc layout.Object, hasPVC bool) string {
+	if dv.Phase == phaseSucceeded {
+		return ""
+	}
+
+	if podProblem != "" {
+		return "the pod can't be scheduled: " + podProblem
+	}
+
+	errors := strings.ToLower(strings.Join(dv.Errors, "\n"))
+	for _, h := range hints {
+		for _, s := range h.substrings {
+			if strings.Contains(errors, s) {
+				return h.hint
+			}
+		}
+	}
+
+	if hasPVC {
+		if phase, _, _ := unstructured.NestedString(pvc.Object, "status", "phase"); phase == "Pending" {
+			return "the PVC is not bound; check the StorageClass, and start the VM if its volume binding mode is WaitForFirstConsumer"
+		}
+		if podPhase := pvc.GetAnnotations()[podPhaseAnnotation]; podPhase == "Pending" {
+			return "the pod is pending"
+		}
+	}
+
+	switch {
+	case dv.Restarts > 0:
+		return fmt.Sprintf("the pod restarted %d times; see its previous logs", dv.Restarts)
+	case len(dv.Errors) > 0:
+		return "see the errors"
+	case len(dv.Pods) == 0 && dv.Phase != "WaitForFirstConsumer" && dv.Phase != "Pending":
+		return "no CDI pod was collected for this DataVolume"
+	}
+	return ""
+}
+
+func dataImportCron(obj layout.Object) DataImportCron {
+	cron := DataImportCron{Namespace: obj.GetNamespace(), Name: obj.GetName(), UpToDate: "Unknown"}
+	cron.Schedule, _, _ = unstructured.NestedString(obj.Object, "spec", "schedule")
+	cron.ManagedDataSource, _, _ = unstructured.NestedString(obj.Object, "spec", "managedDataSource")
+	cron.LastImportedPVC, _, _ = unstructured.NestedString(obj.Object, "status", "lastImportedPVC", "name")
+	cron.LastImport, _ = analysis.NestedTime(obj.Object, "status", "lastImportTimestamp")
+
+	if cond, found := analysis.GetCondition(obj, "UpToDate"); found {
+		cron.UpToDate, cron.Reason, cron.Message = cond.Status, cond.Reason, cond.Message
+	}
+
+	for _, current := range analysis.NestedMaps(obj.Object, "status", "currentImports") {
+		if name, _, _ := unstructured.NestedString(current, "DataVolumeName"); name != "" {
+			cron.CurrentImports = append(cron.CurrentImports, name)
+		}
+	}
+
+	return cron
+}
+
+// WriteText prints a table per DataVolume, and a table of the DataImportCrons.
+func (r *Report) WriteText(w io.Writer) error {
+	t := analysis.NewTable(w)
+
+	for i, dv := range r.DataVolumes {
+		if i > 0 {
+			_, _ = fmt.Fprintln(t)
+		}
+		_, _ = fmt.Fprintf(t, "DataVolume\t%s/%s\n", dv.Namespace, dv.Name)
+		_, _ = fmt.Fprintf(t, "  Phase\t%s\n", dv.Phase)
+		_, _ = fmt.Fprintf(t, "  Progress\t%s\n", dv.Progress)
+		_, _ = fmt.Fprintf(t, "  Source\t%s\n", dv.Source)
+		_, _ = fmt.Fprintf(t, "  Elapsed\t%s\n", dv.Elapsed)
+		_, _ = fmt.Fprintf(t, "  Restarts\t%d\n", dv.Restarts)
+		_, _ = fmt.Fprintf(t, "  Pods\t%s\n", strings.Join(dv.Pods, ", "))
+		for _, e := range dv.Errors {
+			_, _ = fmt.Fprintf(t, "  Error\t%s\n", e)
+		}
+		if dv.Hint != "" {
+			_, _ = fmt.Fprintf(t, "  Hint\t%s\n", dv.Hint)
+		}
+	}
+
+	if len(r.DataImportCrons) > 0 {
+		if len(r.DataVolumes) > 0 {
+			_, _ = fmt.Fprintln(t)
+		}
+		_, _ = fmt.Fprintln(t, "NAMESPACE\tDATAIMPORTCRON\tDATASOURCE\tSCHEDULE\tUP TO DATE\tLAST IMPORT\tIMPORTING\tMESSAGE")
+		for _, c := range r.DataImportCrons {
+			lastImport := ""
+			if !c.LastImport.IsZero() {
+				lastImport = c.LastImport.UTC().Format(time.RFC3339)
+			}
+			_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", c.Namespace, c.Name, c.ManagedDataSource, c.Schedule,
+				c.UpToDate, lastImport, strings.Join(c.CurrentImports, ", "), strings.TrimSpace(c.Reason+" "+c.Message))
+		}
+	}
+
+	return t.Flush()
+}
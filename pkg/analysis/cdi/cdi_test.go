@@ -0,0 +1,55 @@
+package cdi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/analysis/analysistest"
+)
+
+func TestDataVolumes(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	if len(report.DataVolumes) != 3 {
+		t.Fatalf("expected 3 DataVolumes, but got %+v", report.DataVolumes)
+	}
+
+	importing := report.DataVolumes[0]
+	if importing.Name != "fedora-import" || importing.Source != "http" || importing.Progress != "37.25%" ||
+		importing.Restarts != 2 || importing.Elapsed != "30m0s" {
+		t.Errorf("unexpected result %+v", importing)
+	}
+	if len(importing.Pods) != 1 || importing.Pods[0] != "importer-fedora-import" {
+		t.Errorf("expected the importer pod, but got %v", importing.Pods)
+	}
+	if len(importing.Errors) != 2 || !strings.Contains(importing.Errors[1], "no such host") {
+		t.Errorf("expected the condition and the log error, but got %q", importing.Errors)
+	}
+	if !strings.Contains(importing.Hint, "can't reach the source") {
+		t.Errorf("wrong hint %q", importing.Hint)
+	}
+
+	clone := report.DataVolumes[1]
+	if clone.Source != "DataSource/rhel9" || clone.Elapsed != "2m30s" || clone.Hint != "" || len(clone.Errors) != 0 {
+		t.Errorf("unexpected result %+v", clone)
+	}
+
+	upload := report.DataVolumes[2]
+	if !strings.Contains(upload.Hint, "can't be scheduled: 0/3 nodes are available") {
+		t.Errorf("wrong hint %q", upload.Hint)
+	}
+}
+
+func TestDataImportCrons(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	if len(report.DataImportCrons) != 1 {
+		t.Fatalf("expected 1 DataImportCron, but got %+v", report.DataImportCrons)
+	}
+
+	cron := report.DataImportCrons[0]
+	if cron.UpToDate != "False" || cron.Reason != "ImportProgressing" || cron.ManagedDataSource != "fedora" ||
+		len(cron.CurrentImports) != 1 || cron.CurrentImports[0] != "fedora-9f8e7d6c5b4a" {
+		t.Errorf("unexpected result %+v", cron)
+	}
+}
@@ -0,0 +1,410 @@
+// Package cpu tells which VMs can run on, and be live migrated to, which nodes, from the CPU models and features
+// node-labeller puts on the nodes, the domain capabilities collected from the virt-launcher pods, and the CPU model of
+// each VMI. It also flags the nodes whose host model differs from the rest of the cluster.
+package cpu
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/libvirt"
+)
+
+// Node labels set by the node-labeller of virt-handler.
+const (
+	modelLabelPrefix           = "cpu-model.node.kubevirt.io/"
+	featureLabelPrefix         = "cpu-feature.node.kubevirt.io/"
+	hostModelLabelPrefix       = "host-model-cpu.node.kubevirt.io/"
+	requiredFeatureLabelPrefix = "host-model-required-features.node.kubevirt.io/"
+	migrationModelLabelPrefix  = "cpu-model-migration.node.kubevirt.io/"
+	vendorLabelPrefix          = "cpu-vendor.node.kubevirt.io/"
+	schedulableLabel           = "kubevirt.io/schedulable"
+)
+
+// Sources of the CPU information of a node.
+const (
+	SourceLabels             = "labels"
+	SourceDomainCapabilities = "domcapabilities"
+)
+
+const (
+	hostModel       = "host-model"
+	hostPassthrough = "host-passthrough"
+	requirePolicy   = "require"
+)
+
+// Node is what is known of the CPU of a node.
+type Node struct {
+	Name string `json:"name"`
+	// Source tells where the CPU information comes from: the node-labeller labels, or the domain capabilities of a VM
+	// running on the node. It is empty when nothing is known.
+	Source      string `json:"source,omitempty"`
+	Schedulable bool   `json:"schedulable"`
+	Vendor      string `json:"vendor,omitempty"`
+	HostModel   string `json:"hostModel,omitempty"`
+	// Models are the named CPU models the node can run.
+	Models   []string `json:"models"`
+	Features []string `json:"features"`
+	// RequiredFeatures are the features a host-model VM started on the node needs on the target of a migration.
+	RequiredFeatures []string `json:"requiredFeatures,omitempty"`
+	// MigrationModels are the host models of the nodes host-model VMs can be migrated from.
+	MigrationModels []string `json:"migrationModels,omitempty"`
+	// Outlier is set when the host model differs from the cluster majority.
+	Outlier bool     `json:"outlier"`
+	Notes   []string `json:"notes,omitempty"`
+
+	models, features, migrationModels map[string]bool
+}
+
+// Cell tells whether a VM can run on a node.
+type Cell struct {
+	Node       string `json:"node"`
+	Compatible bool   `json:"compatible"`
+	// Current is set for the node the VMI runs on.
+	Current bool     `json:"current,omitempty"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// VM is a row of the matrix.
+type VM struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Model is the CPU model of the VMI: host-model, host-passthrough or a named model.
+	Model    string   `json:"model"`
+	Features []string `json:"features,omitempty"`
+	Node     string   `json:"node,omitempty"`
+	Cells    []Cell   `json:"cells"`
+}
+
+// Report is the result of the CPU check.
+type Report struct {
+	// MajorityHostModel is the most common host model of the nodes.
+	MajorityHostModel string `json:"majorityHostModel,omitempty"`
+	Nodes             []Node `json:"nodes"`
+	VMs               []VM   `json:"vms"`
+}
+
+// Analyze builds the compatibility matrix of the collected VMIs and nodes.
+func Analyze(b *layout.Bundle) (*Report, error) {
+	nodeObjs, err := b.Objects(layout.Nodes)
+	if err != nil {
+		return nil, err
+	}
+	vmis, err := b.VirtualMachineInstances()
+	if err != nil {
+		return nil, err
+	}
+	config, err := analysis.KubeVirtConfig(b)
+	if err != nil {
+		return nil, err
+	}
+	clusterModel, _, _ := unstructured.NestedString(config, "cpuModel")
+
+	report := &Report{Nodes: []Node{}, VMs: []VM{}}
+	nodes := make(map[string]*Node)
+	for _, obj := range nodeObjs {
+		report.Nodes = append(report.Nodes, nodeFromLabels(obj))
+	}
+	for i := range report.Nodes {
+		nodes[report.Nodes[i].Name] = &report.Nodes[i]
+	}
+
+	for _, vmi := range vmis {
+		nodeName, _, _ := unstructured.NestedString(vmi.Object, "status", "nodeName")
+		node := nodes[nodeName]
+		if node == nil {
+			continue
+		}
+		if err = addDomainCapabilities(b, vmi, node); err != nil {
+			return nil, err
+		}
+	}
+
+	report.flagOutliers()
+
+	for _, vmi := range vmis {
+		vm := VM{Namespace: vmi.GetNamespace(), Name: vmi.GetName(), Cells: []Cell{}}
+		vm.Node, _, _ = unstructured.NestedString(vmi.Object, "status", "nodeName")
+		vm.Model, _, _ = unstructured.NestedString(vmi.Object, "spec", "domain", "cpu", "model")
+		if vm.Model == "" {
+			vm.Model = clusterModel
+		}
+		if vm.Model == "" {
+			vm.Model = hostModel
+		}
+		for _, feature := range analysis.NestedMaps(vmi.Object, "spec", "domain", "cpu", "features") {
+			name, _, _ := unstructured.NestedString(feature, "name")
+			policy, _, _ := unstructured.NestedString(feature, "policy")
+			if policy == "" || policy == requirePolicy {
+				vm.Features = append(vm.Features, name)
+			}
+		}
+
+		for i := range report.Nodes {
+			vm.Cells = append(vm.Cells, cell(vm, &report.Nodes[i], nodes[vm.Node]))
+		}
+		report.VMs = append(report.VMs, vm)
+	}
+
+	return report, nil
+}
+
+func nodeFromLabels(obj layout.Object) Node {
+	node := Node{
+		Name:            obj.GetName(),
+		models:          make(map[string]bool),
+		features:        make(map[string]bool),
+		migrationModels: make(map[string]bool),
+	}
+
+	labels := obj.GetLabels()
+	node.Schedulable = labels[schedulableLabel] == "true"
+	for key, value := range labels {
+		if value != "true" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(key, modelLabelPrefix):
+			node.models[strings.TrimPrefix(key, modelLabelPrefix)] = true
+		case strings.HasPrefix(key, featureLabelPrefix):
+			node.features[strings.TrimPrefix(key, featureLabelPrefix)] = true
+		case strings.HasPrefix(key, hostModelLabelPrefix):
+			node.HostModel = strings.TrimPrefix(key, hostModelLabelPrefix)
+		case strings.HasPrefix(key, requiredFeatureLabelPrefix):
+			node.RequiredFeatures = append(node.RequiredFeatures, strings.TrimPrefix(key, requiredFeatureLabelPrefix))
+		case strings.HasPrefix(key, migrationModelLabelPrefix):
+			node.migrationModels[strings.TrimPrefix(key, migrationModelLabelPrefix)] = true
+		case strings.HasPrefix(key, vendorLabelPrefix):
+			node.Vendor = strings.TrimPrefix(key, vendorLabelPrefix)
+		}
+	}
+
+	if node.HostModel != "" || len(node.models) > 0 || len(node.features) > 0 {
+		node.Source = SourceLabels
+	}
+	node.sync()
+
+	return node
+}
+
+// sync sorts the exported lists from the sets
+func (n *Node) sync() {
+	n.Models = sortedKeys(n.models)
+	n.Features = sortedKeys(n.features)
+	n.MigrationModels = slices.Sorted(maps.Keys(n.migrationModels))
+	slices.Sort(n.RequiredFeatures)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	return append([]string{}, slices.Sorted(maps.Keys(set))...)
+}
+
+// addDomainCapabilities completes a node without labels with the domain capabilities of a VMI running on it, and checks
+// that the labels of a labelled node agree with them.
+func addDomainCapabilities(b *layout.Bundle, vmi layout.Object, node *Node) error {
+	data, err := b.ReadVMArtifact(vmi.GetNamespace(), vmi.GetName(), layout.DomCapabilities)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	caps, err := libvirt.ParseDomainCapabilities(data)
+	if err != nil {
+		node.addNote(fmt.Sprintf("the domain capabilities of VMI %s/%s are not readable; %v", vmi.GetNamespace(), vmi.GetName(), err))
+		return nil
+	}
+	mode := caps.HostModel()
+
+	switch node.Source {
+	case SourceLabels:
+		if mode != nil && mode.ModelName() != "" && mode.ModelName() != node.HostModel {
+			node.addNote(fmt.Sprintf("the domain capabilities of VMI %s/%s report the host model %s, but the labels %s",
+				vmi.GetNamespace(), vmi.GetName(), mode.ModelName(), node.HostModel))
+		}
+	case "":
+		node.Source = SourceDomainCapabilities
+		if mode != nil {
+			node.HostModel = mode.ModelName()
+			node.Vendor = mode.Vendor
+			for _, f := range mode.Features {
+				if f.Policy == requirePolicy {
+					node.features[f.Name] = true
+				}
+			}
+		}
+		for _, model := range caps.UsableModels() {
+			node.models[model] = true
+		}
+		node.sync()
+	}
+
+	return nil
+}
+
+func (n *Node) addNote(note string) {
+	if !slices.Contains(n.Notes, note) {
+		n.Notes = append(n.Notes, note)
+	}
+}
+
+// flagOutliers finds the most common host model, and flags the nodes that have another one
+func (r *Report) flagOutliers() {
+	counts := make(map[string]int)
+	for _, node := range r.Nodes {
+		if node.HostModel != "" {
+			counts[node.HostModel]++
+		}
+	}
+	if len(counts) < 2 {
+		for model := range counts {
+			r.MajorityHostModel = model
+		}
+		return
+	}
+
+	for _, model := range slices.Sorted(maps.Keys(counts)) {
+		if counts[model] > counts[r.MajorityHostModel] {
+			r.MajorityHostModel = model
+		}
+	}
+	for i := range r.Nodes {
+		node := &r.Nodes[i]
+		if node.HostModel != "" && node.HostModel != r.MajorityHostModel {
+			node.Outlier = true
+			node.addNote(fmt.Sprintf("the host model %s differs from the cluster majority %s; host-model VMs started on this node can only migrate to nodes that support it",
+				node.HostModel, r.MajorityHostModel))
+		}
+	}
+}
+
+// cell tells whether the VM can run on the node. Host-model and host-passthrough VMs that run are checked against the
+// CPU of the node they run on, as a migration target must offer the same CPU.
+func cell(vm VM, node *Node, source *Node) Cell {
+	c := Cell{Node: node.Name, Current: node.Name == vm.Node}
+
+	if node.Source == "" {
+		c.Reasons = append(c.Reasons, "the node has no CPU labels; node-labeller did not run on it")
+		return c
+	}
+	if !node.Schedulable {
+		c.Reasons = append(c.Reasons, "the node is not schedulable for VMs")
+	}
+
+	migrating := source != nil && source.Source != "" && !c.Current
+	switch vm.Model {
+	case hostModel:
+		switch {
+		case node.HostModel == "":
+			c.Reasons = append(c.Reasons, "the node has no host model")
+		case migrating && source.HostModel != node.HostModel && !node.migrationModels[source.HostModel]:
+			c.Reasons = append(c.Reasons, fmt.Sprintf("the node can't run the host model %s of %s", source.HostModel, source.Name))
+		}
+		if migrating {
+			if missing := missingFeatures(source.RequiredFeatures, node); len(missing) > 0 {
+				c.Reasons = append(c.Reasons, fmt.Sprintf("the node lacks the features %s required by the host model of %s",
+					strings.Join(missing, ", "), source.Name))
+			}
+		}
+	case hostPassthrough:
+		if migrating {
+			if source.HostModel != node.HostModel {
+				c.Reasons = append(c.Reasons, fmt.Sprintf("host-passthrough needs the CPU of %s (%s), but the node has %s",
+					source.Name, source.HostModel, node.HostModel))
+			}
+			if missing := missingFeatures(source.Features, node); len(missing) > 0 {
+				c.Reasons = append(c.Reasons, fmt.Sprintf("the node lacks the features %s of %s", strings.Join(missing, ", "), source.Name))
+			}
+		}
+	default:
+		if !node.models[vm.Model] {
+			c.Reasons = append(c.Reasons, fmt.Sprintf("the node doesn't support the CPU model %s", vm.Model))
+		}
+	}
+
+	if migrating && source.Vendor != "" && node.Vendor != "" && source.Vendor != node.Vendor {
+		c.Reasons = append(c.Reasons, fmt.Sprintf("the CPU vendor %s differs from %s of %s", node.Vendor, source.Vendor, source.Name))
+	}
+	if missing := missingFeatures(vm.Features, node); len(missing) > 0 {
+		c.Reasons = append(c.Reasons, fmt.Sprintf("the node lacks the features %s of the VMI", strings.Join(missing, ", ")))
+	}
+
+	c.Compatible = len(c.Reasons) == 0
+	return c
+}
+
+func missingFeatures(features []string, node *Node) []string {
+	var missing []string
+	for _, f := range features {
+		if !node.features[f] {
+			missing = append(missing, f)
+		}
+	}
+	return missing
+}
+
+// WriteText prints the nodes, the matrix, and the reasons of the incompatibilities as tables.
+func (r *Report) WriteText(w io.Writer) error {
+	t := analysis.NewTable(w)
+
+	if r.MajorityHostModel != "" {
+		_, _ = fmt.Fprintf(t, "Majority host model: %s\n\n", r.MajorityHostModel)
+	}
+
+	_, _ = fmt.Fprintln(t, "NODE\tSOURCE\tVENDOR\tHOST MODEL\tMODELS\tFEATURES\tNOTES")
+	for _, node := range r.Nodes {
+		source := node.Source
+		if source == "" {
+			source = "unknown"
+		}
+		_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", node.Name, source, node.Vendor, node.HostModel,
+			strings.Join(node.Models, ", "), len(node.Features), strings.Join(node.Notes, "; "))
+	}
+
+	_, _ = fmt.Fprintln(t)
+	if len(r.VMs) == 0 {
+		_, _ = fmt.Fprintln(t, "No VMI was collected.")
+		return t.Flush()
+	}
+
+	header := "NAMESPACE\tVM\tMODEL"
+	for _, node := range r.Nodes {
+		header += "\t" + node.Name
+	}
+	_, _ = fmt.Fprintln(t, header)
+	for _, vm := range r.VMs {
+		row := vm.Namespace + "\t" + vm.Name + "\t" + vm.Model
+		for _, c := range vm.Cells {
+			value := "no"
+			if c.Compatible {
+				value = "yes"
+			}
+			if c.Current {
+				value += " (current)"
+			}
+			row += "\t" + value
+		}
+		_, _ = fmt.Fprintln(t, row)
+	}
+
+	_, _ = fmt.Fprintln(t)
+	_, _ = fmt.Fprintln(t, "NAMESPACE\tVM\tNODE\tREASONS")
+	for _, vm := range r.VMs {
+		for _, c := range vm.Cells {
+			if !c.Compatible {
+				_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\n", vm.Namespace, vm.Name, c.Node, strings.Join(c.Reasons, "; "))
+			}
+		}
+	}
+
+	return t.Flush()
+}
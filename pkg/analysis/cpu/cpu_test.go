@@ -0,0 +1,80 @@
+package cpu
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/analysis/analysistest"
+)
+
+func TestNodes(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	if report.MajorityHostModel != "Skylake-Server-IBRS" {
+		t.Errorf("unexpected majority host model %q", report.MajorityHostModel)
+	}
+	if len(report.Nodes) != 4 {
+		t.Fatalf("expected 4 nodes, but got %+v", report.Nodes)
+	}
+
+	master, node01, node03 := report.Nodes[0], report.Nodes[1], report.Nodes[3]
+	if master.Source != "" || master.Outlier {
+		t.Errorf("unexpected result for master01: %+v", master)
+	}
+	if node01.Source != SourceLabels || node01.Vendor != "Intel" || len(node01.Models) != 2 || node01.Outlier {
+		t.Errorf("unexpected result for node01: %+v", node01)
+	}
+	// node03 has no labels; its CPU comes from the domain capabilities of the pt VMI
+	if node03.Source != SourceDomainCapabilities || node03.HostModel != "Haswell-noTSX-IBRS" || !node03.Outlier {
+		t.Errorf("unexpected result for node03: %+v", node03)
+	}
+	if strings.Join(node03.Features, ",") != "pcid,ssbd" || strings.Join(node03.Models, ",") != "Haswell-noTSX" {
+		t.Errorf("unexpected features or models for node03: %+v", node03)
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	expected := map[string]string{
+		"hm":  "no yes yes no",
+		"pt":  "no no no yes",
+		"sky": "no yes yes no",
+	}
+	reasons := map[string]string{
+		"hm/node03":  "can't run the host model Skylake-Server-IBRS of node01",
+		"pt/node01":  "host-passthrough needs the CPU of node03",
+		"sky/node03": "lacks the features avx512f",
+	}
+
+	for _, vm := range report.VMs {
+		var row []string
+		for _, c := range vm.Cells {
+			if c.Compatible {
+				row = append(row, "yes")
+			} else {
+				row = append(row, "no")
+			}
+			if reason, found := reasons[vm.Name+"/"+c.Node]; found && !strings.Contains(strings.Join(c.Reasons, "; "), reason) {
+				t.Errorf("expected %q in the reasons of %s on %s, but got %q", reason, vm.Name, c.Node, c.Reasons)
+			}
+		}
+		if strings.Join(row, " ") != expected[vm.Name] {
+			t.Errorf("expected %s for %s, but got %s", expected[vm.Name], vm.Name, row)
+		}
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := analysistest.Analyze(t, "testdata/must-gather", Analyze).WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"Majority host model: Skylake-Server-IBRS", "yes (current)", "differs from the cluster majority"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in\n%s", expected, buf.String())
+		}
+	}
+}
@@ -0,0 +1,324 @@
+// Package crds validates the collected custom resources against the openAPIV3Schema of their collected CRDs, and
+// checks the stored versions of the CRDs.
+//
+// The validation covers what the API server enforces with a structural schema: unknown fields, that it would prune,
+// types, enums and required fields. Other JSON schema keywords (patterns, formats, bounds, CEL rules) are not checked.
+package crds
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+// Kinds of problems.
+const (
+	UnknownField    = "unknown field"
+	TypeError       = "type error"
+	EnumViolation   = "enum violation"
+	MissingRequired = "missing required field"
+	UnknownVersion  = "unknown version"
+)
+
+// CRD is the version state of a CRD.
+type CRD struct {
+	Name           string   `json:"name"`
+	StorageVersion string   `json:"storageVersion"`
+	Served         []string `json:"served"`
+	StoredVersions []string `json:"storedVersions"`
+	// Objects is the number of collected objects of the CRD.
+	Objects  int      `json:"objects"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Problem is a problem found in a custom resource.
+type Problem struct {
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Path      string `json:"path,omitempty"`
+	Message   string `json:"message"`
+}
+
+// Report is the result of the CRD check.
+type Report struct {
+	CRDs     []CRD     `json:"crds"`
+	Problems []Problem `json:"problems"`
+}
+
+// Analyze validates the custom resources of all the collected CRDs.
+func Analyze(b *layout.Bundle) (*Report, error) {
+	crds, err := b.Objects(layout.CustomResourceDefinitions)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{CRDs: []CRD{}, Problems: []Problem{}}
+	for _, crd := range crds {
+		if err = report.checkCRD(b, crd); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+func (r *Report) checkCRD(b *layout.Bundle, obj layout.Object) error {
+	crd := CRD{Name: obj.GetName()}
+	crd.StoredVersions, _, _ = unstructured.NestedStringSlice(obj.Object, "status", "storedVersions")
+
+	schemas := make(map[string]map[string]any)
+	served := make(map[string]bool)
+	for _, version := range analysis.NestedMaps(obj.Object, "spec", "versions") {
+		name, _, _ := unstructured.NestedString(version, "name")
+		if isServed, _, _ := unstructured.NestedBool(version, "served"); isServed {
+			served[name] = true
+			crd.Served = append(crd.Served, name)
+		}
+		if isStorage, _, _ := unstructured.NestedBool(version, "storage"); isStorage {
+			crd.StorageVersion = name
+		}
+		schemas[name], _, _ = unstructured.NestedMap(version, "schema", "openAPIV3Schema")
+	}
+
+	for _, stored := range crd.StoredVersions {
+		if !served[stored] {
+			crd.Problems = append(crd.Problems, fmt.Sprintf("stored version %s is not served; objects stored in it can't be read", stored))
+		}
+	}
+	if len(crd.StoredVersions) > 1 {
+		crd.Problems = append(crd.Problems, fmt.Sprintf("objects are stored in %d versions (%s); the storage migration to %s is not complete",
+			len(crd.StoredVersions), strings.Join(crd.StoredVersions, ", "), crd.StorageVersion))
+	}
+
+	group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+	plural, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "plural")
+	gr := schema.GroupResource{Group: group, Resource: plural}
+
+	objs, err := b.Objects(gr)
+	if err != nil {
+		return err
+	}
+	crd.Objects = len(objs)
+
+	for _, cr := range objs {
+		gv, err := schema.ParseGroupVersion(cr.GetAPIVersion())
+		if err != nil || gv.Group != group {
+			continue
+		}
+
+		p := Problem{Resource: gr.String(), Namespace: cr.GetNamespace(), Name: cr.GetName(), Version: gv.Version}
+		crSchema, known := schemas[gv.Version]
+		if !known {
+			p.Kind, p.Message = UnknownVersion, fmt.Sprintf("version %s is not defined in the CRD", gv.Version)
+			r.Problems = append(r.Problems, p)
+			continue
+		}
+
+		if crSchema == nil {
+			continue
+		}
+
+		v := &validator{report: func(kind, path, message string) {
+			problem := p
+			problem.Kind, problem.Path, problem.Message = kind, path, message
+			r.Problems = append(r.Problems, problem)
+		}}
+		v.validateObject("", cr.Object, crSchema, true)
+	}
+
+	r.CRDs = append(r.CRDs, crd)
+	return nil
+}
+
+type validator struct {
+	report func(kind, path, message string)
+}
+
+func (v *validator) validate(path string, value any, s map[string]any) {
+	if value == nil {
+		// the API server drops the nulls of non nullable fields
+		return
+	}
+
+	if intOrString, _, _ := unstructured.NestedBool(s, "x-kubernetes-int-or-string"); intOrString {
+		if _, isString := value.(string); !isString && !isInteger(value) {
+			v.report(TypeError, path, fmt.Sprintf("expected an integer or a string, but got %s", typeName(value)))
+		}
+		return
+	}
+
+	expected, _, _ := unstructured.NestedString(s, "type")
+	if expected != "" && !hasType(value, expected) {
+		v.report(TypeError, path, fmt.Sprintf("expected %s, but got %s", expected, typeName(value)))
+		return
+	}
+
+	if enum, found, _ := unstructured.NestedSlice(s, "enum"); found && !inEnum(value, enum) {
+		v.report(EnumViolation, path, fmt.Sprintf("%v is not one of %v", value, enum))
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		embedded, _, _ := unstructured.NestedBool(s, "x-kubernetes-embedded-resource")
+		v.validateObject(path, typed, s, embedded)
+	case []any:
+		items, found, _ := unstructured.NestedMap(s, "items")
+		if !found {
+			return
+		}
+		for i, item := range typed {
+			v.validate(fmt.Sprintf("%s[%d]", path, i), item, items)
+		}
+	}
+}
+
+// validateObject checks the fields of an object. The apiVersion, kind and metadata of resources are not in their
+// schema, and are not checked.
+func (v *validator) validateObject(path string, obj map[string]any, s map[string]any, resource bool) {
+	properties, _, _ := unstructured.NestedMap(s, "properties")
+	preserveUnknown, _, _ := unstructured.NestedBool(s, "x-kubernetes-preserve-unknown-fields")
+
+	var additional map[string]any
+	allowAdditional := preserveUnknown
+	switch a := s["additionalProperties"].(type) {
+	case bool:
+		allowAdditional = allowAdditional || a
+	case map[string]any:
+		additional = a
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if resource && (key == "apiVersion" || key == "kind" || key == "metadata") {
+			continue
+		}
+
+		fieldPath := path + "." + key
+		if propSchema, ok := properties[key].(map[string]any); ok {
+			v.validate(fieldPath, obj[key], propSchema)
+		} else if additional != nil {
+			v.validate(fieldPath, obj[key], additional)
+		} else if !allowAdditional {
+			v.report(UnknownField, fieldPath, "the field is not in the schema, and is pruned by the API server")
+		}
+	}
+
+	required, _, _ := unstructured.NestedStringSlice(s, "required")
+	for _, field := range required {
+		if _, found := obj[field]; !found {
+			v.report(MissingRequired, path+"."+field, "the field is required")
+		}
+	}
+}
+
+func hasType(value any, expected string) bool {
+	switch expected {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "integer":
+		return isInteger(value)
+	case "number":
+		switch value.(type) {
+		case float64, int64, int:
+			return true
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// isInteger reports whether value is a whole number; the objects read by sigs.k8s.io/yaml hold float64 numbers
+func isInteger(value any) bool {
+	switch n := value.(type) {
+	case int64, int:
+		return true
+	case float64:
+		return n == float64(int64(n))
+	}
+	return false
+}
+
+func typeName(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64, int64, int:
+		if isInteger(value) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func inEnum(value any, enum []any) bool {
+	return slices.ContainsFunc(enum, func(allowed any) bool {
+		if isInteger(value) && isInteger(allowed) {
+			return fmt.Sprint(value) == fmt.Sprint(allowed)
+		}
+		return reflect.DeepEqual(value, allowed)
+	})
+}
+
+// WriteText prints the CRDs and the problems as tables.
+func (r *Report) WriteText(w io.Writer) error {
+	t := analysis.NewTable(w)
+
+	_, _ = fmt.Fprintln(t, "CRD\tSTORAGE VERSION\tSERVED\tSTORED VERSIONS\tOBJECTS\tPROBLEMS")
+	for _, crd := range r.CRDs {
+		_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%d\t%s\n", crd.Name, crd.StorageVersion, strings.Join(crd.Served, ", "),
+			strings.Join(crd.StoredVersions, ", "), crd.Objects, strings.Join(crd.Problems, "; "))
+	}
+
+	_, _ = fmt.Fprintln(t)
+	if len(r.Problems) == 0 {
+		_, _ = fmt.Fprintln(t, "All the custom resources match their schema.")
+		return t.Flush()
+	}
+
+	_, _ = fmt.Fprintln(t, "RESOURCE\tOBJECT\tVERSION\tPROBLEM\tPATH\tMESSAGE")
+	for _, p := range r.Problems {
+		object := p.Name
+		if p.Namespace != "" {
+			object = p.Namespace + "/" + p.Name
+		}
+		_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%s\n", p.Resource, object, p.Version, p.Kind, p.Path, p.Message)
+	}
+
+	return t.Flush()
+}
@@ -0,0 +1,74 @@
+package crds
+
+import (
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/analysis/analysistest"
+)
+
+func TestAnalyze(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	if len(report.CRDs) != 1 {
+		t.Fatalf("expected 1 CRD, but got %+v", report.CRDs)
+	}
+	crd := report.CRDs[0]
+	if crd.StorageVersion != "v1" || crd.Objects != 1 || len(crd.Problems) != 2 {
+		t.Errorf("unexpected CRD result %+v", crd)
+	}
+
+	expected := []Problem{
+		{Name: "kubevirt-kubevirt-hyperconverged", Kind: TypeError, Path: ".spec.configuration.developerConfiguration.featureGates"},
+		{Name: "kubevirt-kubevirt-hyperconverged", Kind: UnknownField, Path: ".spec.configuration.migrationsTuning"},
+		{Name: "kubevirt-kubevirt-hyperconverged", Kind: EnumViolation, Path: ".spec.imagePullPolicy"},
+	}
+	if len(report.Problems) != len(expected) {
+		t.Fatalf("expected %d problems, but got %+v", len(expected), report.Problems)
+	}
+	for i, p := range expected {
+		got := report.Problems[i]
+		if got.Name != p.Name || got.Kind != p.Kind || got.Path != p.Path {
+			t.Errorf("expected %s %s at %q, but got %+v", p.Name, p.Kind, p.Path, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"port":    map[string]any{"x-kubernetes-int-or-string": true},
+			"size":    map[string]any{"type": "integer"},
+			"labels":  map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+			"ratio":   map[string]any{"type": "number"},
+			"enabled": map[string]any{"type": "boolean"},
+		},
+		"required": []any{"size"},
+	}
+
+	tests := []struct {
+		obj      map[string]any
+		problems []string
+	}{
+		{obj: map[string]any{"port": "http", "size": float64(3), "labels": map[string]any{"a": "b"}, "ratio": 0.5, "enabled": true}},
+		{obj: map[string]any{"port": float64(8080), "size": float64(3), "enabled": nil}},
+		{obj: map[string]any{"port": true, "size": 1.5}, problems: []string{TypeError, TypeError}},
+		{obj: map[string]any{"labels": map[string]any{"a": float64(1)}}, problems: []string{TypeError, MissingRequired}},
+	}
+
+	for i, test := range tests {
+		var problems []string
+		v := &validator{report: func(kind, path, message string) { problems = append(problems, kind) }}
+		v.validateObject("", test.obj, s, false)
+
+		if len(problems) != len(test.problems) {
+			t.Errorf("test %d: expected %v, but got %v", i, test.problems, problems)
+			continue
+		}
+		for j := range problems {
+			if problems[j] != test.problems[j] {
+				t.Errorf("test %d: expected %v, but got %v", i, test.problems, problems)
+			}
+		}
+	}
+}
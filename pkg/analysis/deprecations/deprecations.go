@@ -0,0 +1,235 @@
+// Package deprecations reports the VMs and the KubeVirt and HyperConverged CRs that use deprecated fields or feature
+// gates, according to a versioned ruleset, so they can be cleaned up before an upgrade.
+package deprecations
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+//go:embed rules.yaml
+var defaultRules []byte
+
+// kinds maps the kinds of the rules to the resources they apply to.
+var kinds = map[string]schema.GroupResource{
+	"VirtualMachine": layout.VirtualMachines,
+	"KubeVirt":       layout.KubeVirts,
+	"HyperConverged": layout.HyperConvergeds,
+}
+
+// Rule is a deprecation.
+type Rule struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// Path is the dot separated path of the field; "[]" iterates over a list, e.g. spec.interfaces[].slirp.
+	Path string `json:"path"`
+	// Value, when set, makes the rule match only when the field has this value.
+	Value any `json:"value,omitempty"`
+	// Contains, when set, makes the rule match only when the field is a list with this item.
+	Contains     any    `json:"contains,omitempty"`
+	Message      string `json:"message"`
+	Replacement  string `json:"replacement,omitempty"`
+	DeprecatedIn string `json:"deprecatedIn"`
+	RemovedIn    string `json:"removedIn,omitempty"`
+}
+
+// Ruleset is a versioned list of deprecations.
+type Ruleset struct {
+	Version string `json:"version"`
+	Rules   []Rule `json:"rules"`
+}
+
+// LoadRuleset parses and checks a YAML ruleset.
+func LoadRuleset(data []byte) (*Ruleset, error) {
+	rs := &Ruleset{}
+	if err := yaml.UnmarshalStrict(data, rs); err != nil {
+		return nil, fmt.Errorf("can't parse the deprecation rules; %w", err)
+	}
+
+	ids := make(map[string]bool)
+	for _, rule := range rs.Rules {
+		switch {
+		case rule.ID == "" || ids[rule.ID]:
+			return nil, fmt.Errorf("missing or duplicate rule id %q", rule.ID)
+		case kinds[rule.Kind] == schema.GroupResource{}:
+			return nil, fmt.Errorf("rule %s: unknown kind %q", rule.ID, rule.Kind)
+		case rule.Path == "":
+			return nil, fmt.Errorf("rule %s: missing path", rule.ID)
+		case rule.Value != nil && rule.Contains != nil:
+			return nil, fmt.Errorf("rule %s: value and contains are exclusive", rule.ID)
+		}
+		ids[rule.ID] = true
+	}
+
+	return rs, nil
+}
+
+// DefaultRuleset returns the ruleset built into the tool.
+func DefaultRuleset() (*Ruleset, error) {
+	return LoadRuleset(defaultRules)
+}
+
+// Finding is a use of a deprecated field or feature gate.
+type Finding struct {
+	Kind         string `json:"kind"`
+	Namespace    string `json:"namespace,omitempty"`
+	Name         string `json:"name"`
+	Rule         string `json:"rule"`
+	Path         string `json:"path"`
+	Message      string `json:"message"`
+	Replacement  string `json:"replacement,omitempty"`
+	DeprecatedIn string `json:"deprecatedIn"`
+	RemovedIn    string `json:"removedIn,omitempty"`
+}
+
+// Report is the result of the deprecation check.
+type Report struct {
+	RulesetVersion string    `json:"rulesetVersion"`
+	Findings       []Finding `json:"findings"`
+}
+
+// Analyze checks the bundle with the default ruleset.
+func Analyze(b *layout.Bundle) (*Report, error) {
+	rs, err := DefaultRuleset()
+	if err != nil {
+		return nil, err
+	}
+	return AnalyzeWith(b, rs)
+}
+
+// AnalyzeWith checks the bundle with the given ruleset.
+func AnalyzeWith(b *layout.Bundle, rs *Ruleset) (*Report, error) {
+	report := &Report{RulesetVersion: rs.Version, Findings: []Finding{}}
+
+	objects := make(map[string][]layout.Object)
+	for _, rule := range rs.Rules {
+		objs, found := objects[rule.Kind]
+		if !found {
+			var err error
+			if objs, err = b.Objects(kinds[rule.Kind]); err != nil {
+				return nil, err
+			}
+			objects[rule.Kind] = objs
+		}
+
+		for _, obj := range objs {
+			for _, path := range rule.match(obj.Object) {
+				report.Findings = append(report.Findings, Finding{
+					Kind:         rule.Kind,
+					Namespace:    obj.GetNamespace(),
+					Name:         obj.GetName(),
+					Rule:         rule.ID,
+					Path:         path,
+					Message:      rule.Message,
+					Replacement:  rule.Replacement,
+					DeprecatedIn: rule.DeprecatedIn,
+					RemovedIn:    rule.RemovedIn,
+				})
+			}
+		}
+	}
+
+	slices.SortStableFunc(report.Findings, func(a, b Finding) int {
+		return strings.Compare(a.Kind+"/"+a.Namespace+"/"+a.Name, b.Kind+"/"+b.Namespace+"/"+b.Name)
+	})
+
+	return report, nil
+}
+
+// match returns the paths of the fields of obj the rule matches
+func (r Rule) match(obj map[string]any) []string {
+	var matches []string
+	for path, value := range lookup(obj, strings.Split(r.Path, "."), "") {
+		switch {
+		case r.Value != nil:
+			if equal(value, r.Value) {
+				matches = append(matches, path)
+			}
+		case r.Contains != nil:
+			items, _ := value.([]any)
+			if slices.ContainsFunc(items, func(item any) bool { return equal(item, r.Contains) }) {
+				matches = append(matches, path)
+			}
+		default:
+			matches = append(matches, path)
+		}
+	}
+
+	slices.Sort(matches)
+	return matches
+}
+
+// lookup returns the values at the path, by their actual path, e.g. spec.interfaces[1].slirp
+func lookup(value any, segments []string, prefix string) map[string]any {
+	if len(segments) == 0 {
+		return map[string]any{prefix: value}
+	}
+
+	field, isList := strings.CutSuffix(segments[0], "[]")
+	obj, ok := value.(map[string]any)
+	if !ok {
+		return nil
+	}
+	child, found := obj[field]
+	if !found {
+		return nil
+	}
+
+	path := field
+	if prefix != "" {
+		path = prefix + "." + field
+	}
+	if !isList {
+		return lookup(child, segments[1:], path)
+	}
+
+	items, _ := child.([]any)
+	values := make(map[string]any)
+	for i, item := range items {
+		for p, v := range lookup(item, segments[1:], fmt.Sprintf("%s[%d]", path, i)) {
+			values[p] = v
+		}
+	}
+	return values
+}
+
+// equal compares values read from YAML, where numbers are float64
+func equal(a, b any) bool {
+	return reflect.DeepEqual(a, b) || fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// WriteText prints the findings as a table.
+func (r *Report) WriteText(w io.Writer) error {
+	t := analysis.NewTable(w)
+
+	_, _ = fmt.Fprintf(t, "Ruleset version: %s\n\n", r.RulesetVersion)
+	if len(r.Findings) == 0 {
+		_, _ = fmt.Fprintln(t, "No deprecated field or feature gate is used.")
+		return t.Flush()
+	}
+
+	_, _ = fmt.Fprintln(t, "KIND\tOBJECT\tPATH\tDEPRECATED IN\tREMOVED IN\tMESSAGE\tREPLACEMENT")
+	for _, f := range r.Findings {
+		object := f.Name
+		if f.Namespace != "" {
+			object = f.Namespace + "/" + f.Name
+		}
+		removedIn := f.RemovedIn
+		if removedIn == "" {
+			removedIn = "not scheduled"
+		}
+		_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", f.Kind, object, f.Path, f.DeprecatedIn, removedIn, f.Message, f.Replacement)
+	}
+
+	return t.Flush()
+}
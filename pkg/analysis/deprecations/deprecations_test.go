@@ -0,0 +1,53 @@
+package deprecations
+
+import (
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/analysis/analysistest"
+)
+
+func TestDefaultRuleset(t *testing.T) {
+	rs, err := DefaultRuleset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Version == "" || len(rs.Rules) == 0 {
+		t.Errorf("the default ruleset is empty")
+	}
+}
+
+func TestLoadRulesetErrors(t *testing.T) {
+	for _, data := range []string{
+		"rules:\n- id: a\n  kind: Pod\n  path: spec\n",
+		"rules:\n- id: a\n  kind: KubeVirt\n",
+		"rules:\n- id: a\n  kind: KubeVirt\n  path: spec\n- id: a\n  kind: KubeVirt\n  path: spec\n",
+		"rules:\n- id: a\n  kind: KubeVirt\n  path: spec\n  unknown: field\n",
+	} {
+		if _, err := LoadRuleset([]byte(data)); err == nil {
+			t.Errorf("expected an error for\n%s", data)
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	expected := []struct{ name, rule, path string }{
+		{"kubevirt-hyperconverged", "hco-gate-non-root", "spec.featureGates.nonRoot"},
+		{"kubevirt-kubevirt-hyperconverged", "kv-permit-slirp", "spec.configuration.network.permitSlirpInterface"},
+		{"kubevirt-kubevirt-hyperconverged", "kv-gate-macvtap", "spec.configuration.developerConfiguration.featureGates"},
+		{"kubevirt-kubevirt-hyperconverged", "kv-gate-live-migration", "spec.configuration.developerConfiguration.featureGates"},
+		{"legacy", "vm-running", "spec.running"},
+		{"legacy", "vm-slirp-binding", "spec.template.spec.domain.devices.interfaces[1].slirp"},
+	}
+
+	if len(report.Findings) != len(expected) {
+		t.Fatalf("expected %d findings, but got %+v", len(expected), report.Findings)
+	}
+	for i, e := range expected {
+		f := report.Findings[i]
+		if f.Name != e.name || f.Rule != e.rule || f.Path != e.path {
+			t.Errorf("expected %s %s at %s, but got %+v", e.name, e.rule, e.path, f)
+		}
+	}
+}
@@ -0,0 +1,489 @@
+// Package domain compares the libvirt domain of each running VM, as collected by gather_vms_details, with the spec and
+// status of its VMI: the vCPU topology, the memory and huge pages, the disks and their buses, the interfaces and their
+// MAC addresses, and the CPU model. The discrepancies point at hotplug leftovers, and at domains that don't run what
+// Kubernetes asked for.
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/libvirt"
+)
+
+// Areas of the discrepancies.
+const (
+	VCPU      = "vcpu"
+	Memory    = "memory"
+	HugePages = "hugepages"
+	Disk      = "disk"
+	Interface = "interface"
+	CPUModel  = "cpu model"
+)
+
+// KubeVirt aligns the guest memory; differences below this are not reported
+const memoryAlignment = 2 << 20
+
+// Discrepancy is a difference between the VMI and its domain.
+type Discrepancy struct {
+	Area string `json:"area"`
+	// Device is the name of the disk or interface in the VMI spec, or the target or alias in the domain.
+	Device   string `json:"device,omitempty"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Message  string `json:"message,omitempty"`
+}
+
+// VM is the comparison of a VMI with its domain.
+type VM struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Domain is the name of the libvirt domain.
+	Domain        string        `json:"domain,omitempty"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+	// Skipped tells why the VM was not compared, e.g. when the domain XML was not collected.
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// Report is the result of the domain check.
+type Report struct {
+	VMs []VM `json:"vms"`
+}
+
+// Analyze compares the domain of every VM gather_vms_details collected with its VMI.
+func Analyze(b *layout.Bundle) (*Report, error) {
+	refs, err := b.VMsWithDetails()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{VMs: []VM{}}
+	for _, ref := range refs {
+		vm, err := compare(b, ref)
+		if err != nil {
+			return nil, err
+		}
+		report.VMs = append(report.VMs, vm)
+	}
+
+	return report, nil
+}
+
+func compare(b *layout.Bundle, ref layout.VMRef) (VM, error) {
+	vm := VM{Namespace: ref.Namespace, Name: ref.Name, Discrepancies: []Discrepancy{}}
+
+	vmi, err := b.Object(layout.VirtualMachineInstances, ref.Namespace, ref.Name)
+	if errors.Is(err, fs.ErrNotExist) {
+		vm.Skipped = "the VMI was not collected"
+		return vm, nil
+	} else if err != nil {
+		return vm, err
+	}
+
+	data, err := b.ReadVMArtifact(ref.Namespace, ref.Name, layout.DomainXML)
+	if errors.Is(err, fs.ErrNotExist) {
+		vm.Skipped = "the domain XML was not collected"
+		return vm, nil
+	} else if err != nil {
+		return vm, err
+	}
+
+	dom, err := libvirt.ParseDomain(data)
+	if err != nil {
+		vm.Skipped = err.Error()
+		return vm, nil
+	}
+	vm.Domain = dom.Name
+
+	// domblklist is optional; it is only used to cross check the disks of the XML
+	var blockList []libvirt.BlockDevice
+	if data, err = b.ReadVMArtifact(ref.Namespace, ref.Name, layout.BlockList); err == nil {
+		blockList, _ = libvirt.ParseBlockList(data)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return vm, err
+	}
+
+	c := &comparison{vmi: vmi.Object, dom: dom}
+	c.compareVCPUs()
+	c.compareMemory()
+	c.compareCPUModel()
+	c.compareDisks(blockList)
+	c.compareInterfaces()
+	vm.Discrepancies = append(vm.Discrepancies, c.discrepancies...)
+
+	return vm, nil
+}
+
+type comparison struct {
+	vmi           map[string]any
+	dom           *libvirt.Domain
+	discrepancies []Discrepancy
+}
+
+func (c *comparison) add(area, device, expected, actual, message string) {
+	c.discrepancies = append(c.discrepancies, Discrepancy{Area: area, Device: device, Expected: expected, Actual: actual, Message: message})
+}
+
+// compareVCPUs compares the topology of the VMI to the domain. The current topology in the status follows CPU hotplug;
+// with hotplug, the domain topology has the maximum number of sockets.
+func (c *comparison) compareVCPUs() {
+	topology, _, _ := unstructured.NestedMap(c.vmi, "status", "currentCPUTopology")
+	if topology == nil {
+		topology, _, _ = unstructured.NestedMap(c.vmi, "spec", "domain", "cpu")
+	}
+	sockets, hasSockets := layout.NestedInt64(topology, "sockets")
+	cores, hasCores := layout.NestedInt64(topology, "cores")
+	threads, hasThreads := layout.NestedInt64(topology, "threads")
+	if !hasSockets && !hasCores && !hasThreads {
+		// the VMI leaves the topology to KubeVirt
+		return
+	}
+	sockets, cores, threads = max(sockets, 1), max(cores, 1), max(threads, 1)
+
+	if expected, online := sockets*cores*threads, int64(c.dom.OnlineVCPUs()); expected != online {
+		c.add(VCPU, "", fmt.Sprint(expected), fmt.Sprint(online), "the domain doesn't have the vCPUs of the VMI")
+	}
+
+	t := c.dom.CPU.Topology
+	if t == nil {
+		c.add(VCPU, "", fmt.Sprintf("%d sockets, %d cores, %d threads", sockets, cores, threads), "no topology", "")
+		return
+	}
+
+	maxSockets := sockets
+	if n, found := layout.NestedInt64(c.vmi, "spec", "domain", "cpu", "maxSockets"); found && n > 0 {
+		maxSockets = n
+	}
+	if int64(t.Sockets) != maxSockets || int64(t.Cores) != cores || int64(t.Threads) != threads {
+		c.add(VCPU, "", fmt.Sprintf("%d sockets, %d cores, %d threads", maxSockets, cores, threads),
+			fmt.Sprintf("%d sockets, %d cores, %d threads", t.Sockets, t.Cores, t.Threads), "the CPU topology differs")
+	}
+}
+
+// compareMemory compares the guest memory and the huge pages of the VMI to the domain. The guest memory in the status
+// follows memory hotplug.
+func (c *comparison) compareMemory() {
+	var pageSize int64
+	if size, found, _ := unstructured.NestedString(c.vmi, "spec", "domain", "memory", "hugepages", "pageSize"); found {
+		q, err := resource.ParseQuantity(size)
+		if err != nil {
+			c.add(HugePages, "", size, "", fmt.Sprintf("can't parse the page size; %v", err))
+		} else {
+			pageSize = q.Value()
+		}
+	}
+	c.compareHugePages(pageSize)
+
+	expected, source := "", ""
+	for _, field := range [][]string{
+		{"status", "memory", "guestCurrent"},
+		{"spec", "domain", "memory", "guest"},
+		{"spec", "domain", "resources", "requests", "memory"},
+	} {
+		if value, found, _ := unstructured.NestedString(c.vmi, field...); found {
+			expected, source = value, strings.Join(field, ".")
+			break
+		}
+	}
+	if expected == "" {
+		return
+	}
+
+	q, err := resource.ParseQuantity(expected)
+	if err != nil {
+		c.add(Memory, "", expected, "", fmt.Sprintf("can't parse %s; %v", source, err))
+		return
+	}
+	actual, err := c.dom.GuestMemory()
+	if err != nil {
+		c.add(Memory, "", expected, "", fmt.Sprintf("can't read the domain memory; %v", err))
+		return
+	}
+
+	tolerance := max(pageSize, memoryAlignment)
+	if diff := q.Value() - int64(actual); diff >= tolerance || -diff >= tolerance {
+		c.add(Memory, "", expected, resource.NewQuantity(int64(actual), resource.BinarySI).String(),
+			fmt.Sprintf("the domain memory differs from %s", source))
+	}
+}
+
+func (c *comparison) compareHugePages(expected int64) {
+	var actual []string
+	matches := false
+	if mb := c.dom.MemoryBacking; mb != nil && mb.HugePages != nil {
+		if len(mb.HugePages.Pages) == 0 {
+			// hugepages without a page size use the default size of the host
+			actual = append(actual, "default size")
+			matches = expected != 0
+		}
+		for _, page := range mb.HugePages.Pages {
+			size, err := page.Bytes()
+			if err != nil {
+				actual = append(actual, fmt.Sprintf("%d %s", page.Size, page.Unit))
+				continue
+			}
+			actual = append(actual, resource.NewQuantity(int64(size), resource.BinarySI).String())
+			matches = matches || int64(size) == expected
+		}
+	}
+
+	switch {
+	case expected == 0 && len(actual) > 0:
+		c.add(HugePages, "", "none", strings.Join(actual, ", "), "the domain is backed by huge pages the VMI doesn't ask for")
+	case expected != 0 && len(actual) == 0:
+		c.add(HugePages, "", resource.NewQuantity(expected, resource.BinarySI).String(), "none",
+			"the domain is not backed by huge pages")
+	case expected != 0 && !matches:
+		c.add(HugePages, "", resource.NewQuantity(expected, resource.BinarySI).String(), strings.Join(actual, ", "),
+			"the huge page size differs")
+	}
+}
+
+// compareCPUModel compares the CPU model and the features of the VMI to the domain.
+func (c *comparison) compareCPUModel() {
+	model, _, _ := unstructured.NestedString(c.vmi, "spec", "domain", "cpu", "model")
+	cpu := c.dom.CPU
+
+	actual := cpu.Mode
+	if cpu.Model != nil && cpu.Model.Name != "" && cpu.Mode != "host-passthrough" {
+		actual = strings.TrimSpace(cpu.Model.Name)
+	}
+	switch model {
+	case "":
+		// the VMI was created before the model was defaulted
+	case "host-model", "host-passthrough":
+		if cpu.Mode != model {
+			c.add(CPUModel, "", model, actual, "the CPU mode differs")
+		}
+	default:
+		if (cpu.Mode != "" && cpu.Mode != "custom") || cpu.Model == nil || strings.TrimSpace(cpu.Model.Name) != model {
+			c.add(CPUModel, "", model, actual, "the CPU model differs")
+		}
+	}
+
+	policies := make(map[string]string, len(cpu.Features))
+	for _, f := range cpu.Features {
+		policies[f.Name] = f.Policy
+	}
+	for _, feature := range analysis.NestedMaps(c.vmi, "spec", "domain", "cpu", "features") {
+		name, _, _ := unstructured.NestedString(feature, "name")
+		policy, _, _ := unstructured.NestedString(feature, "policy")
+		if policy == "" {
+			policy = "require"
+		}
+		if actual, found := policies[name]; !found {
+			c.add(CPUModel, name, policy, "missing", "the CPU feature is not in the domain")
+		} else if actual != policy {
+			c.add(CPUModel, name, policy, actual, "the CPU feature policy differs")
+		}
+	}
+}
+
+// defaultBuses are the buses KubeVirt uses when the VMI doesn't set one
+var defaultBuses = map[string]string{"disk": "virtio", "cdrom": "sata", "lun": "scsi"}
+
+// compareDisks compares the disks of the VMI spec to the disks of the domain, by their alias, and the disks of the
+// domain to domblklist. A domain disk that is not in the spec is a hotplug leftover, unless its volume is still being
+// unplugged.
+func (c *comparison) compareDisks(blockList []libvirt.BlockDevice) {
+	domainDisks := make(map[string]libvirt.Disk)
+	for _, d := range c.dom.Devices.Disks {
+		name, ok := d.Alias.UserAlias()
+		if !ok {
+			name = d.Alias.Name
+		}
+		domainDisks[name] = d
+	}
+
+	volumePhases := make(map[string]string)
+	for _, status := range analysis.NestedMaps(c.vmi, "status", "volumeStatus") {
+		name, _, _ := unstructured.NestedString(status, "name")
+		if _, hotplug := status["hotplugVolume"]; hotplug {
+			phase, _, _ := unstructured.NestedString(status, "phase")
+			volumePhases[name] = phase
+		}
+	}
+
+	specDisks := make(map[string]bool)
+	for _, disk := range analysis.NestedMaps(c.vmi, "spec", "domain", "devices", "disks") {
+		name, _, _ := unstructured.NestedString(disk, "name")
+		specDisks[name] = true
+
+		device, bus := "disk", ""
+		for _, d := range []string{"disk", "cdrom", "lun"} {
+			if target, found, _ := unstructured.NestedMap(disk, d); found {
+				device = d
+				bus, _, _ = unstructured.NestedString(target, "bus")
+			}
+		}
+		if bus == "" {
+			bus = defaultBuses[device]
+		}
+
+		d, found := domainDisks[name]
+		switch {
+		case !found:
+			message := "the disk is not in the domain"
+			if phase, hotplug := volumePhases[name]; hotplug {
+				message = fmt.Sprintf("the hotplugged disk is not in the domain (volume phase %s)", phase)
+			}
+			c.add(Disk, name, device+" on "+bus, "missing", message)
+		case d.Device != "" && d.Device != device:
+			c.add(Disk, name, device, d.Device, "the device type differs")
+		case d.Target.Bus != bus:
+			c.add(Disk, name, bus, d.Target.Bus, "the bus differs")
+		}
+	}
+
+	for _, d := range c.dom.Devices.Disks {
+		name, ok := d.Alias.UserAlias()
+		if ok && specDisks[name] {
+			continue
+		}
+		if !ok {
+			name = d.Target.Dev
+		}
+		message := "the domain disk is not in the VMI spec; it may be a hotplug leftover"
+		if phase, hotplug := volumePhases[name]; hotplug {
+			message = fmt.Sprintf("the disk is being unplugged (volume phase %s)", phase)
+		}
+		c.add(Disk, name, "none", d.Target.Dev+" "+d.Source.Path(), message)
+	}
+
+	if blockList == nil {
+		return
+	}
+	listed := make(map[string]string, len(blockList))
+	for _, dev := range blockList {
+		listed[dev.Target] = dev.Source
+	}
+	for _, d := range c.dom.Devices.Disks {
+		if _, found := listed[d.Target.Dev]; !found {
+			c.add(Disk, d.Target.Dev, "in domblklist", "missing", "the disk of the domain XML is not in domblklist")
+		}
+		delete(listed, d.Target.Dev)
+	}
+	targets := make([]string, 0, len(listed))
+	for target := range listed {
+		targets = append(targets, target)
+	}
+	slices.Sort(targets)
+	for _, target := range targets {
+		c.add(Disk, target, "none", target+" "+listed[target], "the disk of domblklist is not in the domain XML")
+	}
+}
+
+// compareInterfaces compares the interfaces of the VMI spec and status to the interfaces of the domain, by their
+// alias. SR-IOV interfaces are host devices, with a ua-sriov-<name> alias.
+func (c *comparison) compareInterfaces() {
+	domainIfaces := make(map[string]libvirt.Interface)
+	for _, iface := range c.dom.Devices.Interfaces {
+		if name, ok := iface.Alias.UserAlias(); ok {
+			domainIfaces[name] = iface
+		}
+	}
+	hostDevs := make(map[string]bool)
+	for _, dev := range c.dom.Devices.HostDevs {
+		if name, ok := dev.Alias.UserAlias(); ok {
+			hostDevs[name] = true
+		}
+	}
+
+	statusMACs := make(map[string]string)
+	for _, status := range analysis.NestedMaps(c.vmi, "status", "interfaces") {
+		name, _, _ := unstructured.NestedString(status, "name")
+		mac, _, _ := unstructured.NestedString(status, "mac")
+		if name != "" && mac != "" {
+			statusMACs[name] = mac
+		}
+	}
+
+	specIfaces := make(map[string]bool)
+	for _, spec := range analysis.NestedMaps(c.vmi, "spec", "domain", "devices", "interfaces") {
+		name, _, _ := unstructured.NestedString(spec, "name")
+		specIfaces[name] = true
+
+		if _, sriov := spec["sriov"]; sriov {
+			if !hostDevs["sriov-"+name] {
+				c.add(Interface, name, "SR-IOV host device", "missing", "the SR-IOV interface is not in the domain")
+			}
+			continue
+		}
+
+		iface, found := domainIfaces[name]
+		if !found {
+			if state, _, _ := unstructured.NestedString(spec, "state"); state != "absent" {
+				c.add(Interface, name, "interface", "missing", "the interface is not in the domain")
+			}
+			continue
+		}
+		if state, _, _ := unstructured.NestedString(spec, "state"); state == "absent" {
+			c.add(Interface, name, "absent", iface.MAC.Address, "the interface was unplugged from the VMI, but is still in the domain")
+		}
+
+		if mac, _, _ := unstructured.NestedString(spec, "macAddress"); mac != "" && !sameMAC(mac, iface.MAC.Address) {
+			c.add(Interface, name, mac, iface.MAC.Address, "the MAC address differs from the VMI spec")
+		}
+		if mac, found := statusMACs[name]; found && !sameMAC(mac, iface.MAC.Address) {
+			c.add(Interface, name, mac, iface.MAC.Address, "the MAC address differs from the VMI status")
+		}
+
+		model, _, _ := unstructured.NestedString(spec, "model")
+		if model == "" {
+			model = "virtio"
+		}
+		// KubeVirt uses the virtio-non-transitional and virtio-transitional models for virtio
+		if iface.Model.Type != "" && !strings.HasPrefix(iface.Model.Type, model) {
+			c.add(Interface, name, model, iface.Model.Type, "the interface model differs")
+		}
+	}
+
+	for _, iface := range c.dom.Devices.Interfaces {
+		name, ok := iface.Alias.UserAlias()
+		if ok && specIfaces[name] {
+			continue
+		}
+		if !ok {
+			name = iface.Alias.Name
+		}
+		c.add(Interface, name, "none", iface.MAC.Address, "the domain interface is not in the VMI spec; it may be a hotplug leftover")
+	}
+}
+
+func sameMAC(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
+
+// WriteText prints the discrepancies of each VM as a table.
+func (r *Report) WriteText(w io.Writer) error {
+	t := analysis.NewTable(w)
+
+	if len(r.VMs) == 0 {
+		_, _ = fmt.Fprintln(t, "No VM details were collected.")
+		return t.Flush()
+	}
+
+	_, _ = fmt.Fprintln(t, "NAMESPACE\tVM\tAREA\tDEVICE\tEXPECTED\tACTUAL\tMESSAGE")
+	for _, vm := range r.VMs {
+		switch {
+		case vm.Skipped != "":
+			_, _ = fmt.Fprintf(t, "%s\t%s\t\t\t\t\tskipped: %s\n", vm.Namespace, vm.Name, vm.Skipped)
+		case len(vm.Discrepancies) == 0:
+			_, _ = fmt.Fprintf(t, "%s\t%s\t\t\t\t\tthe domain matches the VMI\n", vm.Namespace, vm.Name)
+		}
+		for _, d := range vm.Discrepancies {
+			_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", vm.Namespace, vm.Name, d.Area, d.Device, d.Expected, d.Actual, d.Message)
+		}
+	}
+
+	return t.Flush()
+}
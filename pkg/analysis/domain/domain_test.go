@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/analysis/analysistest"
+)
+
+func findVM(t *testing.T, report *Report, name string) VM {
+	t.Helper()
+
+	for _, vm := range report.VMs {
+		if vm.Name == name {
+			return vm
+		}
+	}
+	t.Fatalf("can't find VM %s in %+v", name, report.VMs)
+	return VM{}
+}
+
+func TestMatchingDomain(t *testing.T) {
+	vm := findVM(t, analysistest.Analyze(t, "testdata/must-gather", Analyze), "good")
+
+	if vm.Domain != "ns1_good" || vm.Skipped != "" {
+		t.Errorf("unexpected result: %+v", vm)
+	}
+	if len(vm.Discrepancies) != 0 {
+		t.Errorf("expected no discrepancy, but got %+v", vm.Discrepancies)
+	}
+}
+
+func TestDiscrepancies(t *testing.T) {
+	vm := findVM(t, analysistest.Analyze(t, "testdata/must-gather", Analyze), "drift")
+
+	expected := []struct {
+		area, device, message string
+	}{
+		{VCPU, "", "doesn't have the vCPUs"},
+		{VCPU, "", "topology differs"},
+		{HugePages, "", "page size differs"},
+		{Memory, "", "spec.domain.memory.guest"},
+		{CPUModel, "", "CPU model differs"},
+		{CPUModel, "pcid", "not in the domain"},
+		{Disk, "rootdisk", "bus differs"},
+		{Disk, "data", "volume phase AttachedToNode"},
+		{Disk, "old", "hotplug leftover"},
+		{Disk, "sdb", "not in domblklist"},
+		{Disk, "sdc", "not in the domain XML"},
+		{Interface, "default", "differs from the VMI status"},
+		{Interface, "default", "model differs"},
+		{Interface, "secondary", "still in the domain"},
+	}
+
+	if len(vm.Discrepancies) != len(expected) {
+		t.Fatalf("expected %d discrepancies, but got %+v", len(expected), vm.Discrepancies)
+	}
+	for i, e := range expected {
+		d := vm.Discrepancies[i]
+		if d.Area != e.area || d.Device != e.device || !strings.Contains(d.Message, e.message) {
+			t.Errorf("expected %s %q %q, but got %+v", e.area, e.device, e.message, d)
+		}
+	}
+}
+
+func TestSkipped(t *testing.T) {
+	vm := findVM(t, analysistest.Analyze(t, "testdata/must-gather", Analyze), "gone")
+
+	if !strings.Contains(vm.Skipped, "VMI was not collected") {
+		t.Errorf("expected the VM to be skipped, but got %+v", vm)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := analysistest.Analyze(t, "testdata/must-gather", Analyze).WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"the domain matches the VMI", "skipped: the VMI was not collected", "Skylake-Server"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in\n%s", expected, buf.String())
+		}
+	}
+}
@@ -0,0 +1,629 @@
+// Package hostdevices checks the readiness of the nodes for PCI passthrough and SR-IOV, from the lspci, /dev/vfio,
+// /proc/cmdline, sriov_numvfs and device plugin config files of gather_nodes: the IOMMU kernel arguments, the devices
+// bound to vfio-pci, and the VF counts the device plugin expects. It checks that the permitted host devices of the
+// KubeVirt or HyperConverged CR are advertised by some node, and lists the VMs requesting host devices or SR-IOV
+// networks that no node can satisfy.
+package hostdevices
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/nodedata"
+)
+
+// States of the IOMMU of a node.
+const (
+	IOMMUEnabled  = "enabled"
+	IOMMUDisabled = "disabled"
+	IOMMUUnknown  = "unknown"
+)
+
+// Kinds of permitted devices and of requests.
+const (
+	KindPCI      = "pci"
+	KindMediated = "mediated"
+	KindHostDev  = "hostDevice"
+	KindGPU      = "gpu"
+	KindSRIOV    = "sriov"
+)
+
+const (
+	vfioDriver          = "vfio-pci"
+	resourceNameAnno    = "k8s.v1.cni.cncf.io/resourceName"
+	vmKind              = "VirtualMachine"
+	vmiKind             = "VirtualMachineInstance"
+	notCollectedProblem = "none of the node files were collected"
+)
+
+// the kernel arguments that matter for passthrough
+var kernelArgs = []string{"intel_iommu", "amd_iommu", "iommu", "vfio-pci.ids", "vfio_iommu_type1.allow_unsafe_interrupts",
+	"pci", "default_hugepagesz", "hugepagesz", "hugepages"}
+
+// pfNamePattern is a pfNames selector of the device plugin with a VF range, e.g. ens1f0#0-7
+var pfNamePattern = regexp.MustCompile(`^(.+)#(\d+)-(\d+)$`)
+
+// PF is an SR-IOV physical function of a node.
+type PF struct {
+	Address     string `json:"address"`
+	Description string `json:"description,omitempty"`
+	NumVFs      int    `json:"numVFs"`
+	TotalVFs    int    `json:"totalVFs,omitempty"`
+}
+
+// Node is the passthrough readiness of a node.
+type Node struct {
+	Name  string `json:"name"`
+	IOMMU string `json:"iommu"`
+	// KernelArgs are the kernel arguments about the IOMMU, vfio-pci and hugepages, e.g. intel_iommu=on.
+	KernelArgs []string `json:"kernelArgs,omitempty"`
+	// VFIODevices are the devices bound to vfio-pci.
+	VFIODevices []nodedata.PCIDevice `json:"vfioDevices,omitempty"`
+	VFIOGroups  []string             `json:"vfioGroups,omitempty"`
+	PFs         []PF                 `json:"pfs,omitempty"`
+	// Resources are the allocatable counts of the host device and SR-IOV resources.
+	Resources map[string]int64 `json:"resources,omitempty"`
+	// DevicePluginResources are the resources of the SR-IOV device plugin config of the node.
+	DevicePluginResources []string `json:"devicePluginResources,omitempty"`
+	Problems              []string `json:"problems,omitempty"`
+}
+
+// PermittedDevice is a permitted host device of the KubeVirt or HyperConverged CR.
+type PermittedDevice struct {
+	Kind string `json:"kind"`
+	// Selector is the PCI vendor:device ID, or the mediated device name.
+	Selector                 string `json:"selector"`
+	ResourceName             string `json:"resourceName"`
+	ExternalResourceProvider bool   `json:"externalResourceProvider,omitempty"`
+	Disabled                 bool   `json:"disabled,omitempty"`
+	// Nodes advertise the resource.
+	Nodes    []string `json:"nodes"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Request is a host device, GPU or SR-IOV network of a VM, grouped by resource.
+type Request struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	// Devices are the names of the devices or networks in the VM spec.
+	Devices  []string `json:"devices"`
+	Resource string   `json:"resource,omitempty"`
+	Count    int      `json:"count"`
+	// Nodes have enough of the resource for the VM.
+	Nodes    []string `json:"nodes"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Report is the result of the host device check.
+type Report struct {
+	Nodes []Node `json:"nodes"`
+	// PermittedFrom is the CR the permitted host devices were read from.
+	PermittedFrom    string            `json:"permittedFrom,omitempty"`
+	PermittedDevices []PermittedDevice `json:"permittedDevices"`
+	Requests         []Request         `json:"requests"`
+}
+
+// Analyze checks the nodes, the permitted host devices and the requests of the VMs.
+func Analyze(b *layout.Bundle) (*Report, error) {
+	report := &Report{Nodes: []Node{}, PermittedDevices: []PermittedDevice{}, Requests: []Request{}}
+
+	var err error
+	if report.PermittedFrom, report.PermittedDevices, err = permittedDevices(b); err != nil {
+		return nil, err
+	}
+
+	nads, err := b.Objects(layout.NetworkAttachmentDefinitions)
+	if err != nil {
+		return nil, err
+	}
+	sriovResources := make(map[string]string)
+	for _, nad := range nads {
+		if name := nad.GetAnnotations()[resourceNameAnno]; name != "" {
+			sriovResources[nad.GetNamespace()+"/"+nad.GetName()] = name
+		}
+	}
+
+	// the resources worth reporting on the nodes
+	relevant := make(map[string]bool)
+	for _, d := range report.PermittedDevices {
+		relevant[d.ResourceName] = true
+	}
+	for _, name := range sriovResources {
+		relevant[name] = true
+	}
+
+	nodeObjects, err := b.Objects(layout.Nodes)
+	if err != nil {
+		return nil, err
+	}
+	allocatable := make(map[string]map[string]int64)
+	for _, node := range nodeObjects {
+		allocatable[node.GetName()] = readAllocatable(node)
+	}
+
+	nodeDirs, err := b.Nodes()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, name := range nodeDirs {
+		names[name] = true
+	}
+	for name := range allocatable {
+		names[name] = true
+	}
+
+	devices := make(map[string][]nodedata.PCIDevice)
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		node, pciDevices, err := readNode(b, name, allocatable[name])
+		if err != nil {
+			return nil, err
+		}
+		devices[name] = pciDevices
+		for _, r := range node.DevicePluginResources {
+			relevant[r] = true
+		}
+		report.Nodes = append(report.Nodes, node)
+	}
+
+	for i := range report.Nodes {
+		n := &report.Nodes[i]
+		for r, count := range allocatable[n.Name] {
+			if relevant[r] {
+				if n.Resources == nil {
+					n.Resources = make(map[string]int64)
+				}
+				n.Resources[r] = count
+			}
+		}
+	}
+
+	for i := range report.PermittedDevices {
+		report.PermittedDevices[i].check(allocatable, devices)
+	}
+
+	if report.Requests, err = collectRequests(b, sriovResources); err != nil {
+		return nil, err
+	}
+	for i := range report.Requests {
+		report.Requests[i].check(report.PermittedFrom, report.PermittedDevices, allocatable)
+	}
+
+	return report, nil
+}
+
+// permittedDevices reads spec.configuration.permittedHostDevices of the KubeVirt CR, or, when it is not set,
+// spec.permittedHostDevices of the HyperConverged CR
+func permittedDevices(b *layout.Bundle) (string, []PermittedDevice, error) {
+	config, err := analysis.KubeVirtConfig(b)
+	if err != nil {
+		return "", nil, err
+	}
+	if permitted, found, _ := unstructured.NestedMap(config, "permittedHostDevices"); found {
+		return "KubeVirt", readPermitted(permitted), nil
+	}
+
+	hco, found, err := analysis.HyperConverged(b)
+	if err != nil {
+		return "", nil, err
+	}
+	if found {
+		if permitted, found, _ := unstructured.NestedMap(hco.Object, "spec", "permittedHostDevices"); found {
+			return "HyperConverged", readPermitted(permitted), nil
+		}
+	}
+
+	return "", []PermittedDevice{}, nil
+}
+
+func readPermitted(permitted map[string]any) []PermittedDevice {
+	devices := []PermittedDevice{}
+	for _, kind := range []struct{ name, list, selector string }{
+		{KindPCI, "pciHostDevices", "pciDeviceSelector"},
+		{KindMediated, "mediatedDevices", "mdevNameSelector"},
+	} {
+		for _, d := range analysis.NestedMaps(permitted, kind.list) {
+			p := PermittedDevice{Kind: kind.name, Nodes: []string{}}
+			p.Selector, _, _ = unstructured.NestedString(d, kind.selector)
+			p.ResourceName, _, _ = unstructured.NestedString(d, "resourceName")
+			p.ExternalResourceProvider, _, _ = unstructured.NestedBool(d, "externalResourceProvider")
+			p.Disabled, _, _ = unstructured.NestedBool(d, "disabled")
+			devices = append(devices, p)
+		}
+	}
+	return devices
+}
+
+// readAllocatable reads the extended resources of status.allocatable of a node
+func readAllocatable(node layout.Object) map[string]int64 {
+	allocatable, _, _ := unstructured.NestedStringMap(node.Object, "status", "allocatable")
+
+	counts := make(map[string]int64)
+	for name, value := range allocatable {
+		if !strings.Contains(name, "/") {
+			continue
+		}
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			continue
+		}
+		counts[name] = q.Value()
+	}
+	return counts
+}
+
+// readNode reads the node files of gather_nodes, and checks them
+func readNode(b *layout.Bundle, name string, allocatable map[string]int64) (Node, []nodedata.PCIDevice, error) {
+	node := Node{Name: name, IOMMU: IOMMUUnknown}
+	collected := false
+
+	read := func(file layout.NodeFile) ([]byte, bool, error) {
+		data, err := b.ReadNodeFile(name, file)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, false, nil
+		} else if err != nil {
+			return nil, false, err
+		}
+		collected = true
+		return data, len(strings.TrimSpace(string(data))) > 0, nil
+	}
+
+	var args nodedata.KernelArgs
+	data, found, err := read(layout.NodeProcCmdline)
+	if err != nil {
+		return node, nil, err
+	}
+	if found {
+		args = nodedata.ParseCmdline(data)
+		for _, arg := range kernelArgs {
+			if value, set := args[arg]; set {
+				node.KernelArgs = append(node.KernelArgs, strings.TrimSuffix(arg+"="+value, "="))
+			}
+		}
+	}
+
+	var devices []nodedata.PCIDevice
+	if data, found, err = read(layout.NodeLspci); err != nil {
+		return node, nil, err
+	} else if found {
+		if devices, err = nodedata.ParseLspci(data); err != nil {
+			node.Problems = append(node.Problems, fmt.Sprintf("can't parse lspci; %v", err))
+		}
+	}
+	iommuGroups := false
+	byAddress := make(map[string]nodedata.PCIDevice)
+	for _, d := range devices {
+		byAddress[d.Slot] = d
+		iommuGroups = iommuGroups || d.IOMMUGroup != ""
+		if d.Driver == vfioDriver {
+			node.VFIODevices = append(node.VFIODevices, d)
+		}
+	}
+
+	var vfio *nodedata.VFIO
+	if data, found, err = read(layout.NodeDevVFIO); err != nil {
+		return node, nil, err
+	} else if found {
+		v, err := nodedata.ParseDevVFIO(data)
+		if err != nil {
+			return node, nil, err
+		}
+		vfio, node.VFIOGroups = &v, v.Groups
+	}
+
+	var numVFs, totalVFs map[string]int
+	if data, found, err = read(layout.NodeSRIOVNumVFs); err != nil {
+		return node, nil, err
+	} else if found {
+		if numVFs, err = nodedata.ParseSRIOVVFs(data); err != nil {
+			node.Problems = append(node.Problems, err.Error())
+		}
+	}
+	if data, found, err = read(layout.NodeSRIOVTotalVFs); err != nil {
+		return node, nil, err
+	} else if found {
+		if totalVFs, err = nodedata.ParseSRIOVVFs(data); err != nil {
+			node.Problems = append(node.Problems, err.Error())
+		}
+	}
+	for _, address := range slices.Sorted(maps.Keys(numVFs)) {
+		pf := PF{Address: address, Description: byAddress[address].Description, NumVFs: numVFs[address], TotalVFs: totalVFs[address]}
+		node.PFs = append(node.PFs, pf)
+		if total, known := totalVFs[address]; known && pf.NumVFs > total {
+			node.Problems = append(node.Problems, fmt.Sprintf("PF %s has %d VFs, more than its %d supported", address, pf.NumVFs, total))
+		}
+	}
+
+	var config *nodedata.PCIDPConfig
+	if data, found, err = read(layout.NodePCIDPConfig); err != nil {
+		return node, nil, err
+	} else if found {
+		if config, err = nodedata.ParsePCIDPConfig(data); err != nil {
+			node.Problems = append(node.Problems, err.Error())
+		}
+	}
+
+	if !collected {
+		node.Problems = append(node.Problems, notCollectedProblem)
+		return node, devices, nil
+	}
+
+	switch {
+	case args.IOMMUEnabled() || iommuGroups || len(node.VFIOGroups) > 0:
+		node.IOMMU = IOMMUEnabled
+	case args != nil:
+		node.IOMMU = IOMMUDisabled
+	}
+	usesIOMMU := len(node.VFIODevices) > 0 || slices.ContainsFunc(node.PFs, func(pf PF) bool { return pf.NumVFs > 0 }) ||
+		(config != nil && len(config.ResourceList) > 0)
+	if node.IOMMU == IOMMUDisabled && usesIOMMU {
+		node.Problems = append(node.Problems, "the node has passthrough devices, but the IOMMU is off: intel_iommu=on or "+
+			"amd_iommu=on is missing from the kernel arguments")
+	}
+
+	if vfio != nil {
+		if !vfio.Container && len(node.VFIODevices) > 0 {
+			node.Problems = append(node.Problems, "/dev/vfio/vfio doesn't exist")
+		}
+		for _, d := range node.VFIODevices {
+			if d.IOMMUGroup != "" && !slices.Contains(vfio.Groups, d.IOMMUGroup) {
+				node.Problems = append(node.Problems, fmt.Sprintf("%s is bound to vfio-pci, but /dev/vfio/%s doesn't exist",
+					d.Slot, d.IOMMUGroup))
+			}
+		}
+	}
+
+	if config != nil {
+		for _, r := range config.ResourceList {
+			node.DevicePluginResources = append(node.DevicePluginResources, r.FullName())
+			node.Problems = append(node.Problems, checkPool(r, numVFs, allocatable)...)
+		}
+	}
+
+	return node, devices, nil
+}
+
+// checkPool checks the VFs a resource pool of the device plugin selects, and that the node advertises it
+func checkPool(r nodedata.PCIDPResource, numVFs map[string]int, allocatable map[string]int64) []string {
+	var problems []string
+
+	maxVFs := 0
+	for _, count := range numVFs {
+		maxVFs = max(maxVFs, count)
+	}
+
+	for _, s := range r.Selectors {
+		for _, root := range s.RootDevices {
+			root = nodedata.NormalizePCIAddress(root)
+			if count, found := numVFs[root]; numVFs != nil && (!found || count == 0) {
+				problems = append(problems, fmt.Sprintf("%s selects the VFs of %s, which has none", r.FullName(), root))
+			}
+		}
+		for _, pfName := range s.PfNames {
+			m := pfNamePattern.FindStringSubmatch(pfName)
+			if m == nil || numVFs == nil {
+				continue
+			}
+			last, _ := strconv.Atoi(m[3])
+			if last >= maxVFs {
+				problems = append(problems, fmt.Sprintf("%s selects VF %d of %s, but no PF has more than %d VFs",
+					r.FullName(), last, m[1], maxVFs))
+			}
+		}
+	}
+
+	if allocatable != nil && allocatable[r.FullName()] == 0 {
+		problems = append(problems, fmt.Sprintf("the node doesn't advertise %s of its device plugin config", r.FullName()))
+	}
+
+	return problems
+}
+
+// check finds the nodes that advertise a permitted device, and the devices that are not bound to vfio-pci while
+// KubeVirt is their device plugin
+func (p *PermittedDevice) check(allocatable map[string]map[string]int64, devices map[string][]nodedata.PCIDevice) {
+	if p.Disabled {
+		return
+	}
+	for _, node := range slices.Sorted(maps.Keys(allocatable)) {
+		if allocatable[node][p.ResourceName] > 0 {
+			p.Nodes = append(p.Nodes, node)
+		}
+	}
+	if len(p.Nodes) == 0 {
+		p.Problems = append(p.Problems, fmt.Sprintf("no node advertises %s", p.ResourceName))
+	}
+
+	if p.Kind != KindPCI || p.ExternalResourceProvider {
+		return
+	}
+	selector := strings.ToLower(p.Selector)
+	for _, node := range slices.Sorted(maps.Keys(devices)) {
+		for _, d := range devices[node] {
+			if d.ID() == selector && d.Driver != vfioDriver {
+				driver := d.Driver
+				if driver == "" {
+					driver = "no driver"
+				}
+				p.Problems = append(p.Problems, fmt.Sprintf("%s on %s is bound to %s, not vfio-pci", d.Slot, node, driver))
+			}
+		}
+	}
+}
+
+// collectRequests reads the host devices, GPUs and SR-IOV interfaces of the VMs, and of the VMIs without a VM
+func collectRequests(b *layout.Bundle, sriovResources map[string]string) ([]Request, error) {
+	vms, err := b.VirtualMachines()
+	if err != nil {
+		return nil, err
+	}
+	vmis, err := b.VirtualMachineInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	requests := []Request{}
+	hasVM := make(map[string]bool)
+	for _, vm := range vms {
+		hasVM[vm.GetNamespace()+"/"+vm.GetName()] = true
+		spec, _, _ := unstructured.NestedMap(vm.Object, "spec", "template", "spec")
+		requests = append(requests, specRequests(vmKind, vm, spec, sriovResources)...)
+	}
+	for _, vmi := range vmis {
+		if hasVM[vmi.GetNamespace()+"/"+vmi.GetName()] {
+			continue
+		}
+		spec, _, _ := unstructured.NestedMap(vmi.Object, "spec")
+		requests = append(requests, specRequests(vmiKind, vmi, spec, sriovResources)...)
+	}
+
+	return requests, nil
+}
+
+func specRequests(kind string, obj layout.Object, spec map[string]any, sriovResources map[string]string) []Request {
+	var requests []Request
+	add := func(typ, device, resourceName string) {
+		for i := range requests {
+			if r := &requests[i]; r.Type == typ && r.Resource == resourceName && resourceName != "" {
+				r.Devices = append(r.Devices, device)
+				r.Count++
+				return
+			}
+		}
+		requests = append(requests, Request{
+			Kind: kind, Namespace: obj.GetNamespace(), Name: obj.GetName(), Type: typ, Devices: []string{device},
+			Resource: resourceName, Count: 1, Nodes: []string{},
+		})
+	}
+
+	for _, list := range []struct{ typ, field string }{{KindHostDev, "hostDevices"}, {KindGPU, "gpus"}} {
+		for _, d := range analysis.NestedMaps(spec, "domain", "devices", list.field) {
+			name, _, _ := unstructured.NestedString(d, "name")
+			deviceName, _, _ := unstructured.NestedString(d, "deviceName")
+			add(list.typ, name, deviceName)
+		}
+	}
+
+	networks := make(map[string]string)
+	for _, n := range analysis.NestedMaps(spec, "networks") {
+		name, _, _ := unstructured.NestedString(n, "name")
+		nad, _, _ := unstructured.NestedString(n, "multus", "networkName")
+		if nad != "" && !strings.Contains(nad, "/") {
+			nad = obj.GetNamespace() + "/" + nad
+		}
+		networks[name] = nad
+	}
+	for _, iface := range analysis.NestedMaps(spec, "domain", "devices", "interfaces") {
+		if _, sriov, _ := unstructured.NestedMap(iface, "sriov"); !sriov {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(iface, "name")
+		nad := networks[name]
+		resourceName := sriovResources[nad]
+		add(KindSRIOV, name, resourceName)
+		if resourceName == "" {
+			r := &requests[len(requests)-1]
+			if nad == "" {
+				r.Problems = append(r.Problems, fmt.Sprintf("interface %s has no multus network", name))
+			} else {
+				r.Problems = append(r.Problems, fmt.Sprintf("network attachment %s was not collected, or has no %s annotation",
+					nad, resourceNameAnno))
+			}
+		}
+	}
+
+	return requests
+}
+
+// check finds the nodes that have enough of the requested resource
+func (r *Request) check(permittedFrom string, permitted []PermittedDevice, allocatable map[string]map[string]int64) {
+	if r.Resource == "" {
+		return
+	}
+
+	if r.Type != KindSRIOV {
+		i := slices.IndexFunc(permitted, func(p PermittedDevice) bool { return p.ResourceName == r.Resource })
+		switch {
+		case permittedFrom == "":
+			r.Problems = append(r.Problems, "no host device is permitted")
+		case i < 0:
+			r.Problems = append(r.Problems, fmt.Sprintf("%s is not a permitted host device of the %s CR", r.Resource, permittedFrom))
+		case permitted[i].Disabled:
+			r.Problems = append(r.Problems, fmt.Sprintf("%s is disabled in the %s CR", r.Resource, permittedFrom))
+		}
+	}
+
+	most := int64(0)
+	for _, node := range slices.Sorted(maps.Keys(allocatable)) {
+		count := allocatable[node][r.Resource]
+		most = max(most, count)
+		if count >= int64(r.Count) {
+			r.Nodes = append(r.Nodes, node)
+		}
+	}
+	switch {
+	case len(r.Nodes) > 0:
+	case most == 0:
+		r.Problems = append(r.Problems, fmt.Sprintf("no node advertises %s", r.Resource))
+	default:
+		r.Problems = append(r.Problems, fmt.Sprintf("the VM needs %d %s, but no node has more than %d", r.Count, r.Resource, most))
+	}
+}
+
+// WriteText prints the nodes, the permitted devices and the requests as tables.
+func (r *Report) WriteText(w io.Writer) error {
+	t := analysis.NewTable(w)
+
+	_, _ = fmt.Fprintln(t, "NODE\tIOMMU\tKERNEL ARGS\tVFIO DEVICES\tPFS\tRESOURCES\tPROBLEMS")
+	for _, n := range r.Nodes {
+		var vfio, pfs, resources []string
+		for _, d := range n.VFIODevices {
+			vfio = append(vfio, d.Slot)
+		}
+		for _, pf := range n.PFs {
+			pfs = append(pfs, fmt.Sprintf("%s (%d/%d VFs)", pf.Address, pf.NumVFs, pf.TotalVFs))
+		}
+		for _, name := range slices.Sorted(maps.Keys(n.Resources)) {
+			resources = append(resources, fmt.Sprintf("%s=%d", name, n.Resources[name]))
+		}
+		_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", n.Name, n.IOMMU, strings.Join(n.KernelArgs, " "),
+			strings.Join(vfio, ", "), strings.Join(pfs, ", "), strings.Join(resources, ", "), strings.Join(n.Problems, "; "))
+	}
+
+	_, _ = fmt.Fprintln(t)
+	if len(r.PermittedDevices) == 0 {
+		_, _ = fmt.Fprintln(t, "No permitted host devices.")
+	} else {
+		_, _ = fmt.Fprintf(t, "Permitted host devices of the %s CR:\n", r.PermittedFrom)
+		_, _ = fmt.Fprintln(t, "KIND\tSELECTOR\tRESOURCE\tEXTERNAL\tDISABLED\tNODES\tPROBLEMS")
+		for _, p := range r.PermittedDevices {
+			_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%t\t%t\t%s\t%s\n", p.Kind, p.Selector, p.ResourceName, p.ExternalResourceProvider,
+				p.Disabled, strings.Join(p.Nodes, ", "), strings.Join(p.Problems, "; "))
+		}
+	}
+
+	if len(r.Requests) > 0 {
+		_, _ = fmt.Fprintln(t)
+		_, _ = fmt.Fprintln(t, "NAMESPACE\tNAME\tTYPE\tDEVICES\tRESOURCE\tCOUNT\tNODES\tPROBLEMS")
+		for _, q := range r.Requests {
+			_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", q.Namespace, q.Name, q.Type, strings.Join(q.Devices, ", "),
+				q.Resource, q.Count, strings.Join(q.Nodes, ", "), strings.Join(q.Problems, "; "))
+		}
+	}
+
+	return t.Flush()
+}
@@ -0,0 +1,109 @@
+package hostdevices
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/analysis/analysistest"
+)
+
+func TestNodes(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	if len(report.Nodes) != 3 {
+		t.Fatalf("expected 3 nodes, but got %+v", report.Nodes)
+	}
+
+	n := report.Nodes[0]
+	if n.IOMMU != IOMMUEnabled || strings.Join(n.KernelArgs, " ") != "intel_iommu=on iommu=pt" || len(n.Problems) != 0 {
+		t.Errorf("unexpected node01: %+v", n)
+	}
+	if len(n.VFIODevices) != 1 || n.VFIODevices[0].Slot != "0000:5e:00.0" || strings.Join(n.VFIOGroups, ",") != "75" {
+		t.Errorf("unexpected vfio devices of node01: %+v", n)
+	}
+	if len(n.PFs) != 2 || n.PFs[0].NumVFs != 4 || n.PFs[0].TotalVFs != 64 || n.Resources["openshift.io/xxv710_vfs"] != 4 {
+		t.Errorf("unexpected PFs or resources of node01: %+v", n)
+	}
+	if _, found := n.Resources["devices.kubevirt.io/kvm"]; found {
+		t.Errorf("expected only the host device resources, but got %v", n.Resources)
+	}
+
+	if n := report.Nodes[1]; n.IOMMU != IOMMUDisabled || len(n.Problems) != 1 || !strings.Contains(n.Problems[0], "the IOMMU is off") {
+		t.Errorf("unexpected node02: %+v", n)
+	}
+	if n := report.Nodes[2]; n.IOMMU != IOMMUUnknown || strings.Join(n.Problems, "") != notCollectedProblem {
+		t.Errorf("unexpected node03: %+v", n)
+	}
+}
+
+func TestPermittedDevices(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	if report.PermittedFrom != "HyperConverged" || len(report.PermittedDevices) != 3 {
+		t.Fatalf("unexpected permitted devices from %s: %+v", report.PermittedFrom, report.PermittedDevices)
+	}
+
+	if p := report.PermittedDevices[0]; strings.Join(p.Nodes, ",") != "node01" || len(p.Problems) != 1 ||
+		p.Problems[0] != "0000:5e:00.0 on node02 is bound to nouveau, not vfio-pci" {
+		t.Errorf("unexpected T4: %+v", p)
+	}
+	if p := report.PermittedDevices[1]; len(p.Nodes) != 0 || strings.Join(p.Problems, "") != "no node advertises nvidia.com/GA102GL_A10" {
+		t.Errorf("unexpected A10: %+v", p)
+	}
+	if p := report.PermittedDevices[2]; p.Kind != KindMediated || !p.Disabled || len(p.Problems) != 0 {
+		t.Errorf("unexpected vGPU: %+v", p)
+	}
+}
+
+func TestRequests(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	expected := map[string]string{
+		"a10/nvidia.com/GA102GL_A10":           "no node advertises",
+		"gpu-vm/nvidia.com/TU104GL_Tesla_T4":   "",
+		"sriov-vm/openshift.io/xxv710_vfs":     "",
+		"sriov-vm/openshift.io/mlx_vfs":        "no node advertises",
+		"sriov-vm/":                            "ns1/absent was not collected",
+		"two-gpus/nvidia.com/TU104GL_Tesla_T4": "needs 2",
+		"vgpu/nvidia.com/GRID_T4-1Q":           "is disabled",
+		"lone/example.com/unknown":             "not a permitted host device",
+	}
+	if len(report.Requests) != len(expected) {
+		t.Fatalf("expected %d requests, but got %+v", len(expected), report.Requests)
+	}
+	for _, r := range report.Requests {
+		problems := strings.Join(r.Problems, "; ")
+		e, found := expected[r.Name+"/"+r.Resource]
+		if !found || (e == "" && problems != "") || !strings.Contains(problems, e) {
+			t.Errorf("expected %q for %s/%s, but got %q", e, r.Name, r.Resource, problems)
+		}
+	}
+
+	if r := report.Requests[0]; r.Name != "a10" || r.Kind != vmKind {
+		t.Errorf("expected the requests of the VMs first, but got %+v", r)
+	}
+	if r := report.Requests[len(report.Requests)-1]; r.Name != "lone" || r.Kind != vmiKind || r.Type != KindHostDev {
+		t.Errorf("expected the VMI without a VM last, but got %+v", r)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	var out bytes.Buffer
+	if err := report.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"0000:3b:00.0 (4/64 VFs)",
+		"Permitted host devices of the HyperConverged CR:",
+		"nvidia.com/TU104GL_Tesla_T4=1",
+		"gpu1, gpu2",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, out.String())
+		}
+	}
+}
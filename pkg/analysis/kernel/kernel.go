@@ -0,0 +1,345 @@
+// Package kernel scans the dmesg of each node for virtualization faults: KVM errors, DMAR and AMD-Vi faults, vfio-pci
+// resets, hugepage allocation failures, OOM kills and lockups. The OOM kills are mapped to their VMI through the pod of
+// their memory cgroup, and the IOMMU faults and vfio-pci resets through the host devices of the domain XMLs.
+package kernel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/libvirt"
+	"github.com/kubevirt/must-gather/pkg/nodedata"
+)
+
+// Severities of the signatures.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Categories of the signatures.
+const (
+	CategoryKVM       = "kvm"
+	CategoryIOMMU     = "iommu"
+	CategoryVFIO      = "vfio"
+	CategoryHugepages = "hugepages"
+	CategoryOOM       = "oom"
+	CategoryLockup    = "lockup"
+)
+
+// Signature is a kernel message the check looks for. The device, process and pid named groups of its pattern tell
+// what the message is about.
+type Signature struct {
+	Name     string
+	Category string
+	Severity string
+	Pattern  *regexp.Regexp
+}
+
+const pciAddress = `(?:[0-9a-f]{4}:)?[0-9a-f]{2}:[0-9a-f]{2}\.[0-7]`
+
+// Signatures is the catalogue of kernel messages. The first signature that matches a message wins.
+var Signatures = []Signature{
+	{"kvm-entry-failed", CategoryKVM, SeverityError,
+		regexp.MustCompile(`KVM: entry failed, hardware error 0x[0-9a-f]+`)},
+	{"kvm-disabled", CategoryKVM, SeverityError,
+		regexp.MustCompile(`kvm: (?:disabled by bios|no hardware support)|kvm_(?:intel|amd): (?:VMX|SVM) not supported`)},
+	{"kvm-unhandled-msr", CategoryKVM, SeverityWarning,
+		regexp.MustCompile(`(?i)kvm \[(?P<pid>\d+)\]: vcpu\d+,? .*unhandled (?:rd|wr)msr`)},
+	{"dmar-fault", CategoryIOMMU, SeverityError,
+		regexp.MustCompile(`DMAR: \[DMA (?:Read|Write)[^\]]*\] Request device \[(?P<device>` + pciAddress + `)\]`)},
+	{"amd-vi-fault", CategoryIOMMU, SeverityError,
+		regexp.MustCompile(`(?:\S+ (?P<device>` + pciAddress + `): )?AMD-Vi: Event logged \[IO_PAGE_FAULT(?: device=(?P<device>` + pciAddress + `))?`)},
+	{"vfio-reset-failed", CategoryVFIO, SeverityError,
+		regexp.MustCompile(`vfio-pci (?P<device>` + pciAddress + `): .*(?:not ready \d+ms after|timed out waiting for pending transaction|Refused to change power state|can't reserve)`)},
+	{"vfio-reset", CategoryVFIO, SeverityWarning,
+		regexp.MustCompile(`vfio-pci (?P<device>` + pciAddress + `): .*(?:reset|FLR)`)},
+	{"hugepages-allocation-failed", CategoryHugepages, SeverityError,
+		regexp.MustCompile(`HugeTLB: allocating \d+ of page size \S+ \S+ failed|(?i)hugetlb.*(?:failed|unable) to allocate`)},
+	{"oom-kill", CategoryOOM, SeverityError,
+		regexp.MustCompile(`(?:Memory cgroup out of memory|Out of memory)(?: \(oom_kill_allocating_task\))?: Killed process (?P<pid>\d+) \((?P<process>[^)]+)\)`)},
+	{"soft-lockup", CategoryLockup, SeverityError,
+		regexp.MustCompile(`BUG: soft lockup - CPU#\d+ stuck for \d+s! \[(?P<process>[^\]]+):(?P<pid>\d+)\]`)},
+	{"hard-lockup", CategoryLockup, SeverityError,
+		regexp.MustCompile(`Watchdog detected hard LOCKUP on cpu \d+`)},
+	{"rcu-stall", CategoryLockup, SeverityWarning,
+		regexp.MustCompile(`rcu: INFO: rcu_\w+ (?:self-)?detected stalls?`)},
+	{"hung-task", CategoryLockup, SeverityWarning,
+		regexp.MustCompile(`INFO: task (?P<process>.+):(?P<pid>\d+) blocked for more than \d+ seconds`)},
+}
+
+var (
+	// the fields of the oom-kill line that precedes the kill, e.g. task_memcg=/kubepods.slice/...,task=qemu-kvm,pid=48213
+	oomKillPattern = regexp.MustCompile(`oom-kill:.*\btask_memcg=([^,]+),task=([^,]+),pid=(\d+)`)
+	// the cgroup of older kernels: "Task in /kubepods/burstable/pod<uid>/<container> killed as a result of limit of ..."
+	oomTaskPattern = regexp.MustCompile(`Task in (\S+) killed as a result of limit`)
+)
+
+// Finding is a signature that matched one or more messages of a node, about the same device or process.
+type Finding struct {
+	Node      string `json:"node"`
+	Signature string `json:"signature"`
+	Category  string `json:"category"`
+	Severity  string `json:"severity"`
+	// Subject is the PCI device, or the process and its PID, the messages are about.
+	Subject string `json:"subject,omitempty"`
+	Count   int    `json:"count"`
+	// First and Last are the timestamps of the first and the last message.
+	First   string `json:"first,omitempty"`
+	Last    string `json:"last,omitempty"`
+	Message string `json:"message"`
+	// Cgroup is the memory cgroup of an OOM killed process.
+	Cgroup    string `json:"cgroup,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	VM        string `json:"vm,omitempty"`
+}
+
+// Node is the findings of a node.
+type Node struct {
+	Name string `json:"name"`
+	// Collected tells whether the dmesg of the node was collected.
+	Collected bool `json:"collected"`
+	Messages  int  `json:"messages"`
+	// Skipped is the number of lines too long to be a message.
+	Skipped  int       `json:"skipped,omitempty"`
+	Findings []Finding `json:"findings"`
+}
+
+// VM is the findings mapped to a VMI.
+type VM struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Findings  []Finding `json:"findings"`
+}
+
+// Report is the result of the kernel check.
+type Report struct {
+	Nodes []Node `json:"nodes"`
+	VMs   []VM   `json:"vms"`
+}
+
+// owners maps pod UIDs and host devices to VMIs
+type owners struct {
+	// pods are the VMI namespace/name by launcher pod UID
+	pods map[string]layout.VMRef
+	// devices are the VMI namespace/name by node and PCI address
+	devices map[string]map[string]layout.VMRef
+}
+
+// Analyze scans the dmesg of each node.
+func Analyze(b *layout.Bundle) (*Report, error) {
+	report := &Report{Nodes: []Node{}, VMs: []VM{}}
+
+	o, err := readOwners(b)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := b.Nodes()
+	if err != nil {
+		return nil, err
+	}
+
+	byVM := make(map[layout.VMRef][]Finding)
+	for _, name := range nodes {
+		data, err := b.ReadNodeFile(name, layout.NodeDmesg)
+		if errors.Is(err, fs.ErrNotExist) {
+			report.Nodes = append(report.Nodes, Node{Name: name, Findings: []Finding{}})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		messages, skipped := nodedata.ParseDmesg(data)
+		node := Node{Name: name, Collected: true, Messages: len(messages), Skipped: skipped, Findings: scan(name, messages, o)}
+		for _, f := range node.Findings {
+			if f.VM != "" {
+				ref := layout.VMRef{Namespace: f.Namespace, Name: f.VM}
+				byVM[ref] = append(byVM[ref], f)
+			}
+		}
+		report.Nodes = append(report.Nodes, node)
+	}
+
+	refs := slices.SortedFunc(maps.Keys(byVM), func(a, b layout.VMRef) int { return strings.Compare(a.String(), b.String()) })
+	for _, ref := range refs {
+		report.VMs = append(report.VMs, VM{Namespace: ref.Namespace, Name: ref.Name, Findings: byVM[ref]})
+	}
+
+	return report, nil
+}
+
+// readOwners reads the launcher pods and the active pods of the VMIs, and the host devices of their domain XMLs
+func readOwners(b *layout.Bundle) (*owners, error) {
+	o := &owners{devices: make(map[string]map[string]layout.VMRef)}
+
+	var err error
+	if o.pods, err = analysis.VMIsByPodUID(b); err != nil {
+		return nil, err
+	}
+
+	vmis, err := b.VirtualMachineInstances()
+	if err != nil {
+		return nil, err
+	}
+	for _, vmi := range vmis {
+		ref := layout.VMRef{Namespace: vmi.GetNamespace(), Name: vmi.GetName()}
+		node, _, _ := unstructured.NestedString(vmi.Object, "status", "nodeName")
+		if node == "" {
+			continue
+		}
+		data, err := b.ReadVMArtifact(ref.Namespace, ref.Name, layout.DomainXML)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		domain, err := libvirt.ParseDomain(data)
+		if err != nil {
+			continue
+		}
+		for _, hostDev := range domain.Devices.HostDevs {
+			if hostDev.Source.Address == nil {
+				continue
+			}
+			if address := hostDev.Source.Address.String(); address != "" {
+				if o.devices[node] == nil {
+					o.devices[node] = make(map[string]layout.VMRef)
+				}
+				o.devices[node][address] = ref
+			}
+		}
+	}
+
+	return o, nil
+}
+
+// scan matches the messages of a node with the signatures, and groups the matches by signature and subject
+func scan(node string, messages []nodedata.KernelMessage, o *owners) []Finding {
+	findings := []Finding{}
+	index := make(map[string]int)
+
+	// the cgroups of the oom-kill lines, by PID, for the kill that follows
+	cgroups := make(map[string]string)
+	lastTaskCgroup := ""
+
+	for _, m := range messages {
+		if fields := oomKillPattern.FindStringSubmatch(m.Text); fields != nil {
+			cgroups[fields[3]] = fields[1]
+			continue
+		}
+		if fields := oomTaskPattern.FindStringSubmatch(m.Text); fields != nil {
+			lastTaskCgroup = fields[1]
+			continue
+		}
+
+		for _, s := range Signatures {
+			groups := match(s.Pattern, m.Text)
+			if groups == nil {
+				continue
+			}
+
+			f := Finding{Node: node, Signature: s.Name, Category: s.Category, Severity: s.Severity}
+			if device := groups["device"]; device != "" {
+				f.Subject = nodedata.NormalizePCIAddress(device)
+				if ref, found := o.devices[node][f.Subject]; found {
+					f.Namespace, f.VM = ref.Namespace, ref.Name
+				}
+			}
+			switch pid, process := groups["pid"], groups["process"]; {
+			case process != "":
+				f.Subject = process + " (" + pid + ")"
+			case pid != "":
+				f.Subject = "pid " + pid
+			}
+			if s.Category == CategoryOOM {
+				f.Cgroup = cgroups[groups["pid"]]
+				if f.Cgroup == "" {
+					f.Cgroup = lastTaskCgroup
+				}
+				delete(cgroups, groups["pid"])
+				lastTaskCgroup = ""
+				if ref, found := o.pods[analysis.PodUID(f.Cgroup)]; found {
+					f.Namespace, f.VM = ref.Namespace, ref.Name
+				}
+			}
+
+			key := s.Name + "/" + f.Subject
+			if i, found := index[key]; found {
+				findings[i].Count++
+				findings[i].Last = m.Time
+				break
+			}
+			f.Count, f.First, f.Last, f.Message = 1, m.Time, m.Time, m.Text
+			index[key] = len(findings)
+			findings = append(findings, f)
+			break
+		}
+	}
+
+	return findings
+}
+
+// match returns the named groups of a match, the first non empty one when a name is used twice, or nil when the
+// pattern doesn't match
+func match(pattern *regexp.Regexp, text string) map[string]string {
+	m := pattern.FindStringSubmatch(text)
+	if m == nil {
+		return nil
+	}
+
+	groups := make(map[string]string)
+	for i, name := range pattern.SubexpNames() {
+		if name != "" && groups[name] == "" {
+			groups[name] = m[i]
+		}
+	}
+	return groups
+}
+
+// WriteText prints the findings by node, and the findings mapped to VMs.
+func (r *Report) WriteText(w io.Writer) error {
+	t := analysis.NewTable(w)
+
+	_, _ = fmt.Fprintln(t, "NODE\tSEVERITY\tSIGNATURE\tSUBJECT\tCOUNT\tFIRST\tLAST\tVM\tMESSAGE")
+	for _, n := range r.Nodes {
+		if !n.Collected {
+			_, _ = fmt.Fprintf(t, "%s\t\t\t\t\t\t\t\tthe dmesg was not collected\n", n.Name)
+			continue
+		}
+		if n.Skipped > 0 {
+			_, _ = fmt.Fprintf(t, "%s\t\t\t\t\t\t\t\t%d lines too long to be read were skipped\n", n.Name, n.Skipped)
+		}
+		for _, f := range n.Findings {
+			vm := ""
+			if f.VM != "" {
+				vm = f.Namespace + "/" + f.VM
+			}
+			_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", n.Name, f.Severity, f.Signature, f.Subject, f.Count,
+				f.First, f.Last, vm, f.Message)
+		}
+	}
+
+	if len(r.VMs) > 0 {
+		_, _ = fmt.Fprintln(t)
+		_, _ = fmt.Fprintln(t, "NAMESPACE\tVM\tNODE\tSIGNATURE\tSUBJECT\tCOUNT\tLAST")
+		for _, vm := range r.VMs {
+			for _, f := range vm.Findings {
+				_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", vm.Namespace, vm.Name, f.Node, f.Signature, f.Subject, f.Count,
+					f.Last)
+			}
+		}
+	}
+
+	return t.Flush()
+}
@@ -0,0 +1,128 @@
+package kernel
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/analysis/analysistest"
+	"github.com/kubevirt/must-gather/pkg/nodedata"
+)
+
+func analyzeFixture(t *testing.T) *Report {
+	t.Helper()
+
+	// node02 was gathered without a dmesg
+	root := analysistest.Copy(t, "testdata/must-gather")
+	if err := os.MkdirAll(filepath.Join(root, "nodes", "node02"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	return analysistest.Analyze(t, root, Analyze)
+}
+
+func TestNodes(t *testing.T) {
+	report := analyzeFixture(t)
+
+	if len(report.Nodes) != 2 {
+		t.Fatalf("expected 2 nodes, but got %+v", report.Nodes)
+	}
+	if n := report.Nodes[1]; n.Name != "node02" || n.Collected || len(n.Findings) != 0 {
+		t.Errorf("unexpected node02: %+v", n)
+	}
+
+	n := report.Nodes[0]
+	if !n.Collected || n.Messages != 24 {
+		t.Fatalf("unexpected node01: %+v", n)
+	}
+
+	expected := []struct{ signature, subject, vm string }{
+		{"hugepages-allocation-failed", "", ""},
+		{"kvm-unhandled-msr", "pid 48213", ""},
+		{"vfio-reset-failed", "0000:5e:00.0", "gpu"},
+		{"dmar-fault", "0000:5e:00.0", "gpu"},
+		{"oom-kill", "qemu-kvm (48213)", "mem"},
+		{"oom-kill", "java (60123)", ""},
+		{"soft-lockup", "CPU 1/KVM (48330)", ""},
+		{"hung-task", "kworker/u96:2 (812)", ""},
+	}
+	if len(n.Findings) != len(expected) {
+		t.Fatalf("expected %d findings, but got %+v", len(expected), n.Findings)
+	}
+	for i, e := range expected {
+		if f := n.Findings[i]; f.Signature != e.signature || f.Subject != e.subject || f.VM != e.vm {
+			t.Errorf("expected %+v, but got %+v", e, f)
+		}
+	}
+
+	if f := n.Findings[3]; f.Count != 2 || f.First != "1024.991210" || f.Last != "1025.001876" || f.Category != CategoryIOMMU {
+		t.Errorf("unexpected DMAR fault: %+v", f)
+	}
+	if f := n.Findings[4]; !strings.Contains(f.Cgroup, "pod3f0e2a4c_5b1d_4c7e_9a8f_2d6b4e1c0a9f") || f.Namespace != "ns1" {
+		t.Errorf("unexpected OOM kill: %+v", f)
+	}
+}
+
+func TestVMs(t *testing.T) {
+	report := analyzeFixture(t)
+
+	if len(report.VMs) != 2 {
+		t.Fatalf("expected 2 VMs, but got %+v", report.VMs)
+	}
+	if vm := report.VMs[0]; vm.Name != "gpu" || len(vm.Findings) != 2 {
+		t.Errorf("unexpected VM: %+v", vm)
+	}
+	if vm := report.VMs[1]; vm.Name != "mem" || len(vm.Findings) != 1 || vm.Findings[0].Signature != "oom-kill" {
+		t.Errorf("unexpected VM: %+v", vm)
+	}
+}
+
+func TestSignatures(t *testing.T) {
+	for message, expected := range map[string]string{
+		"KVM: entry failed, hardware error 0x80000021": "kvm-entry-failed",
+		"kvm: disabled by bios":                        "kvm-disabled",
+		"AMD-Vi: Event logged [IO_PAGE_FAULT device=41:00.0 domain=0x000e address=0xfffffff0 flags=0x0000]":  "amd-vi-fault",
+		"vfio-pci 0000:41:00.0: AMD-Vi: Event logged [IO_PAGE_FAULT domain=0x0021 address=0x0 flags=0x0020]": "amd-vi-fault",
+		"vfio-pci 0000:5e:00.0: not ready 65535ms after FLR; giving up":                                      "vfio-reset-failed",
+		"vfio-pci 0000:5e:00.0: vfio_bar_restore: reset recovery - restoring BARs":                           "vfio-reset",
+		"Out of memory: Killed process 1234 (virt-launcher) total-vm:100kB":                                  "oom-kill",
+		"NMI watchdog: Watchdog detected hard LOCKUP on cpu 3":                                               "hard-lockup",
+		"rcu: INFO: rcu_sched self-detected stall on CPU":                                                    "rcu-stall",
+		"vfio-pci 0000:5e:00.0: vgaarb: changed VGA decodes: olddecodes=io+mem,decodes=io+mem:owns=none":     "",
+	} {
+		findings := scan("node01", []nodedata.KernelMessage{{Text: message}}, &owners{})
+		switch {
+		case expected == "" && len(findings) != 0:
+			t.Errorf("expected no finding for %q, but got %+v", message, findings)
+		case expected != "" && (len(findings) != 1 || findings[0].Signature != expected):
+			t.Errorf("expected %s for %q, but got %+v", expected, message, findings)
+		}
+	}
+
+	findings := scan("node01", []nodedata.KernelMessage{{Text: "vfio-pci 0000:41:00.0: AMD-Vi: Event logged [IO_PAGE_FAULT domain=0x0021]"},
+		{Text: "AMD-Vi: Event logged [IO_PAGE_FAULT device=41:00.0 domain=0x000e]"}}, &owners{})
+	if len(findings) != 1 || findings[0].Subject != "0000:41:00.0" || findings[0].Count != 2 {
+		t.Errorf("expected the AMD-Vi faults of the same device to be grouped, but got %+v", findings)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	report := analyzeFixture(t)
+
+	var out bytes.Buffer
+	if err := report.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"the dmesg was not collected",
+		"ns1/mem",
+		"CPU 1/KVM (48330)",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,377 @@
+// Package logs scans the logs of the KubeVirt components, of the CDI pods and of QEMU with a catalogue of known error
+// signatures. The findings link each hit to its file and line, to the component that logged it, and to the VM or VMI
+// the line is about, from the kind, namespace, name and UID of the KubeVirt JSON lines, from the virt-launcher pod, or
+// from the VM directory of the QEMU log.
+package logs
+
+import (
+	"cmp"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/kvlog"
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+//go:embed signatures.yaml
+var defaultCatalogue []byte
+
+// Components of the scanned logs.
+const (
+	ComponentVirtAPI        = "virt-api"
+	ComponentVirtController = "virt-controller"
+	ComponentVirtHandler    = "virt-handler"
+	ComponentVirtLauncher   = "virt-launcher"
+	ComponentVirtOperator   = "virt-operator"
+	ComponentCDI            = "cdi"
+	ComponentQEMU           = "qemu"
+)
+
+var components = []string{ComponentVirtAPI, ComponentVirtController, ComponentVirtHandler, ComponentVirtLauncher,
+	ComponentVirtOperator, ComponentCDI, ComponentQEMU}
+
+// Severities of the signatures.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Signature is a known error.
+type Signature struct {
+	ID string `json:"id"`
+	// Components limits the signature to the logs of some components; all of them when empty.
+	Components []string `json:"components,omitempty"`
+	// Levels limits the signature to the lines of some levels; the lines without a level always match.
+	Levels   []string `json:"levels,omitempty"`
+	Severity string   `json:"severity"`
+	Pattern  string   `json:"pattern"`
+	Message  string   `json:"message"`
+
+	pattern *regexp.Regexp
+}
+
+// Catalogue is a versioned list of signatures.
+type Catalogue struct {
+	Version    string      `json:"version"`
+	Signatures []Signature `json:"signatures"`
+}
+
+// LoadCatalogue parses and checks a YAML catalogue.
+func LoadCatalogue(data []byte) (*Catalogue, error) {
+	c := &Catalogue{}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("can't parse the log signatures; %w", err)
+	}
+
+	ids := make(map[string]bool)
+	for i := range c.Signatures {
+		s := &c.Signatures[i]
+		switch {
+		case s.ID == "" || ids[s.ID]:
+			return nil, fmt.Errorf("missing or duplicate signature id %q", s.ID)
+		case s.Severity != SeverityError && s.Severity != SeverityWarning:
+			return nil, fmt.Errorf("signature %s: unknown severity %q", s.ID, s.Severity)
+		case s.Pattern == "":
+			return nil, fmt.Errorf("signature %s: missing pattern", s.ID)
+		}
+		for _, component := range s.Components {
+			if !slices.Contains(components, component) {
+				return nil, fmt.Errorf("signature %s: unknown component %q", s.ID, component)
+			}
+		}
+
+		var err error
+		if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+			return nil, fmt.Errorf("signature %s: can't compile the pattern; %w", s.ID, err)
+		}
+		ids[s.ID] = true
+	}
+
+	return c, nil
+}
+
+// DefaultCatalogue returns the catalogue built into the tool.
+func DefaultCatalogue() (*Catalogue, error) {
+	return LoadCatalogue(defaultCatalogue)
+}
+
+// match returns the first signature that matches a line of a component
+func (c *Catalogue) match(component string, e kvlog.Entry) *Signature {
+	text := e.Text()
+	for i := range c.Signatures {
+		s := &c.Signatures[i]
+		if len(s.Components) > 0 && !slices.Contains(s.Components, component) {
+			continue
+		}
+		if e.Level != "" && len(s.Levels) > 0 && !slices.Contains(s.Levels, e.Level) {
+			continue
+		}
+		if s.pattern.MatchString(text) {
+			return s
+		}
+	}
+	return nil
+}
+
+// Finding is the hits of a signature in a log file, about the same object.
+type Finding struct {
+	Signature string `json:"signature"`
+	Severity  string `json:"severity"`
+	Component string `json:"component"`
+	// File is the bundle relative path of the log; Line is the first hit, and LastLine the last one.
+	File     string    `json:"file"`
+	Line     int       `json:"line"`
+	LastLine int       `json:"lastLine"`
+	Count    int       `json:"count"`
+	First    time.Time `json:"first,omitzero"`
+	Last     time.Time `json:"last,omitzero"`
+	// Kind, Namespace, Name and UID are the VM or VMI the lines are about; Kind is empty when it was inferred from
+	// the virt-launcher pod or the QEMU log.
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	UID       string `json:"uid,omitempty"`
+	// Message is the first hit; Description is the message of the signature.
+	Message     string `json:"message"`
+	Description string `json:"description"`
+}
+
+// Log is a scanned log file.
+type Log struct {
+	File      string `json:"file"`
+	Component string `json:"component"`
+	Lines     int    `json:"lines"`
+	// Structured is the number of KubeVirt JSON lines.
+	Structured int `json:"structured"`
+	// Skipped is the number of lines too long to be read, e.g. with a whole domain XML.
+	Skipped int `json:"skipped,omitempty"`
+}
+
+// Report is the result of the logs check.
+type Report struct {
+	CatalogueVersion string    `json:"catalogueVersion"`
+	Logs             []Log     `json:"logs"`
+	Findings         []Finding `json:"findings"`
+}
+
+// source is a log file to scan
+type source struct {
+	path      string
+	component string
+	// vm is the VM of a virt-launcher or a QEMU log
+	vm layout.VMRef
+}
+
+// Analyze scans the logs with the default catalogue.
+func Analyze(b *layout.Bundle) (*Report, error) {
+	c, err := DefaultCatalogue()
+	if err != nil {
+		return nil, err
+	}
+	return AnalyzeWith(b, c)
+}
+
+// AnalyzeWith scans the logs with the given catalogue.
+func AnalyzeWith(b *layout.Bundle, c *Catalogue) (*Report, error) {
+	report := &Report{CatalogueVersion: c.Version, Logs: []Log{}, Findings: []Finding{}}
+
+	sources, err := readSources(b)
+	if err != nil {
+		return nil, err
+	}
+	uids, err := vmsByUID(b)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, src := range sources {
+		f, err := os.Open(src.path)
+		if err != nil {
+			return nil, err
+		}
+
+		log := Log{File: b.Rel(src.path), Component: src.component}
+		index := make(map[string]int)
+		log.Skipped, err = kvlog.Scan(f, func(e kvlog.Entry) {
+			log.Lines++
+			if e.Structured {
+				log.Structured++
+			}
+
+			s := c.match(src.component, e)
+			if s == nil {
+				return
+			}
+
+			kind, namespace, name, uid := subject(e, src, uids)
+			key := s.ID + "/" + namespace + "/" + name
+			if i, found := index[key]; found {
+				finding := &report.Findings[i]
+				finding.Count++
+				finding.LastLine = e.Line
+				if e.Time.After(finding.Last) {
+					finding.Last = e.Time
+				}
+				return
+			}
+			index[key] = len(report.Findings)
+			report.Findings = append(report.Findings, Finding{
+				Signature: s.ID, Severity: s.Severity, Component: src.component,
+				File: log.File, Line: e.Line, LastLine: e.Line, Count: 1, First: e.Time, Last: e.Time,
+				Kind: kind, Namespace: namespace, Name: name, UID: uid,
+				Message: e.Text(), Description: s.Message,
+			})
+		})
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("can't read %s; %w", log.File, err)
+		}
+		report.Logs = append(report.Logs, log)
+	}
+
+	slices.SortStableFunc(report.Findings, func(a, b Finding) int {
+		return cmp.Or(cmp.Compare(a.Severity, b.Severity), cmp.Compare(a.Component, b.Component),
+			cmp.Compare(a.File, b.File), cmp.Compare(a.Line, b.Line))
+	})
+
+	return report, nil
+}
+
+// readSources lists the logs of the KubeVirt and CDI pods, and the QEMU logs
+func readSources(b *layout.Bundle) ([]source, error) {
+	pods, err := b.Objects(layout.Pods)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]layout.Object, len(pods))
+	for _, pod := range pods {
+		byKey[pod.Key()] = pod
+	}
+
+	logs, err := b.AllPodLogs()
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []source
+	for _, log := range logs {
+		pod, found := byKey[log.Namespace+"/"+log.Pod]
+		src := source{path: log.Path, component: podComponent(log.Pod, pod, found)}
+		if src.component == "" {
+			continue
+		}
+		if src.component == ComponentVirtLauncher && found {
+			if name := layout.LauncherVMName(pod); name != "" {
+				src.vm = layout.VMRef{Namespace: log.Namespace, Name: name}
+			}
+		}
+		sources = append(sources, src)
+	}
+
+	refs, err := b.VMsWithDetails()
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		path, err := b.QEMULogPath(ref.Namespace, ref.Name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source{path: path, component: ComponentQEMU, vm: ref})
+	}
+
+	return sources, nil
+}
+
+// podComponent tells which component a pod is, from its labels or else from its name
+func podComponent(name string, pod layout.Object, found bool) string {
+	if found {
+		labels := pod.GetLabels()
+		if c := labels["kubevirt.io"]; slices.Contains(components, c) {
+			return c
+		}
+		if labels["app"] == "containerized-data-importer" || labels["cdi.kubevirt.io"] != "" {
+			return ComponentCDI
+		}
+	}
+
+	for _, c := range []string{ComponentVirtAPI, ComponentVirtController, ComponentVirtHandler, ComponentVirtLauncher,
+		ComponentVirtOperator} {
+		if strings.HasPrefix(name, c+"-") {
+			return c
+		}
+	}
+	if strings.HasPrefix(name, "cdi-") || strings.HasPrefix(name, "importer-") || strings.HasSuffix(name, "-source-pod") {
+		return ComponentCDI
+	}
+	return ""
+}
+
+// vmsByUID returns the VMs and the VMIs by UID, for the lines with a UID and no name
+func vmsByUID(b *layout.Bundle) (map[string]layout.Object, error) {
+	uids := make(map[string]layout.Object)
+	for _, list := range []func() ([]layout.Object, error){b.VirtualMachines, b.VirtualMachineInstances} {
+		objects, err := list()
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objects {
+			uids[string(obj.GetUID())] = obj
+		}
+	}
+	return uids, nil
+}
+
+// subject returns the VM or VMI a line is about
+func subject(e kvlog.Entry, src source, uids map[string]layout.Object) (kind, namespace, name, uid string) {
+	if obj, found := uids[e.UID]; found && e.UID != "" {
+		return obj.GetKind(), obj.GetNamespace(), obj.GetName(), e.UID
+	}
+	if namespace, name := e.VM(); name != "" {
+		return e.Kind, cmp.Or(namespace, src.vm.Namespace), name, e.UID
+	}
+	return "", src.vm.Namespace, src.vm.Name, ""
+}
+
+// WriteText prints the findings.
+func (r *Report) WriteText(w io.Writer) error {
+	t := analysis.NewTable(w)
+
+	_, _ = fmt.Fprintf(t, "catalogue %s, %d logs scanned\n\n", r.CatalogueVersion, len(r.Logs))
+	if len(r.Findings) == 0 {
+		_, _ = fmt.Fprintln(t, "no known error found")
+		return t.Flush()
+	}
+
+	_, _ = fmt.Fprintln(t, "SEVERITY\tSIGNATURE\tCOMPONENT\tVM\tCOUNT\tFIRST\tLAST\tFILE\tMESSAGE")
+	for _, f := range r.Findings {
+		vm := ""
+		if f.Name != "" {
+			vm = f.Namespace + "/" + f.Name
+		}
+		_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s:%d\t%s\n", f.Severity, f.Signature, f.Component, vm, f.Count,
+			formatTime(f.First), formatTime(f.Last), f.File, f.Line, f.Message)
+	}
+
+	return t.Flush()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
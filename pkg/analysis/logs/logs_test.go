@@ -0,0 +1,121 @@
+package logs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/analysis/analysistest"
+	"github.com/kubevirt/must-gather/pkg/kvlog"
+)
+
+func TestDefaultCatalogue(t *testing.T) {
+	c, err := DefaultCatalogue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version == "" || len(c.Signatures) == 0 {
+		t.Errorf("the default catalogue is empty")
+	}
+}
+
+func TestLoadCatalogueErrors(t *testing.T) {
+	for _, data := range []string{
+		"signatures:\n- id: a\n  severity: error\n",
+		"signatures:\n- id: a\n  severity: fatal\n  pattern: x\n",
+		"signatures:\n- id: a\n  severity: error\n  pattern: '('\n",
+		"signatures:\n- id: a\n  components: [virt-exportproxy]\n  severity: error\n  pattern: x\n",
+		"signatures:\n- id: a\n  severity: error\n  pattern: x\n- id: a\n  severity: error\n  pattern: y\n",
+		"signatures:\n- id: a\n  severity: error\n  pattern: x\n  unknown: field\n",
+	} {
+		if _, err := LoadCatalogue([]byte(data)); err == nil {
+			t.Errorf("expected an error for\n%s", data)
+		}
+	}
+}
+
+func TestSignatures(t *testing.T) {
+	c, err := DefaultCatalogue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct{ component, line, expected string }{
+		{ComponentQEMU, "2026-10-19T08:55:00.380123Z qemu-kvm: failed to initialize kvm: Permission denied", "kvm-unavailable"},
+		{ComponentQEMU, `qemu-kvm: -blockdev {"driver":"file"}: Failed to get "write" lock`, "disk-image-locked"},
+		{ComponentQEMU, "2026-10-19T08:55:00.380123Z qemu-kvm: terminating on signal 15 from pid 48190 (<unknown process>)", "qemu-terminated-by-signal"},
+		{ComponentVirtHandler, `{"level":"error","msg":"Synchronizing the VirtualMachineInstance failed.","reason":"failed calling webhook"}`, "sync-failed"},
+		{ComponentVirtHandler, `{"level":"info","msg":"Synchronizing the VirtualMachineInstance failed."}`, ""},
+		{ComponentVirtAPI, `{"level":"error","msg":"x509: certificate has expired or is not yet valid"}`, "certificate-invalid"},
+		{ComponentCDI, "E1019 09:20:03.512345       1 importer.go:173] Unable to process data: No space left on device", "cdi-transfer-failed"},
+		{ComponentVirtController, "2026-10-19 08:55:00.350+0000: terminating on signal 15", ""},
+	} {
+		s := c.match(test.component, kvlog.ParseLine(test.line))
+		switch {
+		case test.expected == "" && s != nil:
+			t.Errorf("expected no signature for %q, but got %s", test.line, s.ID)
+		case test.expected != "" && (s == nil || s.ID != test.expected):
+			t.Errorf("expected %s for %q, but got %+v", test.expected, test.line, s)
+		}
+	}
+}
+
+func TestFindings(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	if len(report.Logs) != 5 {
+		t.Errorf("expected the hco-operator log to be skipped, but got %+v", report.Logs)
+	}
+
+	expected := []struct {
+		signature, component, kind, vm string
+		line, count                    int
+	}{
+		{"registry-access-failed", ComponentCDI, "", "", 2, 1},
+		{"vfio-group-not-viable", ComponentQEMU, "", "ns1/fedora", 2, 1},
+		{"launcher-pod-creation-failed", ComponentVirtController, "VirtualMachineInstance", "ns2/big", 1, 1},
+		{"device-plugin-failed", ComponentVirtHandler, "", "", 2, 1},
+		{"vfio-group-not-viable", ComponentVirtLauncher, "", "ns1/fedora", 2, 1},
+		{"domain-start-failed", ComponentVirtLauncher, "Domain", "ns1/fedora", 3, 1},
+		{"sync-failed", ComponentVirtHandler, "VirtualMachineInstance", "ns1/fedora", 3, 2},
+	}
+	if len(report.Findings) != len(expected) {
+		t.Fatalf("expected %d findings, but got %+v", len(expected), report.Findings)
+	}
+	for i, e := range expected {
+		f := report.Findings[i]
+		vm := ""
+		if f.Name != "" {
+			vm = f.Namespace + "/" + f.Name
+		}
+		if f.Signature != e.signature || f.Component != e.component || f.Kind != e.kind || vm != e.vm || f.Line != e.line ||
+			f.Count != e.count {
+			t.Errorf("expected %+v, but got %+v", e, f)
+		}
+	}
+
+	if f := report.Findings[6]; f.LastLine != 5 || f.UID != "b4a3c2d1-0000-4000-8000-000000000001" ||
+		!strings.HasSuffix(f.File, "virt-handler/logs/current.log") {
+		t.Errorf("unexpected finding: %+v", f)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	var out bytes.Buffer
+	if err := report.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"5 logs scanned",
+		"namespaces/ns1/vms/fedora/ns1_fedora.log:2",
+		"ns2/big",
+		"exceeded quota",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,421 @@
+// Package migration finds the VMIs that can't be live migrated, and the nodes that can't be drained cleanly because
+// of them, or because of PodDisruptionBudgets.
+package migration
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+const (
+	sriovMigrationGate = "SRIOVLiveMigration"
+	readWriteMany      = "ReadWriteMany"
+)
+
+// DrainImpact is what happens to a VMI when its node is drained.
+type DrainImpact string
+
+const (
+	Migrated DrainImpact = "migrated"
+	Stopped  DrainImpact = "stopped"
+	Blocks   DrainImpact = "blocks drain"
+	External DrainImpact = "external"
+)
+
+// DrainStatus tells whether a node can be drained cleanly.
+type DrainStatus string
+
+const (
+	// Clean nodes can be drained, and their VMIs are migrated.
+	Clean DrainStatus = "clean"
+	// Disruptive nodes can be drained, but some VMIs are stopped, or are left to an external controller.
+	Disruptive DrainStatus = "disruptive"
+	// Blocked nodes can't be drained.
+	Blocked DrainStatus = "blocked"
+)
+
+// VMI is a VMI that can't be live migrated.
+type VMI struct {
+	Namespace        string      `json:"namespace"`
+	Name             string      `json:"name"`
+	Node             string      `json:"node"`
+	EvictionStrategy string      `json:"evictionStrategy"`
+	OnDrain          DrainImpact `json:"onDrain"`
+	// Condition is the LiveMigratable condition; it is nil when the VMI does not report it.
+	Condition *analysis.Condition `json:"condition,omitempty"`
+	Reasons   []string            `json:"reasons"`
+}
+
+// Node is the drain status of a node.
+type Node struct {
+	Name    string      `json:"name"`
+	Drain   DrainStatus `json:"drain"`
+	Details []string    `json:"details,omitempty"`
+}
+
+// Report is the result of the migration check.
+type Report struct {
+	// NonMigratable lists the VMIs that can't be live migrated.
+	NonMigratable []VMI `json:"nonMigratable"`
+	// Nodes lists the nodes, and the nodes that run VMIs.
+	Nodes []Node `json:"nodes"`
+}
+
+// Analyze checks the VMIs and the PodDisruptionBudgets of the bundle.
+func Analyze(b *layout.Bundle) (*Report, error) {
+	a, err := newAnalyzer(b)
+	if err != nil {
+		return nil, err
+	}
+
+	vmis, err := b.VirtualMachineInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{NonMigratable: []VMI{}}
+	nodes := make(map[string]*Node)
+	nodeNames, err := a.nodeNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range nodeNames {
+		nodes[name] = &Node{Name: name, Drain: Clean}
+	}
+
+	for _, vmi := range vmis {
+		result, migratable := a.checkVMI(vmi)
+		if !migratable {
+			report.NonMigratable = append(report.NonMigratable, result)
+		}
+
+		node := nodes[result.Node]
+		if result.Node == "" || node == nil {
+			continue
+		}
+
+		switch result.OnDrain {
+		case Blocks:
+			node.block(fmt.Sprintf("VMI %s/%s is not live migratable, and its eviction strategy is %s", result.Namespace, result.Name, result.EvictionStrategy))
+		case Stopped:
+			node.disrupt(fmt.Sprintf("VMI %s/%s is stopped (eviction strategy %s)", result.Namespace, result.Name, result.EvictionStrategy))
+		case External:
+			node.disrupt(fmt.Sprintf("VMI %s/%s is left to an external controller (eviction strategy %s)", result.Namespace, result.Name, result.EvictionStrategy))
+		}
+	}
+
+	blockers, err := a.pdbBlockers()
+	if err != nil {
+		return nil, err
+	}
+	for nodeName, details := range blockers {
+		if node := nodes[nodeName]; node != nil {
+			for _, detail := range details {
+				node.block(detail)
+			}
+		}
+	}
+
+	for _, name := range nodeNames {
+		report.Nodes = append(report.Nodes, *nodes[name])
+	}
+
+	return report, nil
+}
+
+func (n *Node) block(detail string) {
+	n.Drain = Blocked
+	n.Details = append(n.Details, detail)
+}
+
+func (n *Node) disrupt(detail string) {
+	if n.Drain == Clean {
+		n.Drain = Disruptive
+	}
+	n.Details = append(n.Details, detail)
+}
+
+type analyzer struct {
+	b               *layout.Bundle
+	defaultEviction string
+	featureGates    map[string]bool
+	pvcs            map[string]layout.Object
+}
+
+func newAnalyzer(b *layout.Bundle) (*analyzer, error) {
+	a := &analyzer{b: b, pvcs: make(map[string]layout.Object)}
+
+	var err error
+	if a.defaultEviction, err = analysis.DefaultEvictionStrategy(b); err != nil {
+		return nil, err
+	}
+
+	if a.featureGates, err = analysis.FeatureGates(b); err != nil {
+		return nil, err
+	}
+
+	pvcs, err := b.Objects(layout.PersistentVolumeClaims)
+	if err != nil {
+		return nil, err
+	}
+	for _, pvc := range pvcs {
+		a.pvcs[pvc.Key()] = pvc
+	}
+
+	return a, nil
+}
+
+// nodeNames returns the collected nodes, and the nodes VMIs run on, sorted
+func (a *analyzer) nodeNames() ([]string, error) {
+	nodes, err := a.b.Objects(layout.Nodes)
+	if err != nil {
+		return nil, err
+	}
+	vmis, err := a.b.VirtualMachineInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, node := range nodes {
+		names = append(names, node.GetName())
+	}
+	for _, vmi := range vmis {
+		if name, _, _ := unstructured.NestedString(vmi.Object, "status", "nodeName"); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return slices.Compact(names), nil
+}
+
+// checkVMI returns the migration details of a VMI, and whether it can be live migrated
+func (a *analyzer) checkVMI(vmi layout.Object) (VMI, bool) {
+	result := VMI{
+		Namespace:        vmi.GetNamespace(),
+		Name:             vmi.GetName(),
+		EvictionStrategy: a.defaultEviction,
+		Reasons:          []string{},
+	}
+	result.Node, _, _ = unstructured.NestedString(vmi.Object, "status", "nodeName")
+	if strategy, _, _ := unstructured.NestedString(vmi.Object, "spec", "evictionStrategy"); strategy != "" {
+		result.EvictionStrategy = strategy
+	}
+
+	result.Reasons = append(result.Reasons, a.volumeReasons(vmi)...)
+	result.Reasons = append(result.Reasons, a.deviceReasons(vmi)...)
+
+	migratable := len(result.Reasons) == 0
+	if cond, found := analysis.GetCondition(vmi, analysis.LiveMigratableCondition); found {
+		result.Condition = &cond
+		// the condition is authoritative; the reasons found in the spec explain it
+		migratable = cond.Status == string(metav1.ConditionTrue)
+		if !migratable && cond.Message != "" {
+			result.Reasons = append([]string{cond.Reason + ": " + cond.Message}, result.Reasons...)
+		}
+	}
+
+	result.OnDrain = drainImpact(result.EvictionStrategy, migratable)
+	return result, migratable
+}
+
+func drainImpact(strategy string, migratable bool) DrainImpact {
+	switch strategy {
+	case analysis.EvictionLiveMigrate:
+		if migratable {
+			return Migrated
+		}
+		return Blocks
+	case analysis.EvictionLiveMigrateIfPossible:
+		if migratable {
+			return Migrated
+		}
+		return Stopped
+	case analysis.EvictionExternal:
+		return External
+	default:
+		return Stopped
+	}
+}
+
+// volumeReasons returns the volumes that prevent live migration: PVCs that are not ReadWriteMany, and host disks
+func (a *analyzer) volumeReasons(vmi layout.Object) []string {
+	var reasons []string
+
+	for _, volume := range analysis.NestedMaps(vmi.Object, "spec", "volumes") {
+		name, _, _ := unstructured.NestedString(volume, "name")
+
+		if _, found := volume["hostDisk"]; found {
+			reasons = append(reasons, fmt.Sprintf("volume %s is a hostDisk", name))
+			continue
+		}
+
+		claim := claimName(volume)
+		if claim == "" {
+			continue
+		}
+
+		pvc, found := a.pvcs[vmi.GetNamespace()+"/"+claim]
+		if !found {
+			continue
+		}
+
+		modes, _, _ := unstructured.NestedStringSlice(pvc.Object, "status", "accessModes")
+		if len(modes) == 0 {
+			modes, _, _ = unstructured.NestedStringSlice(pvc.Object, "spec", "accessModes")
+		}
+		if !slices.Contains(modes, readWriteMany) {
+			reasons = append(reasons, fmt.Sprintf("volume %s uses PVC %s, which is not ReadWriteMany (%s)", name, claim, strings.Join(modes, ", ")))
+		}
+	}
+
+	return reasons
+}
+
+func claimName(volume map[string]any) string {
+	for _, path := range [][]string{
+		{"persistentVolumeClaim", "claimName"},
+		{"dataVolume", "name"},
+		{"ephemeral", "persistentVolumeClaim", "claimName"},
+	} {
+		if name, _, _ := unstructured.NestedString(volume, path...); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// deviceReasons returns the devices and the CPU settings that prevent live migration
+func (a *analyzer) deviceReasons(vmi layout.Object) []string {
+	var reasons []string
+
+	for _, kind := range []string{"hostDevices", "gpus"} {
+		for _, device := range analysis.NestedMaps(vmi.Object, "spec", "domain", "devices", kind) {
+			name, _, _ := unstructured.NestedString(device, "name")
+			deviceName, _, _ := unstructured.NestedString(device, "deviceName")
+			reasons = append(reasons, fmt.Sprintf("host device %s (%s) is passed through", name, deviceName))
+		}
+	}
+
+	podNetworks := make(map[string]bool)
+	for _, network := range analysis.NestedMaps(vmi.Object, "spec", "networks") {
+		if _, found := network["pod"]; found {
+			name, _, _ := unstructured.NestedString(network, "name")
+			podNetworks[name] = true
+		}
+	}
+
+	for _, iface := range analysis.NestedMaps(vmi.Object, "spec", "domain", "devices", "interfaces") {
+		name, _, _ := unstructured.NestedString(iface, "name")
+		if _, found := iface["sriov"]; found && !a.featureGates[sriovMigrationGate] {
+			reasons = append(reasons, fmt.Sprintf("interface %s is SR-IOV, and the %s feature gate is not enabled", name, sriovMigrationGate))
+		}
+		if _, found := iface["bridge"]; found && podNetworks[name] {
+			reasons = append(reasons, fmt.Sprintf("interface %s connects the pod network with a bridge binding", name))
+		}
+	}
+
+	if dedicated, _, _ := unstructured.NestedBool(vmi.Object, "spec", "domain", "cpu", "dedicatedCpuPlacement"); dedicated {
+		reasons = append(reasons, "the VMI has dedicated CPUs")
+	}
+
+	return reasons
+}
+
+// pdbBlockers returns, by node, the PodDisruptionBudgets that allow no disruption, and the pods they protect on the
+// node. The PDBs KubeVirt creates for the VMIs are skipped; the VMIs are checked on their own.
+func (a *analyzer) pdbBlockers() (map[string][]string, error) {
+	pdbs, err := a.b.Objects(layout.PodDisruptionBudgets)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := a.b.Objects(layout.Pods)
+	if err != nil {
+		return nil, err
+	}
+
+	blockers := make(map[string][]string)
+	for _, pdb := range pdbs {
+		if isOwnedByVMI(pdb) {
+			continue
+		}
+
+		allowed, found := layout.NestedInt64(pdb.Object, "status", "disruptionsAllowed")
+		if !found || allowed > 0 {
+			continue
+		}
+
+		selector, err := pdbSelector(pdb)
+		if err != nil || selector.Empty() {
+			continue
+		}
+
+		for _, pod := range pods {
+			if pod.GetNamespace() != pdb.GetNamespace() || !selector.Matches(labels.Set(pod.GetLabels())) || !analysis.IsPodRunning(pod) {
+				continue
+			}
+
+			node, _, _ := unstructured.NestedString(pod.Object, "spec", "nodeName")
+			blockers[node] = append(blockers[node], fmt.Sprintf("PodDisruptionBudget %s allows no disruption of pod %s", pdb.Key(), pod.Key()))
+		}
+	}
+
+	return blockers, nil
+}
+
+func pdbSelector(pdb layout.Object) (labels.Selector, error) {
+	raw, found, _ := unstructured.NestedMap(pdb.Object, "spec", "selector")
+	if !found {
+		return labels.Nothing(), nil
+	}
+
+	var selector metav1.LabelSelector
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &selector); err != nil {
+		return nil, err
+	}
+	return metav1.LabelSelectorAsSelector(&selector)
+}
+
+func isOwnedByVMI(obj layout.Object) bool {
+	for _, owner := range obj.GetOwnerReferences() {
+		if owner.Kind == "VirtualMachineInstance" {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteText prints the report as tables.
+func (r *Report) WriteText(w io.Writer) error {
+	t := analysis.NewTable(w)
+
+	if len(r.NonMigratable) == 0 {
+		_, _ = fmt.Fprintln(t, "All the VMIs can be live migrated.")
+	} else {
+		_, _ = fmt.Fprintln(t, "NAMESPACE\tVMI\tNODE\tEVICTION STRATEGY\tON DRAIN\tREASONS")
+		for _, vmi := range r.NonMigratable {
+			_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%s\n", vmi.Namespace, vmi.Name, vmi.Node, vmi.EvictionStrategy,
+				vmi.OnDrain, strings.Join(vmi.Reasons, "; "))
+		}
+	}
+
+	_, _ = fmt.Fprintln(t)
+	_, _ = fmt.Fprintln(t, "NODE\tDRAIN\tDETAILS")
+	for _, node := range r.Nodes {
+		_, _ = fmt.Fprintf(t, "%s\t%s\t%s\n", node.Name, node.Drain, strings.Join(node.Details, "; "))
+	}
+
+	return t.Flush()
+}
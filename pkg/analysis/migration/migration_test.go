@@ -0,0 +1,71 @@
+package migration
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/analysis/analysistest"
+)
+
+func TestNonMigratableVMIs(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	if len(report.NonMigratable) != 2 {
+		t.Fatalf("expected 2 non migratable VMIs, but got %+v", report.NonMigratable)
+	}
+
+	hostdev, rwo := report.NonMigratable[0], report.NonMigratable[1]
+	if rwo.Name != "rwo" || rwo.EvictionStrategy != analysis.EvictionLiveMigrate || rwo.OnDrain != Blocks {
+		t.Errorf("unexpected result for the rwo VMI: %+v", rwo)
+	}
+	if !slices.ContainsFunc(rwo.Reasons, func(r string) bool { return strings.Contains(r, "PVC rwo-disk, which is not ReadWriteMany") }) {
+		t.Errorf("expected the RWO PVC in the reasons, but got %q", rwo.Reasons)
+	}
+	if rwo.Condition == nil || rwo.Condition.Reason != "DisksNotLiveMigratable" {
+		t.Errorf("expected the LiveMigratable condition, but got %+v", rwo.Condition)
+	}
+
+	if hostdev.Name != "hostdev" || hostdev.EvictionStrategy != analysis.EvictionNone || hostdev.OnDrain != Stopped {
+		t.Errorf("unexpected result for the hostdev VMI: %+v", hostdev)
+	}
+	for _, expected := range []string{"hostDisk", "host device gpu1", "SR-IOV", "bridge binding", "dedicated CPUs"} {
+		if !slices.ContainsFunc(hostdev.Reasons, func(r string) bool { return strings.Contains(r, expected) }) {
+			t.Errorf("expected %q in the reasons, but got %q", expected, hostdev.Reasons)
+		}
+	}
+}
+
+func TestNodeDrain(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	expected := map[string]DrainStatus{"node01": Blocked, "node02": Disruptive, "node03": Blocked}
+	if len(report.Nodes) != len(expected) {
+		t.Fatalf("expected %d nodes, but got %+v", len(expected), report.Nodes)
+	}
+	for _, node := range report.Nodes {
+		if node.Drain != expected[node.Name] {
+			t.Errorf("expected %s to be %s, but got %s (%q)", node.Name, expected[node.Name], node.Drain, node.Details)
+		}
+	}
+
+	// node03 is blocked by the db PDB only; the PDBs of the VMIs are skipped
+	if details := report.Nodes[2].Details; len(details) != 1 || !strings.Contains(details[0], "ns2/db") {
+		t.Errorf("expected the db PDB to block node03, but got %q", details)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := analysistest.Analyze(t, "testdata/must-gather", Analyze).WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"ns1        rwo", "node01  blocked"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in\n%s", expected, buf.String())
+		}
+	}
+}
@@ -0,0 +1,617 @@
+// Package nmstate reconciles the NodeNetworkConfigurationPolicies with the actual network of the nodes, from their
+// NodeNetworkState or, when it was not collected, from the ip a, bridge and vlan outputs of gather_nodes. It also
+// reports the failed enactments, and the bridge NetworkAttachmentDefinitions whose bridge or VLAN is missing on the
+// nodes that run VMs attached to them.
+package nmstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/nodedata"
+)
+
+// Sources of the actual state of a node.
+const (
+	SourceNNS       = "nns"
+	SourceNodeFiles = "node files"
+)
+
+// Statuses of an attachment on a node.
+const (
+	OK      = "ok"
+	Broken  = "broken"
+	Unknown = "unknown"
+)
+
+const (
+	enactmentNodeLabel   = "nmstate.io/node"
+	enactmentPolicyLabel = "nmstate.io/policy"
+	linuxBridge          = "linux-bridge"
+	ovsBridge            = "ovs-bridge"
+	vlanType             = "vlan"
+	stateUp              = "up"
+	stateAbsent          = "absent"
+)
+
+// Policy is the state of a NodeNetworkConfigurationPolicy.
+type Policy struct {
+	Name string `json:"name"`
+	// Status is the type of the true condition: Available, Degraded or Progressing.
+	Status  string   `json:"status,omitempty"`
+	Reason  string   `json:"reason,omitempty"`
+	Message string   `json:"message,omitempty"`
+	Nodes   []string `json:"nodes"`
+}
+
+// Interface compares an interface of a policy with the actual interface of a node.
+type Interface struct {
+	Policy string `json:"policy"`
+	Node   string `json:"node"`
+	Name   string `json:"name"`
+	// Desired and Actual describe the type, state, bridge ports and VLAN of the interface.
+	Desired  string   `json:"desired"`
+	Actual   string   `json:"actual"`
+	Source   string   `json:"source,omitempty"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Enactment is a NodeNetworkConfigurationEnactment that failed or was aborted.
+type Enactment struct {
+	Name    string `json:"name"`
+	Node    string `json:"node"`
+	Policy  string `json:"policy"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Attachment is a bridge NetworkAttachmentDefinition on a node that runs VMs attached to it.
+type Attachment struct {
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Bridge    string   `json:"bridge"`
+	VLAN      int      `json:"vlan,omitempty"`
+	Node      string   `json:"node"`
+	VMs       []string `json:"vms"`
+	Status    string   `json:"status"`
+	Problems  []string `json:"problems,omitempty"`
+}
+
+// Report is the result of the nmstate check.
+type Report struct {
+	Policies    []Policy     `json:"policies"`
+	Interfaces  []Interface  `json:"interfaces"`
+	Enactments  []Enactment  `json:"enactments"`
+	Attachments []Attachment `json:"attachments"`
+}
+
+// iface is a desired or an actual interface
+type iface struct {
+	name, typ, state string
+	baseIface        string
+	vlanID           int
+	ports            []port
+}
+
+type port struct {
+	name string
+	// vlans describes the VLAN filtering of the port; it is empty when the port doesn't filter
+	vlans  string
+	allows func(id int) bool
+}
+
+// nodeState is the actual network of a node
+type nodeState struct {
+	source     string
+	interfaces map[string]iface
+}
+
+// Analyze reconciles the collected policies, enactments, network states and attachments.
+func Analyze(b *layout.Bundle) (*Report, error) {
+	report := &Report{Policies: []Policy{}, Interfaces: []Interface{}, Enactments: []Enactment{}, Attachments: []Attachment{}}
+
+	policies, err := b.Objects(layout.NodeNetworkConfigurationPolicies)
+	if err != nil {
+		return nil, err
+	}
+	enactments, err := b.Objects(layout.NodeNetworkConfigurationEnactments)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := b.Objects(layout.Nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]*nodeState)
+	state := func(node string) (*nodeState, error) {
+		if s, found := states[node]; found {
+			return s, nil
+		}
+		s, err := readNodeState(b, node)
+		if err != nil {
+			return nil, err
+		}
+		states[node] = s
+		return s, nil
+	}
+
+	enacted := make(map[string][]string)
+	for _, nnce := range enactments {
+		labels := nnce.GetLabels()
+		node, policy := labels[enactmentNodeLabel], labels[enactmentPolicyLabel]
+		if node == "" || policy == "" {
+			node, policy, _ = strings.Cut(nnce.GetName(), ".")
+		}
+		enacted[policy] = append(enacted[policy], node)
+
+		for _, status := range []string{"Failing", "Aborted"} {
+			if c, found := analysis.GetCondition(nnce, status); found && c.Status == "True" {
+				report.Enactments = append(report.Enactments, Enactment{
+					Name: nnce.GetName(), Node: node, Policy: policy, Status: status, Reason: c.Reason, Message: c.Message,
+				})
+			}
+		}
+	}
+
+	for _, nncp := range policies {
+		policy := Policy{Name: nncp.GetName()}
+		for _, status := range []string{"Degraded", "Progressing", "Available"} {
+			if c, found := analysis.GetCondition(nncp, status); found && c.Status == "True" {
+				policy.Status, policy.Reason, policy.Message = status, c.Reason, c.Message
+				break
+			}
+		}
+
+		selector, _, _ := unstructured.NestedStringMap(nncp.Object, "spec", "nodeSelector")
+		targets := make(map[string]bool)
+		for _, node := range enacted[policy.Name] {
+			targets[node] = true
+		}
+		for _, node := range nodes {
+			if matches(node.GetLabels(), selector) {
+				targets[node.GetName()] = true
+			}
+		}
+		policy.Nodes = slices.Sorted(maps.Keys(targets))
+		report.Policies = append(report.Policies, policy)
+
+		desired := analysis.NestedMaps(nncp.Object, "spec", "desiredState", "interfaces")
+		for _, node := range policy.Nodes {
+			s, err := state(node)
+			if err != nil {
+				return nil, err
+			}
+			for _, d := range desired {
+				report.Interfaces = append(report.Interfaces, compare(policy.Name, node, interfaceFromNmstate(d), s))
+			}
+		}
+	}
+
+	if report.Attachments, err = checkAttachments(b, state); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func matches(labels, selector map[string]string) bool {
+	for key, value := range selector {
+		if actual, found := labels[key]; !found || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// readNodeState reads the interfaces of the NodeNetworkState of a node, or of its gather_nodes files
+func readNodeState(b *layout.Bundle, node string) (*nodeState, error) {
+	s := &nodeState{interfaces: make(map[string]iface)}
+
+	nns, err := b.Object(layout.NodeNetworkStates, "", node)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		s.source = SourceNNS
+		for _, i := range analysis.NestedMaps(nns.Object, "status", "currentState", "interfaces") {
+			actual := interfaceFromNmstate(i)
+			s.interfaces[actual.name] = actual
+		}
+		return s, nil
+	}
+
+	data, err := b.ReadNodeFile(node, layout.NodeIPAddr)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	links, err := nodedata.ParseIPAddr(data)
+	if err != nil {
+		return s, nil
+	}
+	s.source = SourceNodeFiles
+
+	bridges := make(map[string]bool)
+	if data, err = b.ReadNodeFile(node, layout.NodeBridges); err == nil {
+		bridgeLinks, _ := nodedata.ParseLinks(data)
+		for _, link := range bridgeLinks {
+			bridges[link.Name] = true
+		}
+	}
+	vlans := make(map[string]nodedata.PortVLANs)
+	if data, err = b.ReadNodeFile(node, layout.NodeVLANs); err == nil {
+		ports, _ := nodedata.ParseVLANs(data)
+		for _, p := range ports {
+			vlans[p.IfName] = p
+		}
+	}
+
+	for _, link := range links {
+		actual := iface{name: link.Name, state: "down"}
+		if link.Up() {
+			actual.state = stateUp
+		}
+		if bridges[link.Name] {
+			actual.typ = linuxBridge
+		}
+		if base, id, found := strings.Cut(link.Name, "."); found && link.Parent == base {
+			actual.typ, actual.baseIface = vlanType, base
+			actual.vlanID, _ = strconv.Atoi(id)
+		}
+		s.interfaces[link.Name] = actual
+	}
+	for _, link := range links {
+		// veth peers (eth0@if3) are the pod ends of the attachments, not uplinks
+		if link.Master == "" || strings.HasPrefix(link.Parent, "if") {
+			continue
+		}
+		master, found := s.interfaces[link.Master]
+		if !found {
+			continue
+		}
+		p := port{name: link.Name}
+		if v, filtered := vlans[link.Name]; filtered {
+			p.vlans = describeVLANs(v)
+			p.allows = v.Contains
+		}
+		master.ports = append(master.ports, p)
+		s.interfaces[link.Master] = master
+	}
+
+	return s, nil
+}
+
+// interfaceFromNmstate reads an interface of a desired or current nmstate state
+func interfaceFromNmstate(obj map[string]any) iface {
+	i := iface{}
+	i.name, _, _ = unstructured.NestedString(obj, "name")
+	i.typ, _, _ = unstructured.NestedString(obj, "type")
+	i.state, _, _ = unstructured.NestedString(obj, "state")
+	i.baseIface, _, _ = unstructured.NestedString(obj, "vlan", "base-iface")
+	if id, found := layout.NestedInt64(obj, "vlan", "id"); found {
+		i.vlanID = int(id)
+	}
+
+	for _, p := range analysis.NestedMaps(obj, "bridge", "port") {
+		name, _, _ := unstructured.NestedString(p, "name")
+		bp := port{name: name}
+		vlan, found, _ := unstructured.NestedMap(p, "vlan")
+		if found && len(vlan) > 0 {
+			bp.vlans, bp.allows = nmstateVLANs(vlan)
+		}
+		i.ports = append(i.ports, bp)
+	}
+
+	return i
+}
+
+// nmstateVLANs describes the VLAN filtering of a bridge port, e.g. "trunk 100,300-310" or "access 10"
+func nmstateVLANs(vlan map[string]any) (string, func(int) bool) {
+	mode, _, _ := unstructured.NestedString(vlan, "mode")
+	if mode == "" {
+		mode = "access"
+	}
+
+	type idRange struct{ min, max int64 }
+	var ranges []idRange
+	if tag, found := layout.NestedInt64(vlan, "tag"); found {
+		ranges = append(ranges, idRange{tag, tag})
+	}
+	for _, tag := range analysis.NestedMaps(vlan, "trunk-tags") {
+		if id, found := layout.NestedInt64(tag, "id"); found {
+			ranges = append(ranges, idRange{id, id})
+		}
+		minID, hasMin := layout.NestedInt64(tag, "id-range", "min")
+		maxID, hasMax := layout.NestedInt64(tag, "id-range", "max")
+		if hasMin && hasMax {
+			ranges = append(ranges, idRange{minID, maxID})
+		}
+	}
+
+	var tags []string
+	for _, r := range ranges {
+		if r.min == r.max {
+			tags = append(tags, strconv.FormatInt(r.min, 10))
+		} else {
+			tags = append(tags, fmt.Sprintf("%d-%d", r.min, r.max))
+		}
+	}
+	allows := func(id int) bool {
+		return slices.ContainsFunc(ranges, func(r idRange) bool { return int64(id) >= r.min && int64(id) <= r.max })
+	}
+
+	return strings.TrimSpace(mode + " " + strings.Join(tags, ",")), allows
+}
+
+func describeVLANs(p nodedata.PortVLANs) string {
+	var ids []string
+	for _, v := range p.VLANs {
+		if v.VLANEnd != 0 {
+			ids = append(ids, fmt.Sprintf("%d-%d", v.VLAN, v.VLANEnd))
+		} else {
+			ids = append(ids, strconv.Itoa(v.VLAN))
+		}
+	}
+	return "vlans " + strings.Join(ids, ",")
+}
+
+func (i iface) String() string {
+	parts := []string{strings.TrimSpace(i.typ + " " + i.state)}
+	if i.vlanID != 0 || i.baseIface != "" {
+		parts = append(parts, fmt.Sprintf("vlan %d on %s", i.vlanID, i.baseIface))
+	}
+	if len(i.ports) > 0 {
+		var ports []string
+		for _, p := range i.ports {
+			if p.vlans != "" {
+				ports = append(ports, fmt.Sprintf("%s (%s)", p.name, p.vlans))
+			} else {
+				ports = append(ports, p.name)
+			}
+		}
+		parts = append(parts, "ports "+strings.Join(ports, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// compare compares a desired interface with the actual interface of a node
+func compare(policy, node string, desired iface, s *nodeState) Interface {
+	result := Interface{Policy: policy, Node: node, Name: desired.name, Desired: desired.String(), Source: s.source}
+
+	actual, found := s.interfaces[desired.name]
+	switch {
+	case s.source == "":
+		result.Actual = "unknown"
+		result.Problems = append(result.Problems, "neither the NodeNetworkState nor the node files were collected")
+		return result
+	case !found:
+		result.Actual = "missing"
+		if desired.state != stateAbsent {
+			result.Problems = append(result.Problems, "the interface doesn't exist on the node")
+		}
+		return result
+	}
+	result.Actual = actual.String()
+
+	if desired.state == stateAbsent {
+		result.Problems = append(result.Problems, "the interface should be absent, but exists")
+		return result
+	}
+	if desired.state == stateUp && actual.state != stateUp {
+		result.Problems = append(result.Problems, fmt.Sprintf("the interface is %s", actual.state))
+	}
+	if desired.typ != "" && actual.typ != "" && desired.typ != actual.typ {
+		result.Problems = append(result.Problems, fmt.Sprintf("the interface is a %s, not a %s", actual.typ, desired.typ))
+	}
+	if desired.vlanID != 0 && actual.vlanID != 0 && (desired.vlanID != actual.vlanID || desired.baseIface != actual.baseIface) {
+		result.Problems = append(result.Problems, fmt.Sprintf("the VLAN is %d on %s, not %d on %s", actual.vlanID, actual.baseIface,
+			desired.vlanID, desired.baseIface))
+	}
+
+	actualPorts := make(map[string]port)
+	for _, p := range actual.ports {
+		actualPorts[p.name] = p
+	}
+	for _, p := range desired.ports {
+		a, found := actualPorts[p.name]
+		switch {
+		case !found:
+			result.Problems = append(result.Problems, fmt.Sprintf("port %s is not in the bridge", p.name))
+		case s.source == SourceNNS && p.vlans != a.vlans:
+			result.Problems = append(result.Problems, fmt.Sprintf("the VLANs of port %s are %q, not %q", p.name, a.vlans, p.vlans))
+		}
+	}
+
+	return result
+}
+
+// bridgeConfig is the part of a NetworkAttachmentDefinition config the bridge and OVS CNI plugins read
+type bridgeConfig struct {
+	Type    string         `json:"type"`
+	Bridge  string         `json:"bridge"`
+	VLAN    int            `json:"vlan"`
+	Plugins []bridgeConfig `json:"plugins"`
+}
+
+// checkAttachments checks the bridge and VLAN of the attachments used by running VMIs, on their nodes
+func checkAttachments(b *layout.Bundle, state func(string) (*nodeState, error)) ([]Attachment, error) {
+	nads, err := b.Objects(layout.NetworkAttachmentDefinitions)
+	if err != nil {
+		return nil, err
+	}
+	vmis, err := b.VirtualMachineInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	// the VMIs by attachment and node
+	users := make(map[string]map[string][]string)
+	for _, vmi := range vmis {
+		node, _, _ := unstructured.NestedString(vmi.Object, "status", "nodeName")
+		if node == "" {
+			continue
+		}
+		for _, network := range analysis.NestedMaps(vmi.Object, "spec", "networks") {
+			nad, _, _ := unstructured.NestedString(network, "multus", "networkName")
+			if nad == "" {
+				continue
+			}
+			if !strings.Contains(nad, "/") {
+				nad = vmi.GetNamespace() + "/" + nad
+			}
+			if users[nad] == nil {
+				users[nad] = make(map[string][]string)
+			}
+			users[nad][node] = append(users[nad][node], vmi.GetNamespace()+"/"+vmi.GetName())
+		}
+	}
+
+	attachments := []Attachment{}
+	for _, nad := range nads {
+		config, _, _ := unstructured.NestedString(nad.Object, "spec", "config")
+		bridge, ok := parseBridgeConfig(config)
+		if !ok {
+			continue
+		}
+
+		byNode := users[nad.GetNamespace()+"/"+nad.GetName()]
+		for _, node := range slices.Sorted(maps.Keys(byNode)) {
+			a := Attachment{
+				Namespace: nad.GetNamespace(), Name: nad.GetName(), Type: bridge.Type, Bridge: bridge.Bridge, VLAN: bridge.VLAN,
+				Node: node, VMs: byNode[node], Status: OK,
+			}
+			s, err := state(node)
+			if err != nil {
+				return nil, err
+			}
+			a.check(s)
+			attachments = append(attachments, a)
+		}
+	}
+
+	return attachments, nil
+}
+
+// parseBridgeConfig finds the bridge or OVS plugin of a CNI config, or of a CNI config list
+func parseBridgeConfig(config string) (bridgeConfig, bool) {
+	var c bridgeConfig
+	if err := json.Unmarshal([]byte(config), &c); err != nil {
+		return c, false
+	}
+	for _, plugin := range append([]bridgeConfig{c}, c.Plugins...) {
+		switch plugin.Type {
+		case "bridge", "cnv-bridge", "ovs":
+			return plugin, plugin.Bridge != ""
+		}
+	}
+	return c, false
+}
+
+func (a *Attachment) check(s *nodeState) {
+	if s.source == "" {
+		a.Status = Unknown
+		a.Problems = append(a.Problems, "neither the NodeNetworkState nor the node files were collected")
+		return
+	}
+
+	bridge, found := s.interfaces[a.Bridge]
+	switch {
+	case !found:
+		a.Problems = append(a.Problems, fmt.Sprintf("bridge %s doesn't exist on the node", a.Bridge))
+	case a.Type == "ovs" && s.source == SourceNNS && bridge.typ != ovsBridge:
+		a.Problems = append(a.Problems, fmt.Sprintf("%s is a %s, not an OVS bridge", a.Bridge, bridge.typ))
+	case a.Type != "ovs" && bridge.typ != "" && bridge.typ != linuxBridge:
+		a.Problems = append(a.Problems, fmt.Sprintf("%s is a %s, not a Linux bridge", a.Bridge, bridge.typ))
+	case bridge.state != stateUp:
+		a.Problems = append(a.Problems, fmt.Sprintf("bridge %s is %s", a.Bridge, bridge.state))
+	}
+
+	if found && a.VLAN != 0 && a.Type != "ovs" && !allowsVLAN(bridge, a.VLAN) {
+		a.Problems = append(a.Problems, fmt.Sprintf("VLAN %d is not allowed on any port of %s", a.VLAN, a.Bridge))
+	}
+
+	if len(a.Problems) > 0 {
+		a.Status = Broken
+	}
+}
+
+// allowsVLAN tells whether a VLAN can leave the bridge: a port without VLAN filtering, or a port that allows it
+func allowsVLAN(bridge iface, id int) bool {
+	if len(bridge.ports) == 0 {
+		return false
+	}
+	return slices.ContainsFunc(bridge.ports, func(p port) bool { return p.allows == nil || p.allows(id) })
+}
+
+// WriteText prints the policies, the interfaces, the failed enactments and the attachments as tables.
+func (r *Report) WriteText(w io.Writer) error {
+	t := analysis.NewTable(w)
+
+	if len(r.Policies) == 0 {
+		_, _ = fmt.Fprintln(t, "No NodeNetworkConfigurationPolicy was collected.")
+	} else {
+		_, _ = fmt.Fprintln(t, "POLICY\tSTATUS\tNODES\tMESSAGE")
+		for _, p := range r.Policies {
+			_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\n", p.Name, p.Status, strings.Join(p.Nodes, ", "), firstLine(p.Message))
+		}
+	}
+
+	if len(r.Interfaces) > 0 {
+		_, _ = fmt.Fprintln(t)
+		_, _ = fmt.Fprintln(t, "POLICY\tNODE\tINTERFACE\tDESIRED\tACTUAL\tSOURCE\tPROBLEMS")
+		for _, i := range r.Interfaces {
+			_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", i.Policy, i.Node, i.Name, i.Desired, i.Actual, i.Source,
+				strings.Join(i.Problems, "; "))
+		}
+	}
+
+	if len(r.Enactments) > 0 {
+		_, _ = fmt.Fprintln(t)
+		_, _ = fmt.Fprintln(t, "ENACTMENT\tSTATUS\tREASON\tMESSAGE")
+		for _, e := range r.Enactments {
+			_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\n", e.Name, e.Status, e.Reason, firstLine(e.Message))
+		}
+	}
+
+	if len(r.Attachments) > 0 {
+		_, _ = fmt.Fprintln(t)
+		_, _ = fmt.Fprintln(t, "NAMESPACE\tATTACHMENT\tBRIDGE\tVLAN\tNODE\tVMS\tSTATUS\tPROBLEMS")
+		for _, a := range r.Attachments {
+			vlan := ""
+			if a.VLAN != 0 {
+				vlan = strconv.Itoa(a.VLAN)
+			}
+			_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", a.Namespace, a.Name, a.Bridge, vlan, a.Node,
+				strings.Join(a.VMs, ", "), a.Status, strings.Join(a.Problems, "; "))
+		}
+	}
+
+	return t.Flush()
+}
+
+// firstLine returns the first line of a condition message that mentions an error, or its first line; the messages
+// of nmstate hold the whole log of the failure
+func firstLine(message string) string {
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+	for _, line := range lines {
+		if strings.Contains(strings.ToLower(line), "error") {
+			return strings.Trim(line, " '")
+		}
+	}
+	return strings.TrimSpace(lines[0])
+}
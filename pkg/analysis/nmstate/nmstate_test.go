@@ -0,0 +1,99 @@
+package nmstate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/analysis/analysistest"
+)
+
+func TestPolicies(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	if len(report.Policies) != 2 {
+		t.Fatalf("expected 2 policies, but got %+v", report.Policies)
+	}
+	if p := report.Policies[0]; p.Name != "br1-policy" || p.Status != "Degraded" || strings.Join(p.Nodes, ",") != "node01,node02,node03" {
+		t.Errorf("unexpected policy: %+v", p)
+	}
+	if p := report.Policies[1]; p.Status != "Available" || strings.Join(p.Nodes, ",") != "node01" {
+		t.Errorf("unexpected policy: %+v", p)
+	}
+}
+
+func TestInterfaces(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	expected := map[string]string{
+		"br1-policy/node01/br1":      "the VLANs of port ens4",
+		"br1-policy/node01/ens4.200": "",
+		"br1-policy/node02/br1":      "",
+		"br1-policy/node02/ens4.200": "",
+		"br1-policy/node03/br1":      "were collected",
+		"br1-policy/node03/ens4.200": "were collected",
+		"cleanup/node01/old-br":      "should be absent",
+	}
+	if len(report.Interfaces) != len(expected) {
+		t.Fatalf("expected %d interfaces, but got %+v", len(expected), report.Interfaces)
+	}
+	for _, i := range report.Interfaces {
+		problems := strings.Join(i.Problems, "; ")
+		e := expected[i.Policy+"/"+i.Node+"/"+i.Name]
+		if (e == "" && problems != "") || !strings.Contains(problems, e) {
+			t.Errorf("expected %q for %s on %s, but got %q", e, i.Name, i.Node, problems)
+		}
+	}
+
+	// node02 has no NodeNetworkState; its bridge ports come from ip a, without the veth of the pods
+	if i := report.Interfaces[2]; i.Source != SourceNodeFiles || i.Actual != "linux-bridge up; ports ens4 (vlans 1,100,300-310)" {
+		t.Errorf("unexpected interface from the node files: %+v", i)
+	}
+}
+
+func TestEnactments(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	if len(report.Enactments) != 1 {
+		t.Fatalf("expected 1 failed enactment, but got %+v", report.Enactments)
+	}
+	if e := report.Enactments[0]; e.Node != "node03" || e.Policy != "br1-policy" || e.Status != "Failing" {
+		t.Errorf("unexpected enactment: %+v", e)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	expected := []struct {
+		name, node, status, problem string
+	}{
+		{"br1-vlan100", "node01", OK, ""},
+		{"br1-vlan100", "node03", Unknown, "were collected"},
+		{"br1-vlan200", "node02", Broken, "VLAN 200 is not allowed"},
+		{"br2", "node01", Broken, "bridge br2 doesn't exist"},
+		{"ovs", "node01", OK, ""},
+	}
+	if len(report.Attachments) != len(expected) {
+		t.Fatalf("expected %d attachments, but got %+v", len(expected), report.Attachments)
+	}
+	for i, e := range expected {
+		a := report.Attachments[i]
+		if a.Name != e.name || a.Node != e.node || a.Status != e.status || !strings.Contains(strings.Join(a.Problems, "; "), e.problem) {
+			t.Errorf("expected %+v, but got %+v", e, a)
+		}
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := analysistest.Analyze(t, "testdata/must-gather", Analyze).WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"NmstateError: InvalidArgument: Interface ens4 not found\n", "br1-vlan200", "linux-bridge absent"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in\n%s", expected, buf.String())
+		}
+	}
+}
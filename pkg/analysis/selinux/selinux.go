@@ -0,0 +1,245 @@
+// Package selinux reports the SELinux AVC denials of the audit.log of each node. The denials are grouped by source
+// context, target context, class and permissions, and tied to pods and VMs through the pod UID in the path of their
+// target, e.g. the kubelet volume of a disk or the cgroup of a container.
+package selinux
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/nodedata"
+)
+
+// Components the denials are attributed to.
+const (
+	ComponentQEMU         = "qemu"
+	ComponentVirtLauncher = "virt-launcher"
+	ComponentVirtHandler  = "virt-handler"
+	ComponentCDI          = "cdi"
+)
+
+// maxPaths is the number of distinct target paths kept for a denial
+const maxPaths = 5
+
+// Denial is the AVC denials with the same source context, target context, class and permissions.
+type Denial struct {
+	// Component is the virtualization component of the denied process, or empty for the other processes.
+	Component   string    `json:"component,omitempty"`
+	SContext    string    `json:"scontext"`
+	TContext    string    `json:"tcontext"`
+	TClass      string    `json:"tclass"`
+	Permissions []string  `json:"permissions"`
+	Count       int       `json:"count"`
+	First       time.Time `json:"first"`
+	Last        time.Time `json:"last"`
+	// Permissive is the number of denials that were allowed anyway, as the domain or the node is permissive.
+	Permissive int      `json:"permissive"`
+	Comms      []string `json:"comms"`
+	// Paths is the first distinct paths, or names, of the targets.
+	Paths []string `json:"paths"`
+	Nodes []string `json:"nodes"`
+	Pods  []string `json:"pods"`
+	VMs   []string `json:"vms"`
+}
+
+// Node is the audit.log of a node.
+type Node struct {
+	Name string `json:"name"`
+	// Collected tells whether the audit.log of the node was collected.
+	Collected bool `json:"collected"`
+	Records   int  `json:"records"`
+	// Skipped is the number of lines too long to be a record.
+	Skipped int `json:"skipped,omitempty"`
+	Denials int `json:"denials"`
+}
+
+// Report is the result of the selinux check.
+type Report struct {
+	Nodes   []Node   `json:"nodes"`
+	Denials []Denial `json:"denials"`
+}
+
+// Analyze reads the audit.log of each node.
+func Analyze(b *layout.Bundle) (*Report, error) {
+	report := &Report{Nodes: []Node{}, Denials: []Denial{}}
+
+	pods, err := podsByUID(b)
+	if err != nil {
+		return nil, err
+	}
+	vmis, err := analysis.VMIsByPodUID(b)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := b.Nodes()
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int)
+	for _, name := range nodes {
+		data, err := b.ReadNodeFile(name, layout.NodeAuditLog)
+		if errors.Is(err, fs.ErrNotExist) {
+			report.Nodes = append(report.Nodes, Node{Name: name})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		records, skipped := nodedata.ParseAuditLog(data)
+		node := Node{Name: name, Collected: true, Records: len(records), Skipped: skipped}
+		for _, r := range records {
+			avc, ok, err := nodedata.ParseAVC(r)
+			if err != nil || !ok || !avc.Denied {
+				continue
+			}
+			node.Denials++
+
+			key := strings.Join([]string{avc.SContext, avc.TContext, avc.TClass, strings.Join(avc.Permissions, " ")}, "|")
+			i, found := index[key]
+			if !found {
+				i = len(report.Denials)
+				index[key] = i
+				report.Denials = append(report.Denials, Denial{
+					SContext: avc.SContext, TContext: avc.TContext, TClass: avc.TClass, Permissions: avc.Permissions,
+					First: avc.Time, Last: avc.Time,
+					Comms: []string{}, Paths: []string{}, Nodes: []string{}, Pods: []string{}, VMs: []string{},
+				})
+			}
+			add(&report.Denials[i], name, avc, pods, vmis)
+		}
+		report.Nodes = append(report.Nodes, node)
+	}
+
+	// the denials of the virtualization components come first, the most frequent first
+	slices.SortStableFunc(report.Denials, func(a, b Denial) int {
+		if (a.Component == "") != (b.Component == "") {
+			if a.Component == "" {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Or(cmp.Compare(b.Count, a.Count), a.First.Compare(b.First))
+	})
+
+	return report, nil
+}
+
+// podsByUID returns the namespace/name of the collected pods by UID
+func podsByUID(b *layout.Bundle) (map[string]string, error) {
+	objects, err := b.Objects(layout.Pods)
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make(map[string]string, len(objects))
+	for _, pod := range objects {
+		pods[string(pod.GetUID())] = pod.Key()
+	}
+	return pods, nil
+}
+
+// add counts an AVC denial in its group
+func add(d *Denial, node string, avc nodedata.AVC, pods map[string]string, vmis map[string]layout.VMRef) {
+	d.Count++
+	if avc.Time.Before(d.First) {
+		d.First = avc.Time
+	}
+	if avc.Time.After(d.Last) {
+		d.Last = avc.Time
+	}
+	if avc.Permissive {
+		d.Permissive++
+	}
+
+	d.Nodes = appendUnique(d.Nodes, node)
+	d.Comms = appendUnique(d.Comms, avc.Comm)
+	if len(d.Paths) < maxPaths {
+		d.Paths = appendUnique(d.Paths, avc.Path)
+	}
+
+	uid := analysis.PodUID(avc.Path)
+	vmi, isLauncher := vmis[uid]
+	if pod := pods[uid]; pod != "" {
+		d.Pods = appendUnique(d.Pods, pod)
+	}
+	if isLauncher {
+		d.VMs = appendUnique(d.VMs, vmi.String())
+	}
+
+	if component := component(avc, isLauncher); d.Component == "" || component == ComponentQEMU {
+		d.Component = component
+	}
+}
+
+// component tells which virtualization component a denied process is, from its command and its SELinux type
+func component(avc nodedata.AVC, launcherPod bool) string {
+	domain := ""
+	if fields := strings.Split(avc.SContext, ":"); len(fields) >= 3 {
+		domain = fields[2]
+	}
+
+	comm := avc.Comm
+	switch {
+	case domain == "svirt_t" || domain == "svirt_tcg_t" || comm == "qemu-kvm" || strings.HasSuffix(comm, "/KVM"):
+		return ComponentQEMU
+	case domain == "virt_launcher.process" || strings.HasPrefix(comm, "virt-launcher") ||
+		comm == "virtqemud" || comm == "virtlogd" || launcherPod:
+		return ComponentVirtLauncher
+	case strings.HasPrefix(comm, "virt-handler") || strings.HasPrefix(comm, "virt-chroot"):
+		return ComponentVirtHandler
+	case strings.HasPrefix(comm, "cdi-") || comm == "qemu-img":
+		return ComponentCDI
+	}
+	return ""
+}
+
+func appendUnique(values []string, value string) []string {
+	if value == "" || slices.Contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+// WriteText prints the audit.log of each node, and the denials.
+func (r *Report) WriteText(w io.Writer) error {
+	t := analysis.NewTable(w)
+
+	_, _ = fmt.Fprintln(t, "NODE\tRECORDS\tDENIALS")
+	for _, n := range r.Nodes {
+		if !n.Collected {
+			_, _ = fmt.Fprintf(t, "%s\tthe audit.log was not collected\n", n.Name)
+			continue
+		}
+		_, _ = fmt.Fprintf(t, "%s\t%d\t%d\n", n.Name, n.Records, n.Denials)
+		if n.Skipped > 0 {
+			_, _ = fmt.Fprintf(t, "%s\t%d lines too long to be read were skipped\n", n.Name, n.Skipped)
+		}
+	}
+
+	if len(r.Denials) > 0 {
+		_, _ = fmt.Fprintln(t)
+		_, _ = fmt.Fprintln(t, "COMPONENT\tCOUNT\tFIRST\tLAST\tSCONTEXT\tTCONTEXT\tTCLASS\tPERMISSIONS\tCOMMS\tNODES\tVMS\tPODS\tPATHS")
+		for _, d := range r.Denials {
+			component := d.Component
+			if d.Permissive == d.Count {
+				component = strings.TrimSpace(component + " (permissive)")
+			}
+			_, _ = fmt.Fprintf(t, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t{ %s }\t%s\t%s\t%s\t%s\t%s\n", component, d.Count,
+				d.First.Format(time.RFC3339), d.Last.Format(time.RFC3339), d.SContext, d.TContext, d.TClass,
+				strings.Join(d.Permissions, " "), strings.Join(d.Comms, ","), strings.Join(d.Nodes, ","),
+				strings.Join(d.VMs, ","), strings.Join(d.Pods, ","), strings.Join(d.Paths, ","))
+		}
+	}
+
+	return t.Flush()
+}
@@ -0,0 +1,105 @@
+package selinux
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubevirt/must-gather/pkg/analysis/analysistest"
+)
+
+func analyzeFixture(t *testing.T) *Report {
+	t.Helper()
+
+	// node03 was gathered without an audit.log
+	root := analysistest.Copy(t, "testdata/must-gather")
+	if err := os.MkdirAll(filepath.Join(root, "nodes", "node03"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	return analysistest.Analyze(t, root, Analyze)
+}
+
+func TestNodes(t *testing.T) {
+	report := analyzeFixture(t)
+
+	expected := []Node{
+		{Name: "node01", Collected: true, Records: 13, Denials: 8},
+		{Name: "node02", Collected: true, Records: 2, Denials: 1},
+		{Name: "node03"},
+	}
+	if len(report.Nodes) != len(expected) {
+		t.Fatalf("expected %d nodes, but got %+v", len(expected), report.Nodes)
+	}
+	for i, e := range expected {
+		if report.Nodes[i] != e {
+			t.Errorf("expected %+v, but got %+v", e, report.Nodes[i])
+		}
+	}
+}
+
+func TestDenials(t *testing.T) {
+	report := analyzeFixture(t)
+
+	expected := []struct {
+		component, tcontext, permissions string
+		count                            int
+		vms, pods                        string
+	}{
+		{ComponentQEMU, "system_u:object_r:vfio_device_t:s0", "read write", 3, "", ""},
+		{ComponentVirtLauncher, "system_u:object_r:cgroup_t:s0", "write", 2, "ns1/fedora", "ns1/virt-launcher-fedora-abcde"},
+		{ComponentQEMU, "system_u:object_r:vfio_device_t:s0", "ioctl", 1, "", ""},
+		{ComponentQEMU, "system_u:object_r:container_file_t:s0:c12,c907", "read", 1, "ns1/fedora", "ns1/virt-launcher-fedora-abcde"},
+		{ComponentCDI, "system_u:object_r:nfs_t:s0", "write", 1, "", "ns1/importer-prime-0c9d"},
+		{"", "system_u:object_r:container_var_lib_t:s0", "search", 1, "", ""},
+	}
+	if len(report.Denials) != len(expected) {
+		t.Fatalf("expected %d denials, but got %+v", len(expected), report.Denials)
+	}
+	for i, e := range expected {
+		d := report.Denials[i]
+		if d.Component != e.component || d.TContext != e.tcontext || strings.Join(d.Permissions, " ") != e.permissions ||
+			d.Count != e.count || strings.Join(d.VMs, ",") != e.vms || strings.Join(d.Pods, ",") != e.pods {
+			t.Errorf("expected %+v, but got %+v", e, d)
+		}
+	}
+
+	d := report.Denials[0]
+	if strings.Join(d.Nodes, ",") != "node01,node02" || strings.Join(d.Comms, ",") != "qemu-kvm" ||
+		!d.First.Equal(time.Unix(1792400100, 512_000_000)) || !d.Last.Equal(time.Unix(1792403000, 250_000_000)) {
+		t.Errorf("unexpected denial: %+v", d)
+	}
+	if d := report.Denials[2]; strings.Join(d.Comms, ",") != "CPU 1/KVM" {
+		t.Errorf("expected the decoded comm, but got %+v", d)
+	}
+	if d := report.Denials[1]; len(d.Paths) != 2 {
+		t.Errorf("expected the name and the path of the targets, but got %+v", d.Paths)
+	}
+	if d := report.Denials[5]; d.Permissive != 1 {
+		t.Errorf("expected a permissive denial, but got %+v", d)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	report := analyzeFixture(t)
+
+	var out bytes.Buffer
+	if err := report.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"the audit.log was not collected",
+		"{ read write }",
+		"ns1/fedora",
+		"(permissive)",
+		"2026-10-19T08:55:00Z",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, out.String())
+		}
+	}
+}
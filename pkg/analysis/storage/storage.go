@@ -0,0 +1,481 @@
+// Package storage follows each volume of the VMs through the collected storage objects: DataVolume, PVC, PV,
+// StorageClass, CSI driver and VolumeAttachment, and reports what can keep a VM from starting or migrating.
+package storage
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+const (
+	readWriteMany  = "ReadWriteMany"
+	filesystemMode = "Filesystem"
+	blockMode      = "Block"
+	noProvisioner  = "kubernetes.io/no-provisioner"
+
+	dvSucceeded            = "Succeeded"
+	dvFailed               = "Failed"
+	dvWaitForFirstConsumer = "WaitForFirstConsumer"
+)
+
+// DataVolume is the DataVolume of a volume.
+type DataVolume struct {
+	Name       string `json:"name"`
+	Phase      string `json:"phase"`
+	Progress   string `json:"progress,omitempty"`
+	VolumeMode string `json:"volumeMode,omitempty"`
+}
+
+// PVC is the PersistentVolumeClaim of a volume.
+type PVC struct {
+	Name         string   `json:"name"`
+	Phase        string   `json:"phase"`
+	AccessModes  []string `json:"accessModes"`
+	VolumeMode   string   `json:"volumeMode"`
+	StorageClass string   `json:"storageClass,omitempty"`
+	VolumeName   string   `json:"volumeName,omitempty"`
+}
+
+// PV is the PersistentVolume bound to the claim of a volume.
+type PV struct {
+	Name        string   `json:"name"`
+	Phase       string   `json:"phase"`
+	AccessModes []string `json:"accessModes"`
+	VolumeMode  string   `json:"volumeMode"`
+	Driver      string   `json:"driver,omitempty"`
+	// NodeAffinity lists the node affinity terms of the PV, e.g. "kubernetes.io/hostname in (node01)".
+	NodeAffinity []string `json:"nodeAffinity,omitempty"`
+}
+
+// StorageClass is the StorageClass of the claim of a volume.
+type StorageClass struct {
+	Name              string `json:"name"`
+	Provisioner       string `json:"provisioner"`
+	VolumeBindingMode string `json:"volumeBindingMode,omitempty"`
+}
+
+// Attachment is a VolumeAttachment of the PV of a volume.
+type Attachment struct {
+	Name     string `json:"name"`
+	Node     string `json:"node"`
+	Attached bool   `json:"attached"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Volume is a VM volume backed by a claim, and the storage objects found for it.
+type Volume struct {
+	Namespace    string        `json:"namespace"`
+	VM           string        `json:"vm"`
+	Volume       string        `json:"volume"`
+	Node         string        `json:"node,omitempty"`
+	DataVolume   *DataVolume   `json:"dataVolume,omitempty"`
+	PVC          *PVC          `json:"pvc,omitempty"`
+	PV           *PV           `json:"pv,omitempty"`
+	StorageClass *StorageClass `json:"storageClass,omitempty"`
+	Attachments  []Attachment  `json:"attachments,omitempty"`
+	Issues       []string      `json:"issues"`
+}
+
+// Report is the result of the storage check.
+type Report struct {
+	Volumes []Volume `json:"volumes"`
+}
+
+// Analyze follows the volumes of all the collected VMs.
+func Analyze(b *layout.Bundle) (*Report, error) {
+	idx, err := newIndex(b)
+	if err != nil {
+		return nil, err
+	}
+
+	vms, err := b.VirtualMachines()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Volumes: []Volume{}}
+	for _, vm := range vms {
+		report.Volumes = append(report.Volumes, idx.vmVolumes(vm)...)
+	}
+
+	return report, nil
+}
+
+// index holds the collected objects, by key
+type index struct {
+	defaultEviction string
+	dvs             map[string]layout.Object
+	pvcs            map[string]layout.Object
+	pvs             map[string]layout.Object
+	scs             map[string]layout.Object
+	csiDrivers      map[string]layout.Object
+	csiNodes        map[string]layout.Object
+	vmis            map[string]layout.Object
+	attachments     []layout.Object
+}
+
+func newIndex(b *layout.Bundle) (*index, error) {
+	idx := &index{}
+
+	var err error
+	if idx.defaultEviction, err = analysis.DefaultEvictionStrategy(b); err != nil {
+		return nil, err
+	}
+
+	if idx.dvs, err = byKey(b, layout.DataVolumes); err != nil {
+		return nil, err
+	}
+	if idx.pvcs, err = byKey(b, layout.PersistentVolumeClaims); err != nil {
+		return nil, err
+	}
+	if idx.pvs, err = byKey(b, layout.PersistentVolumes); err != nil {
+		return nil, err
+	}
+	if idx.scs, err = byKey(b, layout.StorageClasses); err != nil {
+		return nil, err
+	}
+	if idx.csiDrivers, err = byKey(b, layout.CSIDrivers); err != nil {
+		return nil, err
+	}
+	if idx.csiNodes, err = byKey(b, layout.CSINodes); err != nil {
+		return nil, err
+	}
+	if idx.vmis, err = byKey(b, layout.VirtualMachineInstances); err != nil {
+		return nil, err
+	}
+	if idx.attachments, err = b.Objects(layout.VolumeAttachments); err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+func byKey(b *layout.Bundle, gr schema.GroupResource) (map[string]layout.Object, error) {
+	objs, err := b.Objects(gr)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]layout.Object, len(objs))
+	for _, obj := range objs {
+		m[obj.Key()] = obj
+	}
+	return m, nil
+}
+
+// vmVolumes follows the volumes of a VM that are backed by a DataVolume or a PVC
+func (idx *index) vmVolumes(vm layout.Object) []Volume {
+	ns := vm.GetNamespace()
+
+	strategy, _, _ := unstructured.NestedString(vm.Object, "spec", "template", "spec", "evictionStrategy")
+	if strategy == "" {
+		strategy = idx.defaultEviction
+	}
+
+	node := ""
+	if vmi, found := idx.vmis[ns+"/"+vm.GetName()]; found {
+		node, _, _ = unstructured.NestedString(vmi.Object, "status", "nodeName")
+	}
+
+	luns := make(map[string]bool)
+	for _, disk := range analysis.NestedMaps(vm.Object, "spec", "template", "spec", "domain", "devices", "disks") {
+		if _, found := disk["lun"]; found {
+			name, _, _ := unstructured.NestedString(disk, "name")
+			luns[name] = true
+		}
+	}
+
+	var volumes []Volume
+	for _, vol := range analysis.NestedMaps(vm.Object, "spec", "template", "spec", "volumes") {
+		dvName, _, _ := unstructured.NestedString(vol, "dataVolume", "name")
+		claimName, _, _ := unstructured.NestedString(vol, "persistentVolumeClaim", "claimName")
+		if dvName == "" && claimName == "" {
+			continue
+		}
+
+		v := Volume{Namespace: ns, VM: vm.GetName(), Node: node, Issues: []string{}}
+		v.Volume, _, _ = unstructured.NestedString(vol, "name")
+
+		if dvName != "" {
+			claimName = dvName
+			idx.followDataVolume(&v, dvName, node != "")
+		}
+		idx.followClaim(&v, claimName)
+
+		if v.PVC != nil {
+			if v.PVC.Phase == "Bound" && !slices.Contains(v.PVC.AccessModes, readWriteMany) &&
+				(strategy == analysis.EvictionLiveMigrate || strategy == analysis.EvictionLiveMigrateIfPossible) {
+				v.addIssue("the eviction strategy is %s, but PVC %s is not ReadWriteMany (%s), so the VM can't be live migrated",
+					strategy, v.PVC.Name, strings.Join(v.PVC.AccessModes, ", "))
+			}
+			if luns[v.Volume] && v.PVC.VolumeMode != blockMode {
+				v.addIssue("the volume is a LUN disk, but PVC %s has volume mode %s", v.PVC.Name, v.PVC.VolumeMode)
+			}
+		}
+
+		volumes = append(volumes, v)
+	}
+
+	return volumes
+}
+
+func (v *Volume) addIssue(format string, args ...any) {
+	v.Issues = append(v.Issues, fmt.Sprintf(format, args...))
+}
+
+func (idx *index) followDataVolume(v *Volume, name string, running bool) {
+	obj, found := idx.dvs[v.Namespace+"/"+name]
+	if !found {
+		// CDI removes the DataVolumes of succeeded imports, so only the missing PVC is an issue
+		return
+	}
+
+	dv := &DataVolume{Name: name}
+	dv.Phase, _, _ = unstructured.NestedString(obj.Object, "status", "phase")
+	dv.Progress, _, _ = unstructured.NestedString(obj.Object, "status", "progress")
+	dv.VolumeMode, _, _ = unstructured.NestedString(obj.Object, "spec", "pvc", "volumeMode")
+	if dv.VolumeMode == "" {
+		dv.VolumeMode, _, _ = unstructured.NestedString(obj.Object, "spec", "storage", "volumeMode")
+	}
+	v.DataVolume = dv
+
+	switch dv.Phase {
+	case dvSucceeded:
+	case dvWaitForFirstConsumer:
+		// expected until the VM starts
+		if running {
+			v.addIssue("DataVolume %s waits for its first consumer, but the VM is running", name)
+		}
+	case dvFailed:
+		v.addIssue("DataVolume %s failed%s", name, runningCondition(obj))
+	default:
+		progress := ""
+		if dv.Progress != "" && dv.Progress != "N/A" {
+			progress = " at " + dv.Progress
+		}
+		restarts, _ := layout.NestedInt64(obj.Object, "status", "restartCount")
+		if restarts > 0 {
+			progress += fmt.Sprintf(", %d restarts", restarts)
+		}
+		v.addIssue("DataVolume %s is in phase %s%s%s", name, dv.Phase, progress, runningCondition(obj))
+	}
+}
+
+// runningCondition returns the reason and message of the Running condition of a DataVolume, when it is not running
+func runningCondition(dv layout.Object) string {
+	cond, found := analysis.GetCondition(dv, "Running")
+	if !found || cond.Status == "True" || (cond.Reason == "" && cond.Message == "") {
+		return ""
+	}
+	return fmt.Sprintf(" (%s: %s)", cond.Reason, cond.Message)
+}
+
+func (idx *index) followClaim(v *Volume, name string) {
+	obj, found := idx.pvcs[v.Namespace+"/"+name]
+	if !found {
+		v.addIssue("PVC %s was not collected", name)
+		return
+	}
+
+	pvc := &PVC{Name: name}
+	pvc.Phase, _, _ = unstructured.NestedString(obj.Object, "status", "phase")
+	pvc.AccessModes, _, _ = unstructured.NestedStringSlice(obj.Object, "status", "accessModes")
+	if len(pvc.AccessModes) == 0 {
+		pvc.AccessModes, _, _ = unstructured.NestedStringSlice(obj.Object, "spec", "accessModes")
+	}
+	pvc.VolumeMode = volumeMode(obj)
+	pvc.StorageClass, _, _ = unstructured.NestedString(obj.Object, "spec", "storageClassName")
+	pvc.VolumeName, _, _ = unstructured.NestedString(obj.Object, "spec", "volumeName")
+	v.PVC = pvc
+
+	switch pvc.Phase {
+	case "Pending", "Lost":
+		v.addIssue("PVC %s is %s", name, pvc.Phase)
+	}
+
+	if v.DataVolume != nil && v.DataVolume.VolumeMode != "" && v.DataVolume.VolumeMode != pvc.VolumeMode {
+		v.addIssue("DataVolume %s asks for volume mode %s, but PVC %s has %s", v.DataVolume.Name, v.DataVolume.VolumeMode, name, pvc.VolumeMode)
+	}
+
+	idx.followStorageClass(v, pvc.StorageClass)
+	if pvc.VolumeName != "" {
+		idx.followPV(v, pvc.VolumeName)
+	}
+}
+
+func (idx *index) followStorageClass(v *Volume, name string) {
+	if name == "" {
+		return
+	}
+
+	obj, found := idx.scs[name]
+	if !found {
+		v.addIssue("StorageClass %s was not collected", name)
+		return
+	}
+
+	sc := &StorageClass{Name: name}
+	sc.Provisioner, _, _ = unstructured.NestedString(obj.Object, "provisioner")
+	sc.VolumeBindingMode, _, _ = unstructured.NestedString(obj.Object, "volumeBindingMode")
+	v.StorageClass = sc
+
+	// the CSIDrivers may not have been collected at all; only report a missing one if others are there
+	if len(idx.csiDrivers) > 0 && sc.Provisioner != noProvisioner && !strings.HasPrefix(sc.Provisioner, "kubernetes.io/") {
+		if _, found = idx.csiDrivers[sc.Provisioner]; !found {
+			v.addIssue("there is no CSIDriver for the provisioner %s of StorageClass %s", sc.Provisioner, name)
+		}
+	}
+}
+
+func (idx *index) followPV(v *Volume, name string) {
+	obj, found := idx.pvs[name]
+	if !found {
+		v.addIssue("PV %s was not collected", name)
+		return
+	}
+
+	pv := &PV{Name: name}
+	pv.Phase, _, _ = unstructured.NestedString(obj.Object, "status", "phase")
+	pv.AccessModes, _, _ = unstructured.NestedStringSlice(obj.Object, "spec", "accessModes")
+	pv.VolumeMode = volumeMode(obj)
+	pv.Driver, _, _ = unstructured.NestedString(obj.Object, "spec", "csi", "driver")
+	v.PV = pv
+
+	switch pv.Phase {
+	case "Released", "Failed":
+		v.addIssue("PV %s is %s", name, pv.Phase)
+	}
+
+	if v.PVC != nil && v.PVC.VolumeMode != pv.VolumeMode {
+		v.addIssue("PVC %s has volume mode %s, but PV %s has %s", v.PVC.Name, v.PVC.VolumeMode, name, pv.VolumeMode)
+	}
+
+	pinned := false
+	for _, term := range analysis.NestedMaps(obj.Object, "spec", "nodeAffinity", "required", "nodeSelectorTerms") {
+		for _, expr := range analysis.NestedMaps(term, "matchExpressions") {
+			key, _, _ := unstructured.NestedString(expr, "key")
+			operator, _, _ := unstructured.NestedString(expr, "operator")
+			values, _, _ := unstructured.NestedStringSlice(expr, "values")
+			pv.NodeAffinity = append(pv.NodeAffinity, fmt.Sprintf("%s %s (%s)", key, strings.ToLower(operator), strings.Join(values, ", ")))
+			if isNodeKey(key) {
+				pinned = true
+			}
+		}
+	}
+	if pinned {
+		v.addIssue("PV %s is pinned to nodes by its node affinity: %s", name, strings.Join(pv.NodeAffinity, "; "))
+	}
+
+	if pv.Driver != "" && v.Node != "" {
+		if csiNode, found := idx.csiNodes[v.Node]; found && !hasDriver(csiNode, pv.Driver) {
+			v.addIssue("the CSI driver %s is not registered on node %s", pv.Driver, v.Node)
+		}
+	}
+
+	idx.followAttachments(v, name)
+}
+
+// isNodeKey tells whether a node affinity key selects single nodes, and not e.g. zones
+func isNodeKey(key string) bool {
+	return key == "kubernetes.io/hostname" || strings.HasSuffix(key, "/hostname") || strings.HasSuffix(key, "/node")
+}
+
+func hasDriver(csiNode layout.Object, driver string) bool {
+	for _, d := range analysis.NestedMaps(csiNode.Object, "spec", "drivers") {
+		if name, _, _ := unstructured.NestedString(d, "name"); name == driver {
+			return true
+		}
+	}
+	return false
+}
+
+func (idx *index) followAttachments(v *Volume, pvName string) {
+	for _, obj := range idx.attachments {
+		if name, _, _ := unstructured.NestedString(obj.Object, "spec", "source", "persistentVolumeName"); name != pvName {
+			continue
+		}
+
+		a := Attachment{Name: obj.GetName()}
+		a.Node, _, _ = unstructured.NestedString(obj.Object, "spec", "nodeName")
+		a.Attached, _, _ = unstructured.NestedBool(obj.Object, "status", "attached")
+		if msg, _, _ := unstructured.NestedString(obj.Object, "status", "attachError", "message"); msg != "" {
+			a.Error = msg
+			v.addIssue("VolumeAttachment %s to node %s failed: %s", a.Name, a.Node, msg)
+		} else if msg, _, _ = unstructured.NestedString(obj.Object, "status", "detachError", "message"); msg != "" {
+			a.Error = msg
+			v.addIssue("VolumeAttachment %s can't be detached from node %s: %s", a.Name, a.Node, msg)
+		}
+		v.Attachments = append(v.Attachments, a)
+	}
+}
+
+func volumeMode(obj layout.Object) string {
+	if mode, _, _ := unstructured.NestedString(obj.Object, "spec", "volumeMode"); mode != "" {
+		return mode
+	}
+	return filesystemMode
+}
+
+// chain describes the objects found for the volume, e.g. "dv/disk (Succeeded) > pvc/disk (Bound, RWX, Block) > ..."
+func (v *Volume) chain() string {
+	var links []string
+	if v.DataVolume != nil {
+		links = append(links, fmt.Sprintf("dv/%s (%s)", v.DataVolume.Name, v.DataVolume.Phase))
+	}
+	if v.PVC != nil {
+		links = append(links, fmt.Sprintf("pvc/%s (%s, %s, %s)", v.PVC.Name, v.PVC.Phase, shortModes(v.PVC.AccessModes), v.PVC.VolumeMode))
+	}
+	if v.PV != nil {
+		links = append(links, fmt.Sprintf("pv/%s (%s)", v.PV.Name, v.PV.Phase))
+	}
+	if v.StorageClass != nil {
+		links = append(links, fmt.Sprintf("sc/%s (%s)", v.StorageClass.Name, v.StorageClass.Provisioner))
+	}
+	for _, a := range v.Attachments {
+		state := "attached"
+		if !a.Attached {
+			state = "not attached"
+		}
+		links = append(links, fmt.Sprintf("%s to %s", state, a.Node))
+	}
+	return strings.Join(links, " > ")
+}
+
+func shortModes(modes []string) string {
+	short := make([]string, 0, len(modes))
+	for _, mode := range modes {
+		switch mode {
+		case "ReadWriteOnce":
+			short = append(short, "RWO")
+		case "ReadWriteMany":
+			short = append(short, "RWX")
+		case "ReadOnlyMany":
+			short = append(short, "ROX")
+		case "ReadWriteOncePod":
+			short = append(short, "RWOP")
+		default:
+			short = append(short, mode)
+		}
+	}
+	return strings.Join(short, "+")
+}
+
+// WriteText prints the report as a table.
+func (r *Report) WriteText(w io.Writer) error {
+	t := analysis.NewTable(w)
+
+	_, _ = fmt.Fprintln(t, "NAMESPACE\tVM\tVOLUME\tSTORAGE\tISSUES")
+	for _, v := range r.Volumes {
+		_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\n", v.Namespace, v.VM, v.Volume, v.chain(), strings.Join(v.Issues, "; "))
+	}
+
+	return t.Flush()
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/analysis/analysistest"
+)
+
+func TestAnalyze(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	if len(report.Volumes) != 3 {
+		t.Fatalf("expected 3 volumes, but got %+v", report.Volumes)
+	}
+
+	tests := []struct {
+		vm, volume string
+		issues     []string
+	}{
+		{vm: "db", volume: "rootdisk", issues: []string{
+			"not ReadWriteMany (ReadWriteOnce), so the VM can't be live migrated",
+			"PVC db-root has volume mode Block, but PV local-pv-1 has Filesystem",
+			"PV local-pv-1 is pinned to nodes by its node affinity: kubernetes.io/hostname in (node01)",
+		}},
+		{vm: "db", volume: "data", issues: []string{
+			"PVC db-data is Pending",
+			"the volume is a LUN disk, but PVC db-data has volume mode Filesystem",
+		}},
+		{vm: "importer", volume: "rootdisk", issues: []string{
+			"DataVolume importer-root is in phase ImportInProgress at 45.00%, 3 restarts (Error: Unable to connect to http data source)",
+			"the CSI driver kubevirt.io.hostpath-provisioner is not registered on node node02",
+			"VolumeAttachment csi-0123456789 to node node02 failed: rpc error: code = Internal desc = device busy",
+		}},
+	}
+
+	for i, test := range tests {
+		v := report.Volumes[i]
+		if v.VM != test.vm || v.Volume != test.volume {
+			t.Errorf("expected volume %s/%s, but got %s/%s", test.vm, test.volume, v.VM, v.Volume)
+			continue
+		}
+		if len(v.Issues) != len(test.issues) {
+			t.Errorf("%s/%s: expected %d issues, but got %q", v.VM, v.Volume, len(test.issues), v.Issues)
+		}
+		for _, issue := range test.issues {
+			if !slices.ContainsFunc(v.Issues, func(s string) bool { return strings.Contains(s, issue) }) {
+				t.Errorf("%s/%s: expected the issue %q in %q", v.VM, v.Volume, issue, v.Issues)
+			}
+		}
+	}
+
+	if chain := report.Volumes[2].chain(); chain != "dv/importer-root (ImportInProgress) > pvc/importer-root (Bound, RWX, Block) > "+
+		"pv/pvc-0a1b2c3d (Bound) > sc/hostpath-csi (kubevirt.io.hostpath-provisioner) > not attached to node02" {
+		t.Errorf("wrong chain %q", chain)
+	}
+}
@@ -0,0 +1,335 @@
+// Package upgrade tells what happens to the running VMs when KubeVirt is updated: which ones are live migrated to
+// the new virt-launcher image, evicted, or left on the outdated one, and whether OLM is waiting for an approval.
+package upgrade
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubevirt/must-gather/pkg/analysis"
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/olm"
+)
+
+const (
+	// OutdatedLauncherImageLabel is set by virt-controller on the virt-launcher pods that don't run the current image.
+	OutdatedLauncherImageLabel = "kubevirt.io/outdatedLauncherImage"
+
+	computeContainer = "compute"
+)
+
+// Workload update methods of KubeVirt.
+const (
+	MethodLiveMigrate = "LiveMigrate"
+	MethodEvict       = "Evict"
+)
+
+// Action is what KubeVirt does with an outdated VMI.
+type Action string
+
+const (
+	LiveMigrated  Action = "live migrated"
+	Evicted       Action = "evicted"
+	LeftOutdated  Action = "left outdated"
+	BeingMigrated Action = "migrating"
+)
+
+// Workload is a VMI that runs on an outdated virt-launcher image.
+type Workload struct {
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	Node        string `json:"node"`
+	LauncherPod string `json:"launcherPod"`
+	Image       string `json:"image"`
+	ImageID     string `json:"imageID,omitempty"`
+	Action      Action `json:"action"`
+	Reason      string `json:"reason"`
+}
+
+// Migration is a VMI migration that is not done.
+type Migration struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	VMI       string `json:"vmi"`
+	Phase     string `json:"phase"`
+}
+
+// Subscription is the state of an OLM subscription.
+type Subscription struct {
+	Namespace    string `json:"namespace"`
+	Name         string `json:"name"`
+	Channel      string `json:"channel"`
+	InstalledCSV string `json:"installedCSV"`
+	CurrentCSV   string `json:"currentCSV"`
+	State        string `json:"state"`
+}
+
+// InstallPlan is an OLM install plan.
+type InstallPlan struct {
+	Namespace string `json:"namespace"`
+	olm.InstallPlan
+}
+
+// Report is the result of the upgrade check.
+type Report struct {
+	ObservedVersion       string         `json:"observedVersion"`
+	TargetVersion         string         `json:"targetVersion"`
+	WorkloadUpdateMethods []string       `json:"workloadUpdateMethods"`
+	UpToDate              int            `json:"upToDate"`
+	Outdated              []Workload     `json:"outdated"`
+	Migrations            []Migration    `json:"migrations"`
+	Subscriptions         []Subscription `json:"subscriptions"`
+	InstallPlans          []InstallPlan  `json:"installPlans"`
+}
+
+// Analyze checks the launcher pods, the migrations and the OLM objects of the bundle.
+func Analyze(b *layout.Bundle) (*Report, error) {
+	report := &Report{
+		WorkloadUpdateMethods: []string{},
+		Outdated:              []Workload{},
+		Migrations:            []Migration{},
+		Subscriptions:         []Subscription{},
+		InstallPlans:          []InstallPlan{},
+	}
+
+	if err := report.readKubeVirt(b); err != nil {
+		return nil, err
+	}
+
+	migrating, err := report.readMigrations(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = report.readWorkloads(b, migrating); err != nil {
+		return nil, err
+	}
+
+	if err = report.readOLM(b); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// readKubeVirt reads the versions and the workload update methods from the KubeVirt CR, or from the HyperConverged
+// CR if the KubeVirt CR was not collected
+func (r *Report) readKubeVirt(b *layout.Bundle) error {
+	kvs, err := b.Objects(layout.KubeVirts)
+	if err != nil {
+		return err
+	}
+
+	if len(kvs) > 0 {
+		kv := kvs[0].Object
+		r.ObservedVersion, _, _ = unstructured.NestedString(kv, "status", "observedKubeVirtVersion")
+		r.TargetVersion, _, _ = unstructured.NestedString(kv, "status", "targetKubeVirtVersion")
+		if methods, found, _ := unstructured.NestedStringSlice(kv, "spec", "workloadUpdateStrategy", "workloadUpdateMethods"); found {
+			r.WorkloadUpdateMethods = methods
+			return nil
+		}
+	}
+
+	hco, found, err := analysis.HyperConverged(b)
+	if err != nil || !found {
+		return err
+	}
+	if methods, found, _ := unstructured.NestedStringSlice(hco.Object, "spec", "workloadUpdateStrategy", "workloadUpdateMethods"); found {
+		r.WorkloadUpdateMethods = methods
+	}
+	return nil
+}
+
+// readMigrations lists the migrations in progress, and returns the keys of their VMIs
+func (r *Report) readMigrations(b *layout.Bundle) (map[string]bool, error) {
+	migrations, err := b.Objects(layout.VirtualMachineInstanceMigrations)
+	if err != nil {
+		return nil, err
+	}
+
+	migrating := make(map[string]bool)
+	for _, m := range migrations {
+		phase, _, _ := unstructured.NestedString(m.Object, "status", "phase")
+		if phase == "Succeeded" || phase == "Failed" {
+			continue
+		}
+
+		vmi, _, _ := unstructured.NestedString(m.Object, "spec", "vmiName")
+		r.Migrations = append(r.Migrations, Migration{Namespace: m.GetNamespace(), Name: m.GetName(), VMI: vmi, Phase: phase})
+		migrating[m.GetNamespace()+"/"+vmi] = true
+	}
+
+	return migrating, nil
+}
+
+func (r *Report) readWorkloads(b *layout.Bundle, migrating map[string]bool) error {
+	vmis, err := b.VirtualMachineInstances()
+	if err != nil {
+		return err
+	}
+	launchers, err := b.LauncherPods()
+	if err != nil {
+		return err
+	}
+
+	vmisByKey := make(map[string]layout.Object, len(vmis))
+	for _, vmi := range vmis {
+		vmisByKey[vmi.Key()] = vmi
+	}
+
+	for _, pod := range launchers {
+		if !analysis.IsPodRunning(pod) {
+			continue
+		}
+		if _, outdated := pod.GetLabels()[OutdatedLauncherImageLabel]; !outdated {
+			r.UpToDate++
+			continue
+		}
+
+		w := Workload{Namespace: pod.GetNamespace(), Name: layout.LauncherVMName(pod), LauncherPod: pod.GetName()}
+		w.Node, _, _ = unstructured.NestedString(pod.Object, "spec", "nodeName")
+		w.Image, w.ImageID = computeImage(pod)
+
+		vmi, found := vmisByKey[w.Namespace+"/"+w.Name]
+		w.Action, w.Reason = r.action(vmi, found, migrating[w.Namespace+"/"+w.Name])
+
+		r.Outdated = append(r.Outdated, w)
+	}
+
+	return nil
+}
+
+// action tells what KubeVirt does with an outdated VMI: it is live migrated if it can be, evicted otherwise, and
+// left alone if the update methods allow neither
+func (r *Report) action(vmi layout.Object, found bool, migrating bool) (Action, string) {
+	if migrating {
+		return BeingMigrated, "a migration is in progress"
+	}
+
+	liveMigrate := slices.Contains(r.WorkloadUpdateMethods, MethodLiveMigrate)
+	evict := slices.Contains(r.WorkloadUpdateMethods, MethodEvict)
+
+	migratable := false
+	reason := "the VMI was not collected"
+	if found {
+		if cond, ok := analysis.GetCondition(vmi, analysis.LiveMigratableCondition); ok {
+			migratable = cond.Status == "True"
+			reason = cond.Reason
+			if cond.Message != "" {
+				reason += ": " + cond.Message
+			}
+		} else {
+			reason = "the VMI has no LiveMigratable condition"
+		}
+	}
+
+	switch {
+	case liveMigrate && migratable:
+		return LiveMigrated, "the VMI is live migratable"
+	case evict && liveMigrate:
+		return Evicted, "the VMI is not live migratable: " + reason
+	case evict:
+		return Evicted, "Evict is the only workload update method"
+	case liveMigrate:
+		return LeftOutdated, "the VMI is not live migratable, and Evict is not a workload update method: " + reason
+	default:
+		return LeftOutdated, "there are no workload update methods"
+	}
+}
+
+func computeImage(pod layout.Object) (string, string) {
+	var image, imageID string
+
+	for _, c := range analysis.NestedMaps(pod.Object, "spec", "containers") {
+		if name, _, _ := unstructured.NestedString(c, "name"); name == computeContainer {
+			image, _, _ = unstructured.NestedString(c, "image")
+		}
+	}
+	for _, c := range analysis.NestedMaps(pod.Object, "status", "containerStatuses") {
+		if name, _, _ := unstructured.NestedString(c, "name"); name == computeContainer {
+			imageID, _, _ = unstructured.NestedString(c, "imageID")
+		}
+	}
+
+	return image, imageID
+}
+
+func (r *Report) readOLM(b *layout.Bundle) error {
+	subs, err := b.Objects(layout.Subscriptions)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		s := Subscription{Namespace: sub.GetNamespace(), Name: sub.GetName()}
+		s.Channel, _, _ = unstructured.NestedString(sub.Object, "spec", "channel")
+		s.InstalledCSV, _, _ = unstructured.NestedString(sub.Object, "status", "installedCSV")
+		s.CurrentCSV, _, _ = unstructured.NestedString(sub.Object, "status", "currentCSV")
+		s.State, _, _ = unstructured.NestedString(sub.Object, "status", "state")
+		r.Subscriptions = append(r.Subscriptions, s)
+	}
+
+	plans, err := b.Objects(layout.InstallPlans)
+	if err != nil {
+		return err
+	}
+	for _, plan := range plans {
+		r.InstallPlans = append(r.InstallPlans, InstallPlan{Namespace: plan.GetNamespace(), InstallPlan: olm.SummarizeInstallPlan(plan.Unstructured)})
+	}
+
+	return nil
+}
+
+// WriteText prints the report as tables.
+func (r *Report) WriteText(w io.Writer) error {
+	t := analysis.NewTable(w)
+
+	methods := strings.Join(r.WorkloadUpdateMethods, ", ")
+	if methods == "" {
+		methods = "none"
+	}
+	_, _ = fmt.Fprintf(t, "KubeVirt version: %s (target %s)\n", r.ObservedVersion, r.TargetVersion)
+	_, _ = fmt.Fprintf(t, "Workload update methods: %s\n", methods)
+	_, _ = fmt.Fprintf(t, "Up to date virt-launcher pods: %d, outdated: %d\n", r.UpToDate, len(r.Outdated))
+
+	if len(r.Outdated) > 0 {
+		_, _ = fmt.Fprintln(t)
+		_, _ = fmt.Fprintln(t, "NAMESPACE\tVMI\tNODE\tLAUNCHER POD\tIMAGE\tACTION\tREASON")
+		for _, o := range r.Outdated {
+			_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", o.Namespace, o.Name, o.Node, o.LauncherPod, o.Image, o.Action, o.Reason)
+		}
+	}
+
+	if len(r.Migrations) > 0 {
+		_, _ = fmt.Fprintln(t)
+		_, _ = fmt.Fprintln(t, "NAMESPACE\tMIGRATION\tVMI\tPHASE")
+		for _, m := range r.Migrations {
+			_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\n", m.Namespace, m.Name, m.VMI, m.Phase)
+		}
+	}
+
+	if len(r.Subscriptions) > 0 {
+		_, _ = fmt.Fprintln(t)
+		_, _ = fmt.Fprintln(t, "NAMESPACE\tSUBSCRIPTION\tCHANNEL\tINSTALLED CSV\tCURRENT CSV\tSTATE")
+		for _, s := range r.Subscriptions {
+			_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Namespace, s.Name, s.Channel, s.InstalledCSV, s.CurrentCSV, s.State)
+		}
+	}
+
+	if len(r.InstallPlans) > 0 {
+		_, _ = fmt.Fprintln(t)
+		_, _ = fmt.Fprintln(t, "NAMESPACE\tINSTALL PLAN\tCSVS\tAPPROVAL\tPHASE\tNOTE")
+		for _, p := range r.InstallPlans {
+			flag := ""
+			if p.AwaitingApproval {
+				flag = "awaiting approval"
+			}
+			_, _ = fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%s\n", p.Namespace, p.Name, strings.Join(p.CSVs, ", "), p.Approval, p.Phase, flag)
+		}
+	}
+
+	return t.Flush()
+}
@@ -0,0 +1,68 @@
+package upgrade
+
+import (
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/analysis/analysistest"
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+func TestOutdatedWorkloads(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	if report.UpToDate != 1 {
+		t.Errorf("expected 1 up to date launcher pod, but got %d", report.UpToDate)
+	}
+
+	expected := map[string]Action{"migratable": LiveMigrated, "moving": BeingMigrated, "rwo": LeftOutdated}
+	if len(report.Outdated) != len(expected) {
+		t.Fatalf("expected %d outdated VMIs, but got %+v", len(expected), report.Outdated)
+	}
+	for _, w := range report.Outdated {
+		if w.Action != expected[w.Name] {
+			t.Errorf("expected %s to be %s, but got %s (%s)", w.Name, expected[w.Name], w.Action, w.Reason)
+		}
+		if w.Image != "quay.io/kubevirt/virt-launcher:v1.5.0" || w.ImageID == "" {
+			t.Errorf("wrong image of %s: %s %s", w.Name, w.Image, w.ImageID)
+		}
+	}
+}
+
+func TestAction(t *testing.T) {
+	vmi := layout.Object{}
+	vmi.Object = map[string]any{"status": map[string]any{"conditions": []any{
+		map[string]any{"type": "LiveMigratable", "status": "False", "reason": "DisksNotLiveMigratable"},
+	}}}
+
+	tests := []struct {
+		methods  []string
+		expected Action
+	}{
+		{methods: []string{MethodLiveMigrate, MethodEvict}, expected: Evicted},
+		{methods: []string{MethodEvict}, expected: Evicted},
+		{methods: []string{MethodLiveMigrate}, expected: LeftOutdated},
+		{methods: nil, expected: LeftOutdated},
+	}
+
+	for _, test := range tests {
+		r := &Report{WorkloadUpdateMethods: test.methods}
+		if action, reason := r.action(vmi, true, false); action != test.expected {
+			t.Errorf("methods %v: expected %s, but got %s (%s)", test.methods, test.expected, action, reason)
+		}
+	}
+}
+
+func TestOLM(t *testing.T) {
+	report := analysistest.Analyze(t, "testdata/must-gather", Analyze)
+
+	if len(report.Subscriptions) != 1 || report.Subscriptions[0].State != "UpgradePending" {
+		t.Errorf("wrong subscriptions %+v", report.Subscriptions)
+	}
+
+	if len(report.InstallPlans) != 2 {
+		t.Fatalf("expected 2 install plans, but got %+v", report.InstallPlans)
+	}
+	if report.InstallPlans[0].AwaitingApproval || !report.InstallPlans[1].AwaitingApproval {
+		t.Errorf("only install-fghij should be awaiting approval: %+v", report.InstallPlans)
+	}
+}
@@ -0,0 +1,256 @@
+// Package apiaudit filters the kube-apiserver audit logs down to the requests about KubeVirt and CDI resources, and
+// writes them in a compact form, one JSON line per request, in one file per namespace. It tells who created, changed,
+// stopped, restarted, migrated or deleted a VM, without the request and response bodies of the raw events.
+package apiaudit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Groups are the API groups of the requests that are kept.
+var Groups = []string{"kubevirt.io", "cdi.kubevirt.io", "subresources.kubevirt.io"}
+
+// the verbs that don't change anything; they are dropped, except for the subresources, e.g. who opened a VNC console
+var readOnlyVerbs = []string{"get", "list", "watch"}
+
+const (
+	// FileSuffix is the suffix of the file of each namespace, e.g. ns1.jsonl.
+	FileSuffix = ".jsonl"
+	// ClusterFile is the file of the requests about cluster scoped resources, e.g. the KubeVirt CRDs. Namespace names
+	// can't start with an underscore.
+	ClusterFile = "_cluster" + FileSuffix
+)
+
+// Record is the compact form of an audit event.
+type Record struct {
+	Time time.Time `json:"time"`
+	User string    `json:"user"`
+	// ImpersonatedUser is the user the request was made as, when the user impersonated another one.
+	ImpersonatedUser string `json:"impersonatedUser,omitempty"`
+	Verb             string `json:"verb"`
+	Group            string `json:"group"`
+	Resource         string `json:"resource"`
+	Subresource      string `json:"subresource,omitempty"`
+	Namespace        string `json:"namespace,omitempty"`
+	Name             string `json:"name,omitempty"`
+	Code             int    `json:"code"`
+	UserAgent        string `json:"userAgent,omitempty"`
+	AuditID          string `json:"auditID"`
+}
+
+// event is the part of an audit.k8s.io/v1 Event the records are made of
+type event struct {
+	AuditID string `json:"auditID"`
+	Stage   string `json:"stage"`
+	Verb    string `json:"verb"`
+	User    struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	ImpersonatedUser *struct {
+		Username string `json:"username"`
+	} `json:"impersonatedUser"`
+	UserAgent string `json:"userAgent"`
+	ObjectRef *struct {
+		Resource    string `json:"resource"`
+		Namespace   string `json:"namespace"`
+		Name        string `json:"name"`
+		APIGroup    string `json:"apiGroup"`
+		Subresource string `json:"subresource"`
+	} `json:"objectRef"`
+	ResponseStatus *struct {
+		Code int `json:"code"`
+	} `json:"responseStatus"`
+	RequestReceivedTimestamp time.Time `json:"requestReceivedTimestamp"`
+}
+
+// maxLine is the length above which a line is skipped; the events of large objects, e.g. a VM with many disks, are long
+// lines
+const maxLine = 16 * 1024 * 1024
+
+// Stats counts the lines of the filtered logs.
+type Stats struct {
+	Events int
+	Kept   int
+	// Invalid is the number of lines that are not audit events, e.g. the errors of oc adm node-logs, or that are too
+	// long to be read.
+	Invalid int
+}
+
+// Filter reads audit events from r, and appends the records of the KubeVirt and CDI requests received since a time to
+// the file of their namespace in dir. A zero since keeps all the requests. Only the events of the ResponseComplete and
+// Panic stages are kept, so each request is written once.
+func Filter(r io.Reader, dir string, since time.Time) (Stats, error) {
+	var stats Stats
+
+	w := &writer{dir: dir, files: make(map[string]*os.File)}
+	defer func() { _ = w.close() }()
+
+	reader := bufio.NewReaderSize(r, 64*1024)
+	var line []byte
+	for {
+		var tooLong bool
+		var readErr error
+		line, tooLong, readErr = readLine(reader, line)
+		if tooLong {
+			stats.Invalid++
+		} else if len(bytes.TrimSpace(line)) > 0 {
+			if err := stats.filter(w, line, since); err != nil {
+				return stats, err
+			}
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			return stats, readErr
+		}
+	}
+
+	return stats, w.close()
+}
+
+// filter writes the record of an audit event, when it is kept
+func (stats *Stats) filter(w *writer, line []byte, since time.Time) error {
+	var e event
+	if err := json.Unmarshal(line, &e); err != nil || e.AuditID == "" {
+		stats.Invalid++
+		return nil
+	}
+	stats.Events++
+
+	record, ok := toRecord(e, since)
+	if !ok {
+		return nil
+	}
+	if err := w.write(record); err != nil {
+		return err
+	}
+	stats.Kept++
+	return nil
+}
+
+// readLine reads the next line of r into buf. The rest of a line longer than maxLine is skipped, and tooLong is set.
+func readLine(r *bufio.Reader, buf []byte) (line []byte, tooLong bool, err error) {
+	line = buf[:0]
+	for {
+		var chunk []byte
+		chunk, err = r.ReadSlice('\n')
+		if len(line)+len(chunk) > maxLine {
+			tooLong = true
+		} else if !tooLong {
+			line = append(line, chunk...)
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return line, tooLong, err
+		}
+	}
+}
+
+// toRecord returns the record of an event, and false for the events that are not kept
+func toRecord(e event, since time.Time) (Record, bool) {
+	if e.ObjectRef == nil || !slices.Contains(Groups, e.ObjectRef.APIGroup) {
+		return Record{}, false
+	}
+	subresource := e.ObjectRef.Subresource != "" || e.ObjectRef.APIGroup == "subresources.kubevirt.io"
+
+	switch {
+	case e.Stage != "ResponseComplete" && e.Stage != "Panic":
+		return Record{}, false
+	case !subresource && slices.Contains(readOnlyVerbs, e.Verb):
+		return Record{}, false
+	case !since.IsZero() && e.RequestReceivedTimestamp.Before(since):
+		return Record{}, false
+	}
+
+	record := Record{
+		Time:        e.RequestReceivedTimestamp,
+		User:        e.User.Username,
+		Verb:        e.Verb,
+		Group:       e.ObjectRef.APIGroup,
+		Resource:    e.ObjectRef.Resource,
+		Subresource: e.ObjectRef.Subresource,
+		Namespace:   e.ObjectRef.Namespace,
+		Name:        e.ObjectRef.Name,
+		UserAgent:   e.UserAgent,
+		AuditID:     e.AuditID,
+	}
+	if e.ImpersonatedUser != nil {
+		record.ImpersonatedUser = e.ImpersonatedUser.Username
+	}
+	if e.ResponseStatus != nil {
+		record.Code = e.ResponseStatus.Code
+	}
+	return record, true
+}
+
+// writer appends the records to the file of their namespace
+type writer struct {
+	dir   string
+	files map[string]*os.File
+}
+
+func (w *writer) write(r Record) error {
+	name := ClusterFile
+	if r.Namespace != "" {
+		name = r.Namespace + FileSuffix
+	}
+
+	f, found := w.files[name]
+	if !found {
+		var err error
+		f, err = os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("can't open %s; %w", name, err)
+		}
+		w.files[name] = f
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("can't write %s; %w", name, err)
+	}
+	return nil
+}
+
+func (w *writer) close() error {
+	var errs []error
+	for name, f := range w.files {
+		errs = append(errs, f.Close())
+		delete(w.files, name)
+	}
+	return errors.Join(errs...)
+}
+
+// ReadFile reads the records of a namespace file.
+func ReadFile(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var records []Record
+	decoder := json.NewDecoder(f)
+	for {
+		var r Record
+		if err = decoder.Decode(&r); errors.Is(err, io.EOF) {
+			return records, nil
+		} else if err != nil {
+			return records, fmt.Errorf("can't parse %s; %w", path, err)
+		}
+		records = append(records, r)
+	}
+}
@@ -0,0 +1,107 @@
+package apiaudit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	f, err := os.Open("testdata/audit.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	dir := t.TempDir()
+	stats, err := Filter(f, dir, time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (Stats{Events: 10, Kept: 6, Invalid: 1}) {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	records, err := ReadFile(filepath.Join(dir, "ns1"+FileSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Record{
+		{Time: time.Date(2026, 10, 19, 8, 30, 0, 123456000, time.UTC), User: "alice", Verb: "update", Group: "subresources.kubevirt.io",
+			Resource: "virtualmachines", Subresource: "stop", Namespace: "ns1", Name: "fedora", Code: 202,
+			UserAgent: "virtctl/v1.6.0 (linux/amd64) kubevirt/v1.6.0", AuditID: "0b1c2d3e-0002-4000-8000-000000000002"},
+		{Time: time.Date(2026, 10, 19, 8, 32, 0, 0, time.UTC), User: "alice", Verb: "get", Group: "subresources.kubevirt.io",
+			Resource: "virtualmachineinstances", Subresource: "vnc", Namespace: "ns1", Name: "fedora", Code: 101,
+			UserAgent: "Mozilla/5.0", AuditID: "0b1c2d3e-0004-4000-8000-000000000004"},
+		{Time: time.Date(2026, 10, 19, 8, 33, 0, 0, time.UTC), User: "bob", Verb: "delete", Group: "kubevirt.io",
+			Resource: "virtualmachines", Namespace: "ns1", Name: "rhel", Code: 200,
+			UserAgent: "oc/4.20.0 (linux/amd64) kubernetes/abcdef0", AuditID: "0b1c2d3e-0005-4000-8000-000000000005"},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records, but got %+v", len(expected), records)
+	}
+	for i, e := range expected {
+		if records[i] != e {
+			t.Errorf("expected %+v, but got %+v", e, records[i])
+		}
+	}
+
+	records, err = ReadFile(filepath.Join(dir, "ns2"+FileSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].User != "kube:admin" || records[0].ImpersonatedUser != "carol" || records[1].Code != 403 {
+		t.Errorf("unexpected records: %+v", records)
+	}
+
+	records, err = ReadFile(filepath.Join(dir, ClusterFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Resource != "cdis" || records[0].Namespace != "" {
+		t.Errorf("unexpected records: %+v", records)
+	}
+}
+
+func TestFilterAppends(t *testing.T) {
+	dir := t.TempDir()
+	for range 2 {
+		f, err := os.Open("testdata/audit.log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Filter(f, dir, time.Time{})
+		_ = f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the logs of each control plane node are filtered in turn, into the same files
+	records, err := ReadFile(filepath.Join(dir, "ns1"+FileSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 8 {
+		t.Errorf("expected the records of both runs, with the old patch, but got %d", len(records))
+	}
+}
+
+func TestFilterLongLine(t *testing.T) {
+	data, err := os.ReadFile("testdata/audit.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an event too long to be read, before the rest of the log
+	long := `{"auditID":"` + strings.Repeat("x", maxLine) + `"}` + "\n"
+	stats, err := Filter(strings.NewReader(long+string(data)), t.TempDir(), time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (Stats{Events: 10, Kept: 6, Invalid: 2}) {
+		t.Errorf("the long line should be skipped, but got %+v", stats)
+	}
+}
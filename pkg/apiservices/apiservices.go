@@ -0,0 +1,297 @@
+// Package apiservices checks, while gathering, the aggregated APIs of KubeVirt and CDI, such as
+// subresources.kubevirt.io, which serves the console, VNC and the VM actions of virtctl. The APIServices are sampled a
+// few times: each sample has the Available condition, and the time a discovery request to the group-version took. The
+// Service of each APIService is looked up, with the ready endpoints of its EndpointSlices on the port the APIService
+// calls.
+package apiservices
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/oc"
+)
+
+// FileName is the report written into the apiservices directory of the bundle.
+const FileName = "health.json"
+
+// GroupSuffix is the suffix of the groups of the APIServices that are checked.
+const GroupSuffix = "kubevirt.io"
+
+// defaultPort is the port of the APIService services when spec.service.port is not set
+const defaultPort = 443
+
+// Options tell how the APIServices are sampled.
+type Options struct {
+	Samples  int
+	Interval time.Duration
+	// Timeout is the time a discovery request is given.
+	Timeout time.Duration
+	// Slow is the discovery time above which an API is reported as slow.
+	Slow time.Duration
+}
+
+// DefaultOptions take 3 samples, 5 seconds apart.
+var DefaultOptions = Options{Samples: 3, Interval: 5 * time.Second, Timeout: 30 * time.Second, Slow: time.Second}
+
+// Sample is the state of an APIService at a time.
+type Sample struct {
+	Time time.Time `json:"time"`
+	// Available is the status of the Available condition, or empty when the APIService has none.
+	Available          string    `json:"available"`
+	Reason             string    `json:"reason,omitempty"`
+	Message            string    `json:"message,omitempty"`
+	LastTransitionTime time.Time `json:"lastTransitionTime,omitzero"`
+	// DiscoveryMS is how long the discovery request to the group-version took, in milliseconds.
+	DiscoveryMS int64 `json:"discoveryMs"`
+	// Resources is the number of resources the discovery returned.
+	Resources      int    `json:"resources"`
+	DiscoveryError string `json:"discoveryError,omitempty"`
+}
+
+// APIService is an aggregated API, or a local one when it has no Service.
+type APIService struct {
+	Name    string `json:"name"`
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	// Service is the namespace/name of the Service the API server proxies the requests to; it is empty for the local
+	// APIServices, which the API server serves itself.
+	Service string `json:"service,omitempty"`
+	// Port is the port of the Service, 443 by default; only its endpoints are counted.
+	Port         int64 `json:"port,omitempty"`
+	ServiceFound bool  `json:"serviceFound"`
+	// PortFound tells whether the Service has the port; the endpoints are not counted when it doesn't.
+	PortFound         bool     `json:"portFound"`
+	ReadyEndpoints    int      `json:"readyEndpoints"`
+	NotReadyEndpoints int      `json:"notReadyEndpoints"`
+	Samples           []Sample `json:"samples"`
+	Problems          []string `json:"problems"`
+}
+
+// Report is the health of the APIServices.
+type Report struct {
+	Time time.Time `json:"time"`
+	// SlowMS is the discovery time above which an API is reported as slow, in milliseconds.
+	SlowMS      int64        `json:"slowMs"`
+	APIServices []APIService `json:"apiServices"`
+	// Error is the error that stopped the collection; the report has the samples taken before it.
+	Error string `json:"error,omitempty"`
+}
+
+// Collect samples the APIServices of the KubeVirt groups, and looks up their Services. When it fails, e.g. as oc can't
+// reach the API server for a sample, the report has what was collected before the error, which is also set in the
+// report.
+func Collect(ctx context.Context, run oc.Runner, opts Options) (*Report, error) {
+	report := &Report{Time: time.Now().UTC(), SlowMS: opts.Slow.Milliseconds(), APIServices: []APIService{}}
+
+	err := report.sample(ctx, run, opts)
+	resolved := false
+	if err == nil {
+		err = report.resolveServices(ctx, run)
+		resolved = err == nil
+	}
+
+	for i := range report.APIServices {
+		report.APIServices[i].Problems = problems(report.APIServices[i], opts.Slow, resolved)
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return report, err
+}
+
+// sample adds the samples of the APIServices to the report
+func (r *Report) sample(ctx context.Context, run oc.Runner, opts Options) error {
+	index := make(map[string]int)
+	for i := range max(opts.Samples, 1) {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(opts.Interval):
+			}
+		}
+
+		objs, err := oc.Get(ctx, run, "get", "apiservices", "-o", "json")
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+			if group != GroupSuffix && !strings.HasSuffix(group, "."+GroupSuffix) {
+				continue
+			}
+
+			n, found := index[obj.GetName()]
+			if !found {
+				n = len(r.APIServices)
+				index[obj.GetName()] = n
+				r.APIServices = append(r.APIServices, newAPIService(obj))
+			}
+			svc := &r.APIServices[n]
+			svc.Samples = append(svc.Samples, sample(ctx, run, obj, svc.Group+"/"+svc.Version, opts.Timeout))
+		}
+	}
+	return nil
+}
+
+// resolveServices finds the Service of each APIService, and counts its endpoints
+func (r *Report) resolveServices(ctx context.Context, run oc.Runner) error {
+	var namespaces []string
+	for _, svc := range r.APIServices {
+		if namespace, _, found := strings.Cut(svc.Service, "/"); found && !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	var objs []unstructured.Unstructured
+	for _, namespace := range namespaces {
+		found, err := oc.Get(ctx, run, "get", "service,endpointslice", "-n", namespace, "-o", "json")
+		if err != nil {
+			return err
+		}
+		objs = append(objs, found...)
+	}
+
+	services := oc.Services(objs)
+	for i := range r.APIServices {
+		svc := &r.APIServices[i]
+		if svc.Service == "" {
+			continue
+		}
+		found := services[svc.Service]
+		endpoints, portFound := found.EndpointsOf(svc.Port)
+		svc.ServiceFound, svc.PortFound = found.Found, portFound
+		svc.ReadyEndpoints, svc.NotReadyEndpoints = endpoints.Ready, endpoints.NotReady
+	}
+	return nil
+}
+
+func newAPIService(obj unstructured.Unstructured) APIService {
+	svc := APIService{Name: obj.GetName(), Samples: []Sample{}, Problems: []string{}}
+	svc.Group, _, _ = unstructured.NestedString(obj.Object, "spec", "group")
+	svc.Version, _, _ = unstructured.NestedString(obj.Object, "spec", "version")
+	namespace, _, _ := unstructured.NestedString(obj.Object, "spec", "service", "namespace")
+	name, _, _ := unstructured.NestedString(obj.Object, "spec", "service", "name")
+	if name != "" {
+		svc.Service = namespace + "/" + name
+		svc.Port = defaultPort
+		if port, found := layout.NestedInt64(obj.Object, "spec", "service", "port"); found {
+			svc.Port = port
+		}
+	}
+	return svc
+}
+
+// sample reads the Available condition of an APIService, and times a discovery request to its group-version
+func sample(ctx context.Context, run oc.Runner, obj unstructured.Unstructured, groupVersion string, timeout time.Duration) Sample {
+	s := Sample{Time: time.Now().UTC()}
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		fields, _ := c.(map[string]any)
+		if t, _, _ := unstructured.NestedString(fields, "type"); t != "Available" {
+			continue
+		}
+		s.Available, _, _ = unstructured.NestedString(fields, "status")
+		s.Reason, _, _ = unstructured.NestedString(fields, "reason")
+		s.Message, _, _ = unstructured.NestedString(fields, "message")
+		transition, _, _ := unstructured.NestedString(fields, "lastTransitionTime")
+		s.LastTransitionTime, _ = time.Parse(time.RFC3339, transition)
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	out, err := run(ctx, "get", "--raw", "/apis/"+groupVersion)
+	s.DiscoveryMS = time.Since(start).Milliseconds()
+	if err != nil {
+		s.DiscoveryError = err.Error()
+		return s
+	}
+
+	var list struct {
+		Resources []json.RawMessage `json:"resources"`
+	}
+	if err = json.Unmarshal(out, &list); err != nil {
+		s.DiscoveryError = fmt.Sprintf("can't parse the discovery; %v", err)
+		return s
+	}
+	s.Resources = len(list.Resources)
+	return s
+}
+
+// problems lists what is wrong with an APIService, over its samples; its Service is only checked when it was resolved
+func problems(svc APIService, slow time.Duration, resolved bool) []string {
+	problems := []string{}
+
+	var unavailable, failed, slowest Sample
+	var transitions []time.Time
+	for _, s := range svc.Samples {
+		if s.Available != "True" && unavailable.Time.IsZero() {
+			unavailable = s
+		}
+		if s.DiscoveryError != "" && failed.Time.IsZero() {
+			failed = s
+		}
+		if s.DiscoveryMS > slowest.DiscoveryMS {
+			slowest = s
+		}
+		if !s.LastTransitionTime.IsZero() && !slices.ContainsFunc(transitions, s.LastTransitionTime.Equal) {
+			transitions = append(transitions, s.LastTransitionTime)
+		}
+	}
+
+	if !unavailable.Time.IsZero() {
+		problems = append(problems, fmt.Sprintf("Available is %s at %s: %s", cmp.Or(unavailable.Available, "Unknown"),
+			unavailable.Time.Format(time.RFC3339), strings.TrimSpace(unavailable.Reason+" "+unavailable.Message)))
+	}
+	if len(transitions) > 1 {
+		problems = append(problems, fmt.Sprintf("Available changed while sampling, at %s",
+			slices.MaxFunc(transitions, time.Time.Compare).Format(time.RFC3339)))
+	}
+	if !failed.Time.IsZero() {
+		problems = append(problems, fmt.Sprintf("the discovery of %s/%s failed at %s: %s", svc.Group, svc.Version,
+			failed.Time.Format(time.RFC3339), failed.DiscoveryError))
+	}
+	if slow > 0 && slowest.DiscoveryMS > slow.Milliseconds() {
+		problems = append(problems, fmt.Sprintf("the discovery of %s/%s took %s", svc.Group, svc.Version,
+			time.Duration(slowest.DiscoveryMS)*time.Millisecond))
+	}
+
+	switch {
+	case svc.Service == "" || !resolved:
+	case !svc.ServiceFound:
+		problems = append(problems, fmt.Sprintf("the service %s doesn't exist", svc.Service))
+	case !svc.PortFound:
+		problems = append(problems, fmt.Sprintf("the service %s has no port %d", svc.Service, svc.Port))
+	case svc.ReadyEndpoints == 0:
+		problems = append(problems, fmt.Sprintf("the service %s has no ready endpoints", svc.Service))
+	}
+
+	return problems
+}
+
+// ReadFile reads a report.
+func ReadFile(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	if err = json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("can't parse %s; %w", path, err)
+	}
+	return report, nil
+}
@@ -0,0 +1,117 @@
+package apiservices
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeOC answers with the fixtures; the second sample finds subresources.kubevirt.io unavailable
+type fakeOC struct {
+	calls   []string
+	samples int
+	// failAt is the sample whose oc get apiservices fails, when set
+	failAt int
+}
+
+func (f *fakeOC) run(_ context.Context, args ...string) ([]byte, error) {
+	cmd := strings.Join(args, " ")
+	f.calls = append(f.calls, cmd)
+
+	switch cmd {
+	case "get apiservices -o json":
+		f.samples++
+		if f.samples == f.failAt {
+			return nil, errors.New("Unable to connect to the server: net/http: TLS handshake timeout")
+		}
+		if f.samples == 1 {
+			return os.ReadFile("testdata/apiservices-1.yaml")
+		}
+		return os.ReadFile("testdata/apiservices-2.yaml")
+	case "get service,endpointslice -n openshift-cnv -o json":
+		return os.ReadFile("testdata/services.yaml")
+	case "get --raw /apis/kubevirt.io/v1":
+		return []byte(`{"kind":"APIResourceList","resources":[{"name":"virtualmachines"},{"name":"virtualmachineinstances"}]}`), nil
+	case "get --raw /apis/subresources.kubevirt.io/v1":
+		if f.samples > 1 {
+			return nil, errors.New("Error from server (ServiceUnavailable): the server is currently unable to handle the request")
+		}
+		return []byte(`{"kind":"APIResourceList","resources":[{"name":"virtualmachineinstances/console"}]}`), nil
+	case "get --raw /apis/upload.cdi.kubevirt.io/v1beta1":
+		time.Sleep(20 * time.Millisecond)
+		return []byte(`{"kind":"APIResourceList","resources":[{"name":"uploadtokenrequests"}]}`), nil
+	}
+	return nil, errors.New("unexpected command " + cmd)
+}
+
+func TestCollect(t *testing.T) {
+	oc := &fakeOC{}
+	report, err := Collect(context.Background(), oc.run, Options{Samples: 2, Interval: time.Millisecond, Slow: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if slices.Contains(oc.calls, "get --raw /apis/apps/v1") {
+		t.Errorf("expected only the kubevirt.io groups to be checked, but got %v", oc.calls)
+	}
+	if len(report.APIServices) != 3 {
+		t.Fatalf("expected 3 APIServices, but got %+v", report.APIServices)
+	}
+
+	local := report.APIServices[0]
+	if local.Name != "v1.kubevirt.io" || local.Service != "" || len(local.Samples) != 2 || local.Samples[1].Resources != 2 ||
+		len(local.Problems) != 0 {
+		t.Errorf("unexpected local APIService: %+v", local)
+	}
+
+	subresources := report.APIServices[1]
+	if subresources.Service != "openshift-cnv/virt-api" || subresources.Port != 443 || !subresources.ServiceFound ||
+		!subresources.PortFound || subresources.NotReadyEndpoints != 1 {
+		t.Errorf("unexpected subresources APIService: %+v", subresources)
+	}
+	if s := subresources.Samples; len(s) != 2 || s[0].Available != "True" || s[1].Available != "False" ||
+		s[1].Reason != "FailedDiscoveryCheck" || s[0].DiscoveryError != "" || s[1].DiscoveryError == "" {
+		t.Errorf("unexpected samples: %+v", s)
+	}
+	expected := []string{
+		"Available is False at ",
+		"Available changed while sampling, at 2026-10-19T08:59:58Z",
+		"the discovery of subresources.kubevirt.io/v1 failed at ",
+		"the service openshift-cnv/virt-api has no ready endpoints",
+	}
+	if len(subresources.Problems) != len(expected) {
+		t.Fatalf("expected %d problems, but got %q", len(expected), subresources.Problems)
+	}
+	for i, e := range expected {
+		if !strings.HasPrefix(subresources.Problems[i], e) {
+			t.Errorf("expected a problem starting with %q, but got %q", e, subresources.Problems[i])
+		}
+	}
+
+	upload := report.APIServices[2]
+	if upload.ReadyEndpoints != 1 || len(upload.Problems) != 1 || !strings.HasPrefix(upload.Problems[0], "the discovery of upload.cdi.kubevirt.io/v1beta1 took ") {
+		t.Errorf("unexpected upload APIService: %+v", upload)
+	}
+}
+
+func TestCollectFailedSample(t *testing.T) {
+	oc := &fakeOC{failAt: 2}
+	report, err := Collect(context.Background(), oc.run, Options{Samples: 3, Interval: time.Millisecond})
+	if err == nil {
+		t.Fatal("expected the error of the second sample")
+	}
+
+	// the first sample is kept, and the services are not reported as missing
+	if report == nil || len(report.APIServices) != 3 || !strings.Contains(report.Error, "TLS handshake timeout") {
+		t.Fatalf("expected the first sample, with the error, but got %+v", report)
+	}
+	for _, svc := range report.APIServices {
+		if len(svc.Samples) != 1 || len(svc.Problems) != 0 {
+			t.Errorf("unexpected APIService: %+v", svc)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package bundle
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/manifest"
+)
+
+func newIdentity(t *testing.T) (*ecdh.PrivateKey, *ecdh.PublicKey) {
+	t.Helper()
+
+	privPEM, pubPEM, err := GenerateEncryptionKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := ParseIdentity(privPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ParseRecipient(pubPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, pub
+}
+
+func newSigningKey(t *testing.T) (ed25519.PrivateKey, ed25519.PublicKey) {
+	t.Helper()
+
+	privPEM, pubPEM, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := ParseSigningKey(privPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ParseVerificationKey(pubPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, pub
+}
+
+func encrypt(t *testing.T, plain []byte, recipients ...*ecdh.PublicKey) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := Encrypt(&buf, recipients...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(encrypted []byte, identity *ecdh.PrivateKey) ([]byte, error) {
+	r, err := Decrypt(bytes.NewReader(encrypted), identity)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	alice, alicePub := newIdentity(t)
+	bob, bobPub := newIdentity(t)
+	eve, _ := newIdentity(t)
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17} {
+		plain := make([]byte, size)
+		_, _ = rand.Read(plain)
+
+		encrypted := encrypt(t, plain, alicePub, bobPub)
+
+		for name, identity := range map[string]*ecdh.PrivateKey{"alice": alice, "bob": bob} {
+			decrypted, err := decrypt(encrypted, identity)
+			if err != nil {
+				t.Fatalf("size %d, %s: %v", size, name, err)
+			}
+			if !bytes.Equal(plain, decrypted) {
+				t.Errorf("size %d, %s: wrong plain text", size, name)
+			}
+		}
+
+		if _, err := decrypt(encrypted, eve); !errors.Is(err, ErrNoIdentityMatch) {
+			t.Errorf("size %d: expected ErrNoIdentityMatch, but got %v", size, err)
+		}
+	}
+}
+
+func TestDecryptRejectsTampering(t *testing.T) {
+	identity, pub := newIdentity(t)
+
+	plain := make([]byte, 2*chunkSize)
+	encrypted := encrypt(t, plain, pub)
+
+	tests := map[string][]byte{
+		// drop the last chunk; the previous one is not marked as the last one
+		"truncated at a chunk boundary": encrypted[:len(encrypted)-16],
+		"truncated":                     encrypted[:len(encrypted)-100],
+		"modified":                      append(append([]byte{}, encrypted[:len(encrypted)-10]...), bytes.Repeat([]byte{0xff}, 10)...),
+		"extended":                      append(append([]byte{}, encrypted...), 0),
+	}
+
+	for name, data := range tests {
+		if _, err := decrypt(data, identity); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSealAndOpen(t *testing.T) {
+	// the layout of oc adm must-gather, with one directory per image
+	top := filepath.Join(t.TempDir(), "must-gather.local.1")
+	root := filepath.Join(top, "quay-io-kubevirt-must-gather-sha256-1")
+	for rel, content := range map[string]string{
+		"version":                        "kubevirt/must-gather\nv1.6.0\n",
+		"nodes/node01/dmesg":             "[    0.000000] Linux version\n",
+		"namespaces/ns1/vms/vm1/vm1.log": "qemu log\n",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := manifest.Finalize(root); err != nil {
+		t.Fatal(err)
+	}
+
+	signingKey, verificationKey := newSigningKey(t)
+	identity, recipient := newIdentity(t)
+
+	if err := Seal(root, SealOptions{SigningKey: signingKey, Recipients: []*ecdh.PublicKey{recipient}}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("only the version file and the encrypted archive should be left; found %d entries", len(entries))
+	}
+
+	dest := t.TempDir()
+	if err = DecryptBundle(top, dest, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := VerifyBundle(dest, verificationKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("unexpected problems %v", problems)
+	}
+
+	if err = os.WriteFile(filepath.Join(dest, manifest.FileName), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = VerifyBundle(dest, verificationKey); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("expected ErrBadSignature, but got %v", err)
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	privPEM, _, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	if err = os.WriteFile(keyFile, privPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, value := range map[string]string{
+		"file":   keyFile,
+		"pem":    string(privPEM),
+		"base64": base64.StdEncoding.EncodeToString(privPEM),
+	} {
+		data, err := ReadKey(value)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if _, err = ParseSigningKey(data); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	if _, err = ReadKey("not a key"); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,358 @@
+package bundle
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The encrypted file format is:
+//
+//	kubevirt-must-gather-encrypted/v1\n
+//	<header, one JSON line>\n
+//	<payload>
+//
+// The header has one stanza per recipient. A stanza holds an ephemeral X25519 public key, and the file key, encrypted
+// with AES-256-GCM under a key derived with HKDF-SHA256 from the X25519 shared secret.
+//
+// The payload is the plain text, split in chunks of ChunkSize bytes, each encrypted with AES-256-GCM under a key
+// derived from the file key. The nonce of each chunk is its counter, and a flag that marks the last chunk, so
+// truncated, reordered or extended payloads are rejected. The SHA-256 of the header line is the additional data of
+// every chunk.
+const (
+	magicLine       = "kubevirt-must-gather-encrypted/v1\n"
+	chunkSize       = 64 * 1024
+	fileKeySize     = 32
+	payloadSaltSize = 16
+	wrapInfo        = "kubevirt-must-gather/v1 X25519"
+	payloadInfo     = "kubevirt-must-gather/v1 payload"
+	lastChunkFlag   = 1
+	maxHeaderSize   = 1024 * 1024
+)
+
+// ErrNoIdentityMatch is returned when the file was not encrypted for the given identity.
+var ErrNoIdentityMatch = errors.New("the file was not encrypted for this key")
+
+type header struct {
+	Recipients []stanza `json:"recipients"`
+	Salt       []byte   `json:"salt"`
+	ChunkSize  int      `json:"chunkSize"`
+}
+
+type stanza struct {
+	Fingerprint string `json:"fingerprint"`
+	Ephemeral   []byte `json:"ephemeral"`
+	WrappedKey  []byte `json:"wrappedKey"`
+}
+
+// Encrypt returns a WriteCloser that encrypts everything written to it for the recipients, and writes the result to
+// dst. Close must be called to write the last chunk; it does not close dst.
+func Encrypt(dst io.Writer, recipients ...*ecdh.PublicKey) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no recipients")
+	}
+
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+
+	hdr := header{Salt: make([]byte, payloadSaltSize), ChunkSize: chunkSize}
+	if _, err := rand.Read(hdr.Salt); err != nil {
+		return nil, err
+	}
+
+	for _, recipient := range recipients {
+		s, err := wrapFileKey(fileKey, recipient)
+		if err != nil {
+			return nil, err
+		}
+		hdr.Recipients = append(hdr.Recipients, s)
+	}
+
+	hdrLine, err := json.Marshal(hdr)
+	if err != nil {
+		return nil, err
+	}
+	hdrLine = append(hdrLine, '\n')
+
+	if _, err = io.WriteString(dst, magicLine); err != nil {
+		return nil, err
+	}
+	if _, err = dst.Write(hdrLine); err != nil {
+		return nil, err
+	}
+
+	aead, err := payloadAEAD(fileKey, hdr.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	hdrSum := sha256.Sum256(hdrLine)
+	return &encryptWriter{dst: dst, aead: aead, ad: hdrSum[:], buf: make([]byte, 0, chunkSize)}, nil
+}
+
+// Decrypt returns a Reader that decrypts src with identity.
+func Decrypt(src io.Reader, identity *ecdh.PrivateKey) (io.Reader, error) {
+	r := bufio.NewReader(src)
+
+	magic := make([]byte, len(magicLine))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != magicLine {
+		return nil, fmt.Errorf("not an encrypted must-gather bundle")
+	}
+
+	hdrLine, err := readLine(r, maxHeaderSize)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the header; %w", err)
+	}
+
+	var hdr header
+	if err = json.Unmarshal(hdrLine, &hdr); err != nil {
+		return nil, fmt.Errorf("can't parse the header; %w", err)
+	}
+	if hdr.ChunkSize <= 0 || hdr.ChunkSize > 16*chunkSize {
+		return nil, fmt.Errorf("invalid chunk size %d", hdr.ChunkSize)
+	}
+
+	fileKey, err := unwrapFileKey(hdr.Recipients, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := payloadAEAD(fileKey, hdr.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	hdrSum := sha256.Sum256(hdrLine)
+	return &decryptReader{
+		src:   r,
+		aead:  aead,
+		ad:    hdrSum[:],
+		chunk: make([]byte, hdr.ChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func wrapFileKey(fileKey []byte, recipient *ecdh.PublicKey) (stanza, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return stanza{}, err
+	}
+
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return stanza{}, err
+	}
+
+	aead, err := wrapAEAD(shared, ephemeral.PublicKey().Bytes(), recipient.Bytes())
+	if err != nil {
+		return stanza{}, err
+	}
+
+	// the wrapping key is used once, so a zero nonce is fine
+	nonce := make([]byte, aead.NonceSize())
+	return stanza{
+		Fingerprint: Fingerprint(recipient.Bytes()),
+		Ephemeral:   ephemeral.PublicKey().Bytes(),
+		WrappedKey:  aead.Seal(nil, nonce, fileKey, nil),
+	}, nil
+}
+
+func unwrapFileKey(stanzas []stanza, identity *ecdh.PrivateKey) ([]byte, error) {
+	ownPub := identity.PublicKey().Bytes()
+	fingerprint := Fingerprint(ownPub)
+
+	for _, s := range stanzas {
+		if s.Fingerprint != fingerprint {
+			continue
+		}
+
+		ephemeral, err := ecdh.X25519().NewPublicKey(s.Ephemeral)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := identity.ECDH(ephemeral)
+		if err != nil {
+			return nil, err
+		}
+
+		aead, err := wrapAEAD(shared, s.Ephemeral, ownPub)
+		if err != nil {
+			return nil, err
+		}
+
+		fileKey, err := aead.Open(nil, make([]byte, aead.NonceSize()), s.WrappedKey, nil)
+		if err != nil {
+			return nil, fmt.Errorf("can't unwrap the file key; %w", err)
+		}
+		return fileKey, nil
+	}
+
+	return nil, ErrNoIdentityMatch
+}
+
+func wrapAEAD(shared, ephemeralPub, recipientPub []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte{}, ephemeralPub...), recipientPub...)
+	key, err := hkdf.Key(sha256.New, shared, salt, wrapInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	return newGCM(key)
+}
+
+func payloadAEAD(fileKey, salt []byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, fileKey, salt, payloadInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	return newGCM(key)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce of a chunk: an 11 bytes big endian counter, and the last chunk flag.
+func chunkNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[11] = lastChunkFlag
+	}
+	return nonce
+}
+
+type encryptWriter struct {
+	dst     io.Writer
+	aead    cipher.AEAD
+	ad      []byte
+	buf     []byte
+	counter uint64
+	closed  bool
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to a closed encrypt writer")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// a full chunk is only flushed when more data arrives, so that Close can mark the last chunk
+		if len(w.buf) == chunkSize {
+			if err := w.flush(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(w.buf[len(w.buf):chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+func (w *encryptWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.flush(true)
+}
+
+func (w *encryptWriter) flush(last bool) error {
+	sealed := w.aead.Seal(nil, chunkNonce(w.counter, last), w.buf, w.ad)
+	w.counter++
+	w.buf = w.buf[:0]
+
+	_, err := w.dst.Write(sealed)
+	return err
+}
+
+type decryptReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	ad      []byte
+	chunk   []byte
+	plain   []byte
+	counter uint64
+	done    bool
+	err     error
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.readChunk()
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *decryptReader) readChunk() error {
+	n, err := io.ReadFull(r.src, r.chunk)
+	last := false
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case errors.Is(err, io.EOF):
+		return fmt.Errorf("the encrypted file is truncated")
+	case err != nil:
+		return err
+	default:
+		if _, err = r.src.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		}
+	}
+
+	plain, err := r.aead.Open(r.chunk[:0:0], chunkNonce(r.counter, last), r.chunk[:n], r.ad)
+	if err != nil {
+		return fmt.Errorf("the encrypted file is truncated or corrupted; %w", err)
+	}
+
+	r.counter++
+	r.plain = plain
+	r.done = last
+	return nil
+}
+
+func readLine(r *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	for {
+		part, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, part...)
+		if len(line) > max {
+			return nil, fmt.Errorf("line too long")
+		}
+		if !isPrefix {
+			// keep the newline, it is part of the authenticated header
+			return append(bytes.Clone(line), '\n'), nil
+		}
+	}
+}
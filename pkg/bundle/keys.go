@@ -0,0 +1,162 @@
+// Package bundle signs and encrypts must-gather bundles, using the Go standard library only.
+//
+// The manifest (see the manifest package) lists every file of the bundle with its checksum, so signing the manifest
+// with an ed25519 key signs the whole bundle. Encryption is hybrid: the bundle is archived, and the archive is
+// encrypted with a random file key, which is wrapped for each recipient's X25519 public key.
+//
+// Keys are stored in PEM files: PKCS #8 for private keys and PKIX for public keys, so they can also be created with
+// `openssl genpkey -algorithm ed25519` or `openssl genpkey -algorithm x25519`.
+package bundle
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	privateKeyPEMType = "PRIVATE KEY"
+	publicKeyPEMType  = "PUBLIC KEY"
+)
+
+// GenerateSigningKey returns a new ed25519 key pair, PEM encoded.
+func GenerateSigningKey() (privPEM, pubPEM []byte, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encodeKeyPair(priv, pub)
+}
+
+// GenerateEncryptionKey returns a new X25519 key pair, PEM encoded.
+func GenerateEncryptionKey() (privPEM, pubPEM []byte, err error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encodeKeyPair(priv, priv.PublicKey())
+}
+
+func encodeKeyPair(priv, pub any) ([]byte, []byte, error) {
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: privateKeyPEMType, Bytes: privDER}),
+		pem.EncodeToMemory(&pem.Block{Type: publicKeyPEMType, Bytes: pubDER}),
+		nil
+}
+
+// ParseSigningKey parses a PEM encoded ed25519 private key.
+func ParseSigningKey(data []byte) (ed25519.PrivateKey, error) {
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an ed25519 private key")
+	}
+	return priv, nil
+}
+
+// ParseVerificationKey parses a PEM encoded ed25519 public key.
+func ParseVerificationKey(data []byte) (ed25519.PublicKey, error) {
+	key, err := parsePublicKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not an ed25519 public key")
+	}
+	return pub, nil
+}
+
+// ParseIdentity parses a PEM encoded X25519 private key.
+func ParseIdentity(data []byte) (*ecdh.PrivateKey, error) {
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	priv, ok := key.(*ecdh.PrivateKey)
+	if !ok || priv.Curve() != ecdh.X25519() {
+		return nil, fmt.Errorf("not an X25519 private key")
+	}
+	return priv, nil
+}
+
+// ParseRecipient parses a PEM encoded X25519 public key.
+func ParseRecipient(data []byte) (*ecdh.PublicKey, error) {
+	key, err := parsePublicKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := key.(*ecdh.PublicKey)
+	if !ok || pub.Curve() != ecdh.X25519() {
+		return nil, fmt.Errorf("not an X25519 public key")
+	}
+	return pub, nil
+}
+
+// ReadKey returns the PEM content of a key given as a file name, as PEM text, or as base64 encoded PEM text. The
+// base64 form is convenient for passing public keys in environment variables, e.g.
+// `ENCRYPTION_RECIPIENTS=$(base64 -w0 key.pub)`.
+func ReadKey(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "-----BEGIN") {
+		return []byte(value), nil
+	}
+
+	if data, err := os.ReadFile(value); err == nil {
+		return data, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || !strings.HasPrefix(string(data), "-----BEGIN") {
+		return nil, fmt.Errorf("the key is not a file name, a PEM key, or a base64 encoded PEM key")
+	}
+	return data, nil
+}
+
+// Fingerprint returns a short identifier of a public key.
+func Fingerprint(pubKey []byte) string {
+	sum := sha256.Sum256(pubKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+func parsePrivateKey(data []byte) (any, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != privateKeyPEMType {
+		return nil, fmt.Errorf("can't find a %q PEM block", privateKeyPEMType)
+	}
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
+
+func parsePublicKey(data []byte) (any, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != publicKeyPEMType {
+		return nil, fmt.Errorf("can't find a %q PEM block", publicKeyPEMType)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
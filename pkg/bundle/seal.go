@@ -0,0 +1,124 @@
+package bundle
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/manifest"
+)
+
+const (
+	// EncryptedFileName is the encrypted archive that replaces the content of an encrypted bundle.
+	EncryptedFileName = "must-gather.tar.gz.enc"
+
+	partialSuffix = ".partial"
+)
+
+// SealOptions configures Seal. Seal does nothing if both fields are empty.
+type SealOptions struct {
+	// SigningKey, if set, is used to sign the manifest.
+	SigningKey ed25519.PrivateKey
+	// Recipients, if set, are the public keys the bundle is encrypted for.
+	Recipients []*ecdh.PublicKey
+}
+
+// Seal signs and encrypts the bundle in root, in place. The manifest must already be finalized.
+//
+// When encrypting, the whole bundle, with the manifest and its signature, is archived and encrypted, and everything
+// but the version file is replaced by the encrypted archive.
+func Seal(root string, opts SealOptions) error {
+	if opts.SigningKey != nil {
+		if err := SignManifest(root, opts.SigningKey); err != nil {
+			return err
+		}
+	}
+
+	if len(opts.Recipients) == 0 {
+		return nil
+	}
+
+	partial := filepath.Join(root, EncryptedFileName+partialSuffix)
+	if err := encryptBundle(root, partial, opts.Recipients); err != nil {
+		_ = os.Remove(partial)
+		return err
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if name := entry.Name(); name != layout.VersionFile && name != filepath.Base(partial) {
+			if err = os.RemoveAll(filepath.Join(root, name)); err != nil {
+				return fmt.Errorf("can't remove the plain text bundle; %w", err)
+			}
+		}
+	}
+
+	return os.Rename(partial, filepath.Join(root, EncryptedFileName))
+}
+
+func encryptBundle(root, target string, recipients []*ecdh.PublicKey) error {
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	enc, err := Encrypt(f, recipients...)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	skipPartial := func(rel string) bool { return rel == filepath.Base(target) }
+	if err = WriteArchive(enc, root, skipPartial); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err = enc.Close(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// DecryptBundle decrypts an encrypted archive written by Seal, and extracts it into dest. archive is either the
+// encrypted file, or the bundle directory that contains it, which may be the directory created by
+// `oc adm must-gather` (see layout.Open).
+func DecryptBundle(archive, dest string, identity *ecdh.PrivateKey) error {
+	if info, err := os.Stat(archive); err == nil && info.IsDir() {
+		b, err := layout.Open(archive)
+		if err != nil {
+			return err
+		}
+		archive = b.Path(EncryptedFileName)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	plain, err := Decrypt(f, identity)
+	if err != nil {
+		return err
+	}
+
+	return ExtractArchive(plain, dest)
+}
+
+// VerifyBundle checks the manifest signature of the bundle in root, and compares the bundle files with the manifest.
+func VerifyBundle(root string, key ed25519.PublicKey) ([]manifest.Problem, error) {
+	if err := VerifyManifestSignature(root, key); err != nil {
+		return nil, err
+	}
+
+	return manifest.VerifyDir(root)
+}
@@ -0,0 +1,52 @@
+package bundle
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kubevirt/must-gather/pkg/manifest"
+)
+
+// ErrBadSignature is returned when the manifest signature does not match the verification key.
+var ErrBadSignature = fmt.Errorf("the manifest signature is not valid")
+
+// SignManifest signs the manifest.json of the bundle in root, and writes the base64 encoded signature to
+// manifest.json.sig
+func SignManifest(root string, key ed25519.PrivateKey) error {
+	data, err := os.ReadFile(filepath.Join(root, manifest.FileName))
+	if err != nil {
+		return fmt.Errorf("can't read the manifest; %w", err)
+	}
+
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+	return os.WriteFile(filepath.Join(root, manifest.SignatureFileName), []byte(sig+"\n"), 0644)
+}
+
+// VerifyManifestSignature checks the signature of the manifest.json of the bundle in root. It only checks the
+// manifest; use manifest.Verify to check the files.
+func VerifyManifestSignature(root string, key ed25519.PublicKey) error {
+	data, err := os.ReadFile(filepath.Join(root, manifest.FileName))
+	if err != nil {
+		return fmt.Errorf("can't read the manifest; %w", err)
+	}
+
+	encoded, err := os.ReadFile(filepath.Join(root, manifest.SignatureFileName))
+	if err != nil {
+		return fmt.Errorf("can't read the manifest signature; %w", err)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("can't decode the manifest signature; %w", err)
+	}
+
+	if !ed25519.Verify(key, data, sig) {
+		return ErrBadSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+// Package kvlog parses the log lines of the KubeVirt components and of QEMU.
+//
+// The KubeVirt components, and virt-launcher, write one JSON object per line, with the component, the level, the
+// message and, when the line is about an object, its kind, namespace, name and UID. CDI writes klog lines, and QEMU
+// writes plain lines, most of them with a timestamp. The logs collected by oc adm inspect have an RFC 3339 timestamp
+// in front of each line.
+package kvlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MaxLine is the length above which a line is skipped, e.g. a virt-launcher line with a whole domain XML.
+const MaxLine = 4 * 1024 * 1024
+
+// Levels of the log lines.
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+	LevelInfo    = "info"
+	LevelDebug   = "debug"
+)
+
+// Entry is a log line.
+type Entry struct {
+	// Line is the line number, starting at 1.
+	Line int       `json:"line"`
+	Time time.Time `json:"time,omitzero"`
+	// Level is empty when the line doesn't tell, e.g. for most QEMU lines.
+	Level        string `json:"level,omitempty"`
+	Component    string `json:"component,omitempty"`
+	Subcomponent string `json:"subcomponent,omitempty"`
+	// Message is the msg of a JSON line, or the text of another line, without its timestamp and klog header.
+	Message string `json:"message"`
+	Reason  string `json:"reason,omitempty"`
+	// Kind, Namespace, Name and UID are the object the line is about.
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	UID       string `json:"uid,omitempty"`
+	// Pos is the source file and line of a JSON line, e.g. vm.go:1724.
+	Pos string `json:"pos,omitempty"`
+	// Structured tells whether the line is a KubeVirt JSON line.
+	Structured bool `json:"structured"`
+	// Raw is the line without a leading RFC 3339 timestamp, such as the one of oc adm inspect; Time keeps it.
+	Raw string `json:"-"`
+}
+
+// the kinds of the lines that are about a VM or a VMI
+var vmKinds = []string{"VirtualMachineInstance", "VirtualMachine", "Domain"}
+
+// VM returns the namespace and the name of the VM or the VMI a KubeVirt JSON line is about, or empty strings. The
+// domain of a VMI, in the virt-launcher lines, is named <namespace>_<name>.
+func (e Entry) VM() (namespace, name string) {
+	if e.Name == "" || !slices.Contains(vmKinds, e.Kind) {
+		return "", ""
+	}
+	if e.Kind == "Domain" {
+		if ns, n, found := strings.Cut(e.Name, "_"); found && (e.Namespace == "" || ns == e.Namespace) {
+			return ns, n
+		}
+	}
+	return e.Namespace, e.Name
+}
+
+// Text is the message and the reason of the entry, which is what the signatures are matched with.
+func (e Entry) Text() string {
+	if e.Reason == "" {
+		return e.Message
+	}
+	return e.Message + ": " + e.Reason
+}
+
+// jsonLine is the fields of a KubeVirt JSON line; the values that are not strings are ignored
+type jsonLine struct {
+	Timestamp    any `json:"timestamp"`
+	Level        any `json:"level"`
+	Component    any `json:"component"`
+	Subcomponent any `json:"subcomponent"`
+	Msg          any `json:"msg"`
+	Reason       any `json:"reason"`
+	Kind         any `json:"kind"`
+	Namespace    any `json:"namespace"`
+	Name         any `json:"name"`
+	UID          any `json:"uid"`
+	Pos          any `json:"pos"`
+}
+
+var (
+	// the timestamp of oc adm inspect and oc logs --timestamps
+	inspectTimePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2})) `)
+	// the timestamp of QEMU and libvirt, e.g. "2026-10-19 08:55:00.512+0000: " or "2026-10-19T08:55:00.512345Z "
+	qemuTimePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{4}|[+-]\d{2}:\d{2})):? `)
+	// the header of klog lines, e.g. "E1019 08:55:00.512345       1 importer.go:173] "
+	klogPattern = regexp.MustCompile(`^([IWEF])(\d{4} \d{2}:\d{2}:\d{2}\.\d+)\s+\d+ [^ \]]+:\d+\] `)
+)
+
+var klogLevels = map[string]string{"I": LevelInfo, "W": LevelWarning, "E": LevelError, "F": LevelError}
+
+var qemuTimeLayouts = []string{"2006-01-02 15:04:05.999999999-0700", "2006-01-02T15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999Z07:00"}
+
+// ParseLine parses a log line. Lines that are not JSON are returned with their text as the message.
+func ParseLine(line string) Entry {
+	text := strings.TrimRight(line, "\r")
+	e := Entry{}
+	if m := inspectTimePattern.FindStringSubmatch(text); m != nil {
+		e.Time, _ = time.Parse(time.RFC3339Nano, m[1])
+		text = text[len(m[0]):]
+	}
+	e.Raw = text
+
+	if strings.HasPrefix(text, "{") {
+		var j jsonLine
+		if err := json.Unmarshal([]byte(text), &j); err == nil {
+			e.Structured = true
+			if t, err := time.Parse(time.RFC3339Nano, str(j.Timestamp)); err == nil {
+				e.Time = t
+			}
+			e.Level, e.Component, e.Subcomponent = str(j.Level), str(j.Component), str(j.Subcomponent)
+			e.Message, e.Reason, e.Pos = str(j.Msg), str(j.Reason), str(j.Pos)
+			e.Kind, e.Namespace, e.Name, e.UID = str(j.Kind), str(j.Namespace), str(j.Name), str(j.UID)
+			return e
+		}
+	}
+
+	if m := qemuTimePattern.FindStringSubmatch(text); m != nil {
+		for _, layout := range qemuTimeLayouts {
+			if t, err := time.Parse(layout, m[1]); err == nil {
+				e.Time = t
+				break
+			}
+		}
+		text = text[len(m[0]):]
+	} else if m := klogPattern.FindStringSubmatch(text); m != nil {
+		e.Level = klogLevels[m[1]]
+		text = text[len(m[0]):]
+	}
+	e.Message = text
+
+	return e
+}
+
+// Parse reads the lines of a log. Empty lines, and lines longer than MaxLine, are skipped, but counted in the line
+// numbers.
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	_, err := Scan(r, func(e Entry) { entries = append(entries, e) })
+	return entries, err
+}
+
+// Scan calls fn with each line of a log, without keeping them, and returns the number of lines longer than MaxLine,
+// which are skipped. Empty lines are skipped too. Both are counted in the line numbers.
+func Scan(r io.Reader, fn func(Entry)) (skipped int, err error) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	var buf []byte
+	for n := 1; ; n++ {
+		var tooLong bool
+		buf, tooLong, err = readLine(reader, buf)
+		if tooLong {
+			skipped++
+		} else if text := strings.TrimRight(string(buf), "\r\n"); strings.TrimSpace(text) != "" {
+			e := ParseLine(text)
+			e.Line = n
+			fn(e)
+		}
+
+		if errors.Is(err, io.EOF) {
+			return skipped, nil
+		}
+		if err != nil {
+			return skipped, err
+		}
+	}
+}
+
+// readLine reads the next line of r into buf. The rest of a line longer than MaxLine is skipped, and tooLong is set.
+func readLine(r *bufio.Reader, buf []byte) (line []byte, tooLong bool, err error) {
+	line = buf[:0]
+	for {
+		var chunk []byte
+		chunk, err = r.ReadSlice('\n')
+		if len(line)+len(chunk) > MaxLine {
+			tooLong = true
+		} else if !tooLong {
+			line = append(line, chunk...)
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return line, tooLong, err
+		}
+	}
+}
+
+func str(v any) string {
+	s, _ := v.(string)
+	return s
+}
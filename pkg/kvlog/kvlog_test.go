@@ -0,0 +1,95 @@
+package kvlog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	for _, test := range []struct {
+		line     string
+		expected Entry
+	}{
+		{
+			`2026-10-19T08:55:00.600123456Z {"component":"virt-handler","kind":"VirtualMachineInstance","level":"error","msg":"Synchronizing the VirtualMachineInstance failed.","name":"fedora","namespace":"ns1","pos":"vm.go:1724","reason":"server error. command SyncVMI failed","timestamp":"2026-10-19T08:55:00.512345Z","uid":"b4a3c2d1-0000-4000-8000-000000000001"}`,
+			Entry{Time: time.Date(2026, 10, 19, 8, 55, 0, 512345000, time.UTC), Level: LevelError, Component: "virt-handler",
+				Message: "Synchronizing the VirtualMachineInstance failed.", Reason: "server error. command SyncVMI failed",
+				Kind: "VirtualMachineInstance", Namespace: "ns1", Name: "fedora", UID: "b4a3c2d1-0000-4000-8000-000000000001",
+				Pos: "vm.go:1724", Structured: true},
+		},
+		{
+			`{"component":"virt-launcher","level":"info","msg":"Domain started","subcomponent":"libvirt","thread":23,"timestamp":"bad"}`,
+			Entry{Level: LevelInfo, Component: "virt-launcher", Subcomponent: "libvirt", Message: "Domain started", Structured: true},
+		},
+		{
+			`2026-10-19 08:55:01.020+0000: starting up libvirt version: 10.0.0, qemu version: 8.2.0`,
+			Entry{Time: time.Date(2026, 10, 19, 8, 55, 1, 20_000_000, time.UTC), Message: "starting up libvirt version: 10.0.0, qemu version: 8.2.0"},
+		},
+		{
+			`2026-10-19T08:55:01.120345Z qemu-kvm: terminating on signal 15 from pid 48190 (<unknown process>)`,
+			Entry{Time: time.Date(2026, 10, 19, 8, 55, 1, 120345000, time.UTC), Message: "qemu-kvm: terminating on signal 15 from pid 48190 (<unknown process>)"},
+		},
+		{
+			`E1019 08:55:00.512345       1 importer.go:173] Unable to transfer source data to target file`,
+			Entry{Level: LevelError, Message: "Unable to transfer source data to target file"},
+		},
+		{
+			`{not json`,
+			Entry{Message: "{not json"},
+		},
+	} {
+		e := ParseLine(test.line)
+		test.expected.Raw = inspectTimePattern.ReplaceAllString(test.line, "")
+		if !e.Time.Equal(test.expected.Time) {
+			t.Errorf("expected the time %s for %q, but got %s", test.expected.Time, test.line, e.Time)
+		}
+		e.Time, test.expected.Time = time.Time{}, time.Time{}
+		if e != test.expected {
+			t.Errorf("expected %+v, but got %+v", test.expected, e)
+		}
+	}
+}
+
+func TestVM(t *testing.T) {
+	for _, test := range []struct {
+		e               Entry
+		namespace, name string
+	}{
+		{Entry{Kind: "VirtualMachineInstance", Namespace: "ns1", Name: "fedora"}, "ns1", "fedora"},
+		{Entry{Kind: "Domain", Namespace: "ns1", Name: "ns1_fedora"}, "ns1", "fedora"},
+		{Entry{Kind: "Domain", Name: "ns1_fedora"}, "ns1", "fedora"},
+		{Entry{Kind: "VirtualMachineInstanceMigration", Namespace: "ns1", Name: "fedora-migration"}, "", ""},
+		{Entry{Kind: "VirtualMachine", Namespace: "ns1"}, "", ""},
+	} {
+		if namespace, name := test.e.VM(); namespace != test.namespace || name != test.name {
+			t.Errorf("expected %s/%s for %+v, but got %s/%s", test.namespace, test.name, test.e, namespace, name)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	entries, err := Parse(strings.NewReader("first\n\n{\"msg\":\"third\"}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[1].Line != 3 || entries[1].Text() != "third" {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestScanLongLine(t *testing.T) {
+	log := "first\n" + strings.Repeat("x", MaxLine) + "\r\n{\"msg\":\"third\"}\r\nlast"
+
+	var entries []Entry
+	skipped, err := Scan(strings.NewReader(log), func(e Entry) { entries = append(entries, e) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 1 {
+		t.Errorf("expected the long line to be skipped, but got %d", skipped)
+	}
+	if len(entries) != 3 || entries[1].Line != 3 || entries[1].Text() != "third" || entries[2].Line != 4 || entries[2].Raw != "last" {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+}
@@ -0,0 +1,192 @@
+// Package layout encodes the directory layout written by the KubeVirt must-gather collectors, and provides typed
+// access to a gathered bundle.
+//
+// The layout is not fully stable between releases: VMs were first collected as lists by `oc adm inspect`, and then
+// one file per VM by vmConvertor; CRs may be collected by gather_crs or by inspecting a namespace, and so on. The
+// accessors in this package look in every known location, so the callers don't need to know which release produced
+// the bundle.
+package layout
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Well known top level entries of a must-gather bundle.
+const (
+	VersionFile         = "version"
+	NamespacesDir       = "namespaces"
+	ClusterScopedDir    = "cluster-scoped-resources"
+	NodesDir            = "nodes"
+	WebhooksDir         = "webhooks"
+	APIServicesDir      = "apiservices"
+	VirtualizationDir   = "virtualization"
+	APIServerAuditDir   = "apiserver-audit"
+	OLMDir              = "olm"
+	MustGatherLogFile   = "must-gather.log"
+	RunningVMsCountFile = "running_vms_count.txt"
+
+	// ProductName is the first line of the version file of bundles written by this image.
+	ProductName = "kubevirt/must-gather"
+)
+
+const (
+	unknownVersion       = "Unknown"
+	maxBundleSearchDepth = 2
+)
+
+// Bundle is a must-gather output directory.
+type Bundle struct {
+	root string
+
+	mu       sync.Mutex
+	cache    map[schema.GroupResource][]Object
+	warnings []string
+}
+
+// Version is the content of the bundle's version file.
+type Version struct {
+	// Product is always "kubevirt/must-gather" for bundles written by this image.
+	Product string
+	// Image is the must-gather image version (usually its tag), or "Unknown".
+	Image string
+}
+
+// Open returns the bundle found at dir.
+//
+// dir may be the bundle itself, or the directory created by `oc adm must-gather`, that contains one sub directory per
+// image, e.g. must-gather.local.1234/quay-io-kubevirt-must-gather-sha256-abcd/. In that case the first directory with
+// a kubevirt/must-gather version file is used.
+func Open(dir string) (*Bundle, error) {
+	root, err := findBundleRoot(dir, maxBundleSearchDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Bundle{root: root}, nil
+}
+
+// Root returns the bundle directory.
+func (b *Bundle) Root() string {
+	return b.root
+}
+
+// Path returns the absolute path of a bundle entry. The elements are relative to the bundle root.
+func (b *Bundle) Path(elem ...string) string {
+	return filepath.Join(append([]string{b.root}, elem...)...)
+}
+
+// Rel returns the path of file relative to the bundle root, using forward slashes.
+func (b *Bundle) Rel(file string) string {
+	rel, err := filepath.Rel(b.root, file)
+	if err != nil {
+		return file
+	}
+	return filepath.ToSlash(rel)
+}
+
+// ReadFile reads a bundle entry. The elements are relative to the bundle root.
+func (b *Bundle) ReadFile(elem ...string) ([]byte, error) {
+	return os.ReadFile(b.Path(elem...))
+}
+
+// Exists reports whether a bundle entry exists.
+func (b *Bundle) Exists(elem ...string) bool {
+	_, err := os.Stat(b.Path(elem...))
+	return err == nil
+}
+
+// Version reads the version file of the bundle.
+func (b *Bundle) Version() (Version, error) {
+	f, err := os.Open(b.Path(VersionFile))
+	if err != nil {
+		return Version{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	v := Version{Image: unknownVersion}
+	scanner := bufio.NewScanner(f)
+	if scanner.Scan() {
+		v.Product = strings.TrimSpace(scanner.Text())
+	}
+	if scanner.Scan() {
+		if img := strings.TrimSpace(scanner.Text()); img != "" {
+			v.Image = img
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return Version{}, fmt.Errorf("can't read the version file; %w", err)
+	}
+
+	return v, nil
+}
+
+// Namespaces lists the namespaces that have a directory in the bundle.
+func (b *Bundle) Namespaces() ([]string, error) {
+	return listDirs(b.Path(NamespacesDir))
+}
+
+func findBundleRoot(dir string, depth int) (string, error) {
+	if isBundleRoot(dir) {
+		return dir, nil
+	}
+
+	if depth > 0 {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return "", err
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			if root, err := findBundleRoot(filepath.Join(dir, entry.Name()), depth-1); err == nil {
+				return root, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("can't find a %s bundle in %s; %w", ProductName, dir, fs.ErrNotExist)
+}
+
+// isBundleRoot checks if there is a version file in dir, and if it starts with "kubevirt/must-gather".
+func isBundleRoot(dir string) bool {
+	f, err := os.Open(filepath.Join(dir, VersionFile))
+	if err != nil {
+		return false
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	return scanner.Scan() && strings.TrimSpace(scanner.Text()) == ProductName
+}
+
+// listDirs returns the names of the sub directories of dir. A missing dir is not an error.
+func listDirs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
@@ -0,0 +1,259 @@
+package layout
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testBundleDir = "testdata/must-gather.local.1"
+
+func openTestBundle(t *testing.T) *Bundle {
+	t.Helper()
+
+	b, err := Open(testBundleDir)
+	if err != nil {
+		t.Fatalf("can't open the test bundle; %v", err)
+	}
+	return b
+}
+
+func TestOpen(t *testing.T) {
+	b := openTestBundle(t)
+
+	if filepath.Base(b.Root()) != "quay-io-kubevirt-must-gather-sha256-1" {
+		t.Errorf("wrong bundle root %s", b.Root())
+	}
+
+	if _, err := Open(t.TempDir()); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist for an empty directory, but got %v", err)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	v, err := openTestBundle(t).Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Product != ProductName || v.Image != "v1.6.0" {
+		t.Errorf("wrong version %#v", v)
+	}
+}
+
+func TestVirtualMachines(t *testing.T) {
+	vms, err := openTestBundle(t).VirtualMachines()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"ns1/vm1", "ns1/vm2", "ns2/vm3"}
+	if len(vms) != len(expected) {
+		t.Fatalf("expected %d VMs, but found %d", len(expected), len(vms))
+	}
+
+	for i, vm := range vms {
+		if vm.Key() != expected[i] {
+			t.Errorf("expected %s, but found %s", expected[i], vm.Key())
+		}
+	}
+
+	if vms[2].GetKind() != "VirtualMachine" {
+		t.Errorf("the kind of a list item should be set from the list kind; got %q", vms[2].GetKind())
+	}
+	if vms[2].File != "namespaces/ns2/kubevirt.io/virtualmachines.yaml" {
+		t.Errorf("wrong file %s", vms[2].File)
+	}
+
+	if GetVMType(vms[0]) != CustomVM || GetVMType(vms[1]) != TemplateBasedVM {
+		t.Errorf("wrong VM types")
+	}
+}
+
+func TestLauncherPodFor(t *testing.T) {
+	b := openTestBundle(t)
+
+	vmi, err := b.Object(VirtualMachineInstances, "ns1", "vm1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pod, err := b.LauncherPodFor(vmi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.GetName() != "virt-launcher-vm1-abcde" {
+		t.Errorf("wrong launcher pod %s", pod.GetName())
+	}
+
+	logs, err := b.PodLogs(pod.GetNamespace(), pod.GetName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].Container != "compute" || logs[0].Previous {
+		t.Errorf("wrong pod logs %#v", logs)
+	}
+
+	if _, err = b.Object(VirtualMachineInstances, "ns1", "vm2"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, but got %v", err)
+	}
+}
+
+func TestAllPodLogs(t *testing.T) {
+	b := openTestBundle(t)
+
+	logs, err := b.AllPodLogs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].Namespace != "ns1" || logs[0].Pod != "virt-launcher-vm1-abcde" {
+		t.Errorf("wrong pod logs %#v", logs)
+	}
+}
+
+func TestVMArtifacts(t *testing.T) {
+	b := openTestBundle(t)
+
+	refs, err := b.VMsWithDetails()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || refs[0].String() != "ns1/vm1" {
+		t.Fatalf("wrong VMs with details %v", refs)
+	}
+
+	for artifact, fileName := range map[Artifact]string{
+		DomainXML:       "virt-launcher-vm1-abcde.dumpxml.xml",
+		Capabilities:    "virt-launcher-vm1-abcde.capabilities.xml",
+		DomCapabilities: "virt-launcher-vm1-abcde.domcapabilities.xml",
+	} {
+		p, err := b.VMArtifactPath("ns1", "vm1", artifact)
+		if err != nil {
+			t.Errorf("%s: %v", artifact, err)
+			continue
+		}
+		if filepath.Base(p) != fileName {
+			t.Errorf("%s: expected %s, but got %s", artifact, fileName, filepath.Base(p))
+		}
+	}
+
+	domXML, err := b.ReadVMArtifact("ns1", "vm1", DomainXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(domXML), "ns1_vm1") {
+		t.Errorf("wrong domain xml content")
+	}
+
+	if _, err = b.VMArtifactPath("ns1", "vm1", BlockJob); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, but got %v", err)
+	}
+
+	if _, err = b.QEMULogPath("ns1", "vm1"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNodes(t *testing.T) {
+	b := openTestBundle(t)
+
+	nodes, err := b.Nodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0] != "node01" {
+		t.Fatalf("wrong nodes %v", nodes)
+	}
+
+	cmdline, err := b.ReadNodeFile("node01", NodeProcCmdline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(cmdline), "intel_iommu=on") {
+		t.Errorf("wrong proc_cmdline content")
+	}
+
+	if _, err = b.ReadNodeFile("node01", NodeLspci); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, but got %v", err)
+	}
+
+	nodeObjs, err := b.Objects(Nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeObjs) != 1 || nodeObjs[0].Key() != "node01" {
+		t.Errorf("wrong node objects")
+	}
+}
+
+func TestGatherHCOObjects(t *testing.T) {
+	b, err := Open(testBundleDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subs, err := b.Objects(Subscriptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].Key() != "kubevirt-hyperconverged/hco-operatorhub" {
+		t.Errorf("wrong subscriptions %v", subs)
+	}
+}
+
+func TestObjectsUndecodableFile(t *testing.T) {
+	root := t.TempDir()
+	if err := os.CopyFS(root, os.DirFS(testBundleDir)); err != nil {
+		t.Fatal(err)
+	}
+	nodesDir := filepath.Join(root, "quay-io-kubevirt-must-gather-sha256-1", "cluster-scoped-resources", "core", "nodes")
+	// a file cut while it was written
+	if err := os.WriteFile(filepath.Join(nodesDir, "node02.yaml"), []byte("apiVersion: v1\nkind: Node\nmetadata: {name: node02\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := b.Objects(Nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].Key() != "node01" {
+		t.Errorf("wrong node objects %v", nodes)
+	}
+	if w := b.Warnings(); len(w) != 1 || !strings.HasPrefix(w[0], "can't decode cluster-scoped-resources/core/nodes/node02.yaml; ") {
+		t.Errorf("wrong warnings %q", w)
+	}
+}
+
+func TestDecodeObjects(t *testing.T) {
+	data := `apiVersion: v1
+kind: Pod
+metadata:
+  name: a
+---------------
+apiVersion: v1
+kind: Pod
+metadata:
+  name: b
+---
+`
+	objs, err := DecodeObjects([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 || objs[0].GetName() != "a" || objs[1].GetName() != "b" {
+		t.Errorf("wrong objects %v", objs)
+	}
+
+	// the documents before the one that can't be decoded are kept
+	objs, err = DecodeObjects([]byte(data + "apiVersion: v1\nkind: Pod\nmetadata: {name: c\n"))
+	if err == nil || len(objs) != 2 {
+		t.Errorf("expected 2 objects and an error, but got %v, %v", objs, err)
+	}
+}
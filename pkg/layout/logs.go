@@ -0,0 +1,113 @@
+package layout
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// PodLog is a collected container log.
+type PodLog struct {
+	Namespace string
+	Pod       string
+	// Container is empty if the collector did not record it (gather_cdi).
+	Container string
+	// Previous is true for the log of the previous container instance.
+	Previous bool
+	// Path is the absolute path of the log file.
+	Path string
+}
+
+const (
+	inspectLogsDir   = "logs"
+	currentLog       = "current.log"
+	previousLog      = "previous.log"
+	insecureLogInfix = ".insecure"
+)
+
+// PodLogs returns the collected logs of a pod. It knows about the oc adm inspect layout,
+// namespaces/<ns>/pods/<pod>/<container>/<container>/logs/{current,previous}.log, and about the log gather_cdi
+// writes to namespaces/<ns>/<pod>/<pod>.log
+func (b *Bundle) PodLogs(namespace, pod string) ([]PodLog, error) {
+	podDir := b.Path(NamespacesDir, namespace, podsDir, pod)
+	containers, err := listDirs(podDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []PodLog
+	for _, container := range containers {
+		logsDir := filepath.Join(podDir, container, container, inspectLogsDir)
+		entries, err := os.ReadDir(logsDir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := strings.Replace(entry.Name(), insecureLogInfix, "", 1)
+			if entry.IsDir() || (name != currentLog && name != previousLog) {
+				continue
+			}
+			logs = append(logs, PodLog{
+				Namespace: namespace,
+				Pod:       pod,
+				Container: container,
+				Previous:  name == previousLog,
+				Path:      filepath.Join(logsDir, entry.Name()),
+			})
+		}
+	}
+
+	cdiLog := b.Path(NamespacesDir, namespace, pod, pod+".log")
+	if info, err := os.Stat(cdiLog); err == nil && !info.IsDir() {
+		logs = append(logs, PodLog{Namespace: namespace, Pod: pod, Path: cdiLog})
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool {
+		if logs[i].Container != logs[j].Container {
+			return logs[i].Container < logs[j].Container
+		}
+		return logs[i].Previous && !logs[j].Previous
+	})
+
+	return logs, nil
+}
+
+// AllPodLogs returns the collected logs of every pod of every namespace, from the oc adm inspect layout and from the
+// gather_cdi layout.
+func (b *Bundle) AllPodLogs() ([]PodLog, error) {
+	namespaces, err := b.Namespaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []PodLog
+	for _, ns := range namespaces {
+		pods, err := listDirs(b.Path(NamespacesDir, ns, podsDir))
+		if err != nil {
+			return nil, err
+		}
+
+		dirs, err := listDirs(b.Path(NamespacesDir, ns))
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			if _, err := os.Stat(b.Path(NamespacesDir, ns, dir, dir+".log")); err == nil && !slices.Contains(pods, dir) {
+				pods = append(pods, dir)
+			}
+		}
+		sort.Strings(pods)
+
+		for _, pod := range pods {
+			podLogs, err := b.PodLogs(ns, pod)
+			if err != nil {
+				return nil, err
+			}
+			logs = append(logs, podLogs...)
+		}
+	}
+
+	return logs, nil
+}
@@ -0,0 +1,53 @@
+package layout
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// NodeFile is a file gather_nodes writes into nodes/<node>/
+type NodeFile string
+
+const (
+	NodeIPAddr        NodeFile = "ip.txt"             // ip a
+	NodeBridges       NodeFile = "bridge"             // ip -o link show type bridge
+	NodeVLANs         NodeFile = "vlan"               // bridge -j vlan show
+	NodeNFTables      NodeFile = "nftables"           // nft list ruleset
+	NodeSRIOVNumVFs   NodeFile = "sys_sriov_numvfs"   // sriov_numvfs of every PCI device
+	NodeSRIOVTotalVFs NodeFile = "sys_sriov_totalvfs" // sriov_totalvfs of every PCI device
+	NodeOptCNIBin     NodeFile = "opt-cni-bin"        // ls -l /opt/cni/bin
+	NodeVarLibCNIBin  NodeFile = "var-lib-cni-bin"    // ls -l /var/lib/cni/bin
+	NodeDevVFIO       NodeFile = "dev_vfio"           // ls -al /dev/vfio/
+	NodeDmesg         NodeFile = "dmesg"              // dmesg
+	NodeProcCmdline   NodeFile = "proc_cmdline"       // cat /proc/cmdline
+	NodeLspci         NodeFile = "lspci"              // lspci -vv
+	NodePCIDPConfig   NodeFile = "pcidp_config.json"  // /etc/pcidp/config.json
+	NodeAuditLog      NodeFile = "audit.log"          // /var/log/audit/audit.log
+	NodeCNIConfigDir  NodeFile = "etc/cni/net.d"
+	NodeK8sCNIConfDir NodeFile = "etc/kubernetes/cni/net.d"
+)
+
+// SkippedNodesFile lists the nodes gather_nodes failed to collect from.
+const SkippedNodesFile = "skipped_nodes.txt"
+
+const networkManagerLogs = "_logs_NetworkManager"
+
+// Nodes lists the nodes that have a directory in the bundle.
+func (b *Bundle) Nodes() ([]string, error) {
+	return listDirs(b.Path(NodesDir))
+}
+
+// NodeFilePath returns the path of a node file.
+func (b *Bundle) NodeFilePath(node string, file NodeFile) string {
+	return b.Path(NodesDir, node, filepath.FromSlash(string(file)))
+}
+
+// ReadNodeFile reads a node file.
+func (b *Bundle) ReadNodeFile(node string, file NodeFile) ([]byte, error) {
+	return os.ReadFile(b.NodeFilePath(node, file))
+}
+
+// NetworkManagerLogPath returns the path of the NetworkManager journal of a node.
+func (b *Bundle) NetworkManagerLogPath(node string) string {
+	return b.Path(NodesDir, node, node+networkManagerLogs)
+}
@@ -0,0 +1,269 @@
+package layout
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	coreGroupDir = "core"
+	crsDir       = "crs"
+	podsDir      = "pods"
+)
+
+// Object is a Kubernetes object read from the bundle.
+type Object struct {
+	unstructured.Unstructured
+	// File is the bundle-relative path of the file the object was read from.
+	File string
+}
+
+// Key returns the namespace/name key of the object; the name only, for cluster scoped objects.
+func (o Object) Key() string {
+	if ns := o.GetNamespace(); ns != "" {
+		return ns + "/" + o.GetName()
+	}
+	return o.GetName()
+}
+
+// Objects returns all the collected objects of a resource type, sorted by namespace and name.
+//
+// The collectors store objects in several ways, depending on the tool that collected them and on the release:
+//
+//	namespaces/<ns>/<group>/<resource>/<name>.yaml          oc adm inspect <resource>/<name>, vmConvertor (one level deeper)
+//	namespaces/<ns>/<group>/<resource>.yaml                 oc adm inspect namespace <ns> (a List)
+//	namespaces/<ns>/crs/<resource>.<group>/<name>.yaml      gather_crs
+//	namespaces/<ns>/pods/<name>/<name>.yaml                 oc adm inspect pod
+//	namespaces/<ns>/<resource>                              gather_hco (documents separated by dashes)
+//	cluster-scoped-resources/<group>/<resource>/<name>.yaml oc adm inspect
+//	cluster-scoped-resources/<resource>.<group>/<name>.yaml gather_crs
+//	apiservices/<name>.yaml                                 gather_apiservices
+//
+// The core group is stored in the "core" directory. When the same object is found in more than one place, the first
+// one, in the order above, is used. The files that can't be read or decoded, e.g. because the collection was
+// interrupted while writing them, are skipped, and listed in Warnings.
+func (b *Bundle) Objects(gr schema.GroupResource) ([]Object, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if objs, found := b.cache[gr]; found {
+		return objs, nil
+	}
+
+	objs, err := b.readObjects(gr)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.cache == nil {
+		b.cache = make(map[schema.GroupResource][]Object)
+	}
+	b.cache[gr] = objs
+
+	return objs, nil
+}
+
+// Warnings returns the problems found while reading the objects, such as the files that were skipped.
+func (b *Bundle) Warnings() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return slices.Clone(b.warnings)
+}
+
+// Object returns a single collected object. The namespace is empty for cluster scoped objects. The returned error
+// wraps fs.ErrNotExist if the object was not collected.
+func (b *Bundle) Object(gr schema.GroupResource, namespace, name string) (Object, error) {
+	objs, err := b.Objects(gr)
+	if err != nil {
+		return Object{}, err
+	}
+
+	for _, obj := range objs {
+		if obj.GetNamespace() == namespace && obj.GetName() == name {
+			return obj, nil
+		}
+	}
+
+	return Object{}, fmt.Errorf("can't find %s %s/%s; %w", gr.String(), namespace, name, fs.ErrNotExist)
+}
+
+func (b *Bundle) readObjects(gr schema.GroupResource) ([]Object, error) {
+	namespaces, err := b.Namespaces()
+	if err != nil {
+		return nil, err
+	}
+
+	groupDir := gr.Group
+	if groupDir == "" {
+		groupDir = coreGroupDir
+	}
+	crName := gr.Resource
+	if gr.Group != "" {
+		crName = gr.Resource + "." + gr.Group
+	}
+
+	var files []string
+	for _, ns := range namespaces {
+		nsDir := b.Path(NamespacesDir, ns)
+		files = append(files, yamlFilesUnder(filepath.Join(nsDir, groupDir, gr.Resource))...)
+		files = append(files, existingFiles(filepath.Join(nsDir, groupDir, gr.Resource+".yaml"))...)
+		files = append(files, yamlFilesUnder(filepath.Join(nsDir, crsDir, crName))...)
+		if gr == Pods {
+			files = append(files, podFiles(filepath.Join(nsDir, podsDir))...)
+		}
+		files = append(files, existingFiles(filepath.Join(nsDir, gr.Resource))...)
+	}
+	files = append(files, yamlFilesUnder(b.Path(ClusterScopedDir, groupDir, gr.Resource))...)
+	files = append(files, existingFiles(b.Path(ClusterScopedDir, groupDir, gr.Resource+".yaml"))...)
+	files = append(files, yamlFilesUnder(b.Path(ClusterScopedDir, crName))...)
+	if gr == APIServices {
+		files = append(files, yamlFilesUnder(b.Path(APIServicesDir))...)
+	}
+
+	seen := make(map[string]bool)
+	var objs []Object
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			b.warnings = append(b.warnings, fmt.Sprintf("can't read %s; %v", b.Rel(file), err))
+			continue
+		}
+
+		decoded, err := DecodeObjects(data)
+		if err != nil {
+			b.warnings = append(b.warnings, fmt.Sprintf("can't decode %s; %v", b.Rel(file), err))
+		}
+
+		for _, obj := range decoded {
+			o := Object{Unstructured: obj, File: b.Rel(file)}
+			if key := o.Key(); !seen[key] {
+				seen[key] = true
+				objs = append(objs, o)
+			}
+		}
+	}
+
+	sort.SliceStable(objs, func(i, j int) bool {
+		if objs[i].GetNamespace() != objs[j].GetNamespace() {
+			return objs[i].GetNamespace() < objs[j].GetNamespace()
+		}
+		return objs[i].GetName() < objs[j].GetName()
+	})
+
+	return objs, nil
+}
+
+var docSeparator = regexp.MustCompile(`(?m)^-{3,}[ \t]*$`)
+
+// DecodeObjects decodes the Kubernetes objects in a YAML or JSON file. Lists are flattened, and the file may contain
+// several documents, separated by "---" (or by the longer "---------------" used by gather_hco). On error, the objects
+// of the documents before the one that can't be decoded are returned with the error.
+func DecodeObjects(data []byte) ([]unstructured.Unstructured, error) {
+	var objs []unstructured.Unstructured
+
+	for _, doc := range docSeparator.Split(string(data), -1) {
+		if len(bytes.TrimSpace([]byte(doc))) == 0 {
+			continue
+		}
+
+		m := make(map[string]interface{})
+		if err := yaml.Unmarshal([]byte(doc), &m); err != nil {
+			return objs, err
+		}
+		if len(m) == 0 {
+			continue
+		}
+
+		obj := unstructured.Unstructured{Object: m}
+		if !obj.IsList() {
+			objs = append(objs, obj)
+			continue
+		}
+
+		itemKind := strings.TrimSuffix(obj.GetKind(), "List")
+		err := obj.EachListItem(func(item runtime.Object) error {
+			u := *(item.(*unstructured.Unstructured))
+			if u.GetKind() == "" && itemKind != "" {
+				u.SetKind(itemKind)
+			}
+			objs = append(objs, u)
+			return nil
+		})
+		if err != nil {
+			return objs, err
+		}
+	}
+
+	return objs, nil
+}
+
+// yamlFilesUnder returns the yaml files under dir, in lexical order.
+func yamlFilesUnder(dir string) []string {
+	var files []string
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() && (strings.HasSuffix(p, ".yaml") || strings.HasSuffix(p, ".yml")) {
+			files = append(files, p)
+		}
+		return nil
+	})
+
+	return files
+}
+
+// podFiles returns the pod files written by oc adm inspect: pods/<name>/<name>.yaml
+func podFiles(dir string) []string {
+	pods, _ := listDirs(dir)
+
+	var files []string
+	for _, pod := range pods {
+		files = append(files, existingFiles(filepath.Join(dir, pod, pod+".yaml"))...)
+	}
+
+	return files
+}
+
+func existingFiles(files ...string) []string {
+	var existing []string
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			existing = append(existing, file)
+		}
+	}
+	return existing
+}
+
+// NestedInt64 returns a number field. The objects read by DecodeObjects hold float64 numbers, which
+// unstructured.NestedInt64 does not accept.
+func NestedInt64(obj map[string]any, fields ...string) (int64, bool) {
+	value, found, err := unstructured.NestedFieldNoCopy(obj, fields...)
+	if err != nil || !found {
+		return 0, false
+	}
+
+	switch n := value.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,52 @@
+package layout
+
+import "k8s.io/apimachinery/pkg/runtime/schema"
+
+// Resource types that are collected by the must-gather scripts.
+var (
+	VirtualMachines                  = schema.GroupResource{Group: "kubevirt.io", Resource: "virtualmachines"}
+	VirtualMachineInstances          = schema.GroupResource{Group: "kubevirt.io", Resource: "virtualmachineinstances"}
+	VirtualMachineInstanceMigrations = schema.GroupResource{Group: "kubevirt.io", Resource: "virtualmachineinstancemigrations"}
+	KubeVirts                        = schema.GroupResource{Group: "kubevirt.io", Resource: "kubevirts"}
+	HyperConvergeds                  = schema.GroupResource{Group: "hco.kubevirt.io", Resource: "hyperconvergeds"}
+	DataVolumes                      = schema.GroupResource{Group: "cdi.kubevirt.io", Resource: "datavolumes"}
+	DataImportCrons                  = schema.GroupResource{Group: "cdi.kubevirt.io", Resource: "dataimportcrons"}
+
+	Subscriptions          = schema.GroupResource{Group: "operators.coreos.com", Resource: "subscriptions"}
+	InstallPlans           = schema.GroupResource{Group: "operators.coreos.com", Resource: "installplans"}
+	ClusterServiceVersions = schema.GroupResource{Group: "operators.coreos.com", Resource: "clusterserviceversions"}
+	OperatorGroups         = schema.GroupResource{Group: "operators.coreos.com", Resource: "operatorgroups"}
+	CatalogSources         = schema.GroupResource{Group: "operators.coreos.com", Resource: "catalogsources"}
+	PackageManifests       = schema.GroupResource{Group: "packages.operators.coreos.com", Resource: "packagemanifests"}
+
+	NetworkAddonsConfigs         = schema.GroupResource{Group: "networkaddonsoperator.network.kubevirt.io", Resource: "networkaddonsconfigs"}
+	NetworkAttachmentDefinitions = schema.GroupResource{Group: "k8s.cni.cncf.io", Resource: "network-attachment-definitions"}
+
+	NodeNetworkStates                  = schema.GroupResource{Group: "nmstate.io", Resource: "nodenetworkstates"}
+	NodeNetworkConfigurationPolicies   = schema.GroupResource{Group: "nmstate.io", Resource: "nodenetworkconfigurationpolicies"}
+	NodeNetworkConfigurationEnactments = schema.GroupResource{Group: "nmstate.io", Resource: "nodenetworkconfigurationenactments"}
+
+	Pods                      = schema.GroupResource{Resource: "pods"}
+	Nodes                     = schema.GroupResource{Resource: "nodes"}
+	ConfigMaps                = schema.GroupResource{Resource: "configmaps"}
+	PersistentVolumeClaims    = schema.GroupResource{Resource: "persistentvolumeclaims"}
+	PersistentVolumes         = schema.GroupResource{Resource: "persistentvolumes"}
+	StorageClasses            = schema.GroupResource{Group: "storage.k8s.io", Resource: "storageclasses"}
+	CSIDrivers                = schema.GroupResource{Group: "storage.k8s.io", Resource: "csidrivers"}
+	CSINodes                  = schema.GroupResource{Group: "storage.k8s.io", Resource: "csinodes"}
+	VolumeAttachments         = schema.GroupResource{Group: "storage.k8s.io", Resource: "volumeattachments"}
+	CustomResourceDefinitions = schema.GroupResource{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"}
+	PodDisruptionBudgets      = schema.GroupResource{Group: "policy", Resource: "poddisruptionbudgets"}
+	APIServices               = schema.GroupResource{Group: "apiregistration.k8s.io", Resource: "apiservices"}
+)
+
+// Resources are all the resource types above.
+var Resources = []schema.GroupResource{
+	VirtualMachines, VirtualMachineInstances, VirtualMachineInstanceMigrations, KubeVirts, HyperConvergeds, DataVolumes,
+	DataImportCrons,
+	Subscriptions, InstallPlans, ClusterServiceVersions, OperatorGroups, CatalogSources, PackageManifests,
+	NetworkAddonsConfigs, NetworkAttachmentDefinitions,
+	NodeNetworkStates, NodeNetworkConfigurationPolicies, NodeNetworkConfigurationEnactments,
+	Pods, Nodes, ConfigMaps, PersistentVolumeClaims, PersistentVolumes, StorageClasses, CSIDrivers, CSINodes,
+	VolumeAttachments, CustomResourceDefinitions, PodDisruptionBudgets, APIServices,
+}
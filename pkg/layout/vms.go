@@ -0,0 +1,228 @@
+package layout
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// VMType is the sub directory vmConvertor stores a VirtualMachine in.
+type VMType string
+
+const (
+	CustomVM        VMType = "custom"
+	TemplateBasedVM VMType = "template-based"
+)
+
+// Artifact is a per-VM file, written by gather_vms_details into namespaces/<ns>/vms/<vm>/ as <launcher pod>.<artifact>
+type Artifact string
+
+const (
+	DomainXML       Artifact = "dumpxml.xml"
+	Capabilities    Artifact = "capabilities.xml"
+	DomCapabilities Artifact = "domcapabilities.xml"
+	DomainList      Artifact = "list.txt"
+	BlockList       Artifact = "domblklist.txt"
+	JobInfo         Artifact = "domjobinfo.txt"
+	BlockJob        Artifact = "blockjob.txt"
+	LauncherIP      Artifact = "ip.txt"
+	LauncherBridge  Artifact = "bridge.txt"
+	RuleTables      Artifact = "ruletables.txt"
+)
+
+const (
+	vmsDir              = "vms"
+	launcherLabelKey    = "kubevirt.io"
+	launcherLabelValue  = "virt-launcher"
+	launcherDomainAnnot = "kubevirt.io/domain"
+	launcherVMLabel     = "vm.kubevirt.io/name"
+	templateLabelPrefix = "vm.kubevirt.io/template"
+	vmiOwnerKind        = "VirtualMachineInstance"
+)
+
+// VMRef identifies a VM that has a details directory (namespaces/<ns>/vms/<vm>).
+type VMRef struct {
+	Namespace string
+	Name      string
+}
+
+func (r VMRef) String() string {
+	return r.Namespace + "/" + r.Name
+}
+
+// VirtualMachines returns the collected VirtualMachines.
+func (b *Bundle) VirtualMachines() ([]Object, error) {
+	return b.Objects(VirtualMachines)
+}
+
+// VirtualMachineInstances returns the collected VirtualMachineInstances.
+func (b *Bundle) VirtualMachineInstances() ([]Object, error) {
+	return b.Objects(VirtualMachineInstances)
+}
+
+// LauncherPods returns the collected virt-launcher pods.
+func (b *Bundle) LauncherPods() ([]Object, error) {
+	pods, err := b.Objects(Pods)
+	if err != nil {
+		return nil, err
+	}
+
+	var launchers []Object
+	for _, pod := range pods {
+		if IsLauncherPod(pod) {
+			launchers = append(launchers, pod)
+		}
+	}
+
+	return launchers, nil
+}
+
+// LauncherPodFor returns the virt-launcher pod of a VMI. If there are several (e.g. during a migration), the one
+// running on the VMI's node is returned. The returned error wraps fs.ErrNotExist if no pod was collected.
+func (b *Bundle) LauncherPodFor(vmi Object) (Object, error) {
+	launchers, err := b.LauncherPods()
+	if err != nil {
+		return Object{}, err
+	}
+
+	node, _, _ := unstructured.NestedString(vmi.Object, "status", "nodeName")
+
+	var found []Object
+	for _, pod := range launchers {
+		if pod.GetNamespace() == vmi.GetNamespace() && LauncherVMName(pod) == vmi.GetName() {
+			found = append(found, pod)
+		}
+	}
+
+	if len(found) == 0 {
+		return Object{}, fmt.Errorf("can't find the virt-launcher pod of %s; %w", vmi.Key(), fs.ErrNotExist)
+	}
+
+	for _, pod := range found {
+		if podNode, _, _ := unstructured.NestedString(pod.Object, "spec", "nodeName"); podNode == node {
+			return pod, nil
+		}
+	}
+
+	return found[0], nil
+}
+
+// IsLauncherPod reports whether pod is a virt-launcher pod.
+func IsLauncherPod(pod Object) bool {
+	return pod.GetLabels()[launcherLabelKey] == launcherLabelValue
+}
+
+// LauncherVMName returns the name of the VMI a virt-launcher pod runs.
+func LauncherVMName(pod Object) string {
+	if name := pod.GetAnnotations()[launcherDomainAnnot]; name != "" {
+		return name
+	}
+	if name := pod.GetLabels()[launcherVMLabel]; name != "" {
+		return name
+	}
+	for _, ref := range pod.GetOwnerReferences() {
+		if ref.Kind == vmiOwnerKind {
+			return ref.Name
+		}
+	}
+	return ""
+}
+
+// GetVMType returns the vmConvertor type of a VirtualMachine.
+func GetVMType(vm Object) VMType {
+	for k := range vm.GetLabels() {
+		if strings.HasPrefix(k, templateLabelPrefix) {
+			return TemplateBasedVM
+		}
+	}
+	return CustomVM
+}
+
+// VMFile returns the path vmConvertor writes a VirtualMachine to:
+// namespaces/<ns>/kubevirt.io/virtualmachines/<type>/<vm>.yaml
+func (b *Bundle) VMFile(namespace, name string, vmType VMType) string {
+	return b.Path(NamespacesDir, namespace, VirtualMachines.Group, VirtualMachines.Resource, string(vmType), name+".yaml")
+}
+
+// VMDir returns the details directory of a VM: namespaces/<ns>/vms/<vm>
+func (b *Bundle) VMDir(namespace, name string) string {
+	return b.Path(NamespacesDir, namespace, vmsDir, name)
+}
+
+// VMsWithDetails lists the VMs that gather_vms_details collected.
+func (b *Bundle) VMsWithDetails() ([]VMRef, error) {
+	namespaces, err := b.Namespaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []VMRef
+	for _, ns := range namespaces {
+		vms, err := listDirs(b.Path(NamespacesDir, ns, vmsDir))
+		if err != nil {
+			return nil, err
+		}
+		for _, vm := range vms {
+			refs = append(refs, VMRef{Namespace: ns, Name: vm})
+		}
+	}
+
+	return refs, nil
+}
+
+// VMArtifactPath returns the path of a per-VM artifact. The launcher pod name is part of the file name, so it is
+// looked up by its suffix. The returned error wraps fs.ErrNotExist if the artifact was not collected.
+func (b *Bundle) VMArtifactPath(namespace, name string, artifact Artifact) (string, error) {
+	dir := b.VMDir(namespace, name)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var candidates []string
+	suffix := "." + string(artifact)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), suffix) {
+			continue
+		}
+		// pod names can't contain dots; this skips e.g. <pod>.something.ip.txt
+		if pod := strings.TrimSuffix(entry.Name(), suffix); !strings.Contains(pod, ".") {
+			candidates = append(candidates, entry.Name())
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("can't find %s for VM %s/%s; %w", artifact, namespace, name, fs.ErrNotExist)
+	}
+
+	sort.Strings(candidates)
+	return filepath.Join(dir, candidates[0]), nil
+}
+
+// ReadVMArtifact reads a per-VM artifact.
+func (b *Bundle) ReadVMArtifact(namespace, name string, artifact Artifact) ([]byte, error) {
+	p, err := b.VMArtifactPath(namespace, name, artifact)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+// QEMULogPath returns the path of the QEMU log extracted from the virt-launcher pod. The returned error wraps
+// fs.ErrNotExist if the log was not collected.
+func (b *Bundle) QEMULogPath(namespace, name string) (string, error) {
+	p := filepath.Join(b.VMDir(namespace, name), namespace+"_"+name+".log")
+	if _, err := os.Stat(p); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("can't find the QEMU log of VM %s/%s; %w", namespace, name, fs.ErrNotExist)
+		}
+		return "", err
+	}
+	return p, nil
+}
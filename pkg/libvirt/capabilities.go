@@ -0,0 +1,84 @@
+package libvirt
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// DomainCapabilities is what the hypervisor of a node can give a domain, as printed by virsh domcapabilities.
+type DomainCapabilities struct {
+	Arch    string       `xml:"arch"`
+	Machine string       `xml:"machine"`
+	CPU     CapsCPUModes `xml:"cpu"`
+}
+
+// CapsCPUModes are the CPU modes of the domain capabilities.
+type CapsCPUModes struct {
+	Modes []CapsCPUMode `xml:"mode"`
+}
+
+// CapsCPUMode is a CPU mode: host-passthrough, host-model or custom. The host-model mode has a single model, with its
+// vendor and features; the custom mode lists the named models, and whether the host can run them.
+type CapsCPUMode struct {
+	Name      string       `xml:"name,attr"`
+	Supported string       `xml:"supported,attr"`
+	Models    []CapsModel  `xml:"model"`
+	Vendor    string       `xml:"vendor"`
+	Features  []CPUFeature `xml:"feature"`
+}
+
+// CapsModel is a named CPU model.
+type CapsModel struct {
+	Name   string `xml:",chardata"`
+	Usable string `xml:"usable,attr"`
+	Vendor string `xml:"vendor,attr"`
+}
+
+// ParseDomainCapabilities parses a domcapabilities XML.
+func ParseDomainCapabilities(data []byte) (*DomainCapabilities, error) {
+	caps := &DomainCapabilities{}
+	if err := xml.Unmarshal(data, caps); err != nil {
+		return nil, fmt.Errorf("can't parse the domain capabilities; %w", err)
+	}
+	return caps, nil
+}
+
+// Mode returns a CPU mode, or nil if the hypervisor does not support it.
+func (c *DomainCapabilities) Mode(name string) *CapsCPUMode {
+	for i, mode := range c.CPU.Modes {
+		if mode.Name == name && mode.Supported == "yes" {
+			return &c.CPU.Modes[i]
+		}
+	}
+	return nil
+}
+
+// HostModel returns the host-model mode, or nil if it is not supported.
+func (c *DomainCapabilities) HostModel() *CapsCPUMode {
+	return c.Mode("host-model")
+}
+
+// ModelName returns the name of the first model of the mode, which is the CPU model of the host-model mode.
+func (m *CapsCPUMode) ModelName() string {
+	if len(m.Models) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(m.Models[0].Name)
+}
+
+// UsableModels returns the custom models the host can run.
+func (c *DomainCapabilities) UsableModels() []string {
+	custom := c.Mode("custom")
+	if custom == nil {
+		return nil
+	}
+
+	var models []string
+	for _, model := range custom.Models {
+		if model.Usable == "yes" {
+			models = append(models, strings.TrimSpace(model.Name))
+		}
+	}
+	return models
+}
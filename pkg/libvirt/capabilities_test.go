@@ -0,0 +1,41 @@
+package libvirt
+
+import (
+	"strings"
+	"testing"
+)
+
+const domCapabilitiesXML = `<domainCapabilities>
+  <arch>x86_64</arch>
+  <cpu>
+    <mode name='host-passthrough' supported='yes'/>
+    <mode name='maximum' supported='no'/>
+    <mode name='host-model' supported='yes'>
+      <model fallback='forbid'>Skylake-Client-IBRS</model>
+      <vendor>Intel</vendor>
+      <feature policy='require' name='ss'/>
+    </mode>
+    <mode name='custom' supported='yes'>
+      <model usable='yes' vendor='Intel'>Skylake-Client</model>
+      <model usable='no' vendor='AMD'>EPYC</model>
+    </mode>
+  </cpu>
+</domainCapabilities>`
+
+func TestParseDomainCapabilities(t *testing.T) {
+	caps, err := ParseDomainCapabilities([]byte(domCapabilitiesXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostModel := caps.HostModel()
+	if hostModel == nil || hostModel.ModelName() != "Skylake-Client-IBRS" || hostModel.Vendor != "Intel" || len(hostModel.Features) != 1 {
+		t.Errorf("unexpected host model: %+v", hostModel)
+	}
+	if models := caps.UsableModels(); strings.Join(models, ",") != "Skylake-Client" {
+		t.Errorf("unexpected usable models: %q", models)
+	}
+	if caps.Mode("maximum") != nil {
+		t.Error("the maximum mode is not supported")
+	}
+}
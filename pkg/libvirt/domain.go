@@ -0,0 +1,296 @@
+// Package libvirt parses the libvirt documents gather_vms_details collects from the virt-launcher pods: the domain
+// XML, the domain capabilities, and the domblklist output. Only the parts the analyzers use are decoded.
+package libvirt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UserAliasPrefix prefixes the aliases KubeVirt gives to the devices of the VMI spec, e.g. ua-rootdisk.
+const UserAliasPrefix = "ua-"
+
+// Domain is a libvirt domain, as printed by virsh dumpxml.
+type Domain struct {
+	Type          string         `xml:"type,attr"`
+	Name          string         `xml:"name"`
+	UUID          string         `xml:"uuid"`
+	Memory        Size           `xml:"memory"`
+	CurrentMemory *Size          `xml:"currentMemory"`
+	MaxMemory     *Size          `xml:"maxMemory"`
+	MemoryBacking *MemoryBacking `xml:"memoryBacking"`
+	VCPU          VCPU           `xml:"vcpu"`
+	CPU           CPU            `xml:"cpu"`
+	Devices       Devices        `xml:"devices"`
+}
+
+// Size is an amount of memory, with its unit.
+type Size struct {
+	Value uint64 `xml:",chardata"`
+	Unit  string `xml:"unit,attr"`
+}
+
+// MemoryBacking is how the guest memory is backed on the host.
+type MemoryBacking struct {
+	HugePages *HugePages `xml:"hugepages"`
+}
+
+// HugePages lists the huge page sizes backing the guest memory.
+type HugePages struct {
+	Pages []HugePage `xml:"page"`
+}
+
+// HugePage is a huge page size.
+type HugePage struct {
+	Size uint64 `xml:"size,attr"`
+	Unit string `xml:"unit,attr"`
+}
+
+// VCPU is the number of vCPUs; Current is the number of online vCPUs, when CPU hotplug is enabled.
+type VCPU struct {
+	Value     uint   `xml:",chardata"`
+	Current   uint   `xml:"current,attr"`
+	Placement string `xml:"placement,attr"`
+}
+
+// CPU is the guest CPU.
+type CPU struct {
+	Mode     string       `xml:"mode,attr"`
+	Model    *CPUModel    `xml:"model"`
+	Topology *Topology    `xml:"topology"`
+	Features []CPUFeature `xml:"feature"`
+}
+
+// CPUModel is a named CPU model.
+type CPUModel struct {
+	Name     string `xml:",chardata"`
+	Fallback string `xml:"fallback,attr"`
+}
+
+// Topology is the guest CPU topology.
+type Topology struct {
+	Sockets uint `xml:"sockets,attr"`
+	Cores   uint `xml:"cores,attr"`
+	Threads uint `xml:"threads,attr"`
+}
+
+// CPUFeature is a CPU feature, and whether it is required or disabled.
+type CPUFeature struct {
+	Policy string `xml:"policy,attr"`
+	Name   string `xml:"name,attr"`
+}
+
+// Devices are the devices of a domain.
+type Devices struct {
+	Disks      []Disk      `xml:"disk"`
+	Interfaces []Interface `xml:"interface"`
+	HostDevs   []HostDev   `xml:"hostdev"`
+}
+
+// Disk is a disk, CD-ROM or LUN.
+type Disk struct {
+	Type   string     `xml:"type,attr"`
+	Device string     `xml:"device,attr"`
+	Source DiskSource `xml:"source"`
+	Target DiskTarget `xml:"target"`
+	Alias  Alias      `xml:"alias"`
+}
+
+// DiskSource is the file or block device backing a disk.
+type DiskSource struct {
+	File string `xml:"file,attr"`
+	Dev  string `xml:"dev,attr"`
+	Name string `xml:"name,attr"`
+}
+
+// Path returns the file or the device of the source.
+func (s DiskSource) Path() string {
+	switch {
+	case s.File != "":
+		return s.File
+	case s.Dev != "":
+		return s.Dev
+	default:
+		return s.Name
+	}
+}
+
+// DiskTarget is the device a disk is exposed as to the guest.
+type DiskTarget struct {
+	Dev string `xml:"dev,attr"`
+	Bus string `xml:"bus,attr"`
+}
+
+// Interface is a network interface.
+type Interface struct {
+	Type  string `xml:"type,attr"`
+	MAC   MAC    `xml:"mac"`
+	Model Model  `xml:"model"`
+	Alias Alias  `xml:"alias"`
+}
+
+// MAC is the MAC address of an interface.
+type MAC struct {
+	Address string `xml:"address,attr"`
+}
+
+// Model is the model of a device.
+type Model struct {
+	Type string `xml:"type,attr"`
+}
+
+// HostDev is a device passed through from the host.
+type HostDev struct {
+	Mode   string        `xml:"mode,attr"`
+	Type   string        `xml:"type,attr"`
+	Source HostDevSource `xml:"source"`
+	Alias  Alias         `xml:"alias"`
+}
+
+// HostDevSource is the host device a hostdev passes through.
+type HostDevSource struct {
+	Address *PCIAddress `xml:"address"`
+}
+
+// PCIAddress is a PCI address, with hexadecimal fields, e.g. domain="0x0000" bus="0x5e" slot="0x00" function="0x0".
+type PCIAddress struct {
+	Domain   string `xml:"domain,attr"`
+	Bus      string `xml:"bus,attr"`
+	Slot     string `xml:"slot,attr"`
+	Function string `xml:"function,attr"`
+}
+
+// String returns the address the way lspci -D and the kernel print it, e.g. 0000:5e:00.0, or an empty string when a
+// field is not a number.
+func (a PCIAddress) String() string {
+	var fields [4]uint64
+	for i, field := range []string{a.Domain, a.Bus, a.Slot, a.Function} {
+		value, err := strconv.ParseUint(strings.TrimPrefix(field, "0x"), 16, 32)
+		if err != nil {
+			return ""
+		}
+		fields[i] = value
+	}
+	return fmt.Sprintf("%04x:%02x:%02x.%x", fields[0], fields[1], fields[2], fields[3])
+}
+
+// Alias is the name of a device.
+type Alias struct {
+	Name string `xml:"name,attr"`
+}
+
+// UserAlias returns the name of the VMI device an alias was given for, or false if it is not a user alias.
+func (a Alias) UserAlias() (string, bool) {
+	return strings.CutPrefix(a.Name, UserAliasPrefix)
+}
+
+// ParseDomain parses a domain XML.
+func ParseDomain(data []byte) (*Domain, error) {
+	d := &Domain{}
+	if err := xml.Unmarshal(data, d); err != nil {
+		return nil, fmt.Errorf("can't parse the domain XML; %w", err)
+	}
+	return d, nil
+}
+
+// OnlineVCPUs returns the number of vCPUs the guest has.
+func (d *Domain) OnlineVCPUs() uint {
+	if d.VCPU.Current != 0 {
+		return d.VCPU.Current
+	}
+	return d.VCPU.Value
+}
+
+// GuestMemory returns the memory of the guest in bytes: the current memory if it is set, otherwise the boot memory.
+func (d *Domain) GuestMemory() (uint64, error) {
+	if d.CurrentMemory != nil {
+		return d.CurrentMemory.Bytes()
+	}
+	return d.Memory.Bytes()
+}
+
+// Bytes returns the size in bytes.
+func (s Size) Bytes() (uint64, error) {
+	return ToBytes(s.Value, s.Unit)
+}
+
+// Bytes returns the page size in bytes. The default unit of pages is KiB.
+func (p HugePage) Bytes() (uint64, error) {
+	if p.Unit == "" {
+		return p.Size * 1024, nil
+	}
+	return ToBytes(p.Size, p.Unit)
+}
+
+// ToBytes converts a value in a libvirt unit to bytes. The default unit of libvirt is KiB.
+func ToBytes(value uint64, unit string) (uint64, error) {
+	var factor uint64
+	switch unit {
+	case "b", "bytes":
+		factor = 1
+	case "KB":
+		factor = 1000
+	case "", "k", "KiB":
+		factor = 1 << 10
+	case "MB":
+		factor = 1000 * 1000
+	case "M", "MiB":
+		factor = 1 << 20
+	case "GB":
+		factor = 1000 * 1000 * 1000
+	case "G", "GiB":
+		factor = 1 << 30
+	case "TB":
+		factor = 1000 * 1000 * 1000 * 1000
+	case "T", "TiB":
+		factor = 1 << 40
+	default:
+		return 0, fmt.Errorf("unknown unit %q", unit)
+	}
+	return value * factor, nil
+}
+
+// BlockDevice is a line of virsh domblklist.
+type BlockDevice struct {
+	Target string
+	Source string
+}
+
+// ParseBlockList parses the output of virsh domblklist: a header, a separator line and a "target source" line per disk.
+func ParseBlockList(data []byte) ([]BlockDevice, error) {
+	var devices []BlockDevice
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	header := true
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if header {
+			if strings.HasPrefix(line, "---") {
+				header = false
+			}
+			continue
+		}
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		dev := BlockDevice{Target: fields[0]}
+		if len(fields) > 1 {
+			dev.Source = strings.Join(fields[1:], " ")
+		}
+		devices = append(devices, dev)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if header {
+		return nil, fmt.Errorf("can't parse the block device list; missing header")
+	}
+
+	return devices, nil
+}
@@ -0,0 +1,67 @@
+package libvirt
+
+import (
+	"testing"
+)
+
+const domainXML = `<domain type="kvm">
+  <name>ns1_vm1</name>
+  <memory unit="GiB">4</memory>
+  <memoryBacking><hugepages><page size="2048"/></hugepages></memoryBacking>
+  <vcpu placement="static" current="2">4</vcpu>
+  <cpu mode="custom"><model fallback="allow">Skylake-Server</model><topology sockets="2" cores="2" threads="1"/></cpu>
+  <devices>
+    <disk type="block" device="lun"><source dev="/dev/data"/><target dev="sda" bus="scsi"/><alias name="ua-data"/></disk>
+    <interface type="ethernet"><mac address="02:00:00:00:00:01"/><alias name="net0"/></interface>
+    <hostdev mode="subsystem" type="pci" managed="no">
+      <source><address domain="0x0000" bus="0x5e" slot="0x00" function="0x0"/></source><alias name="ua-hostdevice-gpu1"/>
+    </hostdev>
+  </devices>
+</domain>`
+
+func TestParseDomain(t *testing.T) {
+	d, err := ParseDomain([]byte(domainXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Name != "ns1_vm1" || d.OnlineVCPUs() != 2 || d.CPU.Model.Name != "Skylake-Server" || d.CPU.Topology.Sockets != 2 {
+		t.Errorf("unexpected domain: %+v", d)
+	}
+	if memory, err := d.GuestMemory(); err != nil || memory != 4<<30 {
+		t.Errorf("expected 4GiB, but got %d (%v)", memory, err)
+	}
+	if size, err := d.MemoryBacking.HugePages.Pages[0].Bytes(); err != nil || size != 2<<20 {
+		t.Errorf("expected 2MiB pages, but got %d (%v)", size, err)
+	}
+
+	disk := d.Devices.Disks[0]
+	if name, ok := disk.Alias.UserAlias(); !ok || name != "data" || disk.Source.Path() != "/dev/data" || disk.Device != "lun" {
+		t.Errorf("unexpected disk: %+v", disk)
+	}
+	if _, ok := d.Devices.Interfaces[0].Alias.UserAlias(); ok {
+		t.Errorf("net0 is not a user alias")
+	}
+	if address := d.Devices.HostDevs[0].Source.Address; address == nil || address.String() != "0000:5e:00.0" {
+		t.Errorf("unexpected host device address: %+v", address)
+	}
+}
+
+func TestParseBlockList(t *testing.T) {
+	devices, err := ParseBlockList([]byte(` Target   Source
+------------------------------------------------
+ vda      /var/run/kubevirt-private/vmi-disks/rootdisk/disk.img
+ sda      -
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(devices) != 2 || devices[0].Target != "vda" || devices[1].Source != "-" {
+		t.Errorf("unexpected devices: %+v", devices)
+	}
+
+	if _, err = ParseBlockList([]byte("error: failed to get domain 'ns1_vm1'\n")); err == nil {
+		t.Error("expected an error without the header")
+	}
+}
@@ -0,0 +1,310 @@
+// Package manifest records which collector produced each file of a must-gather bundle, and how.
+//
+// While gathering, the collectors append one entry per file to a journal in the bundle root. When all the collectors
+// are done, Finalize computes the size and the checksum of every file in the bundle, merges in the journal entries,
+// and writes the result to manifest.json. Verify compares a received bundle with its manifest.
+package manifest
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+const (
+	// FileName is the name of the manifest, in the bundle root.
+	FileName = "manifest.json"
+	// JournalFileName is the file the collectors append their entries to while gathering. Finalize removes it.
+	JournalFileName = ".manifest.journal"
+	// SignatureFileName is the detached signature of the manifest, when the bundle is signed.
+	SignatureFileName = "manifest.json.sig"
+
+	// FormatVersion is the version of the manifest file format.
+	FormatVersion = 1
+)
+
+// Entry describes one file of the bundle.
+type Entry struct {
+	// Path is relative to the bundle root, with forward slashes.
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+
+	// Collector is the script or program that wrote the file; e.g. gather_nodes, or vmConvertor.
+	Collector string `json:"collector,omitempty"`
+	// Command is the command or API call that produced the content.
+	Command string `json:"command,omitempty"`
+	// ExitStatus is the exit status of the command. It is not set when unknown.
+	ExitStatus *int `json:"exitStatus,omitempty"`
+	// Error is the error a Go collector got while producing the file.
+	Error string `json:"error,omitempty"`
+	// DurationMS is how long it took to produce the file, in milliseconds.
+	DurationMS int64 `json:"durationMs,omitempty"`
+	// NotWritten tells that the collector failed before writing the file, which is not in the bundle.
+	NotWritten bool `json:"notWritten,omitempty"`
+}
+
+// Failed reports whether the collector recorded a failure while producing the file.
+func (e Entry) Failed() bool {
+	return e.NotWritten || e.Error != "" || (e.ExitStatus != nil && *e.ExitStatus != 0)
+}
+
+// Manifest is the content of manifest.json.
+type Manifest struct {
+	FormatVersion int       `json:"formatVersion"`
+	Created       time.Time `json:"created"`
+	Entries       []Entry   `json:"entries"`
+}
+
+// ExcludedFiles are bundle-root files that are never listed in the manifest.
+var ExcludedFiles = map[string]bool{
+	FileName:          true,
+	JournalFileName:   true,
+	SignatureFileName: true,
+}
+
+// Record appends an entry for a bundle file to the journal. The size and the checksum are computed from the file,
+// unless the entry tells it was not written. It is safe to call Record concurrently, from several processes.
+func Record(root string, entry Entry) error {
+	entry.Path = filepath.ToSlash(filepath.Clean(entry.Path))
+	if !entry.NotWritten {
+		if err := fillFileInfo(root, &entry); err != nil {
+			return err
+		}
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	journal, err := os.OpenFile(filepath.Join(root, JournalFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("can't open the manifest journal; %w", err)
+	}
+	defer func() { _ = journal.Close() }()
+
+	if err = syscall.Flock(int(journal.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("can't lock the manifest journal; %w", err)
+	}
+	defer func() { _ = syscall.Flock(int(journal.Fd()), syscall.LOCK_UN) }()
+
+	if _, err = journal.Write(line); err != nil {
+		return fmt.Errorf("can't write to the manifest journal; %w", err)
+	}
+
+	return nil
+}
+
+// RecordAll records the entries, for the tools that write files after the collectors, and may run on a bundle again.
+// It does nothing once the manifest is finalized, as a finalized manifest is not changed; Verify then lists the files
+// as unlisted.
+func RecordAll(root string, entries []Entry) error {
+	if _, err := os.Stat(filepath.Join(root, FileName)); !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := Record(root, entry); err != nil {
+			return fmt.Errorf("can't record %s; %w", entry.Path, err)
+		}
+	}
+	return nil
+}
+
+// Finalize builds the manifest of the bundle in root, writes it to manifest.json and removes the journal.
+//
+// Every regular file is listed, and the files the journal tells were not written. When the journal has several
+// entries for the same file (e.g. a file several commands appended to), the last failed one is kept, or else the last
+// one. The size and the checksum always reflect the final content.
+func Finalize(root string) (*Manifest, error) {
+	journal, err := readJournal(filepath.Join(root, JournalFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{FormatVersion: FormatVersion, Created: time.Now().UTC()}
+
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if ExcludedFiles[rel] {
+			return nil
+		}
+
+		entry, found := journal[rel]
+		if !found {
+			entry = Entry{Path: rel}
+		}
+		delete(journal, rel)
+		// a later command wrote it after all
+		entry.NotWritten = false
+		if err = fillFileInfo(root, &entry); err != nil {
+			return err
+		}
+
+		m.Entries = append(m.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't walk the bundle; %w", err)
+	}
+
+	for _, entry := range journal {
+		if entry.NotWritten {
+			m.Entries = append(m.Entries, entry)
+		}
+	}
+
+	sortEntries(m.Entries)
+
+	if err = m.Write(root); err != nil {
+		return nil, err
+	}
+
+	if err = os.Remove(filepath.Join(root, JournalFileName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Load reads the manifest of the bundle in root.
+func Load(root string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(root, FileName))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("can't parse %s; %w", FileName, err)
+	}
+
+	if m.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("unsupported manifest format version %d", m.FormatVersion)
+	}
+
+	return m, nil
+}
+
+// Write writes the manifest to root/manifest.json
+func (m *Manifest) Write(root string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(root, FileName), append(data, '\n'), 0644)
+}
+
+// Refresh recomputes the sizes and the checksums of the entries from the files in root, e.g. after the bundle was
+// sanitized. The entries are sorted again, as their paths may have changed.
+func (m *Manifest) Refresh(root string) error {
+	for i := range m.Entries {
+		if m.Entries[i].NotWritten {
+			continue
+		}
+		if err := fillFileInfo(root, &m.Entries[i]); err != nil {
+			return err
+		}
+	}
+
+	sortEntries(m.Entries)
+	return nil
+}
+
+// Entry returns the entry of a file.
+func (m *Manifest) Entry(path string) (Entry, bool) {
+	i := sort.Search(len(m.Entries), func(i int) bool { return m.Entries[i].Path >= path })
+	if i < len(m.Entries) && m.Entries[i].Path == path {
+		return m.Entries[i], true
+	}
+	return Entry{}, false
+}
+
+func readJournal(journalPath string) (map[string]Entry, error) {
+	entries := make(map[string]Entry)
+
+	f, err := os.Open(journalPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return entries, nil
+		}
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// a collector that was killed in the middle of a write; keep going
+			continue
+		}
+
+		if prev, found := entries[entry.Path]; found && prev.Failed() && !entry.Failed() {
+			continue
+		}
+		entries[entry.Path] = entry
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("can't read the manifest journal; %w", err)
+	}
+
+	return entries, nil
+}
+
+func fillFileInfo(root string, entry *Entry) error {
+	size, sum, err := hashFile(filepath.Join(root, filepath.FromSlash(entry.Path)))
+	if err != nil {
+		return err
+	}
+
+	entry.Size = size
+	entry.SHA256 = sum
+	return nil
+}
+
+func hashFile(p string) (int64, string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", fmt.Errorf("can't read %s; %w", p, err)
+	}
+
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+}
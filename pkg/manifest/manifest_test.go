@@ -0,0 +1,204 @@
+package manifest
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func writeFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+
+	p := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestFinalize(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "version", "kubevirt/must-gather\nv1.6.0\n")
+	writeFile(t, root, "nodes/node01/dmesg", "")
+	writeFile(t, root, "nodes/node01/ip.txt", "1: lo: <LOOPBACK,UP,LOWER_UP>\n")
+
+	if err := Record(root, Entry{Path: "nodes/node01/dmesg", Collector: "gather_nodes", Command: "oc exec dmesg", ExitStatus: intPtr(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Record(root, Entry{Path: "nodes/node01/ip.txt", Collector: "gather_nodes", Command: "oc exec ip a", ExitStatus: intPtr(0), DurationMS: 120}); err != nil {
+		t.Fatal(err)
+	}
+	// a later successful command must not hide the failure
+	if err := Record(root, Entry{Path: "nodes/node01/dmesg", Collector: "gather_nodes", Command: "oc exec dmesg", ExitStatus: intPtr(0)}); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Finalize(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(filepath.Join(root, JournalFileName)); !os.IsNotExist(err) {
+		t.Errorf("the journal should be removed")
+	}
+
+	if len(m.Entries) != 3 {
+		t.Fatalf("expected 3 entries, but got %d", len(m.Entries))
+	}
+
+	dmesg, found := m.Entry("nodes/node01/dmesg")
+	if !found {
+		t.Fatal("dmesg is not in the manifest")
+	}
+	if !dmesg.Failed() || dmesg.Size != 0 {
+		t.Errorf("wrong dmesg entry %#v", dmesg)
+	}
+
+	ip, _ := m.Entry("nodes/node01/ip.txt")
+	if ip.Failed() || ip.DurationMS != 120 || ip.Collector != "gather_nodes" || ip.Size == 0 || ip.SHA256 == "" {
+		t.Errorf("wrong ip.txt entry %#v", ip)
+	}
+
+	version, _ := m.Entry("version")
+	if version.Collector != "" || version.SHA256 == "" {
+		t.Errorf("wrong version entry %#v", version)
+	}
+
+	loaded, err := Load(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Entries) != len(m.Entries) {
+		t.Errorf("the loaded manifest is different")
+	}
+}
+
+func TestFinalizeNotWritten(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "version", "kubevirt/must-gather\nv1.6.0\n")
+
+	entry := Entry{Path: "nodes/node01/journal", Collector: "gather_nodes", Command: "oc cp", ExitStatus: intPtr(124), NotWritten: true}
+	if err := Record(root, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Finalize(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal, found := m.Entry("nodes/node01/journal")
+	if !found || !journal.Failed() || journal.SHA256 != "" {
+		t.Fatalf("the file that was not written should be recorded as failed; got %#v", journal)
+	}
+
+	problems, err := VerifyDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Kind != CollectionFailed || problems[0].IsIntegrityProblem() {
+		t.Errorf("expected only the failed collection, but got %v", problems)
+	}
+}
+
+func TestRecordConcurrently(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "a", "a")
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := Record(root, Entry{Path: "a", Collector: "test"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, err := readJournal(filepath.Join(root, JournalFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected one entry, but got %d", len(entries))
+	}
+}
+
+func TestRecordAll(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "a", "a")
+	writeFile(t, root, "b", "b")
+
+	if err := RecordAll(root, []Entry{{Path: "a", Collector: "test"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Finalize(root); err != nil {
+		t.Fatal(err)
+	}
+
+	// the finalized manifest is left as is
+	if err := RecordAll(root, []Entry{{Path: "b", Collector: "test"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, JournalFileName)); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected no journal, but got %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "version", "kubevirt/must-gather\nv1.6.0\n")
+	writeFile(t, root, "missing", "missing")
+	writeFile(t, root, "truncated", "0123456789")
+	writeFile(t, root, "modified", "0123456789")
+	writeFile(t, root, "failed", "")
+	if err := Record(root, Entry{Path: "failed", Collector: "gather_nodes", ExitStatus: intPtr(137)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Finalize(root); err != nil {
+		t.Fatal(err)
+	}
+
+	if problems, err := VerifyDir(root); err != nil || len(problems) != 1 || problems[0].Kind != CollectionFailed {
+		t.Fatalf("a fresh bundle should only report the failed collection; got %v, %v", problems, err)
+	}
+
+	if err := os.Remove(filepath.Join(root, "missing")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, root, "truncated", "01234")
+	writeFile(t, root, "modified", "012345678X")
+	writeFile(t, root, "unlisted", "new")
+
+	problems, err := VerifyDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]ProblemKind{
+		"failed":    CollectionFailed,
+		"missing":   Missing,
+		"truncated": Truncated,
+		"modified":  Modified,
+		"unlisted":  Unlisted,
+	}
+	if len(problems) != len(expected) {
+		t.Errorf("expected %d problems, but got %v", len(expected), problems)
+	}
+	for _, problem := range problems {
+		if expected[problem.Path] != problem.Kind {
+			t.Errorf("wrong problem %s", problem)
+		}
+	}
+}
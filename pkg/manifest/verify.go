@@ -0,0 +1,136 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// ProblemKind classifies the differences between a bundle and its manifest.
+type ProblemKind string
+
+const (
+	// Missing files are listed in the manifest, but are not in the bundle.
+	Missing ProblemKind = "missing"
+	// Truncated files are shorter than recorded.
+	Truncated ProblemKind = "truncated"
+	// Modified files have the recorded size or are longer, but a different checksum.
+	Modified ProblemKind = "modified"
+	// Unlisted files are in the bundle, but not in the manifest.
+	Unlisted ProblemKind = "unlisted"
+	// CollectionFailed files were written by a command that failed. They are reported for information; the file
+	// itself is what the collector wrote.
+	CollectionFailed ProblemKind = "collection-failed"
+)
+
+// Problem is a difference between a bundle and its manifest.
+type Problem struct {
+	Path    string
+	Kind    ProblemKind
+	Details string
+}
+
+func (p Problem) String() string {
+	if p.Details == "" {
+		return fmt.Sprintf("%s: %s", p.Kind, p.Path)
+	}
+	return fmt.Sprintf("%s: %s (%s)", p.Kind, p.Path, p.Details)
+}
+
+// IsIntegrityProblem reports whether the problem means the bundle is not what the collectors wrote.
+func (p Problem) IsIntegrityProblem() bool {
+	return p.Kind != CollectionFailed
+}
+
+// Verify compares the files in root with the manifest.
+func Verify(root string, m *Manifest) ([]Problem, error) {
+	var problems []Problem
+
+	listed := make(map[string]bool, len(m.Entries))
+	for _, entry := range m.Entries {
+		listed[entry.Path] = true
+
+		if entry.Failed() {
+			problems = append(problems, Problem{Path: entry.Path, Kind: CollectionFailed, Details: failureDetails(entry)})
+		}
+		if entry.NotWritten {
+			continue
+		}
+
+		size, sum, err := hashFile(filepath.Join(root, filepath.FromSlash(entry.Path)))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			problems = append(problems, Problem{Path: entry.Path, Kind: Missing})
+		case err != nil:
+			return nil, err
+		case size < entry.Size:
+			problems = append(problems, Problem{
+				Path:    entry.Path,
+				Kind:    Truncated,
+				Details: fmt.Sprintf("%d bytes instead of %d", size, entry.Size),
+			})
+		case sum != entry.SHA256:
+			details := "checksum mismatch"
+			if size != entry.Size {
+				details = fmt.Sprintf("%d bytes instead of %d", size, entry.Size)
+			}
+			problems = append(problems, Problem{Path: entry.Path, Kind: Modified, Details: details})
+		}
+	}
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if !listed[rel] && !ExcludedFiles[rel] {
+			problems = append(problems, Problem{Path: rel, Kind: Unlisted})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't walk the bundle; %w", err)
+	}
+
+	return problems, nil
+}
+
+// VerifyDir loads the manifest of the bundle in root, and verifies the bundle.
+func VerifyDir(root string) ([]Problem, error) {
+	m, err := Load(root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("there is no %s in %s", FileName, root)
+		}
+		return nil, err
+	}
+
+	return Verify(root, m)
+}
+
+func failureDetails(entry Entry) string {
+	details := entry.Collector
+	if entry.Command != "" {
+		details += ": " + entry.Command
+	}
+	if entry.ExitStatus != nil && *entry.ExitStatus != 0 {
+		details += fmt.Sprintf("; exit status %d", *entry.ExitStatus)
+	}
+	if entry.Error != "" {
+		details += "; " + entry.Error
+	}
+	if entry.NotWritten {
+		details += "; the file was not written"
+	}
+	return details
+}
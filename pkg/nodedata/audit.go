@@ -0,0 +1,130 @@
+package nodedata
+
+import (
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditRecord is a record of the audit log.
+type AuditRecord struct {
+	// Node is set when the record was forwarded from another host.
+	Node string    `json:"node,omitempty"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Serial identifies the event; the records of an event, e.g. AVC and SYSCALL, share it.
+	Serial int64 `json:"serial"`
+	// Message is what follows the audit(...) stamp.
+	Message string `json:"message"`
+}
+
+// AVC is an SELinux access vector cache decision.
+type AVC struct {
+	Time   time.Time `json:"time"`
+	Serial int64     `json:"serial"`
+	// Denied is false for the granted decisions that are audited, e.g. by auditallow rules.
+	Denied      bool     `json:"denied"`
+	Permissions []string `json:"permissions"`
+	PID         int      `json:"pid,omitempty"`
+	Comm        string   `json:"comm,omitempty"`
+	// Path is the path, or the name, of the target.
+	Path     string `json:"path,omitempty"`
+	SContext string `json:"scontext"`
+	TContext string `json:"tcontext"`
+	TClass   string `json:"tclass"`
+	// Permissive tells whether the access was allowed anyway, as the domain or the node is permissive.
+	Permissive bool `json:"permissive"`
+}
+
+var (
+	auditRecordPattern = regexp.MustCompile(`^(?:node=(\S+) )?type=(\S+) msg=audit\((\d+)\.(\d+):(\d+)\):\s*(.*)$`)
+	avcPattern         = regexp.MustCompile(`^avc:\s+(denied|granted)\s+\{([^}]*)\}\s+for\s+(.*)$`)
+)
+
+// the fields the kernel hex encodes when they contain a space or a special character
+var untrustedFields = map[string]bool{"comm": true, "path": true, "name": true, "exe": true, "cmd": true, "proctitle": true}
+
+// ParseAuditLog parses /var/log/audit/audit.log. The lines that are not audit records are skipped; it also returns the
+// number of lines it skipped as too long to be a record.
+func ParseAuditLog(data []byte) (records []AuditRecord, skipped int) {
+	skipped = eachLine(data, func(line string) {
+		m := auditRecordPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			return
+		}
+
+		seconds, _ := strconv.ParseInt(m[3], 10, 64)
+		millis, _ := strconv.ParseInt(m[4], 10, 64)
+		serial, _ := strconv.ParseInt(m[5], 10, 64)
+		records = append(records, AuditRecord{
+			Node: m[1], Type: m[2], Time: time.UnixMilli(seconds*1000 + millis).UTC(), Serial: serial, Message: m[6],
+		})
+	})
+
+	return records, skipped
+}
+
+// ParseAVC parses an AVC record, and returns false for the other records.
+func ParseAVC(r AuditRecord) (AVC, bool, error) {
+	if r.Type != "AVC" {
+		return AVC{}, false, nil
+	}
+
+	m := avcPattern.FindStringSubmatch(r.Message)
+	if m == nil {
+		return AVC{}, false, fmt.Errorf("can't parse the AVC %q", r.Message)
+	}
+
+	avc := AVC{Time: r.Time, Serial: r.Serial, Denied: m[1] == "denied", Permissions: strings.Fields(m[2])}
+	fields := ParseAuditFields(m[3])
+	avc.PID, _ = strconv.Atoi(fields["pid"])
+	avc.Comm = fields["comm"]
+	avc.Path = fields["path"]
+	if avc.Path == "" {
+		avc.Path = fields["name"]
+	}
+	avc.SContext, avc.TContext, avc.TClass = fields["scontext"], fields["tcontext"], fields["tclass"]
+	avc.Permissive = fields["permissive"] == "1"
+
+	return avc, true, nil
+}
+
+// ParseAuditFields parses the key=value fields of an audit record. Quoted values are unquoted, and the untrusted
+// fields the kernel hex encoded, such as comm and path, are decoded.
+func ParseAuditFields(s string) map[string]string {
+	fields := make(map[string]string)
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		key, rest, found := strings.Cut(s, "=")
+		if !found || strings.ContainsAny(key, " \t") {
+			// a word without a value, such as the trailing text of some records
+			_, s, _ = strings.Cut(s, " ")
+			continue
+		}
+
+		var value string
+		quoted := strings.HasPrefix(rest, `"`) || strings.HasPrefix(rest, `'`)
+		if quoted {
+			end := strings.IndexByte(rest[1:], rest[0])
+			if end < 0 {
+				value, s = rest[1:], ""
+			} else {
+				value, s = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, s, _ = strings.Cut(rest, " ")
+		}
+
+		if !quoted && untrustedFields[key] && value != "(null)" {
+			if decoded, err := hex.DecodeString(value); err == nil {
+				value = string(decoded)
+			}
+		}
+		fields[key] = value
+	}
+
+	return fields
+}
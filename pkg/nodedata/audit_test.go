@@ -0,0 +1,72 @@
+package nodedata
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAuditLog(t *testing.T) {
+	records, skipped := ParseAuditLog(readFixture(t, "audit.log"))
+	if len(records) != 13 || skipped != 0 {
+		t.Fatalf("expected 13 records, but got %d, and %d skipped lines", len(records), skipped)
+	}
+	r := records[2]
+	if r.Type != "AVC" || r.Serial != 8812 || !r.Time.Equal(time.Date(2026, 10, 19, 8, 55, 0, 512_000_000, time.UTC)) {
+		t.Errorf("unexpected record: %+v", r)
+	}
+
+	fields := ParseAuditFields(records[1].Message)
+	if fields["msg"] != `unit=crio comm="systemd" exe="/usr/lib/systemd/systemd" hostname=? addr=? terminal=? res=success` {
+		t.Errorf("unexpected nested message: %q", fields["msg"])
+	}
+	if fields := ParseAuditFields(records[4].Message); !strings.HasPrefix(fields["proctitle"], "/usr/libexec/qemu-kvm\x00-name") {
+		t.Errorf("expected the hex encoded proctitle to be decoded, but got %q", fields["proctitle"])
+	}
+}
+
+func TestParseAuditLogLongLine(t *testing.T) {
+	data := "type=AVC msg=audit(1760864100.512:1): avc:  denied  { read } for  pid=1\n" +
+		"type=PROCTITLE msg=audit(1760864100.512:1): proctitle=" + strings.Repeat("00", maxLine/2) + "\n" +
+		"type=SYSCALL msg=audit(1760864100.512:1): arch=c000003e\n"
+	records, skipped := ParseAuditLog([]byte(data))
+	if len(records) != 2 || records[1].Type != "SYSCALL" || skipped != 1 {
+		t.Errorf("expected the long line to be skipped, but got %+v, and %d skipped lines", records, skipped)
+	}
+}
+
+func TestParseAVC(t *testing.T) {
+	records, _ := ParseAuditLog(readFixture(t, "audit.log"))
+
+	var avcs []AVC
+	for _, r := range records {
+		avc, ok, err := ParseAVC(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			avcs = append(avcs, avc)
+		}
+	}
+
+	if len(avcs) != 9 {
+		t.Fatalf("expected 9 AVCs, but got %d", len(avcs))
+	}
+	if a := avcs[0]; !a.Denied || strings.Join(a.Permissions, ",") != "read,write" || a.PID != 48213 || a.Comm != "qemu-kvm" ||
+		a.Path != "75" || a.SContext != "system_u:system_r:svirt_t:s0:c214,c733" || a.TClass != "chr_file" || a.Permissive {
+		t.Errorf("unexpected AVC: %+v", a)
+	}
+	if a := avcs[2]; a.Comm != "CPU 1/KVM" || a.Path != "/dev/vfio/75" {
+		t.Errorf("expected the hex encoded comm to be decoded, but got %+v", a)
+	}
+	if a := avcs[7]; a.Denied || a.Permissive {
+		t.Errorf("unexpected granted AVC: %+v", a)
+	}
+	if a := avcs[8]; !a.Permissive {
+		t.Errorf("expected a permissive AVC: %+v", a)
+	}
+
+	if _, _, err := ParseAVC(AuditRecord{Type: "AVC", Message: "something else"}); err == nil {
+		t.Error("expected an error for an AVC that can't be parsed")
+	}
+}
@@ -0,0 +1,53 @@
+package nodedata
+
+import (
+	"strings"
+	"unicode"
+)
+
+// KernelArgs are the arguments of the kernel command line, by name. Flags without a value have an empty value; when
+// an argument is repeated, the last one wins, as it does for the kernel.
+type KernelArgs map[string]string
+
+// ParseCmdline parses /proc/cmdline.
+func ParseCmdline(data []byte) KernelArgs {
+	args := make(KernelArgs)
+	for _, field := range splitCmdline(string(data)) {
+		key, value, _ := strings.Cut(field, "=")
+		args[key] = value
+	}
+	return args
+}
+
+// splitCmdline splits the command line at the spaces outside of double quotes, and drops the quotes, the way the
+// kernel does for param="value with spaces" and "param=value".
+func splitCmdline(cmdline string) []string {
+	var fields []string
+	var field strings.Builder
+	quoted, inField := false, false
+	for _, r := range cmdline {
+		switch {
+		case r == '"':
+			quoted, inField = !quoted, true
+		case unicode.IsSpace(r) && !quoted:
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// IOMMUEnabled tells whether the arguments turn the IOMMU on. On AMD hosts the IOMMU is on by default, which this
+// can't tell.
+func (a KernelArgs) IOMMUEnabled() bool {
+	return a["intel_iommu"] == "on" || a["amd_iommu"] == "on" || a["iommu"] == "pt" || a["iommu"] == "on"
+}
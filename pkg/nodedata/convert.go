@@ -0,0 +1,104 @@
+package nodedata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+// JSONSuffix is appended to the name of a node file for its JSON form, e.g. nodes/node01/ip.txt.json.
+const JSONSuffix = ".json"
+
+// Converter parses a node file into the value written as its JSON form.
+type Converter struct {
+	File  layout.NodeFile
+	Parse func(data []byte) (any, error)
+}
+
+// Converters are the node files with a JSON form.
+var Converters = []Converter{
+	{layout.NodeIPAddr, func(data []byte) (any, error) { return nonNil(ParseIPAddr(data)) }},
+	{layout.NodeBridges, func(data []byte) (any, error) { return nonNil(ParseLinks(data)) }},
+	{layout.NodeVLANs, func(data []byte) (any, error) { return nonNil(ParseVLANs(data)) }},
+	{layout.NodeNFTables, func(data []byte) (any, error) { return ParseNFTables(data) }},
+	{layout.NodeLspci, func(data []byte) (any, error) { return nonNil(ParseLspci(data)) }},
+	{layout.NodeDevVFIO, func(data []byte) (any, error) { return ParseDevVFIO(data) }},
+	{layout.NodeProcCmdline, func(data []byte) (any, error) { return ParseCmdline(data), nil }},
+	{layout.NodeSRIOVNumVFs, func(data []byte) (any, error) { return ParseSRIOVVFs(data) }},
+	{layout.NodeSRIOVTotalVFs, func(data []byte) (any, error) { return ParseSRIOVVFs(data) }},
+}
+
+// nonNil makes empty outputs an empty JSON array rather than null
+func nonNil[T any](items []T, err error) ([]T, error) {
+	if items == nil && err == nil {
+		items = []T{}
+	}
+	return items, err
+}
+
+// Conversion is the result of converting a node file.
+type Conversion struct {
+	Node string
+	File layout.NodeFile
+	// Path is the JSON file, when it was written.
+	Path string
+	// Err is set when the file could not be parsed; no JSON file is written then.
+	Err error
+}
+
+// ConvertNode writes the JSON form of each node file of a node next to it. The files that were not collected are
+// skipped; the files that can't be parsed are returned with their error. The returned error is for I/O failures.
+func ConvertNode(b *layout.Bundle, node string) ([]Conversion, error) {
+	var conversions []Conversion
+
+	for _, c := range Converters {
+		data, err := b.ReadNodeFile(node, c.File)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return conversions, err
+		}
+
+		conversion := Conversion{Node: node, File: c.File}
+		value, err := c.Parse(data)
+		if err != nil {
+			conversion.Err = fmt.Errorf("can't parse %s; %w", b.Rel(b.NodeFilePath(node, c.File)), err)
+			conversions = append(conversions, conversion)
+			continue
+		}
+
+		out, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return conversions, err
+		}
+		conversion.Path = b.NodeFilePath(node, c.File) + JSONSuffix
+		if err = os.WriteFile(conversion.Path, append(out, '\n'), 0644); err != nil {
+			return conversions, fmt.Errorf("can't write %s; %w", conversion.Path, err)
+		}
+		conversions = append(conversions, conversion)
+	}
+
+	return conversions, nil
+}
+
+// ConvertBundle writes the JSON form of the node files of every node of the bundle.
+func ConvertBundle(b *layout.Bundle) ([]Conversion, error) {
+	nodes, err := b.Nodes()
+	if err != nil {
+		return nil, err
+	}
+
+	var conversions []Conversion
+	for _, node := range nodes {
+		c, err := ConvertNode(b, node)
+		conversions = append(conversions, c...)
+		if err != nil {
+			return conversions, err
+		}
+	}
+	return conversions, nil
+}
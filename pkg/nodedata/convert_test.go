@@ -0,0 +1,136 @@
+package nodedata
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+// newBundle makes a bundle with the fixtures of node01, and an lspci that can't be parsed on node02
+func newBundle(t *testing.T) *layout.Bundle {
+	t.Helper()
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, layout.VersionFile), []byte(layout.ProductName+"\nv1.6.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"node01/ip.txt":             "ip.txt",
+		"node01/bridge":             "bridge",
+		"node01/vlan":               "vlan",
+		"node01/nftables":           "nftables",
+		"node01/lspci":              "lspci",
+		"node01/dev_vfio":           "dev_vfio",
+		"node01/proc_cmdline":       "proc_cmdline",
+		"node01/sys_sriov_numvfs":   "sys_sriov_numvfs",
+		"node01/sys_sriov_totalvfs": "sys_sriov_totalvfs",
+		"node01/pcidp_config.json":  "pcidp_config.json",
+	}
+	for dst, src := range files {
+		path := filepath.Join(root, layout.NodesDir, dst)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, readFixture(t, src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(root, layout.NodesDir, "node02"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := os.WriteFile(filepath.Join(root, layout.NodesDir, "node02", "lspci"), []byte("pcilib: Cannot open /sys/bus/pci\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := layout.Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestConvertBundle(t *testing.T) {
+	b := newBundle(t)
+
+	conversions, err := ConvertBundle(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(conversions) != len(Converters)+1 {
+		t.Fatalf("expected %d conversions, but got %+v", len(Converters)+1, conversions)
+	}
+	for _, c := range conversions {
+		switch {
+		case c.Node == "node02":
+			if c.Err == nil || c.Path != "" {
+				t.Errorf("expected an error for node02, but got %+v", c)
+			}
+			if _, err := os.Stat(b.NodeFilePath("node02", layout.NodeLspci) + JSONSuffix); err == nil {
+				t.Error("expected no JSON for an lspci that can't be parsed")
+			}
+		case c.Err != nil:
+			t.Errorf("unexpected error for %s: %v", c.File, c.Err)
+		case c.Path != b.NodeFilePath("node01", c.File)+JSONSuffix:
+			t.Errorf("unexpected path for %s: %s", c.File, c.Path)
+		}
+	}
+
+	// the JSON form reads back into the parsed types
+	var links []Link
+	readJSON(t, b.NodeFilePath("node01", layout.NodeIPAddr)+JSONSuffix, &links)
+	if len(links) == 0 || links[0].Name != "lo" {
+		t.Errorf("unexpected links: %+v", links)
+	}
+	var ruleset Ruleset
+	readJSON(t, b.NodeFilePath("node01", layout.NodeNFTables)+JSONSuffix, &ruleset)
+	if len(ruleset.Tables) != 4 {
+		t.Errorf("unexpected ruleset: %+v", ruleset)
+	}
+	var args map[string]string
+	readJSON(t, b.NodeFilePath("node01", layout.NodeProcCmdline)+JSONSuffix, &args)
+	if args["intel_iommu"] != "on" {
+		t.Errorf("unexpected kernel arguments: %v", args)
+	}
+
+	// the device plugin config already is JSON
+	if _, err = os.Stat(b.NodeFilePath("node01", layout.NodePCIDPConfig) + JSONSuffix); err == nil {
+		t.Error("expected no JSON for pcidp_config.json")
+	}
+}
+
+func TestConvertEmptyOutput(t *testing.T) {
+	b := newBundle(t)
+	if err := os.WriteFile(b.NodeFilePath("node01", layout.NodeVLANs), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ConvertNode(b, "node01"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(b.NodeFilePath("node01", layout.NodeVLANs) + JSONSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "[]\n" {
+		t.Errorf("expected an empty array, but got %q", data)
+	}
+}
+
+func readJSON(t *testing.T, path string, v any) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
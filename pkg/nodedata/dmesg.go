@@ -0,0 +1,35 @@
+package nodedata
+
+import (
+	"regexp"
+	"strings"
+)
+
+// KernelMessage is a line of the kernel ring buffer.
+type KernelMessage struct {
+	// Time is the timestamp of the message: seconds since boot, e.g. 12345.678901, or a date with dmesg -T. It is
+	// empty for the continuation lines, which dmesg prints without one.
+	Time string `json:"time,omitempty"`
+	Text string `json:"text"`
+}
+
+// a "<4>" syslog level prefix, as printed by dmesg -r, and a "[ 12.345678]" or "[Mon Oct 19 10:12:00 2026]" timestamp
+var dmesgPrefixPattern = regexp.MustCompile(`^(?:<\d+>)?\[\s*([^\]]*)\]\s?`)
+
+// ParseDmesg parses the output of dmesg. It also returns the number of lines it skipped as too long to be a message.
+func ParseDmesg(data []byte) (messages []KernelMessage, skipped int) {
+	skipped = eachLine(data, func(line string) {
+		line = strings.TrimRight(line, " ")
+		if strings.TrimSpace(line) == "" {
+			return
+		}
+
+		m := KernelMessage{Text: line}
+		if prefix := dmesgPrefixPattern.FindStringSubmatch(line); prefix != nil {
+			m.Time, m.Text = prefix[1], line[len(prefix[0]):]
+		}
+		messages = append(messages, m)
+	})
+
+	return messages, skipped
+}
@@ -0,0 +1,29 @@
+package nodedata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDmesg(t *testing.T) {
+	messages, skipped := ParseDmesg(readFixture(t, "dmesg"))
+	if len(messages) != 24 || skipped != 0 {
+		t.Fatalf("expected 24 messages, but got %d, and %d skipped lines", len(messages), skipped)
+	}
+	if m := messages[2]; m.Time != "0.512345" || m.Text != "DMAR: IOMMU enabled" {
+		t.Errorf("unexpected message: %+v", m)
+	}
+
+	messages, _ = ParseDmesg([]byte("<4>[Mon Oct 19 10:12:00 2026] kvm: disabled by bios\n  continued\n"))
+	if messages[0].Time != "Mon Oct 19 10:12:00 2026" || messages[0].Text != "kvm: disabled by bios" || messages[1].Time != "" {
+		t.Errorf("unexpected messages: %+v", messages)
+	}
+}
+
+func TestParseDmesgLongLine(t *testing.T) {
+	data := "[    1.000000] before\n[    2.000000] " + strings.Repeat("x", maxLine) + "\n[    3.000000] after\n"
+	messages, skipped := ParseDmesg([]byte(data))
+	if len(messages) != 2 || messages[1].Text != "after" || skipped != 1 {
+		t.Errorf("expected the long line to be skipped, but got %d messages, and %d skipped lines", len(messages), skipped)
+	}
+}
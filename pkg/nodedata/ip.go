@@ -0,0 +1,209 @@
+// Package nodedata parses the command outputs gather_nodes stores in nodes/<node>/.
+package nodedata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Link is a network interface, as printed by ip a, or ip -o link show.
+type Link struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	// Parent is the link a VLAN or a veth is on, e.g. eth1 for eth1.100@eth1.
+	Parent    string    `json:"parent,omitempty"`
+	Flags     []string  `json:"flags"`
+	MTU       int       `json:"mtu,omitempty"`
+	Master    string    `json:"master,omitempty"`
+	State     string    `json:"state,omitempty"`
+	LinkType  string    `json:"linkType,omitempty"`
+	MAC       string    `json:"mac,omitempty"`
+	AltNames  []string  `json:"altNames,omitempty"`
+	Addresses []Address `json:"addresses,omitempty"`
+}
+
+// Address is an IP address of a link.
+type Address struct {
+	// Family is inet or inet6.
+	Family string `json:"family"`
+	CIDR   string `json:"cidr"`
+	Scope  string `json:"scope,omitempty"`
+}
+
+// Up tells whether the link is administratively up.
+func (l Link) Up() bool {
+	for _, flag := range l.Flags {
+		if flag == "UP" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseIPAddr parses the output of ip a.
+func ParseIPAddr(data []byte) ([]Link, error) {
+	var links []Link
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, " ") {
+			link, err := parseLinkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			links = append(links, link)
+			continue
+		}
+		if len(links) == 0 {
+			return nil, fmt.Errorf("can't parse %q; expected a link first", line)
+		}
+		parseLinkDetail(&links[len(links)-1], strings.Fields(line))
+	}
+
+	return links, scanner.Err()
+}
+
+// ParseLinks parses the output of ip -o link show, where each link is on a single line, the details after a
+// backslash.
+func ParseLinks(data []byte) ([]Link, error) {
+	var links []Link
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		parts := strings.Split(line, "\\")
+		link, err := parseLinkHeader(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, detail := range parts[1:] {
+			parseLinkDetail(&link, strings.Fields(detail))
+		}
+		links = append(links, link)
+	}
+
+	return links, scanner.Err()
+}
+
+// parseLinkHeader parses "2: eth0@if5: <BROADCAST,UP> mtu 1500 ... master br1 state UP ..."
+func parseLinkHeader(line string) (Link, error) {
+	var link Link
+
+	index, rest, found := strings.Cut(line, ": ")
+	if !found {
+		return link, fmt.Errorf("can't parse the link %q", line)
+	}
+	var err error
+	if link.Index, err = strconv.Atoi(strings.TrimSpace(index)); err != nil {
+		return link, fmt.Errorf("can't parse the index of the link %q; %w", line, err)
+	}
+
+	name, rest, found := strings.Cut(rest, ": ")
+	if !found {
+		return link, fmt.Errorf("can't parse the name of the link %q", line)
+	}
+	link.Name, link.Parent, _ = strings.Cut(name, "@")
+
+	fields := strings.Fields(rest)
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "<") {
+		flags := strings.Trim(fields[0], "<>")
+		if flags != "" {
+			link.Flags = strings.Split(flags, ",")
+		}
+		fields = fields[1:]
+	}
+	if link.Flags == nil {
+		link.Flags = []string{}
+	}
+
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "mtu":
+			link.MTU, _ = strconv.Atoi(fields[i+1])
+		case "master":
+			link.Master = fields[i+1]
+		case "state":
+			link.State = fields[i+1]
+		default:
+			continue
+		}
+		i++
+	}
+
+	return link, nil
+}
+
+// parseLinkDetail parses a detail line of a link: its type and address, an IP address, or an alternative name
+func parseLinkDetail(link *Link, fields []string) {
+	if len(fields) < 2 {
+		return
+	}
+
+	switch key := fields[0]; {
+	case strings.HasPrefix(key, "link/"):
+		link.LinkType = strings.TrimPrefix(key, "link/")
+		if strings.Count(fields[1], ":") == 5 {
+			link.MAC = fields[1]
+		}
+	case key == "inet" || key == "inet6":
+		address := Address{Family: key, CIDR: fields[1]}
+		for i := 2; i+1 < len(fields); i++ {
+			if fields[i] == "scope" {
+				address.Scope = fields[i+1]
+			}
+		}
+		link.Addresses = append(link.Addresses, address)
+	case key == "altname":
+		link.AltNames = append(link.AltNames, fields[1])
+	}
+}
+
+// PortVLANs are the VLANs of a bridge port, as printed by bridge -j vlan show.
+type PortVLANs struct {
+	IfName string `json:"ifname"`
+	VLANs  []VLAN `json:"vlans"`
+}
+
+// VLAN is a VLAN, or a range of VLANs when VLANEnd is set.
+type VLAN struct {
+	VLAN    int      `json:"vlan"`
+	VLANEnd int      `json:"vlanEnd,omitempty"`
+	Flags   []string `json:"flags,omitempty"`
+}
+
+// Contains tells whether a VLAN is allowed on the port.
+func (p PortVLANs) Contains(id int) bool {
+	for _, v := range p.VLANs {
+		if id == v.VLAN || (v.VLANEnd != 0 && id >= v.VLAN && id <= v.VLANEnd) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseVLANs parses the output of bridge -j vlan show.
+func ParseVLANs(data []byte) ([]PortVLANs, error) {
+	var ports []PortVLANs
+	if len(bytes.TrimSpace(data)) == 0 {
+		return ports, nil
+	}
+	if err := json.Unmarshal(data, &ports); err != nil {
+		return nil, fmt.Errorf("can't parse the VLANs; %w", err)
+	}
+	return ports, nil
+}
@@ -0,0 +1,83 @@
+package nodedata
+
+import (
+	"os"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseIPAddr(t *testing.T) {
+	links, err := ParseIPAddr(readFixture(t, "ip.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(links) != 8 {
+		t.Fatalf("expected 8 links, but got %d", len(links))
+	}
+
+	lo := links[0]
+	if lo.Name != "lo" || lo.MTU != 65536 || lo.LinkType != "loopback" || len(lo.Addresses) != 2 || lo.Addresses[1].Family != "inet6" {
+		t.Errorf("unexpected lo: %+v", lo)
+	}
+
+	ens4 := links[2]
+	if ens4.Master != "br1" || ens4.State != "UP" || ens4.MAC != "52:54:00:6b:1f:02" || !ens4.Up() || ens4.AltNames[0] != "enp0s4" {
+		t.Errorf("unexpected ens4: %+v", ens4)
+	}
+	if ovs := links[3]; ovs.Up() || ovs.State != "DOWN" {
+		t.Errorf("expected ovs-system to be down: %+v", ovs)
+	}
+
+	brEx := links[4]
+	if len(brEx.Addresses) != 2 || brEx.Addresses[0].CIDR != "192.168.122.11/24" || brEx.Addresses[0].Scope != "global" {
+		t.Errorf("unexpected br-ex addresses: %+v", brEx.Addresses)
+	}
+
+	if vlan := links[6]; vlan.Name != "ens4.200" || vlan.Parent != "ens4" {
+		t.Errorf("unexpected VLAN link: %+v", vlan)
+	}
+	if veth := links[7]; veth.Index != 12 || veth.Parent != "if3" || veth.Master != "br1" {
+		t.Errorf("unexpected veth: %+v", veth)
+	}
+}
+
+func TestParseLinks(t *testing.T) {
+	links, err := ParseLinks(readFixture(t, "bridge"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(links) != 2 || links[1].Name != "br1" || links[1].MAC != "52:54:00:6b:1f:02" || links[1].LinkType != "ether" {
+		t.Errorf("unexpected bridges: %+v", links)
+	}
+}
+
+func TestParseVLANs(t *testing.T) {
+	ports, err := ParseVLANs(readFixture(t, "vlan"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ports) != 3 || ports[0].IfName != "ens4" {
+		t.Fatalf("unexpected ports: %+v", ports)
+	}
+	for id, expected := range map[int]bool{1: true, 100: true, 200: false, 305: true, 311: false} {
+		if ports[0].Contains(id) != expected {
+			t.Errorf("expected VLAN %d on ens4 to be %t", id, expected)
+		}
+	}
+
+	if ports, err = ParseVLANs(nil); err != nil || len(ports) != 0 {
+		t.Errorf("expected no port for an empty output, but got %+v, %v", ports, err)
+	}
+}
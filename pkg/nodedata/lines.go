@@ -0,0 +1,27 @@
+package nodedata
+
+import "bytes"
+
+// maxLine is the length above which a line of a node log is skipped; the kernel and audit lines are far shorter, so a
+// longer one is usually a corrupted log.
+const maxLine = 1024 * 1024
+
+// eachLine calls fn with each line of data, without its line ending, and returns the number of lines it skipped as
+// longer than maxLine.
+func eachLine(data []byte, fn func(line string)) (skipped int) {
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+
+		if len(line) > maxLine {
+			skipped++
+			continue
+		}
+		fn(string(bytes.TrimRight(line, "\r")))
+	}
+	return skipped
+}
@@ -0,0 +1,323 @@
+package nodedata
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Ruleset is the output of nft list ruleset.
+type Ruleset struct {
+	Tables []Table `json:"tables"`
+}
+
+// Table is an nftables table.
+type Table struct {
+	// Family is ip, ip6, inet, arp, bridge or netdev.
+	Family string  `json:"family"`
+	Name   string  `json:"name"`
+	Chains []Chain `json:"chains"`
+	Sets   []Set   `json:"sets,omitempty"`
+}
+
+// Chain is a chain of a table. Base chains have a type, a hook and a priority; regular chains are jumped to.
+type Chain struct {
+	Name     string `json:"name"`
+	Type     string `json:"type,omitempty"`
+	Hook     string `json:"hook,omitempty"`
+	Device   string `json:"device,omitempty"`
+	Priority string `json:"priority,omitempty"`
+	Policy   string `json:"policy,omitempty"`
+	Rules    []Rule `json:"rules"`
+}
+
+// Set is a named set, or a map, of a table.
+type Set struct {
+	Name string `json:"name"`
+	// Kind is set or map.
+	Kind     string   `json:"kind"`
+	Type     string   `json:"type,omitempty"`
+	Flags    []string `json:"flags,omitempty"`
+	Elements []string `json:"elements,omitempty"`
+}
+
+// Rule is a rule of a chain.
+type Rule struct {
+	Text string `json:"text"`
+	// Handle is set when the ruleset was listed with nft -a.
+	Handle  int      `json:"handle,omitempty"`
+	Comment string   `json:"comment,omitempty"`
+	Counter *Counter `json:"counter,omitempty"`
+	// Verdict is the last verdict of the rule, e.g. accept, drop or jump; Target is the chain of jump and goto.
+	Verdict string `json:"verdict,omitempty"`
+	Target  string `json:"target,omitempty"`
+}
+
+// Counter is the counter of a rule.
+type Counter struct {
+	Packets int64 `json:"packets"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// Chain returns a chain of the table.
+func (t Table) Chain(name string) (Chain, bool) {
+	for _, c := range t.Chains {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Chain{}, false
+}
+
+var (
+	handlePattern  = regexp.MustCompile(`\s+# handle (\d+)$`)
+	counterPattern = regexp.MustCompile(`\bcounter packets (\d+) bytes (\d+)`)
+	commentPattern = regexp.MustCompile(`\bcomment "((?:[^"\\]|\\.)*)"`)
+	verdicts       = map[string]bool{"accept": true, "drop": true, "reject": true, "return": true, "continue": true, "queue": true}
+)
+
+// the kinds of block the parser is in
+const (
+	inRuleset = iota
+	inTable
+	inChain
+	inSet
+	inOther
+)
+
+// ParseNFTables parses the output of nft list ruleset. The blocks it doesn't know, such as flowtables, counters and
+// ct helpers, are skipped.
+func ParseNFTables(data []byte) (*Ruleset, error) {
+	r := &Ruleset{Tables: []Table{}}
+
+	var (
+		state = inRuleset
+		// depth is how deep the parser is in a skipped block
+		depth   int
+		table   *Table
+		chain   *Chain
+		set     *Set
+		pending string
+		lineNum int
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// statements with a set literal, such as the elements of a large set, span several lines
+		if pending != "" {
+			line = pending + " " + line
+			pending = ""
+		}
+		if braceBalance(line) > 0 && !strings.HasSuffix(line, "{") {
+			pending = line
+			continue
+		}
+
+		switch state {
+		case inRuleset:
+			fields := strings.Fields(strings.TrimSuffix(line, "{"))
+			if len(fields) < 2 || fields[0] != "table" || !strings.HasSuffix(line, "{") {
+				return nil, fmt.Errorf("line %d: can't parse %q; expected a table", lineNum, line)
+			}
+			t := Table{Family: "ip", Chains: []Chain{}}
+			if len(fields) >= 3 {
+				t.Family, t.Name = fields[1], fields[2]
+			} else {
+				t.Name = fields[1]
+			}
+			r.Tables = append(r.Tables, t)
+			table, state = &r.Tables[len(r.Tables)-1], inTable
+
+		case inTable:
+			if line == "}" {
+				table, state = nil, inRuleset
+				continue
+			}
+			fields := strings.Fields(line)
+			if !strings.HasSuffix(line, "{") {
+				// table flags and comments
+				continue
+			}
+			switch fields[0] {
+			case "chain":
+				table.Chains = append(table.Chains, Chain{Name: unquote(fields[1]), Rules: []Rule{}})
+				chain, state = &table.Chains[len(table.Chains)-1], inChain
+			case "set", "map":
+				table.Sets = append(table.Sets, Set{Name: unquote(fields[1]), Kind: fields[0]})
+				set, state = &table.Sets[len(table.Sets)-1], inSet
+			default:
+				depth, state = 1, inOther
+			}
+
+		case inChain:
+			if line == "}" {
+				chain, state = nil, inTable
+				continue
+			}
+			if parseChainHeader(chain, line) {
+				continue
+			}
+			chain.Rules = append(chain.Rules, parseRule(line))
+
+		case inSet:
+			if line == "}" {
+				set, state = nil, inTable
+				continue
+			}
+			key, value, _ := strings.Cut(line, " ")
+			switch key {
+			case "type", "typeof":
+				set.Type = strings.TrimSpace(value)
+			case "flags":
+				for _, flag := range strings.Split(value, ",") {
+					set.Flags = append(set.Flags, strings.TrimSpace(flag))
+				}
+			case "elements":
+				set.Elements = splitElements(strings.TrimPrefix(strings.TrimSpace(value), "="))
+			}
+
+		case inOther:
+			depth += braceBalance(line)
+			if depth <= 0 {
+				state = inTable
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if state != inRuleset || pending != "" {
+		return nil, fmt.Errorf("the ruleset is truncated")
+	}
+
+	return r, nil
+}
+
+// parseChainHeader reads the "type filter hook input priority filter; policy accept;" statements of a base chain
+func parseChainHeader(chain *Chain, line string) bool {
+	if !strings.HasSuffix(line, ";") {
+		return false
+	}
+
+	for _, statement := range strings.Split(line, ";") {
+		fields := strings.Fields(statement)
+		for i := 0; i+1 < len(fields); i += 2 {
+			value := fields[i+1]
+			switch fields[i] {
+			case "type":
+				chain.Type = value
+			case "hook":
+				chain.Hook = value
+			case "device":
+				chain.Device = unquote(value)
+			case "priority":
+				// priorities are a name, a number, or an expression such as "filter - 10"
+				chain.Priority = strings.Join(fields[i+1:], " ")
+				i = len(fields)
+			case "policy":
+				chain.Policy = value
+			}
+		}
+	}
+	return true
+}
+
+func parseRule(line string) Rule {
+	rule := Rule{}
+	if m := handlePattern.FindStringSubmatch(line); m != nil {
+		rule.Handle, _ = strconv.Atoi(m[1])
+		line = strings.TrimSuffix(line, m[0])
+	}
+	rule.Text = line
+
+	if m := counterPattern.FindStringSubmatch(line); m != nil {
+		packets, _ := strconv.ParseInt(m[1], 10, 64)
+		bytes, _ := strconv.ParseInt(m[2], 10, 64)
+		rule.Counter = &Counter{Packets: packets, Bytes: bytes}
+	}
+	if m := commentPattern.FindStringSubmatch(line); m != nil {
+		rule.Comment = m[1]
+		line = strings.Replace(line, m[0], "", 1)
+	}
+
+	// the verdict is the last one outside of a verdict map
+	fields := strings.Fields(line)
+	for i := len(fields) - 1; i >= 0; i-- {
+		if braceBalance(strings.Join(fields[i:], " ")) != 0 {
+			continue
+		}
+		switch f := fields[i]; {
+		case (f == "jump" || f == "goto") && i+1 < len(fields):
+			rule.Verdict, rule.Target = f, unquote(fields[i+1])
+		case verdicts[f]:
+			rule.Verdict = f
+		default:
+			continue
+		}
+		break
+	}
+
+	return rule
+}
+
+// braceBalance counts the braces opened and not closed in s, outside of quoted strings
+func braceBalance(s string) int {
+	balance, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == '{' && !quoted:
+			balance++
+		case c == '}' && !quoted:
+			balance--
+		}
+	}
+	return balance
+}
+
+// splitElements splits "{ 10.0.0.0/8, 192.168.0.0/16 }" into its elements
+func splitElements(s string) []string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+
+	var elements []string
+	depth, quoted, start := 0, false, 0
+	add := func(end int) {
+		if e := strings.TrimSpace(s[start:end]); e != "" {
+			elements = append(elements, e)
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			add(i)
+			start = i + 1
+		}
+	}
+	add(len(s))
+	return elements
+}
+
+func unquote(s string) string {
+	return strings.Trim(s, `"`)
+}
@@ -0,0 +1,82 @@
+package nodedata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNFTables(t *testing.T) {
+	r, err := ParseNFTables(readFixture(t, "nftables"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.Tables) != 4 {
+		t.Fatalf("expected 4 tables, but got %+v", r.Tables)
+	}
+
+	filter := r.Tables[0]
+	if filter.Family != "ip" || filter.Name != "filter" || len(filter.Chains) != 6 {
+		t.Fatalf("unexpected table: %+v", filter)
+	}
+	input, _ := filter.Chain("INPUT")
+	if input.Type != "filter" || input.Hook != "input" || input.Priority != "filter" || input.Policy != "accept" || len(input.Rules) != 2 {
+		t.Errorf("unexpected chain: %+v", input)
+	}
+	if rule := input.Rules[0]; rule.Verdict != "jump" || rule.Target != "KUBE-FIREWALL" || rule.Counter == nil ||
+		rule.Counter.Packets != 2315778 || rule.Counter.Bytes != 1398651874 {
+		t.Errorf("unexpected rule: %+v", rule)
+	}
+	if c, found := filter.Chain("KUBE-EXTERNAL-SERVICES"); !found || c.Type != "" || len(c.Rules) != 0 {
+		t.Errorf("unexpected regular chain: %+v", c)
+	}
+
+	ovnk := r.Tables[2]
+	if ovnk.Family != "inet" || len(ovnk.Sets) != 3 || len(ovnk.Chains) != 2 {
+		t.Fatalf("unexpected table: %+v", ovnk)
+	}
+	if s := ovnk.Sets[1]; s.Type != "ipv4_addr" || strings.Join(s.Flags, ",") != "interval" ||
+		strings.Join(s.Elements, ",") != "10.128.2.0/23,10.131.0.0/23,169.254.0.0/17" {
+		t.Errorf("unexpected set: %+v", s)
+	}
+	if s := ovnk.Sets[2]; s.Kind != "map" || len(s.Elements) != 2 || s.Elements[1] != "172.30.0.10 . tcp . 53 : return" {
+		t.Errorf("unexpected map: %+v", s)
+	}
+	snat := ovnk.Chains[0]
+	if rule := snat.Rules[1]; rule.Verdict != "" {
+		t.Errorf("expected no verdict for a verdict map, but got %+v", rule)
+	}
+	if rule := snat.Rules[4]; rule.Comment != "OVN SNAT to Management Port" || rule.Counter.Packets != 1287 {
+		t.Errorf("unexpected rule: %+v", rule)
+	}
+	if mark := ovnk.Chains[1]; mark.Priority != "mangle - 10" || len(mark.Rules) != 1 {
+		t.Errorf("unexpected chain: %+v", mark)
+	}
+
+	forward := r.Tables[3].Chains[0]
+	if forward.Priority != "-300" || len(forward.Rules) != 2 {
+		t.Fatalf("unexpected chain: %+v", forward)
+	}
+	if rule := forward.Rules[0]; rule.Verdict != "accept" || rule.Comment != "trunk {a, b}" {
+		t.Errorf("unexpected rule: %+v", rule)
+	}
+	if rule := forward.Rules[1]; rule.Handle != 7 || rule.Target != "drop-spoofed" || strings.Contains(rule.Text, "handle") {
+		t.Errorf("unexpected rule: %+v", rule)
+	}
+}
+
+func TestParseNFTablesErrors(t *testing.T) {
+	for name, data := range map[string]string{
+		"not a table": "chain INPUT {\n}\n",
+		"truncated":   "table ip filter {\n\tchain INPUT {\n",
+	} {
+		if _, err := ParseNFTables([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	r, err := ParseNFTables(nil)
+	if err != nil || len(r.Tables) != 0 {
+		t.Errorf("expected an empty ruleset, but got %+v, %v", r, err)
+	}
+}
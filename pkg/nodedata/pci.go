@@ -0,0 +1,193 @@
+package nodedata
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PCIDevice is a PCI device, as printed by lspci -vv, or lspci -nn -vv which adds the class, vendor and device IDs.
+type PCIDevice struct {
+	// Slot is the PCI address with its domain, e.g. 0000:3b:00.0.
+	Slot        string   `json:"slot"`
+	Class       string   `json:"class"`
+	ClassID     string   `json:"classID,omitempty"`
+	Description string   `json:"description"`
+	VendorID    string   `json:"vendorID,omitempty"`
+	DeviceID    string   `json:"deviceID,omitempty"`
+	Subsystem   string   `json:"subsystem,omitempty"`
+	IOMMUGroup  string   `json:"iommuGroup,omitempty"`
+	Driver      string   `json:"driver,omitempty"`
+	Modules     []string `json:"modules,omitempty"`
+}
+
+// ID returns the vendor:device selector of the device, e.g. 10de:1eb8, or an empty string when lspci didn't print it.
+func (d PCIDevice) ID() string {
+	if d.VendorID == "" || d.DeviceID == "" {
+		return ""
+	}
+	return d.VendorID + ":" + d.DeviceID
+}
+
+var (
+	// the slot of lspci -D, or the slot without the domain
+	slotPattern = regexp.MustCompile(`^(?:[0-9a-fA-F]{4}:)?[0-9a-fA-F]{2}:[0-9a-fA-F]{2}\.[0-7]$`)
+	// a trailing [id] or [vendor:device] of lspci -nn
+	idPattern = regexp.MustCompile(`\s*\[([0-9a-fA-F]{4})(?::([0-9a-fA-F]{4}))?\]$`)
+)
+
+// ParseLspci parses the output of lspci -vv: a block per device, whose first line is the slot, the class and the
+// description, and whose indented lines are the details.
+func ParseLspci(data []byte) ([]PCIDevice, error) {
+	var devices []PCIDevice
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, " ") {
+			device, err := parsePCIHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			devices = append(devices, device)
+			continue
+		}
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("can't parse %q; expected a device first", line)
+		}
+
+		d := &devices[len(devices)-1]
+		key, value, found := strings.Cut(strings.TrimSpace(line), ": ")
+		if !found {
+			continue
+		}
+		switch key {
+		case "Subsystem":
+			d.Subsystem = value
+		case "IOMMU group":
+			d.IOMMUGroup = value
+		case "Kernel driver in use":
+			d.Driver = value
+		case "Kernel modules":
+			for _, module := range strings.Split(value, ",") {
+				d.Modules = append(d.Modules, strings.TrimSpace(module))
+			}
+		}
+	}
+
+	return devices, scanner.Err()
+}
+
+// parsePCIHeader parses "3b:00.0 Ethernet controller [0200]: Intel Corporation Ethernet Controller XL710 [8086:1583] (rev 02)"
+func parsePCIHeader(line string) (PCIDevice, error) {
+	var d PCIDevice
+
+	slot, rest, found := strings.Cut(line, " ")
+	if !found || !slotPattern.MatchString(slot) {
+		return d, fmt.Errorf("can't parse the PCI device %q", line)
+	}
+	d.Slot = NormalizePCIAddress(slot)
+
+	class, description, _ := strings.Cut(rest, ": ")
+	if m := idPattern.FindStringSubmatch(class); m != nil {
+		d.ClassID = strings.ToLower(m[1])
+		class = strings.TrimSuffix(class, m[0])
+	}
+	d.Class = class
+
+	description, _, _ = strings.Cut(description, " (rev ")
+	if m := idPattern.FindStringSubmatch(description); m != nil && m[2] != "" {
+		d.VendorID, d.DeviceID = strings.ToLower(m[1]), strings.ToLower(m[2])
+		description = strings.TrimSuffix(description, m[0])
+	}
+	d.Description = description
+
+	return d, nil
+}
+
+// NormalizePCIAddress adds the default domain to a PCI address without one, e.g. 3b:00.0 becomes 0000:3b:00.0.
+func NormalizePCIAddress(address string) string {
+	address = strings.ToLower(address)
+	if strings.Count(address, ":") == 1 {
+		return "0000:" + address
+	}
+	return address
+}
+
+// ParseSRIOVVFs parses the sys_sriov_numvfs and sys_sriov_totalvfs files of gather_nodes, with a
+// "sriov_numvfs on dev 0000:3b:00.0: 8" line per physical function, into the number of VFs by PCI address.
+func ParseSRIOVVFs(data []byte) (map[string]int, error) {
+	vfs := make(map[string]int)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		_, rest, found := strings.Cut(line, " on dev ")
+		if !found {
+			return nil, fmt.Errorf("can't parse the VF count %q", line)
+		}
+		sep := strings.LastIndex(rest, ": ")
+		if sep < 0 {
+			return nil, fmt.Errorf("can't parse the VF count %q", line)
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(rest[sep+2:]))
+		if err != nil {
+			return nil, fmt.Errorf("can't parse the VF count %q; %w", line, err)
+		}
+		vfs[NormalizePCIAddress(rest[:sep])] = count
+	}
+
+	return vfs, scanner.Err()
+}
+
+// VFIO is the content of /dev/vfio.
+type VFIO struct {
+	// Container tells whether the /dev/vfio/vfio container device exists.
+	Container bool `json:"container"`
+	// Groups are the IOMMU groups of the devices bound to vfio-pci.
+	Groups []string `json:"groups"`
+}
+
+// ParseDevVFIO parses the output of ls -al /dev/vfio/.
+func ParseDevVFIO(data []byte) (VFIO, error) {
+	v := VFIO{Groups: []string{}}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] == "total" {
+			continue
+		}
+		if !strings.HasPrefix(fields[0], "c") {
+			// ., .. and anything that is not a character device
+			continue
+		}
+
+		name := fields[len(fields)-1]
+		switch {
+		case name == "vfio":
+			v.Container = true
+		case isNumber(name):
+			v.Groups = append(v.Groups, name)
+		}
+	}
+
+	return v, scanner.Err()
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
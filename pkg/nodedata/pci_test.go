@@ -0,0 +1,105 @@
+package nodedata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseLspci(t *testing.T) {
+	devices, err := ParseLspci(readFixture(t, "lspci"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(devices) != 4 {
+		t.Fatalf("expected 4 devices, but got %+v", devices)
+	}
+
+	pf := devices[1]
+	if pf.Slot != "0000:3b:00.0" || pf.Class != "Ethernet controller" || pf.IOMMUGroup != "32" || pf.Driver != "i40e" {
+		t.Errorf("unexpected PF: %+v", pf)
+	}
+	if pf.Description != "Intel Corporation Ethernet Controller XXV710 for 25GbE SFP28" || pf.ID() != "" {
+		t.Errorf("unexpected description or ID: %+v", pf)
+	}
+
+	gpu := devices[3]
+	if gpu.Driver != "vfio-pci" || strings.Join(gpu.Modules, ",") != "nouveau" || gpu.Description != "NVIDIA Corporation TU104GL [Tesla T4]" {
+		t.Errorf("unexpected GPU: %+v", gpu)
+	}
+}
+
+func TestParseLspciIDs(t *testing.T) {
+	devices, err := ParseLspci([]byte("0000:5e:00.0 3D controller [0302]: NVIDIA Corporation TU104GL [Tesla T4] [10de:1eb8] (rev a1)\n\tKernel driver in use: vfio-pci\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := devices[0]
+	if d.Slot != "0000:5e:00.0" || d.ClassID != "0302" || d.Class != "3D controller" || d.ID() != "10de:1eb8" ||
+		d.Description != "NVIDIA Corporation TU104GL [Tesla T4]" {
+		t.Errorf("unexpected device: %+v", d)
+	}
+
+	if _, err = ParseLspci([]byte("pcilib: Cannot open /sys/bus/pci/devices\n")); err == nil {
+		t.Error("expected an error for a line that is not a device")
+	}
+}
+
+func TestParseSRIOVVFs(t *testing.T) {
+	numVFs, err := ParseSRIOVVFs(readFixture(t, "sys_sriov_numvfs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	totalVFs, err := ParseSRIOVVFs(readFixture(t, "sys_sriov_totalvfs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if numVFs["0000:3b:00.0"] != 4 || numVFs["0000:3b:00.1"] != 0 || totalVFs["0000:3b:00.1"] != 64 || len(totalVFs) != 2 {
+		t.Errorf("unexpected VF counts: %v, %v", numVFs, totalVFs)
+	}
+}
+
+func TestParseDevVFIO(t *testing.T) {
+	v, err := ParseDevVFIO(readFixture(t, "dev_vfio"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !v.Container || strings.Join(v.Groups, ",") != "75" {
+		t.Errorf("unexpected /dev/vfio: %+v", v)
+	}
+}
+
+func TestParseCmdline(t *testing.T) {
+	args := ParseCmdline(readFixture(t, "proc_cmdline"))
+
+	if !args.IOMMUEnabled() || args["iommu"] != "pt" || args["console"] != "ttyS0,115200n8" {
+		t.Errorf("unexpected arguments: %v", args)
+	}
+	if _, found := args["rw"]; !found {
+		t.Error("expected the rw flag")
+	}
+	if ParseCmdline([]byte("BOOT_IMAGE=/vmlinuz root=/dev/sda1")).IOMMUEnabled() {
+		t.Error("expected the IOMMU to be off")
+	}
+}
+
+func TestParsePCIDPConfig(t *testing.T) {
+	c, err := ParsePCIDPConfig(readFixture(t, "pcidp_config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.ResourceList) != 2 || c.ResourceList[0].FullName() != "openshift.io/xxv710_vfs" {
+		t.Fatalf("unexpected resources: %+v", c.ResourceList)
+	}
+	// the first resource has a single selector object, the second a list
+	if s := c.ResourceList[0].Selectors; len(s) != 1 || s[0].RootDevices[0] != "0000:3b:00.0" {
+		t.Errorf("unexpected selectors: %+v", s)
+	}
+	if s := c.ResourceList[1].Selectors; len(s) != 1 || s[0].RootDevices[0] != "0000:3b:00.1" {
+		t.Errorf("unexpected selectors: %+v", s)
+	}
+}
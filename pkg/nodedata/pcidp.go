@@ -0,0 +1,72 @@
+package nodedata
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// PCIDPConfig is the configuration of the SR-IOV network device plugin, /etc/pcidp/config.json.
+type PCIDPConfig struct {
+	ResourceList []PCIDPResource `json:"resourceList"`
+}
+
+// PCIDPResource is a resource pool of the device plugin.
+type PCIDPResource struct {
+	ResourceName   string `json:"resourceName"`
+	ResourcePrefix string `json:"resourcePrefix,omitempty"`
+	DeviceType     string `json:"deviceType,omitempty"`
+	// Selectors is a single selector in older releases, and a list of selectors since.
+	Selectors PCIDPSelectors `json:"selectors"`
+}
+
+// FullName returns the name of the extended resource, e.g. openshift.io/intel_sriov_netdevice. The default prefix of
+// the device plugin is intel.com.
+func (r PCIDPResource) FullName() string {
+	prefix := r.ResourcePrefix
+	if prefix == "" {
+		prefix = "intel.com"
+	}
+	return prefix + "/" + r.ResourceName
+}
+
+// PCIDPSelector selects the devices of a resource pool.
+type PCIDPSelector struct {
+	Vendors     []string `json:"vendors,omitempty"`
+	Devices     []string `json:"devices,omitempty"`
+	Drivers     []string `json:"drivers,omitempty"`
+	PfNames     []string `json:"pfNames,omitempty"`
+	RootDevices []string `json:"rootDevices,omitempty"`
+	IsRdma      bool     `json:"isRdma,omitempty"`
+}
+
+// PCIDPSelectors accepts a selector object, or a list of selectors.
+type PCIDPSelectors []PCIDPSelector
+
+// UnmarshalJSON reads a selector object, or a list of selectors.
+func (s *PCIDPSelectors) UnmarshalJSON(data []byte) error {
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") {
+		var selector PCIDPSelector
+		if err := json.Unmarshal(data, &selector); err != nil {
+			return err
+		}
+		*s = PCIDPSelectors{selector}
+		return nil
+	}
+
+	var selectors []PCIDPSelector
+	if err := json.Unmarshal(data, &selectors); err != nil {
+		return err
+	}
+	*s = selectors
+	return nil
+}
+
+// ParsePCIDPConfig parses the configuration of the SR-IOV network device plugin.
+func ParsePCIDPConfig(data []byte) (*PCIDPConfig, error) {
+	c := &PCIDPConfig{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("can't parse the device plugin config; %w", err)
+	}
+	return c, nil
+}
@@ -0,0 +1,44 @@
+package oc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+// Runner runs oc with the arguments, and returns its standard output.
+type Runner func(ctx context.Context, args ...string) ([]byte, error)
+
+// Run runs oc. The error has the standard error of oc.
+func Run(ctx context.Context, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "oc", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return out, fmt.Errorf("%w: %s", err, msg)
+		}
+		return out, err
+	}
+	return out, nil
+}
+
+// Get runs oc, and decodes the objects of its output, e.g. of oc get -o json.
+func Get(ctx context.Context, run Runner, args ...string) ([]unstructured.Unstructured, error) {
+	out, err := run(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("can't run oc %s; %w", strings.Join(args, " "), err)
+	}
+	objs, err := layout.DecodeObjects(out)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode the output of oc %s; %w", strings.Join(args, " "), err)
+	}
+	return objs, nil
+}
@@ -0,0 +1,85 @@
+// Package oc has the helpers of the Go collectors that read the cluster objects with oc while gathering.
+package oc
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+// Endpoints counts the endpoints of EndpointSlices.
+type Endpoints struct {
+	Ready    int
+	NotReady int
+}
+
+// Service is a Service, with the endpoints of its EndpointSlices.
+type Service struct {
+	// Found tells whether the Service exists; EndpointSlices may be left behind by a deleted one.
+	Found bool
+	// Ports has the name of each port of the Service, by port number; the only port of a Service may have no name.
+	Ports map[int64]string
+	// PortEndpoints has the endpoints of the EndpointSlices, by port name.
+	PortEndpoints map[string]Endpoints
+}
+
+// EndpointsOf returns the endpoints serving a port of the Service; none when the Service doesn't have the port.
+func (s Service) EndpointsOf(port int64) (Endpoints, bool) {
+	name, ok := s.Ports[port]
+	if !ok {
+		return Endpoints{}, false
+	}
+	return s.PortEndpoints[name], true
+}
+
+// Services returns the Services of objs, with the endpoints of the EndpointSlices of objs, by namespace/name. The other
+// objects are ignored.
+func Services(objs []unstructured.Unstructured) map[string]Service {
+	services := make(map[string]Service)
+	for _, obj := range objs {
+		switch obj.GetKind() {
+		case "Service":
+			key := obj.GetNamespace() + "/" + obj.GetName()
+			svc := services[key]
+			svc.Found = true
+			svc.Ports = make(map[int64]string)
+			ports, _, _ := unstructured.NestedSlice(obj.Object, "spec", "ports")
+			for _, p := range ports {
+				fields, _ := p.(map[string]any)
+				port, _ := layout.NestedInt64(fields, "port")
+				name, _, _ := unstructured.NestedString(fields, "name")
+				svc.Ports[port] = name
+			}
+			services[key] = svc
+		case "EndpointSlice":
+			key := obj.GetNamespace() + "/" + obj.GetLabels()["kubernetes.io/service-name"]
+			svc := services[key]
+			if svc.PortEndpoints == nil {
+				svc.PortEndpoints = make(map[string]Endpoints)
+			}
+			var counted Endpoints
+			eps, _, _ := unstructured.NestedSlice(obj.Object, "endpoints")
+			for _, ep := range eps {
+				fields, _ := ep.(map[string]any)
+				// a nil ready condition means ready
+				if ready, found, _ := unstructured.NestedBool(fields, "conditions", "ready"); found && !ready {
+					counted.NotReady++
+				} else {
+					counted.Ready++
+				}
+			}
+			// the ports of an EndpointSlice are named after the ports of its Service
+			ports, _, _ := unstructured.NestedSlice(obj.Object, "ports")
+			for _, p := range ports {
+				fields, _ := p.(map[string]any)
+				name, _, _ := unstructured.NestedString(fields, "name")
+				e := svc.PortEndpoints[name]
+				e.Ready += counted.Ready
+				e.NotReady += counted.NotReady
+				svc.PortEndpoints[name] = e
+			}
+			services[key] = svc
+		}
+	}
+	return services
+}
@@ -0,0 +1,89 @@
+package oc
+
+import (
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+const servicesYAML = `apiVersion: v1
+kind: Service
+metadata:
+  name: virt-api
+  namespace: openshift-cnv
+spec:
+  ports:
+  - name: https
+    port: 443
+  - name: metrics
+    port: 8443
+---
+apiVersion: discovery.k8s.io/v1
+kind: EndpointSlice
+metadata:
+  name: virt-api-abcde
+  namespace: openshift-cnv
+  labels:
+    kubernetes.io/service-name: virt-api
+endpoints:
+- addresses: [10.128.0.10]
+  conditions:
+    ready: true
+- addresses: [10.128.0.11]
+  conditions:
+    ready: false
+- addresses: [10.128.0.12]
+ports:
+- name: https
+  port: 8443
+---
+apiVersion: discovery.k8s.io/v1
+kind: EndpointSlice
+metadata:
+  name: virt-api-fghij
+  namespace: openshift-cnv
+  labels:
+    kubernetes.io/service-name: virt-api
+endpoints:
+- addresses: [10.128.0.14]
+ports:
+- name: metrics
+  port: 8080
+---
+apiVersion: discovery.k8s.io/v1
+kind: EndpointSlice
+metadata:
+  name: deleted-xyz
+  namespace: openshift-cnv
+  labels:
+    kubernetes.io/service-name: deleted
+endpoints:
+- addresses: [10.128.0.13]
+ports:
+- port: 443
+`
+
+func TestServices(t *testing.T) {
+	objs, err := layout.DecodeObjects([]byte(servicesYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services := Services(objs)
+	svc := services["openshift-cnv/virt-api"]
+	if !svc.Found {
+		t.Errorf("unexpected virt-api: %+v", svc)
+	}
+	if e, ok := svc.EndpointsOf(443); !ok || e != (Endpoints{Ready: 2, NotReady: 1}) {
+		t.Errorf("unexpected endpoints of the port 443: %+v", e)
+	}
+	if e, ok := svc.EndpointsOf(8443); !ok || e != (Endpoints{Ready: 1}) {
+		t.Errorf("unexpected endpoints of the port 8443: %+v", e)
+	}
+	if _, ok := svc.EndpointsOf(80); ok {
+		t.Error("the port 80 should not be found")
+	}
+	if svc := services["openshift-cnv/deleted"]; svc.Found || svc.PortEndpoints[""] != (Endpoints{Ready: 1}) {
+		t.Errorf("the endpoints of a deleted service should be counted, without the service; got %+v", svc)
+	}
+}
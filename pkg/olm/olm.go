@@ -0,0 +1,374 @@
+// Package olm collects the OLM objects of the HyperConverged installation namespace: the Subscriptions, InstallPlans,
+// ClusterServiceVersions and OperatorGroups, the CatalogSources the subscriptions use, and the PackageManifests of
+// their packages. Each object is written as its own YAML file, where oc adm inspect would put it, and the summary tells
+// whether the installation is healthy: the phase of the CSVs, the state of the subscriptions, the install plans waiting
+// for a manual approval, the connection state of the catalog sources, and the upgrade chain of each package from the
+// installed CSV to the head of its channel.
+package olm
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/oc"
+)
+
+// SummaryFile is the summary written into the olm directory of the bundle.
+const SummaryFile = "summary.json"
+
+// the label OLM puts on the copies of the CSVs of the operators that watch all the namespaces
+const copiedFromLabel = "olm.copiedFrom"
+
+// the subscription conditions that tell why OLM can't install or upgrade
+var failureConditions = []string{"CatalogSourcesUnhealthy", "ResolutionFailed", "InstallPlanFailed", "InstallPlanMissing"}
+
+// resources are the resource types of the collected objects, by kind
+var resources = map[string]schema.GroupResource{
+	"Subscription":          layout.Subscriptions,
+	"InstallPlan":           layout.InstallPlans,
+	"ClusterServiceVersion": layout.ClusterServiceVersions,
+	"OperatorGroup":         layout.OperatorGroups,
+	"CatalogSource":         layout.CatalogSources,
+	"PackageManifest":       layout.PackageManifests,
+}
+
+// CSV is the state of a ClusterServiceVersion.
+type CSV struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Phase    string `json:"phase"`
+	Reason   string `json:"reason,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Replaces string `json:"replaces,omitempty"`
+}
+
+// ChainEntry is a CSV of the upgrade chain of a subscription.
+type ChainEntry struct {
+	CSV       string `json:"csv"`
+	Version   string `json:"version"`
+	Installed bool   `json:"installed"`
+	// Head tells whether the CSV is the head of the channel.
+	Head bool `json:"head"`
+}
+
+// Subscription is the state of a Subscription.
+type Subscription struct {
+	Name                string `json:"name"`
+	Package             string `json:"package"`
+	Channel             string `json:"channel"`
+	Source              string `json:"source"`
+	SourceNamespace     string `json:"sourceNamespace"`
+	InstallPlanApproval string `json:"installPlanApproval"`
+	State               string `json:"state"`
+	InstalledCSV        string `json:"installedCSV"`
+	CurrentCSV          string `json:"currentCSV"`
+	// Chain is the CSVs of the channel, from the installed one to the head, oldest first; it is empty when the
+	// PackageManifest was not found.
+	Chain []ChainEntry `json:"chain"`
+}
+
+// InstallPlan is the state of an InstallPlan.
+type InstallPlan struct {
+	Name     string   `json:"name"`
+	CSVs     []string `json:"csvs"`
+	Approval string   `json:"approval"`
+	Approved bool     `json:"approved"`
+	Phase    string   `json:"phase"`
+	// AwaitingApproval is set for the manual install plans that were not approved; the upgrade waits for them.
+	AwaitingApproval bool `json:"awaitingApproval"`
+}
+
+// CatalogSource is the connection state of a CatalogSource.
+type CatalogSource struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Found tells whether the catalog source exists.
+	Found bool `json:"found"`
+	// State is the last observed state of the gRPC connection, e.g. READY or TRANSIENT_FAILURE.
+	State           string    `json:"state,omitempty"`
+	Address         string    `json:"address,omitempty"`
+	LastConnectTime time.Time `json:"lastConnectTime,omitzero"`
+}
+
+// OperatorGroup is an OperatorGroup of the namespace.
+type OperatorGroup struct {
+	Name             string   `json:"name"`
+	TargetNamespaces []string `json:"targetNamespaces"`
+}
+
+// Summary is the health of the OLM installation of a namespace.
+type Summary struct {
+	Time           time.Time       `json:"time"`
+	Namespace      string          `json:"namespace"`
+	CSVs           []CSV           `json:"csvs"`
+	Subscriptions  []Subscription  `json:"subscriptions"`
+	InstallPlans   []InstallPlan   `json:"installPlans"`
+	OperatorGroups []OperatorGroup `json:"operatorGroups"`
+	CatalogSources []CatalogSource `json:"catalogSources"`
+	Problems       []string        `json:"problems"`
+}
+
+// Fetch reads the OLM objects of a namespace, the CatalogSources of its subscriptions, and the PackageManifests of
+// their packages. The copies of the CSVs of the operators that watch all the namespaces are left out. A CatalogSource
+// or a PackageManifest that can't be read is skipped; the summary tells it is missing.
+func Fetch(ctx context.Context, run oc.Runner, namespace string) ([]unstructured.Unstructured, error) {
+	found, err := oc.Get(ctx, run, "get", "subscriptions,installplans,clusterserviceversions,operatorgroups", "-n",
+		namespace, "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+
+	var objs []unstructured.Unstructured
+	for _, obj := range found {
+		if obj.GetKind() == "ClusterServiceVersion" && obj.GetLabels()[copiedFromLabel] != "" {
+			continue
+		}
+		objs = append(objs, obj)
+	}
+
+	var fetched []string
+	for _, sub := range found {
+		if sub.GetKind() != "Subscription" {
+			continue
+		}
+		source, _, _ := unstructured.NestedString(sub.Object, "spec", "source")
+		sourceNamespace, _, _ := unstructured.NestedString(sub.Object, "spec", "sourceNamespace")
+		pkg, _, _ := unstructured.NestedString(sub.Object, "spec", "name")
+
+		for _, get := range [][]string{
+			{"get", "catalogsource", source, "-n", sourceNamespace, "-o", "json"},
+			{"get", "packagemanifest", pkg, "-n", namespace, "-o", "json"},
+		} {
+			key := strings.Join(get, " ")
+			if get[2] == "" || slices.Contains(fetched, key) {
+				continue
+			}
+			fetched = append(fetched, key)
+
+			if obj, err := oc.Get(ctx, run, get...); err == nil {
+				objs = append(objs, obj...)
+			}
+		}
+	}
+
+	return objs, nil
+}
+
+// WriteObjects writes each object as YAML into the bundle in root, at
+// namespaces/<ns>/<group>/<resource>/<name>.yaml, and returns the paths of the files.
+func WriteObjects(root string, objs []unstructured.Unstructured) ([]string, error) {
+	var paths []string
+	for _, obj := range objs {
+		gr, found := resources[obj.GetKind()]
+		if !found {
+			continue
+		}
+
+		obj = *obj.DeepCopy()
+		unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return paths, fmt.Errorf("can't marshal %s %s/%s; %w", gr, obj.GetNamespace(), obj.GetName(), err)
+		}
+
+		dir := filepath.Join(root, layout.NamespacesDir, obj.GetNamespace(), gr.Group, gr.Resource)
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return paths, err
+		}
+		path := filepath.Join(dir, obj.GetName()+".yaml")
+		if err = os.WriteFile(path, data, 0644); err != nil {
+			return paths, fmt.Errorf("can't write %s; %w", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// Summarize tells whether the OLM installation of a namespace is healthy, from its objects.
+func Summarize(objs []unstructured.Unstructured, namespace string, now time.Time) *Summary {
+	s := &Summary{
+		Time:           now,
+		Namespace:      namespace,
+		CSVs:           []CSV{},
+		Subscriptions:  []Subscription{},
+		InstallPlans:   []InstallPlan{},
+		OperatorGroups: []OperatorGroup{},
+		CatalogSources: []CatalogSource{},
+		Problems:       []string{},
+	}
+
+	byKind := make(map[string][]unstructured.Unstructured)
+	for _, obj := range objs {
+		byKind[obj.GetKind()] = append(byKind[obj.GetKind()], obj)
+	}
+
+	for _, obj := range byKind["ClusterServiceVersion"] {
+		csv := CSV{Name: obj.GetName()}
+		csv.Version, _, _ = unstructured.NestedString(obj.Object, "spec", "version")
+		csv.Replaces, _, _ = unstructured.NestedString(obj.Object, "spec", "replaces")
+		csv.Phase, _, _ = unstructured.NestedString(obj.Object, "status", "phase")
+		csv.Reason, _, _ = unstructured.NestedString(obj.Object, "status", "reason")
+		csv.Message, _, _ = unstructured.NestedString(obj.Object, "status", "message")
+		s.CSVs = append(s.CSVs, csv)
+
+		if csv.Phase != "Succeeded" {
+			s.Problems = append(s.Problems, strings.TrimSpace(fmt.Sprintf("the CSV %s is %s: %s %s", csv.Name,
+				cmp.Or(csv.Phase, "without a phase"), csv.Reason, csv.Message)))
+		}
+	}
+
+	for _, obj := range byKind["OperatorGroup"] {
+		og := OperatorGroup{Name: obj.GetName()}
+		og.TargetNamespaces, _, _ = unstructured.NestedStringSlice(obj.Object, "spec", "targetNamespaces")
+		if og.TargetNamespaces == nil {
+			og.TargetNamespaces = []string{}
+		}
+		s.OperatorGroups = append(s.OperatorGroups, og)
+	}
+	if len(s.OperatorGroups) != 1 {
+		s.Problems = append(s.Problems, fmt.Sprintf("the namespace has %d OperatorGroups; OLM needs exactly one",
+			len(s.OperatorGroups)))
+	}
+
+	for _, obj := range byKind["Subscription"] {
+		sub := summarizeSubscription(obj, byKind["PackageManifest"])
+		s.Subscriptions = append(s.Subscriptions, sub)
+
+		if sub.State != "AtLatestKnown" {
+			s.Problems = append(s.Problems, fmt.Sprintf("the subscription %s is %s; the installed CSV is %s, the current one %s",
+				sub.Name, cmp.Or(sub.State, "without a state"), cmp.Or(sub.InstalledCSV, "none"), cmp.Or(sub.CurrentCSV, "none")))
+		}
+		if sub.InstalledCSV != "" && !slices.ContainsFunc(s.CSVs, func(c CSV) bool { return c.Name == sub.InstalledCSV }) {
+			s.Problems = append(s.Problems, fmt.Sprintf("the installed CSV %s of the subscription %s doesn't exist",
+				sub.InstalledCSV, sub.Name))
+		}
+		if len(sub.Chain) > 0 && sub.InstalledCSV != "" && !slices.ContainsFunc(sub.Chain, func(e ChainEntry) bool { return e.Installed }) {
+			s.Problems = append(s.Problems, fmt.Sprintf("the installed CSV %s is not in the %s channel of %s",
+				sub.InstalledCSV, sub.Channel, sub.Package))
+		}
+
+		conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+		for _, c := range conditions {
+			fields, _ := c.(map[string]any)
+			t, _, _ := unstructured.NestedString(fields, "type")
+			status, _, _ := unstructured.NestedString(fields, "status")
+			if status == "True" && slices.Contains(failureConditions, t) {
+				message, _, _ := unstructured.NestedString(fields, "message")
+				s.Problems = append(s.Problems, strings.TrimSpace(fmt.Sprintf("the subscription %s has %s: %s", sub.Name, t, message)))
+			}
+		}
+
+		if sub.Source != "" && !slices.ContainsFunc(s.CatalogSources, func(c CatalogSource) bool {
+			return c.Namespace == sub.SourceNamespace && c.Name == sub.Source
+		}) {
+			s.CatalogSources = append(s.CatalogSources, summarizeCatalogSource(sub.SourceNamespace, sub.Source, byKind["CatalogSource"]))
+		}
+	}
+
+	for _, c := range s.CatalogSources {
+		switch {
+		case !c.Found:
+			s.Problems = append(s.Problems, fmt.Sprintf("the catalog source %s/%s doesn't exist", c.Namespace, c.Name))
+		case c.State != "READY":
+			s.Problems = append(s.Problems, fmt.Sprintf("the catalog source %s/%s is %s", c.Namespace, c.Name,
+				cmp.Or(c.State, "not connected")))
+		}
+	}
+
+	for _, obj := range byKind["InstallPlan"] {
+		p := SummarizeInstallPlan(obj)
+		s.InstallPlans = append(s.InstallPlans, p)
+
+		if p.AwaitingApproval {
+			s.Problems = append(s.Problems, fmt.Sprintf("the install plan %s of %s waits for a manual approval", p.Name,
+				strings.Join(p.CSVs, ", ")))
+		} else if p.Phase == "Failed" {
+			s.Problems = append(s.Problems, fmt.Sprintf("the install plan %s of %s failed", p.Name, strings.Join(p.CSVs, ", ")))
+		}
+	}
+
+	return s
+}
+
+// SummarizeInstallPlan returns the approval and the phase of an InstallPlan.
+func SummarizeInstallPlan(obj unstructured.Unstructured) InstallPlan {
+	p := InstallPlan{Name: obj.GetName()}
+	p.CSVs, _, _ = unstructured.NestedStringSlice(obj.Object, "spec", "clusterServiceVersionNames")
+	if p.CSVs == nil {
+		p.CSVs = []string{}
+	}
+	p.Approval, _, _ = unstructured.NestedString(obj.Object, "spec", "approval")
+	p.Approved, _, _ = unstructured.NestedBool(obj.Object, "spec", "approved")
+	p.Phase, _, _ = unstructured.NestedString(obj.Object, "status", "phase")
+	p.AwaitingApproval = p.Phase == "RequiresApproval" || (p.Approval == "Manual" && !p.Approved && p.Phase != "Complete")
+	return p
+}
+
+func summarizeSubscription(obj unstructured.Unstructured, packages []unstructured.Unstructured) Subscription {
+	sub := Subscription{Name: obj.GetName(), Chain: []ChainEntry{}}
+	sub.Package, _, _ = unstructured.NestedString(obj.Object, "spec", "name")
+	sub.Channel, _, _ = unstructured.NestedString(obj.Object, "spec", "channel")
+	sub.Source, _, _ = unstructured.NestedString(obj.Object, "spec", "source")
+	sub.SourceNamespace, _, _ = unstructured.NestedString(obj.Object, "spec", "sourceNamespace")
+	sub.InstallPlanApproval, _, _ = unstructured.NestedString(obj.Object, "spec", "installPlanApproval")
+	sub.State, _, _ = unstructured.NestedString(obj.Object, "status", "state")
+	sub.InstalledCSV, _, _ = unstructured.NestedString(obj.Object, "status", "installedCSV")
+	sub.CurrentCSV, _, _ = unstructured.NestedString(obj.Object, "status", "currentCSV")
+
+	i := slices.IndexFunc(packages, func(p unstructured.Unstructured) bool { return p.GetName() == sub.Package })
+	if i < 0 {
+		return sub
+	}
+	channels, _, _ := unstructured.NestedSlice(packages[i].Object, "status", "channels")
+	for _, c := range channels {
+		fields, _ := c.(map[string]any)
+		if name, _, _ := unstructured.NestedString(fields, "name"); name != sub.Channel {
+			continue
+		}
+		head, _, _ := unstructured.NestedString(fields, "currentCSV")
+
+		// the entries of a channel are listed from its head
+		entries, _, _ := unstructured.NestedSlice(fields, "entries")
+		for _, e := range entries {
+			entry, _ := e.(map[string]any)
+			ce := ChainEntry{}
+			ce.CSV, _, _ = unstructured.NestedString(entry, "name")
+			ce.Version, _, _ = unstructured.NestedString(entry, "version")
+			ce.Installed, ce.Head = ce.CSV == sub.InstalledCSV, ce.CSV == head
+			sub.Chain = append(sub.Chain, ce)
+			if ce.Installed {
+				break
+			}
+		}
+		slices.Reverse(sub.Chain)
+	}
+	return sub
+}
+
+func summarizeCatalogSource(namespace, name string, sources []unstructured.Unstructured) CatalogSource {
+	c := CatalogSource{Namespace: namespace, Name: name}
+	i := slices.IndexFunc(sources, func(s unstructured.Unstructured) bool {
+		return s.GetNamespace() == namespace && s.GetName() == name
+	})
+	if i < 0 {
+		return c
+	}
+
+	c.Found = true
+	c.State, _, _ = unstructured.NestedString(sources[i].Object, "status", "connectionState", "lastObservedState")
+	c.Address, _, _ = unstructured.NestedString(sources[i].Object, "status", "connectionState", "address")
+	connected, _, _ := unstructured.NestedString(sources[i].Object, "status", "connectionState", "lastConnect")
+	c.LastConnectTime, _ = time.Parse(time.RFC3339, connected)
+	return c
+}
@@ -0,0 +1,156 @@
+package olm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+func fakeOC(_ context.Context, args ...string) ([]byte, error) {
+	switch cmd := strings.Join(args, " "); cmd {
+	case "get subscriptions,installplans,clusterserviceversions,operatorgroups -n openshift-cnv -o json":
+		return os.ReadFile("testdata/namespace.yaml")
+	case "get catalogsource redhat-operators -n openshift-marketplace -o json":
+		return os.ReadFile("testdata/catalogsource.yaml")
+	case "get packagemanifest kubevirt-hyperconverged -n openshift-cnv -o json":
+		return os.ReadFile("testdata/packagemanifest.yaml")
+	default:
+		return nil, errors.New("unexpected command " + cmd)
+	}
+}
+
+func TestFetchAndWrite(t *testing.T) {
+	objs, err := Fetch(context.Background(), fakeOC, "openshift-cnv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the copied CSV is left out
+	if len(objs) != 7 {
+		t.Fatalf("expected 7 objects, but got %d", len(objs))
+	}
+
+	root := t.TempDir()
+	if err = os.WriteFile(filepath.Join(root, layout.VersionFile), []byte(layout.ProductName+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	paths, err := WriteObjects(root, objs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 7 {
+		t.Errorf("expected 7 files, but got %v", paths)
+	}
+
+	// the files are where the layout looks for the objects
+	b, err := layout.Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for gr, count := range map[string]int{"Subscription": 1, "InstallPlan": 2, "ClusterServiceVersion": 1, "OperatorGroup": 1, "CatalogSource": 1, "PackageManifest": 1} {
+		found, err := b.Objects(resources[gr])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != count {
+			t.Errorf("expected %d %s, but got %d", count, gr, len(found))
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "namespaces/openshift-cnv/operators.coreos.com/subscriptions/hco-operatorhub.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "managedFields") {
+		t.Errorf("expected the managed fields to be dropped, but got\n%s", data)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	objs, err := Fetch(context.Background(), fakeOC, "openshift-cnv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Summarize(objs, "openshift-cnv", time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC))
+
+	if len(s.CSVs) != 1 || s.CSVs[0].Phase != "Succeeded" || s.CSVs[0].Replaces != "kubevirt-hyperconverged-operator.v4.19.1" {
+		t.Errorf("unexpected CSVs: %+v", s.CSVs)
+	}
+	if len(s.OperatorGroups) != 1 || !slices.Equal(s.OperatorGroups[0].TargetNamespaces, []string{"openshift-cnv"}) {
+		t.Errorf("unexpected operator groups: %+v", s.OperatorGroups)
+	}
+	if len(s.InstallPlans) != 2 || s.InstallPlans[0].AwaitingApproval || !s.InstallPlans[1].AwaitingApproval {
+		t.Errorf("unexpected install plans: %+v", s.InstallPlans)
+	}
+	if len(s.CatalogSources) != 1 || !s.CatalogSources[0].Found || s.CatalogSources[0].State != "TRANSIENT_FAILURE" {
+		t.Errorf("unexpected catalog sources: %+v", s.CatalogSources)
+	}
+
+	if len(s.Subscriptions) != 1 {
+		t.Fatalf("expected 1 subscription, but got %+v", s.Subscriptions)
+	}
+	expectedChain := []ChainEntry{
+		{CSV: "kubevirt-hyperconverged-operator.v4.19.3", Version: "4.19.3", Installed: true},
+		{CSV: "kubevirt-hyperconverged-operator.v4.19.4", Version: "4.19.4"},
+		{CSV: "kubevirt-hyperconverged-operator.v4.19.5", Version: "4.19.5", Head: true},
+	}
+	if sub := s.Subscriptions[0]; sub.Package != "kubevirt-hyperconverged" || !slices.Equal(sub.Chain, expectedChain) {
+		t.Errorf("unexpected subscription: %+v", sub)
+	}
+
+	expected := []string{
+		"the subscription hco-operatorhub is UpgradePending; the installed CSV is kubevirt-hyperconverged-operator.v4.19.3, the current one kubevirt-hyperconverged-operator.v4.19.5",
+		"the catalog source openshift-marketplace/redhat-operators is TRANSIENT_FAILURE",
+		"the install plan install-fghij of kubevirt-hyperconverged-operator.v4.19.5 waits for a manual approval",
+	}
+	if !slices.Equal(s.Problems, expected) {
+		t.Errorf("expected the problems\n%s\nbut got\n%s", strings.Join(expected, "\n"), strings.Join(s.Problems, "\n"))
+	}
+}
+
+func TestSummarizeMissingObjects(t *testing.T) {
+	objs, err := layout.DecodeObjects([]byte(`
+apiVersion: operators.coreos.com/v1alpha1
+kind: Subscription
+metadata:
+  name: hco-operatorhub
+  namespace: openshift-cnv
+spec:
+  channel: stable
+  name: kubevirt-hyperconverged
+  source: custom-catalog
+  sourceNamespace: openshift-marketplace
+status:
+  state: AtLatestKnown
+  installedCSV: kubevirt-hyperconverged-operator.v4.19.3
+  currentCSV: kubevirt-hyperconverged-operator.v4.19.3
+  conditions:
+  - type: ResolutionFailed
+    status: "True"
+    message: "constraints not satisfiable"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Summarize(objs, "openshift-cnv", time.Now())
+	expected := []string{
+		"the namespace has 0 OperatorGroups; OLM needs exactly one",
+		"the installed CSV kubevirt-hyperconverged-operator.v4.19.3 of the subscription hco-operatorhub doesn't exist",
+		"the subscription hco-operatorhub has ResolutionFailed: constraints not satisfiable",
+		"the catalog source openshift-marketplace/custom-catalog doesn't exist",
+	}
+	if !slices.Equal(s.Problems, expected) {
+		t.Errorf("expected the problems\n%s\nbut got\n%s", strings.Join(expected, "\n"), strings.Join(s.Problems, "\n"))
+	}
+	if len(s.Subscriptions) != 1 || len(s.Subscriptions[0].Chain) != 0 {
+		t.Errorf("unexpected subscriptions: %+v", s.Subscriptions)
+	}
+}
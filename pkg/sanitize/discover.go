@@ -0,0 +1,155 @@
+package sanitize
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+// Name is a name found in the bundle, that must be replaced wherever it appears.
+type Name struct {
+	Kind  Kind
+	Value string
+}
+
+// system namespaces are kept, so the layout stays readable and the analyzers keep working
+var (
+	keptNamespaces        = []string{"default"}
+	keptNamespacePrefixes = []string{"kube-", "openshift"}
+)
+
+// node address types that hold host names
+var hostAddressTypes = map[string]bool{
+	"Hostname":    true,
+	"InternalDNS": true,
+	"ExternalDNS": true,
+}
+
+// Discover finds the namespaces, nodes, host names and VMs of the bundle. System namespaces, the namespaces of the
+// KubeVirt and HyperConverged CRs, and the namespaces in keep are not returned.
+func Discover(b *layout.Bundle, keep []string) ([]Name, error) {
+	d := discovery{seen: make(map[string]bool)}
+
+	kept := make(map[string]bool)
+	for _, ns := range append(keptNamespaces, keep...) {
+		kept[ns] = true
+	}
+	for _, gr := range []schema.GroupResource{layout.KubeVirts, layout.HyperConvergeds} {
+		objects, err := b.Objects(gr)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objects {
+			kept[obj.GetNamespace()] = true
+		}
+	}
+
+	nodes, err := b.Nodes()
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		d.addNode(node)
+	}
+
+	nodeObjects, err := b.Objects(layout.Nodes)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodeObjects {
+		d.addNode(node.GetName())
+		d.addHostNames(node.Object)
+	}
+
+	namespaces, err := b.Namespaces()
+	if err != nil {
+		return nil, err
+	}
+
+	vms, err := b.VirtualMachines()
+	if err != nil {
+		return nil, err
+	}
+	vmis, err := b.VirtualMachineInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, vmi := range vmis {
+		if node, _, _ := unstructured.NestedString(vmi.Object, "status", "nodeName"); node != "" {
+			d.addNode(node)
+		}
+	}
+
+	for _, vm := range append(vms, vmis...) {
+		namespaces = append(namespaces, vm.GetNamespace())
+		d.add(VM, vm.GetName())
+	}
+
+	for _, ns := range namespaces {
+		if !kept[ns] && !hasAnyPrefix(ns, keptNamespacePrefixes) {
+			d.add(Namespace, ns)
+		}
+	}
+
+	return d.names, nil
+}
+
+type discovery struct {
+	names []Name
+	seen  map[string]bool
+}
+
+// add records a name, unless it is empty, already a token, or already known; the first kind wins
+func (d *discovery) add(kind Kind, value string) {
+	if value == "" || IsToken(kind, value) || d.seen[value] {
+		return
+	}
+
+	d.seen[value] = true
+	d.names = append(d.names, Name{Kind: kind, Value: value})
+}
+
+// addNode adds a node name, and its short form if it is fully qualified
+func (d *discovery) addNode(name string) {
+	d.add(Node, name)
+	d.addShortHostName(name)
+}
+
+// addHostNames adds the host names of a node, and their short forms
+func (d *discovery) addHostNames(node map[string]any) {
+	addresses, _, _ := unstructured.NestedSlice(node, "status", "addresses")
+	for _, address := range addresses {
+		fields, ok := address.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		addrType, _, _ := unstructured.NestedString(fields, "type")
+		value, _, _ := unstructured.NestedString(fields, "address")
+		if !hostAddressTypes[addrType] {
+			continue
+		}
+
+		d.add(Host, value)
+		d.addShortHostName(value)
+	}
+}
+
+func (d *discovery) addShortHostName(name string) {
+	if short, _, found := strings.Cut(name, "."); found {
+		d.add(Host, short)
+	}
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,277 @@
+// Package sanitize anonymizes a must-gather bundle in place.
+//
+// Namespaces, node names, host names, VM names, IP addresses and MAC addresses are replaced with tokens derived from
+// the value with a keyed hash, so the same value always becomes the same token, in every file and in every bundle
+// sanitized with the same key. Tokens are recognizable, so sanitizing an already sanitized bundle changes nothing.
+//
+// The key and the reverse mapping, from token to original value, are kept in a mapping file that stays with the
+// customer.
+package sanitize
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Kind is the kind of a sanitized value. It selects the token format.
+type Kind string
+
+const (
+	Namespace Kind = "namespace"
+	Node      Kind = "node"
+	Host      Kind = "host"
+	VM        Kind = "vm"
+	IPv4      Kind = "ipv4"
+	IPv6      Kind = "ipv6"
+	MAC       Kind = "mac"
+)
+
+// the token prefix of each name kind
+var namePrefixes = map[Kind]string{
+	Namespace: "ns-",
+	Node:      "node-",
+	Host:      "host-",
+	VM:        "vm-",
+}
+
+const (
+	// MappingFormatVersion is the version of the mapping file format.
+	MappingFormatVersion = 1
+
+	keySize = 32
+
+	// IPv4 tokens are in 240.0.0.0/4, which is reserved and never used by real hosts.
+	ipv4TokenFirstOctet = 240
+	// MAC tokens are locally administered unicast addresses with this prefix.
+	macTokenPrefix = "fe:ed:"
+)
+
+// IPv6 tokens are in the documentation prefix, which is never used by real hosts.
+var ipv6TokenPrefix = netip.MustParsePrefix("2001:db8::/32")
+
+var (
+	nameTokenRe = regexp.MustCompile(`^(ns|node|host|vm)-[0-9a-f]{10}$`)
+	macTokenRe  = regexp.MustCompile(`^` + macTokenPrefix + `[0-9a-f]{2}(:[0-9a-f]{2}){3}$`)
+)
+
+// MappingEntry is one replaced value.
+type MappingEntry struct {
+	Kind     Kind   `json:"kind"`
+	Original string `json:"original"`
+	Token    string `json:"token"`
+}
+
+// mappingFile is the content of the mapping file.
+type mappingFile struct {
+	FormatVersion int            `json:"formatVersion"`
+	Key           string         `json:"key"`
+	Entries       []MappingEntry `json:"entries"`
+}
+
+// Mapper replaces values with tokens, and records the reverse mapping. It is safe for concurrent use.
+type Mapper struct {
+	key []byte
+
+	mu      sync.Mutex
+	tokens  map[Kind]map[string]string
+	reverse map[string]MappingEntry
+}
+
+// NewMapper returns a Mapper that derives the tokens with key. A random key is generated if key is empty.
+func NewMapper(key []byte) (*Mapper, error) {
+	if len(key) == 0 {
+		key = make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Mapper{
+		key:     key,
+		tokens:  make(map[Kind]map[string]string),
+		reverse: make(map[string]MappingEntry),
+	}, nil
+}
+
+// LoadMapper reads a mapping file written by Save, and returns a Mapper with its key and entries. If the file does
+// not exist, it returns a new Mapper with key, or with a random key if key is empty. If both the file and key are
+// given, they must match.
+func LoadMapper(path string, key []byte) (*Mapper, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return NewMapper(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var mf mappingFile
+	if err = json.Unmarshal(data, &mf); err != nil {
+		return nil, fmt.Errorf("can't parse the mapping file %s; %w", path, err)
+	}
+	if mf.FormatVersion > MappingFormatVersion {
+		return nil, fmt.Errorf("unsupported mapping file format version %d", mf.FormatVersion)
+	}
+
+	fileKey, err := hex.DecodeString(mf.Key)
+	if err != nil || len(fileKey) == 0 {
+		return nil, fmt.Errorf("invalid key in the mapping file %s", path)
+	}
+	if len(key) > 0 && !hmac.Equal(key, fileKey) {
+		return nil, fmt.Errorf("the key does not match the key of the mapping file %s", path)
+	}
+
+	m, err := NewMapper(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range mf.Entries {
+		m.add(entry)
+	}
+
+	return m, nil
+}
+
+// Save writes the key and the reverse mapping to path. The file is only readable by its owner.
+func (m *Mapper) Save(path string) error {
+	mf := mappingFile{
+		FormatVersion: MappingFormatVersion,
+		Key:           hex.EncodeToString(m.key),
+		Entries:       m.Entries(),
+	}
+
+	data, err := json.MarshalIndent(mf, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// Entries returns the mapping, sorted by kind and original value.
+func (m *Mapper) Entries() []MappingEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := make([]MappingEntry, 0, len(m.reverse))
+	for _, entry := range m.reverse {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		return entries[i].Original < entries[j].Original
+	})
+
+	return entries
+}
+
+// Original returns the original value of a token.
+func (m *Mapper) Original(token string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, found := m.reverse[token]
+	return entry.Original, found
+}
+
+// Token returns the token of a value. Values that already are tokens are returned as is.
+func (m *Mapper) Token(kind Kind, value string) string {
+	value = normalize(kind, value)
+	if IsToken(kind, value) {
+		return value
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if token, found := m.tokens[kind][value]; found {
+		return token
+	}
+
+	// the short token formats may collide; derive another token until a free one is found
+	for i := uint64(0); ; i++ {
+		token := m.derive(kind, value, i)
+		if _, taken := m.reverse[token]; !taken {
+			m.add(MappingEntry{Kind: kind, Original: value, Token: token})
+			return token
+		}
+	}
+}
+
+// IsToken reports whether value is a token of the given kind.
+func IsToken(kind Kind, value string) bool {
+	switch kind {
+	case IPv4:
+		addr, err := netip.ParseAddr(value)
+		return err == nil && addr.Is4() && addr.As4()[0]&0xf0 == ipv4TokenFirstOctet
+	case IPv6:
+		addr, err := netip.ParseAddr(value)
+		return err == nil && addr.Is6() && ipv6TokenPrefix.Contains(addr)
+	case MAC:
+		return macTokenRe.MatchString(strings.ToLower(value))
+	default:
+		return nameTokenRe.MatchString(value) && strings.HasPrefix(value, namePrefixes[kind])
+	}
+}
+
+func (m *Mapper) add(entry MappingEntry) {
+	if m.tokens[entry.Kind] == nil {
+		m.tokens[entry.Kind] = make(map[string]string)
+	}
+	m.tokens[entry.Kind][entry.Original] = entry.Token
+	m.reverse[entry.Token] = entry
+}
+
+func (m *Mapper) derive(kind Kind, value string, attempt uint64) string {
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	if attempt > 0 {
+		_ = binary.Write(mac, binary.BigEndian, attempt)
+	}
+	sum := mac.Sum(nil)
+
+	switch kind {
+	case IPv4:
+		return netip.AddrFrom4([4]byte{ipv4TokenFirstOctet | sum[0]&0x0f, sum[1], sum[2], sum[3]}).String()
+	case IPv6:
+		var b [16]byte
+		prefix := ipv6TokenPrefix.Addr().As16()
+		copy(b[:4], prefix[:4])
+		copy(b[4:], sum[:12])
+		return netip.AddrFrom16(b).String()
+	case MAC:
+		return fmt.Sprintf("%s%02x:%02x:%02x:%02x", macTokenPrefix, sum[0], sum[1], sum[2], sum[3])
+	default:
+		return namePrefixes[kind] + hex.EncodeToString(sum[:5])
+	}
+}
+
+func normalize(kind Kind, value string) string {
+	switch kind {
+	case MAC:
+		return strings.ToLower(value)
+	case IPv6:
+		if addr, err := netip.ParseAddr(value); err == nil {
+			return addr.String()
+		}
+	}
+	return value
+}
@@ -0,0 +1,285 @@
+package sanitize
+
+import (
+	"bytes"
+	"net/netip"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+// addressRe finds MAC, IPv6 and IPv4 address candidates. At the same position, the first alternative wins, so a MAC
+// address is not taken for an IPv6 one. The candidates are validated by replaceAddress.
+var addressRe = regexp.MustCompile(`(?i)` +
+	`[0-9a-f]{2}(?::[0-9a-f]{2}){5}` +
+	`|[0-9a-f]{0,4}(?::[0-9a-f]{0,4}){2,7}` +
+	`|\d{1,3}(?:\.\d{1,3}){3}`)
+
+var macRe = regexp.MustCompile(`(?i)^[0-9a-f]{2}(?::[0-9a-f]{2}){5}$`)
+
+// versionRe matches the API versions, e.g. v1 or v1beta1
+var versionRe = regexp.MustCompile(`^v\d+(?:(?:alpha|beta)\d+)?$`)
+
+// layoutWords are the directories of the bundle layout, in addition to the API groups and resources
+var layoutWords = []string{
+	"core", "crs", "pods", "vms", "logs",
+	layout.NamespacesDir, layout.ClusterScopedDir, layout.NodesDir, layout.WebhooksDir, layout.APIServicesDir,
+	layout.VirtualizationDir, layout.APIServerAuditDir, layout.OLMDir,
+}
+
+// Replacer replaces the names and the addresses in text.
+//
+// Node and host names are replaced wherever they are not part of a longer word. VM and namespace names are often
+// common words, such as fedora or test, so they are only replaced where they are used as names: as the value of a
+// field, e.g. name: vm1 or "namespace":"ns1"; joined as ns1/vm1 or ns1_vm1; in the namespaces/<ns> and vms/<vm> path
+// parts, as the name of an object file, and in the name of the virt-launcher pods. A name that is also an API group,
+// an API version or a directory of the layout, e.g. v1 or core, is never replaced.
+type Replacer struct {
+	mapper  *Mapper
+	names   map[string]Kind
+	namesRe *regexp.Regexp
+}
+
+// NewReplacer returns a Replacer for the names, and for the names already in the mapping of mapper.
+func NewReplacer(mapper *Mapper, names []Name) *Replacer {
+	r := &Replacer{mapper: mapper, names: make(map[string]Kind)}
+
+	for _, entry := range mapper.Entries() {
+		if _, isName := namePrefixes[entry.Kind]; isName && !isReserved(entry.Original) {
+			r.names[entry.Original] = entry.Kind
+		}
+	}
+	for _, name := range names {
+		if _, found := r.names[name.Value]; !found && !isReserved(name.Value) {
+			r.names[name.Value] = name.Kind
+		}
+	}
+
+	if len(r.names) == 0 {
+		return r
+	}
+
+	// the longest names first, so that worker-0.example.com wins over worker-0
+	quoted := make([]string, 0, len(r.names))
+	for name := range r.names {
+		quoted = append(quoted, regexp.QuoteMeta(name))
+	}
+	sort.Slice(quoted, func(i, j int) bool {
+		if len(quoted[i]) != len(quoted[j]) {
+			return len(quoted[i]) > len(quoted[j])
+		}
+		return quoted[i] < quoted[j]
+	})
+	r.namesRe = regexp.MustCompile(strings.Join(quoted, "|"))
+
+	return r
+}
+
+// Replace returns text with its addresses and names replaced by their tokens.
+func (r *Replacer) Replace(text []byte) []byte {
+	text = replaceMatches(text, addressRe, isBoundedAddress, r.replaceAddress)
+	if r.namesRe != nil {
+		text = r.replaceNames(text)
+	}
+	return text
+}
+
+// ReplacePath returns a slash separated, bundle relative path with the names in its elements replaced.
+func (r *Replacer) ReplacePath(rel string) string {
+	return string(r.Replace([]byte(rel)))
+}
+
+// replaceNames replaces the names of text that are used as names
+func (r *Replacer) replaceNames(text []byte) []byte {
+	var matches [][]int
+	for _, m := range r.namesRe.FindAllIndex(text, -1) {
+		if isBoundedName(text, m[0], m[1]) {
+			matches = append(matches, m)
+		}
+	}
+	if len(matches) == 0 {
+		return text
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(text))
+
+	last := 0
+	for i, m := range matches {
+		if !r.isNameContext(text, matches, i) {
+			continue
+		}
+
+		name := string(text[m[0]:m[1]])
+		out.Write(text[last:m[0]])
+		out.WriteString(r.mapper.Token(r.names[name], name))
+		last = m[1]
+	}
+	out.Write(text[last:])
+
+	return out.Bytes()
+}
+
+// isNameContext tells whether the i-th of the bounded name matches of text is used as a name
+func (r *Replacer) isNameContext(text []byte, matches [][]int, i int) bool {
+	start, end := matches[i][0], matches[i][1]
+	kind := r.names[string(text[start:end])]
+	if kind != Namespace && kind != VM {
+		return true
+	}
+	before, after := text[:start], text[end:]
+
+	// ns1/vm1, or the domain name ns1_vm1
+	if i > 0 && matches[i-1][1] == start-1 && isJoiner(text[start-1]) &&
+		r.names[string(text[matches[i-1][0]:matches[i-1][1]])] == Namespace {
+		return true
+	}
+	if kind == Namespace && i+1 < len(matches) && matches[i+1][0] == end+1 && isJoiner(text[end]) {
+		return true
+	}
+
+	switch {
+	case kind == Namespace && bytes.HasSuffix(before, []byte(layout.NamespacesDir+"/")):
+		return true
+	case kind == VM && (bytes.HasSuffix(before, []byte("vms/")) || bytes.HasSuffix(before, []byte("virt-launcher-"))):
+		return true
+	case bytes.HasSuffix(before, []byte("/")) && bytes.HasPrefix(after, []byte(".yaml")):
+		// the file of an object, e.g. virtualmachines/vm1.yaml
+		return true
+	}
+	return isValue(before, after)
+}
+
+func isJoiner(c byte) bool {
+	return c == '/' || c == '_'
+}
+
+// isValue tells whether a name is the whole value of a field, e.g. name: vm1, "namespace":"ns1",
+// kubevirt.io/domain=vm1 or <name>vm1</name>
+func isValue(before, after []byte) bool {
+	if n := len(before); n > 0 && (before[n-1] == '"' || before[n-1] == '\'') {
+		before = before[:n-1]
+	}
+	if len(after) > 0 && (after[0] == '"' || after[0] == '\'') {
+		after = after[1:]
+	}
+
+	if n := len(before); n == 0 || before[n-1] != '>' {
+		before = bytes.TrimRight(before, " \t")
+		if n = len(before); n == 0 || (before[n-1] != ':' && before[n-1] != '=') {
+			return false
+		}
+	}
+	return len(after) == 0 || strings.IndexByte(" \t\r\n,}]<", after[0]) >= 0
+}
+
+// isReserved tells whether a name is also an API group or version, or a directory of the layout; it is never
+// replaced, so that the sanitized bundle can still be read
+func isReserved(name string) bool {
+	if versionRe.MatchString(name) || slices.Contains(layoutWords, name) {
+		return true
+	}
+	return slices.ContainsFunc(layout.Resources, func(gr schema.GroupResource) bool {
+		return name == gr.Group || name == gr.Resource
+	})
+}
+
+func (r *Replacer) replaceAddress(candidate []byte) []byte {
+	s := string(candidate)
+
+	// e.g. mac:aa:bb:cc:dd:ee:ff, where the IPv6 candidate starts at the colon
+	if len(s) == 18 && s[0] == ':' && macRe.MatchString(s[1:]) {
+		return append([]byte{':'}, r.replaceAddress(candidate[1:])...)
+	}
+
+	if macRe.MatchString(s) {
+		if s == "00:00:00:00:00:00" || strings.EqualFold(s, "ff:ff:ff:ff:ff:ff") {
+			return candidate
+		}
+		return []byte(r.mapper.Token(MAC, s))
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil || !isPersonalAddress(addr) {
+		return candidate
+	}
+
+	if addr.Is4() {
+		return []byte(r.mapper.Token(IPv4, s))
+	}
+	return []byte(r.mapper.Token(IPv6, s))
+}
+
+// isPersonalAddress reports whether an address identifies something in the customer environment. Well known
+// addresses, and netmasks, are kept.
+func isPersonalAddress(addr netip.Addr) bool {
+	if addr.IsLoopback() || addr.IsUnspecified() || addr.IsMulticast() || addr.Is4In6() {
+		return false
+	}
+	if addr.Is4() && addr.As4()[0] == 255 {
+		return false
+	}
+	return true
+}
+
+// replaceMatches replaces the matches of re in text that are not part of a longer word, as told by isBounded
+func replaceMatches(text []byte, re *regexp.Regexp, isBounded func(text []byte, start, end int) bool, replace func([]byte) []byte) []byte {
+	matches := re.FindAllIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(text))
+
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if !isBounded(text, start, end) {
+			continue
+		}
+
+		out.Write(text[last:start])
+		out.Write(replace(text[start:end]))
+		last = end
+	}
+	out.Write(text[last:])
+
+	return out.Bytes()
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// names are matched between any non alphanumeric characters, e.g. in virt-launcher-vm1-abcde or in ns1_vm1.log
+func isBoundedName(text []byte, start, end int) bool {
+	return (start == 0 || !isAlphanumeric(text[start-1])) && (end == len(text) || !isAlphanumeric(text[end]))
+}
+
+// addresses are not part of a longer dotted or colon separated string, e.g. 1.2.3.4.5, but may end a sentence, and
+// IPv4 addresses may be followed by a port
+func isBoundedAddress(text []byte, start, end int) bool {
+	// a candidate that starts with a colon is separated from what precedes it
+	if start > 0 && text[start] != ':' && (isAlphanumeric(text[start-1]) || text[start-1] == '.') {
+		return false
+	}
+	if end == len(text) {
+		return true
+	}
+
+	switch next := text[end]; {
+	case isAlphanumeric(next):
+		return false
+	case next == '.':
+		return end+1 == len(text) || !isAlphanumeric(text[end+1])
+	case next == ':':
+		return !bytes.ContainsRune(text[start:end], ':')
+	}
+	return true
+}
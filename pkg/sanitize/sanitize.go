@@ -0,0 +1,251 @@
+package sanitize
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/manifest"
+)
+
+// binarySniffSize is how much of a file is checked for NUL bytes, to tell binary files from text files
+const binarySniffSize = 8000
+
+// Options configures Sanitize.
+type Options struct {
+	// KeepNamespaces are namespaces that are not replaced, in addition to the system namespaces.
+	KeepNamespaces []string
+}
+
+// Stats counts what Sanitize did.
+type Stats struct {
+	// Files is the number of text files that were read.
+	Files int
+	// Modified is the number of files whose content changed.
+	Modified int
+	// Renamed is the number of files that were moved, because their path had a replaced name.
+	Renamed int
+	// Skipped is the number of binary files, that were left as is.
+	Skipped int
+}
+
+// Sanitize anonymizes the bundle in root, in place, with the tokens of mapper. Running it again on the sanitized
+// bundle, with the same mapper, changes nothing.
+//
+// If the bundle has a manifest, its entries are updated to the new paths and checksums, and the manifest signature,
+// which no longer matches, is removed.
+func Sanitize(root string, mapper *Mapper, opts Options) (Stats, error) {
+	b, err := layout.Open(root)
+	if err != nil {
+		return Stats{}, err
+	}
+	root = b.Root()
+
+	names, err := Discover(b, opts.KeepNamespaces)
+	if err != nil {
+		return Stats{}, fmt.Errorf("can't list the names to replace; %w", err)
+	}
+
+	r := NewReplacer(mapper, names)
+
+	var files []string
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return Stats{}, fmt.Errorf("can't walk the bundle; %w", err)
+	}
+
+	var stats Stats
+	renamedDirs := make(map[string]bool)
+	for _, p := range files {
+		rel := filepath.ToSlash(b.Rel(p))
+		if rel == manifest.SignatureFileName {
+			if err = os.Remove(p); err != nil {
+				return stats, err
+			}
+			continue
+		}
+
+		newRel := r.ReplacePath(rel)
+		target := filepath.Join(root, filepath.FromSlash(newRel))
+		if newRel != rel {
+			stats.Renamed++
+			renamedDirs[filepath.Dir(p)] = true
+		}
+
+		changed, binary, err := sanitizeFile(p, target, r)
+		if err != nil {
+			return stats, fmt.Errorf("can't sanitize %s; %w", rel, err)
+		}
+
+		if binary {
+			stats.Skipped++
+		} else {
+			stats.Files++
+		}
+		if changed {
+			stats.Modified++
+		}
+	}
+
+	removeEmptyDirs(root, renamedDirs)
+
+	if b.Exists(manifest.FileName) {
+		if err = updateManifest(root); err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+// sanitizeFile writes the sanitized content of src to target, and removes src if it is another file. Binary files are
+// only moved.
+func sanitizeFile(src, target string, r *Replacer) (changed, binary bool, err error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return false, false, err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return false, false, err
+	}
+	defer func() { _ = in.Close() }()
+
+	reader := bufio.NewReaderSize(in, 64*1024)
+	head, err := reader.Peek(binarySniffSize)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return false, false, err
+	}
+	binary = bytes.IndexByte(head, 0) >= 0
+
+	if binary && src == target {
+		return false, true, nil
+	}
+
+	if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return false, binary, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".sanitize-*")
+	if err != nil {
+		return false, binary, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if binary {
+		_, err = io.Copy(tmp, reader)
+	} else {
+		changed, err = sanitizeText(reader, tmp, r)
+	}
+	if err != nil {
+		return false, binary, err
+	}
+
+	if err = tmp.Chmod(info.Mode().Perm()); err != nil {
+		return false, binary, err
+	}
+	if err = tmp.Close(); err != nil {
+		return false, binary, err
+	}
+
+	if src == target && !changed {
+		err = os.Remove(tmp.Name())
+		return false, binary, err
+	}
+
+	if err = os.Rename(tmp.Name(), target); err != nil {
+		return false, binary, err
+	}
+
+	if src != target {
+		if err = os.Remove(src); err != nil {
+			return changed, binary, err
+		}
+	}
+
+	return changed, binary, nil
+}
+
+// sanitizeText copies r to w, line by line, with the names and the addresses replaced
+func sanitizeText(in *bufio.Reader, out io.Writer, r *Replacer) (bool, error) {
+	w := bufio.NewWriterSize(out, 64*1024)
+	changed := false
+
+	for {
+		line, err := in.ReadBytes('\n')
+		if len(line) > 0 {
+			sanitized := r.Replace(line)
+			if !bytes.Equal(line, sanitized) {
+				changed = true
+			}
+			if _, werr := w.Write(sanitized); werr != nil {
+				return false, werr
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return changed, w.Flush()
+}
+
+// removeEmptyDirs removes the directories that are left empty after the files were renamed, and their empty parents
+func removeEmptyDirs(root string, dirs map[string]bool) {
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	// the deepest first
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	for _, dir := range sorted {
+		for dir != root && strings.HasPrefix(dir, root) {
+			if os.Remove(dir) != nil {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+}
+
+// updateManifest refreshes the sizes and the checksums of the manifest entries, whose paths were already sanitized
+// with the rest of manifest.json
+func updateManifest(root string) error {
+	m, err := manifest.Load(root)
+	if err != nil {
+		return err
+	}
+
+	if err = m.Refresh(root); err != nil {
+		return fmt.Errorf("can't update the manifest; %w", err)
+	}
+
+	return m.Write(root)
+}
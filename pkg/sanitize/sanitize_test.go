@@ -0,0 +1,275 @@
+package sanitize
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/manifest"
+)
+
+const fixture = "../layout/testdata/must-gather.local.1/quay-io-kubevirt-must-gather-sha256-1"
+
+func newTestMapper(t *testing.T) *Mapper {
+	t.Helper()
+
+	m, err := NewMapper([]byte("test key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestReplaceAddresses(t *testing.T) {
+	r := NewReplacer(newTestMapper(t), nil)
+
+	tests := []struct {
+		in      string
+		replace bool
+	}{
+		{in: "inet 10.1.2.3/24 brd 10.1.2.255 scope global eth0", replace: true},
+		{in: "connecting to 10.1.2.3:6443", replace: true},
+		{in: "the address is 10.1.2.3.", replace: true},
+		{in: `"ip": "10.1.2.3"`, replace: true},
+		{in: "link/ether 52:54:00:ab:CD:ef brd ff:ff:ff:ff:ff:ff", replace: true},
+		{in: "<mac address='52:54:00:ab:cd:ef'/>", replace: true},
+		{in: "ether saddr 52:54:00:ab:cd:ef accept", replace: true},
+		{in: "inet6 fd00:10:244::12/64 scope global", replace: true},
+		{in: "inet6 fe80::5054:ff:feab:cdef/64 scope link", replace: true},
+		{in: "version 4.14.0.1.2", replace: false},
+		{in: "inet 127.0.0.1/8 scope host lo", replace: false},
+		{in: "inet6 ::1/128 scope host", replace: false},
+		{in: "netmask 255.255.255.0", replace: false},
+		{in: "2024-05-01T10:20:30.123456Z", replace: false},
+		{in: "image: registry/kubevirt@sha256:0123abcd", replace: false},
+	}
+
+	for _, test := range tests {
+		out := string(r.Replace([]byte(test.in)))
+		if replaced := out != test.in; replaced != test.replace {
+			t.Errorf("%q: expected replaced %v, but got %q", test.in, test.replace, out)
+		}
+		if again := string(r.Replace([]byte(out))); again != out {
+			t.Errorf("%q: sanitizing twice changed %q to %q", test.in, out, again)
+		}
+	}
+}
+
+func TestReplaceNames(t *testing.T) {
+	m := newTestMapper(t)
+	r := NewReplacer(m, []Name{
+		{Kind: Namespace, Value: "ns1"},
+		{Kind: VM, Value: "vm1"},
+		{Kind: Node, Value: "worker-0.example.com"},
+		{Kind: Host, Value: "worker-0"},
+	})
+
+	vm1 := m.Token(VM, "vm1")
+	ns1 := m.Token(Namespace, "ns1")
+	node := m.Token(Node, "worker-0.example.com")
+	host := m.Token(Host, "worker-0")
+
+	tests := map[string]string{
+		"virt-launcher-vm1-abcde":              "virt-launcher-" + vm1 + "-abcde",
+		"namespaces/ns1/vms/vm1/ns1_vm1.log":   "namespaces/" + ns1 + "/vms/" + vm1 + "/" + ns1 + "_" + vm1 + ".log",
+		"vm10 and avm1 are other names":        "vm10 and avm1 are other names",
+		"nodeName: worker-0.example.com":       "nodeName: " + node,
+		"Jan 01 worker-0 kernel: Linux":        "Jan 01 " + host + " kernel: Linux",
+		`{"name":"vm1","namespace":"ns1"}`:     `{"name":"` + vm1 + `","namespace":"` + ns1 + `"}`,
+		"vmi ns1/vm1 is running on worker-0.1": "vmi " + ns1 + "/" + vm1 + " is running on " + host + ".1",
+	}
+
+	for in, expected := range tests {
+		if out := string(r.Replace([]byte(in))); out != expected {
+			t.Errorf("%q: expected %q, but got %q", in, expected, out)
+		}
+	}
+}
+
+func TestReplaceCommonNames(t *testing.T) {
+	m := newTestMapper(t)
+	r := NewReplacer(m, []Name{
+		{Kind: Namespace, Value: "ns1"},
+		{Kind: VM, Value: "v1"},
+		{Kind: VM, Value: "core"},
+		{Kind: VM, Value: "fedora"},
+	})
+
+	ns1 := m.Token(Namespace, "ns1")
+	fedora := m.Token(VM, "fedora")
+
+	tests := map[string]string{
+		"apiVersion: kubevirt.io/v1":                  "apiVersion: kubevirt.io/v1",
+		"namespaces/ns1/core/pods/virt-launcher.yaml": "namespaces/" + ns1 + "/core/pods/virt-launcher.yaml",
+		"name: v1":     "name: v1",
+		"name: core":   "name: core",
+		"name: fedora": "name: " + fedora,
+		"image: quay.io/containerdisks/fedora:latest":     "image: quay.io/containerdisks/fedora:latest",
+		"booting fedora from the disk":                    "booting fedora from the disk",
+		"namespaces/ns1/vms/fedora/ns1_fedora.log":        "namespaces/" + ns1 + "/vms/" + fedora + "/" + ns1 + "_" + fedora + ".log",
+		"kubevirt.io/virtualmachines/custom/fedora.yaml":  "kubevirt.io/virtualmachines/custom/" + fedora + ".yaml",
+		"pods/virt-launcher-fedora-abcde/compute/current": "pods/virt-launcher-" + fedora + "-abcde/compute/current",
+	}
+
+	for in, expected := range tests {
+		if out := string(r.Replace([]byte(in))); out != expected {
+			t.Errorf("%q: expected %q, but got %q", in, expected, out)
+		}
+	}
+}
+
+func TestMapper(t *testing.T) {
+	m := newTestMapper(t)
+
+	token := m.Token(IPv4, "10.1.2.3")
+	if !IsToken(IPv4, token) {
+		t.Errorf("%s is not recognized as a token", token)
+	}
+	if again := m.Token(IPv4, "10.1.2.3"); again != token {
+		t.Errorf("expected the same token, but got %s and %s", token, again)
+	}
+	if other := newTestMapper(t).Token(IPv4, "10.1.2.3"); other != token {
+		t.Errorf("expected the same token with the same key, but got %s and %s", token, other)
+	}
+	if upper, lower := m.Token(MAC, "52:54:00:AB:CD:EF"), m.Token(MAC, "52:54:00:ab:cd:ef"); upper != lower {
+		t.Errorf("expected the same token regardless of case, but got %s and %s", upper, lower)
+	}
+
+	mappingFile := filepath.Join(t.TempDir(), "mapping.json")
+	if err := m.Save(mappingFile); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadMapper(mappingFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original, found := loaded.Original(token); !found || original != "10.1.2.3" {
+		t.Errorf("expected 10.1.2.3, but got %q", original)
+	}
+	if again := loaded.Token(IPv4, "10.1.2.3"); again != token {
+		t.Errorf("expected the same token after loading the mapping, but got %s and %s", token, again)
+	}
+
+	if _, err = LoadMapper(mappingFile, []byte("another key")); err == nil {
+		t.Error("expected an error for a key that does not match the mapping file")
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	root := copyFixture(t)
+
+	ipFile := filepath.Join(root, "nodes", "node01", "ip.txt")
+	ipContent := "2: eth0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500\n" +
+		"    link/ether 52:54:00:ab:cd:ef brd ff:ff:ff:ff:ff:ff\n" +
+		"    inet 192.168.66.101/24 brd 192.168.66.255 scope global eth0\n"
+	if err := os.WriteFile(ipFile, []byte(ipContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := manifest.Finalize(root); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newTestMapper(t)
+	stats, err := Sanitize(root, m, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Modified == 0 || stats.Renamed == 0 {
+		t.Errorf("expected modified and renamed files, but got %+v", stats)
+	}
+
+	for _, leak := range []string{"ns1", "ns2", "vm1", "vm2", "node01", "192.168.66.101", "52:54:00:ab:cd:ef"} {
+		_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(p[len(root):], leak) {
+				t.Errorf("%s is in the path %s", leak, p)
+			}
+			if d.Type().IsRegular() {
+				data, _ := os.ReadFile(p)
+				if strings.Contains(string(data), leak) {
+					t.Errorf("%s is in %s", leak, p)
+				}
+			}
+			return nil
+		})
+	}
+
+	// the layout is kept, with the tokens
+	qemuLog := filepath.Join(root, "namespaces", m.Token(Namespace, "ns1"), "vms", m.Token(VM, "vm1"),
+		m.Token(Namespace, "ns1")+"_"+m.Token(VM, "vm1")+".log")
+	if _, err = os.Stat(qemuLog); err != nil {
+		t.Error(err)
+	}
+	if _, err = os.Stat(filepath.Join(root, "namespaces", "kubevirt-hyperconverged")); err != nil {
+		t.Errorf("the KubeVirt namespace should be kept; %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(root, "namespaces", "ns1")); err == nil {
+		t.Error("the renamed directories should be removed")
+	}
+
+	problems, err := manifest.VerifyDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("the manifest should be updated, but got %v", problems)
+	}
+
+	stats, err = Sanitize(root, m, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Modified != 0 || stats.Renamed != 0 {
+		t.Errorf("sanitizing twice should not change anything, but got %+v", stats)
+	}
+}
+
+func TestSanitizeKeepNamespaces(t *testing.T) {
+	root := copyFixture(t)
+
+	if _, err := Sanitize(root, newTestMapper(t), Options{KeepNamespaces: []string{"ns2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "namespaces", "ns2")); err != nil {
+		t.Errorf("ns2 should be kept; %v", err)
+	}
+}
+
+func copyFixture(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	err := filepath.WalkDir(fixture, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(fixture, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(root, rel)
+
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return root
+}
@@ -0,0 +1,216 @@
+package upload
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is a local stand-in for an S3-compatible object store. It implements the single PUT and the multipart
+// upload API, and checks the payload checksums of every request.
+type fakeS3 struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu       sync.Mutex
+	objects  map[string][]byte
+	metadata map[string]string
+	uploads  map[string]map[int][]byte
+	nextID   int
+	requests map[string]int
+
+	// failPart makes the upload of a part fail with the status, failCount times
+	failPart   int
+	failStatus int
+	failCount  int
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	f := &fakeS3{
+		t:        t,
+		objects:  make(map[string][]byte),
+		metadata: make(map[string]string),
+		uploads:  make(map[string]map[int][]byte),
+		requests: make(map[string]int),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeS3) count(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[op]
+}
+
+func (f *fakeS3) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), sigV4Algorithm+" Credential=test-key/") {
+		http.Error(w, "missing or invalid signature", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if sum := sha256.Sum256(body); r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+		return
+	}
+	if contentMD5 := r.Header.Get("Content-MD5"); contentMD5 != "" {
+		sum := md5.Sum(body)
+		if contentMD5 != base64.StdEncoding.EncodeToString(sum[:]) {
+			http.Error(w, "BadDigest", http.StatusBadRequest)
+			return
+		}
+	}
+
+	key := r.URL.Path
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		f.requests["UploadPart"]++
+		f.uploadPart(w, query, body)
+	case r.Method == http.MethodPut:
+		f.requests["PutObject"]++
+		f.objects[key] = body
+		f.metadata[key] = r.Header.Get(sha256MetadataHeader)
+		w.Header().Set("ETag", `"`+md5Hex(body)+`"`)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.requests["CreateMultipartUpload"]++
+		f.nextID++
+		id := fmt.Sprintf("upload-%d", f.nextID)
+		f.uploads[id] = make(map[int][]byte)
+		f.metadata[key] = r.Header.Get(sha256MetadataHeader)
+		writeXML(w, initiateMultipartUploadResult{UploadID: id})
+	case r.Method == http.MethodGet && query.Has("uploadId"):
+		f.requests["ListParts"]++
+		f.listParts(w, query)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		f.requests["CompleteMultipartUpload"]++
+		f.complete(w, key, query, body)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		f.requests["AbortMultipartUpload"]++
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeS3) uploadPart(w http.ResponseWriter, query map[string][]string, body []byte) {
+	parts, found := f.uploads[first(query["uploadId"])]
+	if !found {
+		http.Error(w, "NoSuchUpload", http.StatusNotFound)
+		return
+	}
+
+	number, _ := strconv.Atoi(first(query["partNumber"]))
+	if number == f.failPart && f.failCount > 0 {
+		f.failCount--
+		http.Error(w, "injected failure", f.failStatus)
+		return
+	}
+
+	parts[number] = body
+	w.Header().Set("ETag", `"`+md5Hex(body)+`"`)
+}
+
+func (f *fakeS3) listParts(w http.ResponseWriter, query map[string][]string) {
+	parts, found := f.uploads[first(query["uploadId"])]
+	if !found {
+		http.Error(w, "NoSuchUpload", http.StatusNotFound)
+		return
+	}
+
+	type listedPart struct {
+		PartNumber int
+		ETag       string
+	}
+	result := struct {
+		XMLName xml.Name     `xml:"ListPartsResult"`
+		Parts   []listedPart `xml:"Part"`
+	}{}
+	for number, data := range parts {
+		result.Parts = append(result.Parts, listedPart{PartNumber: number, ETag: `"` + md5Hex(data) + `"`})
+	}
+	sort.Slice(result.Parts, func(i, j int) bool { return result.Parts[i].PartNumber < result.Parts[j].PartNumber })
+
+	writeXML(w, result)
+}
+
+func (f *fakeS3) complete(w http.ResponseWriter, key string, query map[string][]string, body []byte) {
+	id := first(query["uploadId"])
+	parts, found := f.uploads[id]
+	if !found {
+		http.Error(w, "NoSuchUpload", http.StatusNotFound)
+		return
+	}
+
+	var req completeMultipartUpload
+	if err := xml.Unmarshal(body, &req); err != nil {
+		http.Error(w, "MalformedXML", http.StatusBadRequest)
+		return
+	}
+
+	var object []byte
+	all := md5.New()
+	for _, p := range req.Parts {
+		data, found := parts[p.PartNumber]
+		if !found || strings.Trim(p.ETag, `"`) != md5Hex(data) {
+			http.Error(w, "InvalidPart", http.StatusBadRequest)
+			return
+		}
+		object = append(object, data...)
+		sum := md5.Sum(data)
+		all.Write(sum[:])
+	}
+
+	f.objects[key] = object
+	delete(f.uploads, id)
+	writeXML(w, completeMultipartUploadResult{ETag: fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(all.Sum(nil)), len(req.Parts))})
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (f *fakeS3) object(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, found := f.objects[key]
+	return bytes.Clone(data), found
+}
@@ -0,0 +1,118 @@
+package upload
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// HTTP uploads to a generic HTTP endpoint, with a PUT of the file, or with a POST of a multipart/form-data form.
+//
+// The checksums of the file are sent in the Content-MD5, Digest and X-Checksum-Sha256 headers, so the server can
+// check them. There is no resume; a failed upload is sent again from the start.
+type HTTP struct {
+	URL string
+	// Form, if set, sends the file in a multipart/form-data POST, in this form field. Otherwise, the file is the body
+	// of a PUT.
+	Form string
+	// Headers are added to the request, e.g. for authentication.
+	Headers http.Header
+
+	Client *http.Client
+	Retry  Retry
+}
+
+// Upload sends the file at path.
+func (h *HTTP) Upload(ctx context.Context, path string) error {
+	if h.Client == nil {
+		h.Client = http.DefaultClient
+	}
+	if h.Retry.Attempts == 0 {
+		h.Retry = DefaultRetry
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	sums, err := computeChecksums(io.NewSectionReader(f, 0, info.Size()))
+	if err != nil {
+		return err
+	}
+
+	return h.Retry.do(ctx, func() error {
+		var req *http.Request
+		if h.Form != "" {
+			req, err = h.newFormRequest(ctx, f, info, sums)
+		} else {
+			req, err = http.NewRequestWithContext(ctx, http.MethodPut, h.URL, io.NewSectionReader(f, 0, info.Size()))
+			if err == nil {
+				req.ContentLength = info.Size()
+				req.Header.Set("Content-Type", "application/octet-stream")
+				req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sums.md5))
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(sums.sha256))
+		req.Header.Set("X-Checksum-Sha256", sums.sha256Hex())
+		for name, values := range h.Headers {
+			for _, value := range values {
+				req.Header.Add(name, value)
+			}
+		}
+
+		resp, err := h.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		if err = checkResponse(resp); err != nil {
+			return err
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return resp.Body.Close()
+	})
+}
+
+// newFormRequest streams the file in a multipart/form-data body, after a sha256 field with its checksum
+func (h *HTTP) newFormRequest(ctx context.Context, f *os.File, info os.FileInfo, sums checksums) (*http.Request, error) {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+
+	go func() {
+		err := form.WriteField("sha256", sums.sha256Hex())
+		if err == nil {
+			var part io.Writer
+			if part, err = form.CreateFormFile(h.Form, filepath.Base(info.Name())); err == nil {
+				_, err = io.Copy(part, io.NewSectionReader(f, 0, info.Size()))
+			}
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		_ = pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, pr)
+	if err != nil {
+		_ = pr.CloseWithError(err)
+		return nil, fmt.Errorf("can't create the request; %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	return req, nil
+}
@@ -0,0 +1,527 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPartSize is the size of the parts of a multipart upload.
+	DefaultPartSize = 64 * 1024 * 1024
+	// MinPartSize is the smallest part size S3 accepts, for all the parts but the last one.
+	MinPartSize = 5 * 1024 * 1024
+	// DefaultConcurrency is the number of parts sent in parallel.
+	DefaultConcurrency = 4
+	// DefaultRegion is used when no region is set; most S3-compatible stores ignore it.
+	DefaultRegion = "us-east-1"
+
+	maxParts = 10000
+
+	// the checksum of the whole file is kept with the object, so the receiver can check it too
+	sha256MetadataHeader = "X-Amz-Meta-Sha256"
+)
+
+// S3 uploads to a bucket of an S3-compatible object store, with path-style URLs.
+type S3 struct {
+	// Endpoint is the URL of the object store, e.g. https://s3.example.com:9000
+	Endpoint *url.URL
+	Bucket   string
+	Key      string
+	Region   string
+
+	Credentials Credentials
+	Client      *http.Client
+	Retry       Retry
+
+	// PartSize is the size of the parts. Files up to PartSize are sent with a single PUT.
+	PartSize int64
+	// Concurrency is the number of parts sent in parallel.
+	Concurrency int
+	// StateFile records the multipart upload in progress, so an interrupted upload can resume. It defaults to
+	// <file>.upload.json
+	StateFile string
+
+	// Progress, if set, is called after each part is sent, with the number of bytes the server has.
+	Progress func(done, total int64)
+
+	signer *signer
+}
+
+// Upload sends the file at path to the bucket.
+func (s *S3) Upload(ctx context.Context, path string) error {
+	if s.Endpoint == nil || s.Bucket == "" || s.Key == "" {
+		return fmt.Errorf("the S3 endpoint, bucket and key must be set")
+	}
+	s.init()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() <= s.PartSize {
+		return s.putObject(ctx, f, info.Size())
+	}
+
+	stateFile := s.StateFile
+	if stateFile == "" {
+		stateFile = path + ".upload.json"
+	}
+
+	return s.multipartUpload(ctx, f, info, stateFile)
+}
+
+func (s *S3) init() {
+	if s.Client == nil {
+		s.Client = http.DefaultClient
+	}
+	if s.Retry.Attempts == 0 {
+		s.Retry = DefaultRetry
+	}
+	if s.PartSize <= 0 {
+		s.PartSize = DefaultPartSize
+	}
+	if s.Concurrency <= 0 {
+		s.Concurrency = DefaultConcurrency
+	}
+	if s.Region == "" {
+		s.Region = DefaultRegion
+	}
+	s.signer = &signer{creds: s.Credentials, region: s.Region, service: "s3", now: time.Now}
+}
+
+func (s *S3) putObject(ctx context.Context, f *os.File, size int64) error {
+	sums, err := computeChecksums(io.NewSectionReader(f, 0, size))
+	if err != nil {
+		return err
+	}
+
+	return s.Retry.do(ctx, func() error {
+		req, err := s.newRequest(ctx, http.MethodPut, nil, io.NewSectionReader(f, 0, size), size)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sums.md5))
+		req.Header.Set(sha256MetadataHeader, sums.sha256Hex())
+
+		resp, err := s.send(req, sums.sha256Hex())
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+
+		return checkETag(resp.Header.Get("ETag"), hex.EncodeToString(sums.md5))
+	})
+}
+
+// uploadState is the content of the state file
+type uploadState struct {
+	Endpoint string    `json:"endpoint"`
+	Bucket   string    `json:"bucket"`
+	Key      string    `json:"key"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modTime"`
+	PartSize int64     `json:"partSize"`
+	UploadID string    `json:"uploadId"`
+}
+
+// sameUpload reports whether the state is of an upload of the same file, to the same object, in the same parts
+func (u uploadState) sameUpload(other uploadState) bool {
+	return u.Endpoint == other.Endpoint && u.Bucket == other.Bucket && u.Key == other.Key && u.Size == other.Size &&
+		u.ModTime.Equal(other.ModTime) && u.PartSize == other.PartSize
+}
+
+type part struct {
+	number int
+	offset int64
+	size   int64
+	sums   checksums
+}
+
+func (s *S3) multipartUpload(ctx context.Context, f *os.File, info os.FileInfo, stateFile string) error {
+	partSize := s.PartSize
+	if info.Size() > partSize*maxParts {
+		partSize = (info.Size() + maxParts - 1) / maxParts
+	}
+
+	wanted := uploadState{
+		Endpoint: s.Endpoint.String(),
+		Bucket:   s.Bucket,
+		Key:      s.Key,
+		Size:     info.Size(),
+		ModTime:  info.ModTime().UTC(),
+		PartSize: partSize,
+	}
+
+	// the checksums are needed for every part anyway, and tell which parts the server already has
+	parts, fileSums, err := splitParts(f, info.Size(), partSize)
+	if err != nil {
+		return err
+	}
+
+	state, uploaded, err := s.resume(ctx, stateFile, wanted)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		state = &wanted
+		if state.UploadID, err = s.createMultipartUpload(ctx, fileSums); err != nil {
+			return err
+		}
+		if err = saveState(stateFile, state); err != nil {
+			return err
+		}
+	}
+
+	var pending []part
+	var done int64
+	for _, p := range parts {
+		if uploaded[p.number] == hex.EncodeToString(p.sums.md5) {
+			done += p.size
+		} else {
+			pending = append(pending, p)
+		}
+	}
+
+	if err = s.uploadParts(ctx, f, state.UploadID, pending, done, info.Size()); err != nil {
+		return fmt.Errorf("can't upload the parts; run the upload again to resume; %w", err)
+	}
+
+	if err = s.completeMultipartUpload(ctx, state.UploadID, parts); err != nil {
+		return err
+	}
+
+	return removeState(stateFile)
+}
+
+// splitParts computes the checksums of the parts, and of the whole file
+func splitParts(f *os.File, size, partSize int64) ([]part, checksums, error) {
+	var parts []part
+	for offset, number := int64(0), 1; offset < size; offset, number = offset+partSize, number+1 {
+		partLen := min(partSize, size-offset)
+		sums, err := computeChecksums(io.NewSectionReader(f, offset, partLen))
+		if err != nil {
+			return nil, checksums{}, err
+		}
+		parts = append(parts, part{number: number, offset: offset, size: partLen, sums: sums})
+	}
+
+	fileSums, err := computeChecksums(io.NewSectionReader(f, 0, size))
+	if err != nil {
+		return nil, checksums{}, err
+	}
+
+	return parts, fileSums, nil
+}
+
+// resume returns the state of an upload of the same file to the same object, and the ETags of the parts the server
+// has. It returns a nil state if there is nothing to resume.
+func (s *S3) resume(ctx context.Context, stateFile string, wanted uploadState) (*uploadState, map[int]string, error) {
+	state, err := loadState(stateFile)
+	if err != nil || state == nil {
+		return nil, nil, err
+	}
+
+	if !state.sameUpload(wanted) {
+		// another file, or the file changed; the old upload is of no use
+		_ = s.abortMultipartUpload(ctx, state.UploadID)
+		return nil, nil, removeState(stateFile)
+	}
+
+	uploaded, err := s.listParts(ctx, state.UploadID)
+	if err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			// the upload expired, or was aborted
+			return nil, nil, removeState(stateFile)
+		}
+		return nil, nil, err
+	}
+
+	return state, uploaded, nil
+}
+
+func (s *S3) uploadParts(ctx context.Context, f *os.File, uploadID string, parts []part, done, total int64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	work := make(chan part)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	for i := 0; i < s.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range work {
+				err := s.uploadPart(ctx, f, uploadID, p)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("part %d; %w", p.number, err)
+					cancel()
+				}
+				if err == nil {
+					done += p.size
+					if s.Progress != nil {
+						s.Progress(done, total)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, p := range parts {
+		select {
+		case work <- p:
+		case <-ctx.Done():
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+func (s *S3) uploadPart(ctx context.Context, f *os.File, uploadID string, p part) error {
+	query := url.Values{
+		"partNumber": {strconv.Itoa(p.number)},
+		"uploadId":   {uploadID},
+	}
+
+	return s.Retry.do(ctx, func() error {
+		req, err := s.newRequest(ctx, http.MethodPut, query, io.NewSectionReader(f, p.offset, p.size), p.size)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(p.sums.md5))
+
+		resp, err := s.send(req, p.sums.sha256Hex())
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+
+		return checkETag(resp.Header.Get("ETag"), hex.EncodeToString(p.sums.md5))
+	})
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+func (s *S3) createMultipartUpload(ctx context.Context, fileSums checksums) (string, error) {
+	var result initiateMultipartUploadResult
+	err := s.Retry.do(ctx, func() error {
+		req, err := s.newRequest(ctx, http.MethodPost, url.Values{"uploads": {""}}, nil, 0)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(sha256MetadataHeader, fileSums.sha256Hex())
+
+		return s.sendXML(req, emptyPayloadHash, &result)
+	})
+	if err != nil {
+		return "", fmt.Errorf("can't start the multipart upload; %w", err)
+	}
+
+	if result.UploadID == "" {
+		return "", fmt.Errorf("can't start the multipart upload; no upload ID in the response")
+	}
+	return result.UploadID, nil
+}
+
+type listPartsResult struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+	IsTruncated          bool `xml:"IsTruncated"`
+	NextPartNumberMarker int  `xml:"NextPartNumberMarker"`
+}
+
+// listParts returns the ETags of the parts the server has, by part number
+func (s *S3) listParts(ctx context.Context, uploadID string) (map[int]string, error) {
+	uploaded := make(map[int]string)
+
+	marker := 0
+	for {
+		query := url.Values{"uploadId": {uploadID}}
+		if marker > 0 {
+			query.Set("part-number-marker", strconv.Itoa(marker))
+		}
+
+		var result listPartsResult
+		err := s.Retry.do(ctx, func() error {
+			req, err := s.newRequest(ctx, http.MethodGet, query, nil, 0)
+			if err != nil {
+				return err
+			}
+			return s.sendXML(req, emptyPayloadHash, &result)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("can't list the uploaded parts; %w", err)
+		}
+
+		for _, p := range result.Parts {
+			uploaded[p.PartNumber] = strings.Trim(p.ETag, `"`)
+		}
+
+		if !result.IsTruncated || result.NextPartNumberMarker <= marker {
+			return uploaded, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	ETag string `xml:"ETag"`
+}
+
+func (s *S3) completeMultipartUpload(ctx context.Context, uploadID string, parts []part) error {
+	body := completeMultipartUpload{}
+	// the multipart ETag is the MD5 of the concatenated MD5s of the parts, and the number of parts
+	all := md5.New()
+	for _, p := range parts {
+		body.Parts = append(body.Parts, completedPart{PartNumber: p.number, ETag: `"` + hex.EncodeToString(p.sums.md5) + `"`})
+		all.Write(p.sums.md5)
+	}
+	sort.Slice(body.Parts, func(i, j int) bool { return body.Parts[i].PartNumber < body.Parts[j].PartNumber })
+	expectedETag := fmt.Sprintf("%s-%d", hex.EncodeToString(all.Sum(nil)), len(parts))
+
+	data, err := xml.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	var result completeMultipartUploadResult
+	err = s.Retry.do(ctx, func() error {
+		req, err := s.newRequest(ctx, http.MethodPost, url.Values{"uploadId": {uploadID}}, bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return err
+		}
+		return s.sendXML(req, hashHex(data), &result)
+	})
+	if err != nil {
+		return fmt.Errorf("can't complete the multipart upload; %w", err)
+	}
+
+	return checkETag(result.ETag, expectedETag)
+}
+
+func (s *S3) abortMultipartUpload(ctx context.Context, uploadID string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, url.Values{"uploadId": {uploadID}}, nil, 0)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.send(req, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3) newRequest(ctx context.Context, method string, query url.Values, body io.Reader, size int64) (*http.Request, error) {
+	u := *s.Endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.Bucket + "/" + strings.TrimPrefix(s.Key, "/")
+	u.RawPath = awsEscape(u.Path, false)
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	if body == nil {
+		req.Body = http.NoBody
+	}
+
+	return req, nil
+}
+
+// send signs and sends req, and returns the response of a successful request
+func (s *S3) send(req *http.Request, payloadHash string) (*http.Response, error) {
+	s.signer.sign(req, payloadHash)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (s *S3) sendXML(req *http.Request, payloadHash string, result any) error {
+	resp, err := s.send(req, payloadHash)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if err = xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("can't parse the response; %w", err)
+	}
+	return nil
+}
+
+// checkETag compares the ETag the server returned with the expected one. Servers that do not use MD5 based ETags,
+// e.g. for encrypted objects, are trusted on the Content-MD5 check they did.
+func checkETag(etag, expected string) error {
+	etag = strings.Trim(etag, `"`)
+	if etag == "" || !looksLikeMD5ETag(etag) {
+		return nil
+	}
+
+	if !strings.EqualFold(etag, expected) {
+		return fmt.Errorf("checksum mismatch: the server has ETag %s, expected %s", etag, expected)
+	}
+	return nil
+}
+
+func looksLikeMD5ETag(etag string) bool {
+	digest, _, _ := strings.Cut(etag, "-")
+	_, err := hex.DecodeString(digest)
+	return err == nil && len(digest) == 2*md5.Size
+}
@@ -0,0 +1,45 @@
+package upload
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// loadState reads the state file; it returns nil if there is none
+func loadState(stateFile string) (*uploadState, error) {
+	data, err := os.ReadFile(stateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := &uploadState{}
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("can't parse the upload state file %s; remove it to start over; %w", stateFile, err)
+	}
+	return state, nil
+}
+
+func saveState(stateFile string, state *uploadState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(stateFile, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("can't save the upload state; %w", err)
+	}
+	return nil
+}
+
+func removeState(stateFile string) error {
+	if err := os.Remove(stateFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+// Package upload sends a finished must-gather bundle to an S3-compatible object store, or to a generic HTTP endpoint.
+//
+// S3 uploads of large files use multipart uploads; the parts are sent in parallel, and an interrupted upload resumes
+// from the parts the server already has. Every request carries the checksums of its body, and the result is checked
+// against the checksums of the local file.
+package upload
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Target is where a file is uploaded to.
+type Target interface {
+	// Upload sends the file at path.
+	Upload(ctx context.Context, path string) error
+}
+
+// ClientOptions configures the HTTP client used by the targets.
+type ClientOptions struct {
+	// Proxy is the URL of the proxy. When empty, the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables are
+	// used.
+	Proxy string
+	// CAFile is a PEM file with additional CA certificates to trust.
+	CAFile string
+	// Timeout limits each request. Zero means no limit.
+	Timeout time.Duration
+}
+
+// NewClient returns an HTTP client configured with opts.
+func NewClient(opts ClientOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q; %w", opts.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	} else {
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+
+	if opts.CAFile != "" {
+		pemData, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read the CA file; %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("no certificate found in %s", opts.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &http.Client{Transport: transport, Timeout: opts.Timeout}, nil
+}
+
+// StatusError is returned when the server answers with an unexpected status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// maxErrorBody is how much of an error response is kept in a StatusError
+const maxErrorBody = 1024
+
+// checkResponse returns a StatusError for non 2xx responses, and closes their body
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	_ = resp.Body.Close()
+	return &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+}
+
+// retryable reports whether a failed request may succeed if sent again
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests ||
+			statusErr.StatusCode == http.StatusRequestTimeout
+	}
+
+	// network errors
+	return true
+}
+
+// Retry configures how failed requests are retried.
+type Retry struct {
+	// Attempts is the number of times a request is sent, at most.
+	Attempts int
+	// Backoff is the delay before the first retry; it doubles on every retry.
+	Backoff time.Duration
+}
+
+// DefaultRetry is used when a target does not set its own.
+var DefaultRetry = Retry{Attempts: 5, Backoff: time.Second}
+
+func (r Retry) do(ctx context.Context, fn func() error) error {
+	attempts := r.Attempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	backoff := r.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt == attempts || !retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// checksums of a file, or of a part of it
+type checksums struct {
+	md5    []byte
+	sha256 []byte
+}
+
+func (c checksums) sha256Hex() string {
+	return hex.EncodeToString(c.sha256)
+}
+
+func computeChecksums(r io.Reader) (checksums, error) {
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), r); err != nil {
+		return checksums{}, err
+	}
+
+	return checksums{md5: md5Hash.Sum(nil), sha256: sha256Hash.Sum(nil)}, nil
+}
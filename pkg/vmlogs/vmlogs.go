@@ -0,0 +1,234 @@
+// Package vmlogs slices the virt-handler and virt-controller logs by VM. The lines about each VM with a details
+// directory are matched on the namespace, name and UID of the KubeVirt JSON lines, and written to
+// namespaces/<ns>/vms/<vm>/component-logs.log, merged in time order with the logs of the virt-launcher pod and the
+// QEMU log of the VM.
+package vmlogs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kubevirt/must-gather/pkg/kvlog"
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+// FileName is the merged log written into the details directory of each VM.
+const FileName = "component-logs.log"
+
+// SourceQEMU is the source of the lines of the QEMU log.
+const SourceQEMU = "qemu"
+
+// the prefixes of the pods of the components that log about many VMs
+var sharedPodPrefixes = []string{"virt-handler-", "virt-controller-"}
+
+// timeFormat has a fixed width, so the sources and the lines are aligned
+const timeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// Result is the merged log of a VM.
+type Result struct {
+	VM layout.VMRef
+	// Path is the merged log; it is empty when no log has a line about the VM, and no file is written then.
+	Path  string
+	Lines int
+	// Sources are the bundle relative paths of the logs the lines come from.
+	Sources []string
+}
+
+// line is a log line of a VM
+type line struct {
+	time time.Time
+	// source is the pod and container, with /previous for the log of the previous container, or qemu
+	source string
+	text   string
+}
+
+// SliceBundle writes the merged log of each VM with a details directory. A log that can't be read is left out of the
+// merged logs, and the other logs and VMs are still written; the errors are returned with the results.
+func SliceBundle(b *layout.Bundle) ([]Result, error) {
+	refs, err := b.VMsWithDetails()
+	if err != nil || len(refs) == 0 {
+		return nil, err
+	}
+
+	lines, sources, errs := sharedLines(b, refs)
+
+	launchers, err := b.LauncherPods()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	var results []Result
+	for _, ref := range refs {
+		var logs []layout.PodLog
+		for _, pod := range launchers {
+			if pod.GetNamespace() == ref.Namespace && layout.LauncherVMName(pod) == ref.Name {
+				podLogs, err := b.PodLogs(pod.GetNamespace(), pod.GetName())
+				if err != nil {
+					errs = append(errs, err)
+				}
+				logs = append(logs, podLogs...)
+			}
+		}
+		for _, log := range logs {
+			var read []line
+			if err = readLines(log.Path, source(log), func(l line, _ kvlog.Entry) {
+				read = append(read, l)
+			}); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			lines[ref] = append(lines[ref], read...)
+			sources[ref] = append(sources[ref], b.Rel(log.Path))
+		}
+
+		qemuLog, err := b.QEMULogPath(ref.Namespace, ref.Name)
+		if err == nil {
+			var read []line
+			if err = readLines(qemuLog, SourceQEMU, func(l line, _ kvlog.Entry) {
+				read = append(read, l)
+			}); err != nil {
+				errs = append(errs, err)
+			} else {
+				lines[ref] = append(lines[ref], read...)
+				sources[ref] = append(sources[ref], b.Rel(qemuLog))
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+
+		vmLines := lines[ref]
+		delete(lines, ref)
+		result := Result{VM: ref, Lines: len(vmLines), Sources: sources[ref]}
+		if result.Lines > 0 {
+			path := filepath.Join(b.VMDir(ref.Namespace, ref.Name), FileName)
+			if err = write(path, vmLines); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			result.Path = path
+		}
+		results = append(results, result)
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// sharedLines reads the virt-handler and virt-controller logs once, and keeps the lines about the VMs. The logs that
+// can't be read are left out, and their errors returned.
+func sharedLines(b *layout.Bundle, refs []layout.VMRef) (map[layout.VMRef][]line, map[layout.VMRef][]string, []error) {
+	lines := make(map[layout.VMRef][]line)
+	sources := make(map[layout.VMRef][]string)
+	var errs []error
+
+	uids := make(map[string]layout.VMRef)
+	for _, list := range []func() ([]layout.Object, error){b.VirtualMachines, b.VirtualMachineInstances} {
+		objects, err := list()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, obj := range objects {
+			ref := layout.VMRef{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+			if slices.Contains(refs, ref) {
+				uids[string(obj.GetUID())] = ref
+			}
+		}
+	}
+
+	logs, err := b.AllPodLogs()
+	if err != nil {
+		return lines, sources, append(errs, err)
+	}
+	for _, log := range logs {
+		if !slices.ContainsFunc(sharedPodPrefixes, func(prefix string) bool { return strings.HasPrefix(log.Pod, prefix) }) {
+			continue
+		}
+
+		matched := make(map[layout.VMRef][]line)
+		err := readLines(log.Path, source(log), func(l line, e kvlog.Entry) {
+			ref, found := uids[e.UID]
+			if !found || e.UID == "" {
+				namespace, name := e.VM()
+				ref = layout.VMRef{Namespace: namespace, Name: name}
+				if name == "" || !slices.Contains(refs, ref) {
+					return
+				}
+			}
+			matched[ref] = append(matched[ref], l)
+		})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for ref, read := range matched {
+			lines[ref] = append(lines[ref], read...)
+			sources[ref] = append(sources[ref], b.Rel(log.Path))
+		}
+	}
+
+	return lines, sources, errs
+}
+
+func source(log layout.PodLog) string {
+	s := log.Pod
+	if log.Container != "" {
+		s += "/" + log.Container
+	}
+	if log.Previous {
+		s += "/previous"
+	}
+	return s
+}
+
+// readLines calls fn with each line of a log. The lines without a timestamp, such as the continuation lines of a QEMU
+// error, get the time of the line before them, so they stay with it once merged.
+func readLines(path, source string, fn func(line, kvlog.Entry)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	var last time.Time
+	_, err = kvlog.Scan(f, func(e kvlog.Entry) {
+		if e.Time.IsZero() {
+			e.Time = last
+		}
+		last = e.Time
+		fn(line{time: e.Time, source: source, text: e.Raw}, e)
+	})
+	if err != nil {
+		return fmt.Errorf("can't read %s; %w", path, err)
+	}
+	return nil
+}
+
+// write sorts the lines by time, and writes them with their time and source
+func write(path string, lines []line) error {
+	slices.SortStableFunc(lines, func(a, b line) int { return a.time.Compare(b.time) })
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("can't write %s; %w", path, err)
+	}
+	w := bufio.NewWriter(f)
+	for _, l := range lines {
+		t := "-"
+		if !l.time.IsZero() {
+			t = l.time.UTC().Format(timeFormat)
+		}
+		_, _ = fmt.Fprintf(w, "%s %s %s\n", t, l.source, l.text)
+	}
+	if err = w.Flush(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("can't write %s; %w", path, err)
+	}
+	return f.Close()
+}
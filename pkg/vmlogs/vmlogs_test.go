@@ -0,0 +1,118 @@
+package vmlogs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kubevirt/must-gather/pkg/kvlog"
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+func TestSliceBundle(t *testing.T) {
+	root := t.TempDir()
+	if err := os.CopyFS(root, os.DirFS("testdata/must-gather")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := layout.Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := SliceBundle(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 VMs, but got %+v", results)
+	}
+
+	fedora := results[0]
+	if fedora.VM.String() != "ns1/fedora" || fedora.Lines != 9 || len(fedora.Sources) != 5 {
+		t.Errorf("unexpected result: %+v", fedora)
+	}
+	data, err := os.ReadFile(fedora.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	expected := []string{
+		"2026-10-19T08:40:00.000000Z virt-handler-x7k2p/virt-handler/previous {",
+		"2026-10-19T08:54:50.000000Z virt-controller-5d9f7-abcde/virt-controller {",
+		"2026-10-19T08:54:58.000000Z virt-launcher-fedora-abcde/compute {",
+		"2026-10-19T08:55:00.350000Z qemu 2026-10-19 08:55:00.350+0000: starting up libvirt version",
+		"2026-10-19T08:55:00.380123Z qemu qemu-kvm: -device vfio-pci",
+		"2026-10-19T08:55:00.380123Z qemu Please ensure all devices",
+		"2026-10-19T08:55:00.385000Z qemu 2026-10-19 08:55:00.385+0000: shutting down",
+		"2026-10-19T08:55:00.500000Z virt-launcher-fedora-abcde/compute {",
+		`2026-10-19T08:55:00.512345Z virt-handler-x7k2p/virt-handler {"component":"virt-handler"`,
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, but got:\n%s", len(expected), data)
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("expected line %d to start with %q, but got %q", i+1, prefix, lines[i])
+		}
+	}
+
+	rhel := results[1]
+	if rhel.VM.String() != "ns1/rhel" || rhel.Lines != 1 || !strings.Contains(rhel.Sources[0], "virt-handler-x7k2p") {
+		t.Errorf("expected the line with the UID of the VMI only, but got %+v", rhel)
+	}
+
+	idle := results[2]
+	if idle.Path != "" || idle.Lines != 0 {
+		t.Errorf("unexpected result: %+v", idle)
+	}
+	if _, err = os.Stat(filepath.Join(b.VMDir("ns2", "idle"), FileName)); !os.IsNotExist(err) {
+		t.Errorf("expected no merged log for a VM without lines, but got %v", err)
+	}
+}
+
+func TestSliceBundleUnreadableLog(t *testing.T) {
+	root := t.TempDir()
+	if err := os.CopyFS(root, os.DirFS("testdata/must-gather")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a line too long to be read is skipped, and a log that can't be read is left out
+	handlerLog := filepath.Join(root, "namespaces/kubevirt-hyperconverged/pods/virt-handler-x7k2p/virt-handler/virt-handler/logs/current.log")
+	f, err := os.OpenFile(handlerLog, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString(`{"level":"info","msg":"` + strings.Repeat("x", kvlog.MaxLine) + "\"}\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	qemuLog := filepath.Join(root, "namespaces/ns1/vms/fedora/ns1_fedora.log")
+	if err = os.Remove(qemuLog); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Mkdir(qemuLog, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := layout.Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := SliceBundle(b)
+	if err == nil || !strings.Contains(err.Error(), "ns1_fedora.log") {
+		t.Errorf("expected the error of the QEMU log, but got %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 VMs, but got %+v", results)
+	}
+	if fedora := results[0]; fedora.Lines != 5 || len(fedora.Sources) != 4 || fedora.Path == "" {
+		t.Errorf("expected the merged log without the QEMU log, but got %+v", fedora)
+	}
+	if rhel := results[1]; rhel.Lines != 1 || rhel.Path == "" {
+		t.Errorf("unexpected result: %+v", rhel)
+	}
+}
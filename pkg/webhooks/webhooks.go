@@ -0,0 +1,262 @@
+// Package webhooks checks, while gathering, whether the admission webhooks can work. gather_webhooks strips the
+// caBundle of the webhook configurations it saves, so the CA certificates are described here: subject, SANs,
+// fingerprint and expiry. The Service each webhook calls is looked up, with the ready endpoints of its EndpointSlices
+// on the port the webhook calls. A webhook with failurePolicy Fail on KubeVirt resources, whose Service is down, is
+// reported as blocking, as the API server then rejects every request it matches, such as starting or migrating a VM.
+package webhooks
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+	"github.com/kubevirt/must-gather/pkg/oc"
+)
+
+// FileName is the report written into the webhooks directory of the bundle.
+const FileName = "health.json"
+
+// Types of webhook configurations.
+const (
+	Validating = "validating"
+	Mutating   = "mutating"
+)
+
+// FailurePolicyFail is the failure policy that rejects the requests when the webhook can't be called; it is the default
+// of admissionregistration.k8s.io/v1.
+const FailurePolicyFail = "Fail"
+
+// defaultPort is the port of the webhook services when clientConfig.service.port is not set
+const defaultPort = 443
+
+// expiryWarning is how long before its expiry a CA certificate is reported
+const expiryWarning = 30 * 24 * time.Hour
+
+// Certificate is a CA certificate of a caBundle.
+type Certificate struct {
+	Subject string   `json:"subject"`
+	Issuer  string   `json:"issuer"`
+	SANs    []string `json:"sans"`
+	// SHA256 is the fingerprint of the certificate, in the form of openssl x509 -fingerprint -sha256.
+	SHA256    string    `json:"sha256"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+}
+
+// Webhook is a webhook of a validating or mutating webhook configuration.
+type Webhook struct {
+	Type          string `json:"type"`
+	Configuration string `json:"configuration"`
+	Name          string `json:"name"`
+	// Service is the namespace/name of the Service the webhook calls; URL is set instead for the webhooks outside the
+	// cluster.
+	Service string `json:"service,omitempty"`
+	// Port is the port of the Service the webhook calls, 443 by default; only its endpoints are counted.
+	Port          int64  `json:"port,omitempty"`
+	URL           string `json:"url,omitempty"`
+	FailurePolicy string `json:"failurePolicy"`
+	// KubeVirt tells whether the rules of the webhook match KubeVirt resources, e.g. kubevirt.io or cdi.kubevirt.io.
+	KubeVirt     bool          `json:"kubevirt"`
+	Certificates []Certificate `json:"certificates"`
+	// ServiceFound tells whether the Service exists; the endpoints are not counted when it doesn't.
+	ServiceFound bool `json:"serviceFound"`
+	// PortFound tells whether the Service has the port; the endpoints are not counted when it doesn't.
+	PortFound         bool `json:"portFound"`
+	ReadyEndpoints    int  `json:"readyEndpoints"`
+	NotReadyEndpoints int  `json:"notReadyEndpoints"`
+	// Blocking tells whether the webhook rejects the requests about KubeVirt resources, as it can't be called.
+	Blocking bool     `json:"blocking"`
+	Problems []string `json:"problems"`
+}
+
+// Report is the health of the webhooks at a time.
+type Report struct {
+	Time     time.Time `json:"time"`
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+// Problems returns the number of webhooks with a problem, and the number of blocking ones.
+func (r *Report) Problems() (problems, blocking int) {
+	for _, w := range r.Webhooks {
+		if len(w.Problems) > 0 {
+			problems++
+		}
+		if w.Blocking {
+			blocking++
+		}
+	}
+	return problems, blocking
+}
+
+// Check returns the health of the webhooks of the validating and mutating webhook configurations in objs, with the
+// Services and EndpointSlices in objs, at a time. The other objects are ignored.
+func Check(objs []unstructured.Unstructured, now time.Time) *Report {
+	services := oc.Services(objs)
+	var configurations []unstructured.Unstructured
+	for _, obj := range objs {
+		if kind := obj.GetKind(); kind == "ValidatingWebhookConfiguration" || kind == "MutatingWebhookConfiguration" {
+			configurations = append(configurations, obj)
+		}
+	}
+
+	report := &Report{Time: now, Webhooks: []Webhook{}}
+	for _, conf := range configurations {
+		typ := Validating
+		if conf.GetKind() == "MutatingWebhookConfiguration" {
+			typ = Mutating
+		}
+
+		hooks, _, _ := unstructured.NestedSlice(conf.Object, "webhooks")
+		for _, h := range hooks {
+			fields := asMap(h)
+			w := Webhook{Type: typ, Configuration: conf.GetName(), Certificates: []Certificate{}, Problems: []string{}}
+			w.Name, _, _ = unstructured.NestedString(fields, "name")
+			w.FailurePolicy, _, _ = unstructured.NestedString(fields, "failurePolicy")
+			if w.FailurePolicy == "" {
+				w.FailurePolicy = FailurePolicyFail
+			}
+			w.KubeVirt = matchesKubeVirt(fields)
+
+			w.URL, _, _ = unstructured.NestedString(fields, "clientConfig", "url")
+
+			caBundle, _, _ := unstructured.NestedString(fields, "clientConfig", "caBundle")
+			checkCABundle(&w, caBundle, now)
+
+			if svc, found, _ := unstructured.NestedMap(fields, "clientConfig", "service"); found {
+				namespace, _, _ := unstructured.NestedString(svc, "namespace")
+				name, _, _ := unstructured.NestedString(svc, "name")
+				w.Service = namespace + "/" + name
+				w.Port = defaultPort
+				if port, found := layout.NestedInt64(svc, "port"); found {
+					w.Port = port
+				}
+				found := services[w.Service]
+				endpoints, portFound := found.EndpointsOf(w.Port)
+				w.ServiceFound, w.PortFound = found.Found, portFound
+				w.ReadyEndpoints, w.NotReadyEndpoints = endpoints.Ready, endpoints.NotReady
+
+				switch {
+				case !w.ServiceFound:
+					w.Problems = append(w.Problems, fmt.Sprintf("the service %s doesn't exist", w.Service))
+				case !w.PortFound:
+					w.Problems = append(w.Problems, fmt.Sprintf("the service %s has no port %d", w.Service, w.Port))
+				case w.ReadyEndpoints == 0:
+					w.Problems = append(w.Problems, fmt.Sprintf("the service %s has no ready endpoints", w.Service))
+				}
+				w.Blocking = w.KubeVirt && w.FailurePolicy == FailurePolicyFail && (!w.ServiceFound || w.ReadyEndpoints == 0)
+			}
+
+			report.Webhooks = append(report.Webhooks, w)
+		}
+	}
+
+	// the blocking webhooks first, then the ones with a problem
+	slices.SortStableFunc(report.Webhooks, func(a, b Webhook) int {
+		if a.Blocking != b.Blocking {
+			if a.Blocking {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(len(b.Problems), len(a.Problems))
+	})
+
+	return report
+}
+
+// matchesKubeVirt tells whether the rules of a webhook match a KubeVirt API group; a * group matches them all
+func matchesKubeVirt(webhook map[string]any) bool {
+	rules, _, _ := unstructured.NestedSlice(webhook, "rules")
+	for _, rule := range rules {
+		groups, _, _ := unstructured.NestedStringSlice(asMap(rule), "apiGroups")
+		for _, group := range groups {
+			if group == "*" || group == "kubevirt.io" || strings.HasSuffix(group, ".kubevirt.io") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkCABundle describes the certificates of a caBundle, and reports the expired ones and the ones about to expire
+func checkCABundle(w *Webhook, caBundle string, now time.Time) {
+	if caBundle == "" {
+		// the webhooks called with a URL may be signed by a public CA
+		if w.URL == "" {
+			w.Problems = append(w.Problems, "the caBundle is empty")
+		}
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(caBundle)
+	if err != nil {
+		w.Problems = append(w.Problems, fmt.Sprintf("can't decode the caBundle; %v", err))
+		return
+	}
+
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			w.Problems = append(w.Problems, fmt.Sprintf("can't parse a certificate of the caBundle; %v", err))
+			continue
+		}
+		w.Certificates = append(w.Certificates, describe(cert))
+
+		switch {
+		case now.After(cert.NotAfter):
+			w.Problems = append(w.Problems, fmt.Sprintf("the CA certificate %s expired on %s", cert.Subject,
+				cert.NotAfter.UTC().Format(time.RFC3339)))
+		case now.Before(cert.NotBefore):
+			w.Problems = append(w.Problems, fmt.Sprintf("the CA certificate %s is not valid before %s", cert.Subject,
+				cert.NotBefore.UTC().Format(time.RFC3339)))
+		case cert.NotAfter.Sub(now) < expiryWarning:
+			w.Problems = append(w.Problems, fmt.Sprintf("the CA certificate %s expires on %s", cert.Subject,
+				cert.NotAfter.UTC().Format(time.RFC3339)))
+		}
+	}
+	if len(w.Certificates) == 0 && len(w.Problems) == 0 {
+		w.Problems = append(w.Problems, "the caBundle has no certificate")
+	}
+}
+
+func describe(cert *x509.Certificate) Certificate {
+	c := Certificate{
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		SANs:      slices.Clone(cert.DNSNames),
+		NotBefore: cert.NotBefore.UTC(),
+		NotAfter:  cert.NotAfter.UTC(),
+	}
+	for _, ip := range cert.IPAddresses {
+		c.SANs = append(c.SANs, ip.String())
+	}
+	if c.SANs == nil {
+		c.SANs = []string{}
+	}
+
+	sum := sha256.Sum256(cert.Raw)
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	c.SHA256 = strings.Join(hex, ":")
+
+	return c
+}
+
+func asMap(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
@@ -0,0 +1,201 @@
+package webhooks
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubevirt/must-gather/pkg/layout"
+)
+
+var now = time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+
+// caBundle returns the base64 PEM of a self-signed CA certificate that expires at a time
+func caBundle(t *testing.T, name string, notAfter time.Time) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name + ".svc"},
+		NotBefore:             notAfter.AddDate(-1, 0, 0),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestCheck(t *testing.T) {
+	data, err := os.ReadFile("testdata/objects.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := strings.NewReplacer(
+		"VALID_CA", caBundle(t, "openshift-service-serving-signer", now.AddDate(1, 0, 0)),
+		"EXPIRING_CA", caBundle(t, "cdi-apiserver-signer", now.AddDate(0, 0, 10)),
+		"EXPIRED_CA", caBundle(t, "policy-ca", now.AddDate(0, 0, -1)),
+	).Replace(string(data))
+	objs, err := layout.DecodeObjects([]byte(objects))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := Check(objs, now)
+	if len(report.Webhooks) != 5 {
+		t.Fatalf("expected 5 webhooks, but got %+v", report.Webhooks)
+	}
+	webhooks := make(map[string]Webhook)
+	for _, w := range report.Webhooks {
+		webhooks[w.Name] = w
+	}
+
+	virtAPI := webhooks["virtualmachine-validator.kubevirt.io"]
+	if virtAPI.Type != Validating || virtAPI.Service != "openshift-cnv/virt-api" || virtAPI.Port != 443 || !virtAPI.ServiceFound || !virtAPI.PortFound || !virtAPI.KubeVirt ||
+		virtAPI.ReadyEndpoints != 2 || virtAPI.NotReadyEndpoints != 1 || virtAPI.Blocking || len(virtAPI.Problems) != 0 {
+		t.Errorf("unexpected virt-api webhook: %+v", virtAPI)
+	}
+	if len(virtAPI.Certificates) != 1 {
+		t.Fatalf("expected the CA certificate, but got %+v", virtAPI.Certificates)
+	}
+	cert := virtAPI.Certificates[0]
+	if cert.Subject != "CN=openshift-service-serving-signer" || !slices.Equal(cert.SANs, []string{"openshift-service-serving-signer.svc"}) ||
+		!cert.NotAfter.Equal(now.AddDate(1, 0, 0)) || len(cert.SHA256) != 95 {
+		t.Errorf("unexpected certificate: %+v", cert)
+	}
+
+	// the default failure policy is Fail, and the only endpoint of the port of cdi-api the webhook calls is not ready
+	cdi := webhooks["datavolume-validator.cdi.kubevirt.io"]
+	if cdi.FailurePolicy != FailurePolicyFail || !cdi.Blocking || len(cdi.Problems) != 2 ||
+		!strings.Contains(cdi.Problems[0], "CN=cdi-apiserver-signer expires on 2026-10-29") ||
+		cdi.Problems[1] != "the service openshift-cnv/cdi-api has no ready endpoints" {
+		t.Errorf("unexpected cdi webhook: %+v", cdi)
+	}
+	if report.Webhooks[0].Name != cdi.Name {
+		t.Errorf("expected the blocking webhook first, but got %s", report.Webhooks[0].Name)
+	}
+
+	// policy-webhook matches KubeVirt resources, but it is ignored when it fails
+	policy := webhooks["mutate.policy.example.com"]
+	if policy.Type != Mutating || !policy.KubeVirt || policy.Blocking || len(policy.Problems) != 2 ||
+		!strings.Contains(policy.Problems[0], "CN=policy-ca expired on 2026-10-18") ||
+		policy.Problems[1] != "the service policy/policy-webhook has no ready endpoints" {
+		t.Errorf("unexpected policy webhook: %+v", policy)
+	}
+
+	// a webhook on pods can't block the VM operations themselves
+	if pods := webhooks["pods.policy.example.com"]; pods.KubeVirt || pods.Blocking || len(pods.Problems) != 1 {
+		t.Errorf("unexpected pods webhook: %+v", pods)
+	}
+
+	if external := webhooks["external.example.com"]; external.URL == "" || external.Service != "" || len(external.Problems) != 0 {
+		t.Errorf("unexpected external webhook: %+v", external)
+	}
+
+	if problems, blocking := report.Problems(); problems != 3 || blocking != 1 {
+		t.Errorf("expected 3 webhooks with a problem, 1 blocking, but got %d and %d", problems, blocking)
+	}
+}
+
+func TestCheckMissingService(t *testing.T) {
+	objs, err := layout.DecodeObjects([]byte(`
+apiVersion: admissionregistration.k8s.io/v1
+kind: MutatingWebhookConfiguration
+metadata:
+  name: virt-api-mutator
+webhooks:
+- name: virtualmachines-mutator.kubevirt.io
+  clientConfig:
+    caBundle: bm90IGEgY2VydGlmaWNhdGU=
+    service:
+      namespace: openshift-cnv
+      name: virt-api
+  rules:
+  - apiGroups: ["kubevirt.io"]
+    resources: ["virtualmachines"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := Check(objs, now)
+	if len(report.Webhooks) != 1 {
+		t.Fatalf("expected 1 webhook, but got %+v", report.Webhooks)
+	}
+	w := report.Webhooks[0]
+	expected := []string{"the caBundle has no certificate", "the service openshift-cnv/virt-api doesn't exist"}
+	if !w.Blocking || w.ServiceFound || !slices.Equal(w.Problems, expected) {
+		t.Errorf("unexpected webhook: %+v", w)
+	}
+}
+
+func TestCheckServicePort(t *testing.T) {
+	objs, err := layout.DecodeObjects([]byte(`
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: virt-api-validator
+webhooks:
+- name: virtualmachine-validator.kubevirt.io
+  clientConfig:
+    service:
+      namespace: openshift-cnv
+      name: virt-api
+      port: 9443
+  rules:
+  - apiGroups: ["kubevirt.io"]
+    resources: ["virtualmachines"]
+---
+apiVersion: v1
+kind: Service
+metadata:
+  namespace: openshift-cnv
+  name: virt-api
+spec:
+  ports:
+  - port: 443
+---
+apiVersion: discovery.k8s.io/v1
+kind: EndpointSlice
+metadata:
+  namespace: openshift-cnv
+  name: virt-api-x7k2p
+  labels:
+    kubernetes.io/service-name: virt-api
+endpoints:
+- addresses: ["10.128.0.31"]
+ports:
+- port: 8443
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := Check(objs, now)
+	if len(report.Webhooks) != 1 {
+		t.Fatalf("expected 1 webhook, but got %+v", report.Webhooks)
+	}
+	w := report.Webhooks[0]
+	expected := []string{"the caBundle is empty", "the service openshift-cnv/virt-api has no port 9443"}
+	if !w.Blocking || !w.ServiceFound || w.PortFound || w.Port != 9443 || w.ReadyEndpoints != 0 || !slices.Equal(w.Problems, expected) {
+		t.Errorf("the endpoints of the other ports should not be counted; got %+v", w)
+	}
+}